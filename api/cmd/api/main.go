@@ -2,27 +2,54 @@ package main
 
 import (
 	"archive/zip"
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
+	"unicode"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-co-op/gocron/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"golang.org/x/net/html"
 )
 
 type App struct {
-	DB  *pgxpool.Pool
-	Loc *time.Location
+	DB     *pgxpool.Pool
+	Loc    *time.Location
+	Photos PhotoStore
 }
 
 const DefaultUserID = "00000000-0000-0000-0000-000000000001"
@@ -54,14 +81,45 @@ func main() {
 	}
 	defer db.Close()
 
-	app := &App{DB: db, Loc: loc}
+	photoDir := os.Getenv("PHOTO_DIR")
+	if photoDir == "" {
+		photoDir = "data/photos"
+	}
+	photos, err := newDirPhotoStore(photoDir)
+	if err != nil {
+		log.Fatalf("photo store: %v", err)
+	}
+
+	app := &App{DB: db, Loc: loc, Photos: photos}
 	if err := app.EnsureRecipePages(context.Background()); err != nil {
 		log.Printf("ensure recipe pages failed: %v", err)
 	}
+	if err := app.MigrateLegacyPhotos(context.Background()); err != nil {
+		log.Printf("migrate legacy photos failed: %v", err)
+	}
+	if len(os.Args) > 1 {
+		if err := app.runCommand(ctx, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	r := chi.NewRouter()
 	r.Use(middleware.RealIP, middleware.RequestID, middleware.Logger, middleware.Recoverer)
-	r.Use(middleware.Timeout(10 * time.Second))
+	r.Use(func(next http.Handler) http.Handler {
+		// Uploads, recipe imports, data export/import and long reports move
+		// more bytes than the usual 10s allows.
+		short, long := middleware.Timeout(10*time.Second)(next), middleware.Timeout(2*time.Minute)(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := r.URL.Path
+			upload := r.Method != http.MethodGet && (strings.HasSuffix(p, "/photos") || strings.HasSuffix(p, "/photo") || strings.HasSuffix(p, "/recipes/import"))
+			if upload || strings.HasPrefix(p, "/reports/") || strings.HasPrefix(p, "/data/") {
+				long.ServeHTTP(w, r)
+				return
+			}
+			short.ServeHTTP(w, r)
+		})
+	})
 	r.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
@@ -99,21 +157,59 @@ func main() {
 	r.Get("/day/totals", app.HandleDayTotals)
 	r.Post("/food-items", app.HandleCreateFoodItem)
 	r.Get("/food-items", app.HandleListFoodItems)
+	r.Get("/food-items/search", app.HandleSearchFoodItems)
+	r.Get("/food-items/quick-add", app.HandleQuickAdd)
+	r.Get("/food-items/by-barcode/{code}", app.HandleGetFoodByBarcode)
+	r.Post("/food-items/by-barcode/{code}", app.HandleLinkBarcode)
+	r.Delete("/food-items/by-barcode/{code}", app.HandleUnlinkBarcode)
+	r.Get("/food-items/duplicates", app.HandleFindDuplicateFoods)
 	r.Get("/food-items/{id}", app.HandleGetFoodItem)
 	r.Put("/food-items/{id}", app.HandleUpdateFoodItem)
 	r.Delete("/food-items/{id}", app.HandleDeleteFoodItem)
+	r.Post("/food-items/{id}/archive", app.HandleArchiveFoodItem)
+	r.Delete("/food-items/{id}/archive", app.HandleArchiveFoodItem)
+	r.Post("/food-items/{id}/merge", app.HandleMergeFoodItem)
 	r.Get("/log/today", app.HandleLogToday)
 	r.Get("/log/range", app.HandleLogRange)
+	r.Get("/reports/daily", app.HandleDailyReport)
+	r.Get("/insights/summary", app.HandleInsightsSummary)
+	r.Get("/insights/meal-timing", app.HandleMealTiming)
+	r.Get("/insights/foods", app.HandleFoodContributions)
+	r.Get("/streaks", app.HandleStreaks)
 	r.Post("/log/food", app.HandleLogFood)
+	r.Post("/log/parse", app.HandleParseLog)
+	r.Post("/log/parse/confirm", app.HandleConfirmParsedLog)
+	r.Post("/log/recalculate", app.HandleRecalculateLog)
 	r.Delete("/log/{id}", app.HandleDeleteLogEntry)
 	r.Post("/body/weight", app.HandleBodyWeight)
+	r.Get("/body/measurements", app.HandleListBodyMeasurements)
+	r.Post("/body/measurements", app.HandleCreateBodyMeasurement)
+	r.Delete("/body/measurements/{id}", app.HandleDeleteBodyMeasurement)
+	r.Get("/body/trend", app.HandleBodyTrend)
+	r.Get("/body/photos", app.HandleListProgressPhotos)
+	r.Post("/body/photos", app.HandleUploadProgressPhoto)
+	r.Get("/body/photos/compare", app.HandleCompareProgressPhotos)
+	r.Get("/body/photos/{id}", app.HandleServeProgressPhoto)
+	r.Delete("/body/photos/{id}", app.HandleDeleteProgressPhoto)
+	r.Get("/activity/daily", app.HandleListDailyActivity)
 	r.Post("/activity/daily", app.HandleDailyActivity)
+	r.Get("/activity/daily/{date}", app.HandleGetDailyActivity)
+	r.Patch("/activity/daily/{date}", app.HandlePatchDailyActivity)
+	r.Delete("/activity/daily/{date}", app.HandleDeleteDailyActivity)
 	r.Get("/activity/water", app.HandleGetWater)
 	r.Post("/activity/water", app.HandleSetWater)
+	r.Get("/workouts", app.HandleListWorkouts)
+	r.Post("/workouts", app.HandleCreateWorkout)
+	r.Get("/workouts/activities", app.HandleWorkoutActivities)
+	r.Put("/workouts/{id}", app.HandleUpdateWorkout)
+	r.Delete("/workouts/{id}", app.HandleDeleteWorkout)
 	r.Post("/presets", app.HandleCreatePreset)
 	r.Post("/presets/{id}/apply", app.HandleApplyPreset)
 	r.Get("/recipes", app.HandleListRecipes)
 	r.Post("/recipes", app.HandleCreateRecipe)
+	r.Post("/recipes/import", app.HandleImportRecipe)
+	r.Post("/recipes/parse-ingredients", app.HandleParseIngredients)
+	r.Get("/recipes/tags", app.HandleListRecipeTags)
 	r.Get("/recipes/{id}", app.HandleGetRecipe)
 	r.Put("/recipes/{id}", app.HandleUpdateRecipe)
 	r.Post("/recipes/{id}/ingredients", app.HandleAddRecipeIngredient)
@@ -121,11 +217,23 @@ func main() {
 	r.Put("/recipes/{id}/ingredients/{ingredient_id}", app.HandleUpdateRecipeIngredient)
 	r.Delete("/recipes/{id}/ingredients/{ingredient_id}", app.HandleDeleteRecipeIngredient)
 	r.Post("/recipes/export-ingredients", app.HandleExportRecipeIngredients)
+	r.Put("/recipes/{id}/tags", app.HandleReplaceRecipeTags)
 	r.Get("/recipes/{id}/shopping-items", app.HandleGetShoppingItems)
 	r.Put("/recipes/{id}/shopping-items", app.HandleReplaceShoppingItems)
+	r.Get("/recipe-collections", app.HandleListRecipeCollections)
+	r.Post("/recipe-collections", app.HandleCreateRecipeCollection)
+	r.Put("/recipe-collections/{id}", app.HandleUpdateRecipeCollection)
+	r.Delete("/recipe-collections/{id}", app.HandleDeleteRecipeCollection)
+	r.Post("/recipe-collections/{id}/recipes", app.HandleAddToRecipeCollection)
+	r.Delete("/recipe-collections/{id}/recipes/{recipe_id}", app.HandleRemoveFromRecipeCollection)
 	r.Get("/recipes/{id}/photo", app.HandleGetRecipePhoto)
 	r.Put("/recipes/{id}/photo", app.HandlePutRecipePhoto)
 	r.Delete("/recipes/{id}/photo", app.HandleDeleteRecipePhoto)
+	r.Get("/recipes/{id}/photos", app.HandleListRecipePhotos)
+	r.Post("/recipes/{id}/photos", app.HandleUploadRecipePhotos)
+	r.Put("/recipes/{id}/photos/order", app.HandleReorderRecipePhotos)
+	r.Get("/recipes/{id}/photos/{photo_id}", app.HandleServeRecipePhoto)
+	r.Delete("/recipes/{id}/photos/{photo_id}", app.HandleDeleteRecipePhotoFile)
 	r.Get("/shopping-list", app.HandleShoppingList)
 	r.Get("/pantry", app.HandleListPantry)
 	r.Put("/pantry/{food_item_id}", app.HandleUpsertPantry)
@@ -141,11 +249,21 @@ func main() {
 	r.Put("/nudges/{id}", app.HandleUpdateNudge)
 	r.Delete("/nudges/{id}", app.HandleDeleteNudge)
 	r.Post("/nudges/{id}/test", app.HandleTestNudge)
+	r.Get("/nutrients", app.HandleListNutrients)
+	r.Put("/nutrients/{key}", app.HandleUpsertNutrient)
+	r.Get("/goals", app.HandleGetGoals)
+	r.Put("/goals", app.HandleUpdateGoals)
+	r.Get("/digests", app.HandleListDigests)
+	r.Post("/digests", app.HandleCreateDigest)
+	r.Get("/digests/preview", app.HandlePreviewDigest)
+	r.Put("/digests/{id}", app.HandleUpdateDigest)
+	r.Delete("/digests/{id}", app.HandleDeleteDigest)
+	r.Post("/digests/{id}/test", app.HandleTestDigest)
 	r.Get("/data/export", app.HandleExportData)
 	r.Get("/data/export/markdown", app.HandleExportMarkdown)
 	r.Post("/data/import", app.HandleImportData)
 
-	// Start nudge scheduler
+	// Start nudge + digest scheduler
 	s, err := gocron.NewScheduler(gocron.WithLocation(loc))
 	if err != nil {
 		log.Printf("nudge scheduler init failed: %v", err)
@@ -154,6 +272,10 @@ func main() {
 			gocron.DurationJob(1*time.Minute),
 			gocron.NewTask(app.checkNudges),
 		)
+		_, _ = s.NewJob(
+			gocron.DurationJob(1*time.Minute),
+			gocron.NewTask(app.checkDigests),
+		)
 		s.Start()
 		log.Println("nudge scheduler started (1-min check)")
 	}
@@ -190,12 +312,16 @@ type CreateFoodItemRequest struct {
 	CarbsPerServing    float64 `json:"carbs_g_per_serving"`
 	FatPerServing      float64 `json:"fat_g_per_serving"`
 	FiberPerServing    float64 `json:"fiber_g_per_serving"`
-	RecipeInstructions string  `json:"recipe_instructions"`
-	RecipeYieldCount   int     `json:"recipe_yield_count"`
+	// IsRecipe gives the item a recipe page. Supplying instructions or
+	// ingredients implies it.
+	IsRecipe           bool   `json:"is_recipe"`
+	RecipeInstructions string `json:"recipe_instructions"`
+	RecipeYieldCount   int    `json:"recipe_yield_count"`
 	RecipeIngredients  []struct {
 		FoodItemID string  `json:"food_item_id"`
 		AmountG    float64 `json:"amount_g"`
 	} `json:"recipe_ingredients"`
+	Nutrients map[string]float64 `json:"nutrients"`
 }
 
 func (a *App) HandleCreateFoodItem(w http.ResponseWriter, r *http.Request) {
@@ -217,6 +343,7 @@ func (a *App) HandleCreateFoodItem(w http.ResponseWriter, r *http.Request) {
 	if req.RecipeYieldCount <= 0 {
 		req.RecipeYieldCount = 1
 	}
+	isRecipe := req.IsRecipe || strings.TrimSpace(req.RecipeInstructions) != "" || len(req.RecipeIngredients) > 0
 	var id string
 	ctx := r.Context()
 	tx, err := a.DB.Begin(ctx)
@@ -226,25 +353,22 @@ func (a *App) HandleCreateFoodItem(w http.ResponseWriter, r *http.Request) {
 	}
 	defer func() { _ = tx.Rollback(ctx) }()
 	err = tx.QueryRow(ctx, `
-    INSERT INTO food_items (user_id, name, brand, serving_label, calories_per_serving, protein_g_per_serving, carbs_g_per_serving, fat_g_per_serving, fiber_g_per_serving, source)
-    VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,'custom') RETURNING id;
-  `, req.UserID, req.Name, req.Brand, req.ServingLabel, req.CaloriesPerServing, req.ProteinPerServing, req.CarbsPerServing, req.FatPerServing, req.FiberPerServing).Scan(&id)
+    INSERT INTO food_items (user_id, name, brand, serving_label, calories_per_serving, protein_g_per_serving, carbs_g_per_serving, fat_g_per_serving, fiber_g_per_serving, source, is_recipe)
+    VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,'custom',$10) RETURNING id;
+  `, req.UserID, req.Name, req.Brand, req.ServingLabel, req.CaloriesPerServing, req.ProteinPerServing, req.CarbsPerServing, req.FatPerServing, req.FiberPerServing, isRecipe).Scan(&id)
 	if err != nil {
 		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("insert food_item: %v", err)})
 		return
 	}
-	_, err = tx.Exec(ctx, `
-    INSERT INTO recipes (id, user_id, name, instructions, yield_count)
-    VALUES ($1,$2,$3,$4,$5)
-    ON CONFLICT (id) DO UPDATE SET
-      user_id = EXCLUDED.user_id,
-      name = EXCLUDED.name,
-      instructions = EXCLUDED.instructions,
-      yield_count = EXCLUDED.yield_count;
-  `, id, req.UserID, req.Name, req.RecipeInstructions, req.RecipeYieldCount)
-	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("insert recipe: %v", err)})
-		return
+	if isRecipe {
+		_, err = tx.Exec(ctx, `
+      INSERT INTO recipes (id, user_id, name, instructions, yield_count)
+      VALUES ($1,$2,$3,$4,$5);
+    `, id, req.UserID, req.Name, req.RecipeInstructions, req.RecipeYieldCount)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("insert recipe: %v", err)})
+			return
+		}
 	}
 	for _, it := range req.RecipeIngredients {
 		if it.FoodItemID == "" || it.AmountG <= 0 {
@@ -259,30 +383,48 @@ func (a *App) HandleCreateFoodItem(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+	if err := saveFoodNutrients(ctx, tx, id, req.Nutrients); err != nil {
+		writeJSON(w, nutrientErrorStatus(err), map[string]any{"error": fmt.Sprintf("save nutrients: %v", err)})
+		return
+	}
 	if err := tx.Commit(ctx); err != nil {
 		writeJSON(w, 500, map[string]any{"error": "tx commit"})
 		return
 	}
-	writeJSON(w, 201, map[string]any{"ok": true, "id": id, "recipe_id": id})
+	resp := map[string]any{"ok": true, "id": id, "is_recipe": isRecipe}
+	if isRecipe {
+		resp["recipe_id"] = id
+	}
+	writeJSON(w, 201, resp)
 }
 
 type FoodItem struct {
-	ID                 string  `json:"id"`
-	Name               string  `json:"name"`
-	Brand              string  `json:"brand"`
-	ServingLabel       string  `json:"serving_label"`
-	CaloriesPerServing float64 `json:"calories_per_serving"`
-	ProteinPerServing  float64 `json:"protein_g_per_serving"`
-	CarbsPerServing    float64 `json:"carbs_g_per_serving"`
-	FatPerServing      float64 `json:"fat_g_per_serving"`
-	FiberPerServing    float64 `json:"fiber_g_per_serving"`
+	ID                 string             `json:"id"`
+	Name               string             `json:"name"`
+	Brand              string             `json:"brand"`
+	ServingLabel       string             `json:"serving_label"`
+	CaloriesPerServing float64            `json:"calories_per_serving"`
+	ProteinPerServing  float64            `json:"protein_g_per_serving"`
+	CarbsPerServing    float64            `json:"carbs_g_per_serving"`
+	FatPerServing      float64            `json:"fat_g_per_serving"`
+	FiberPerServing    float64            `json:"fiber_g_per_serving"`
+	Barcodes           []string           `json:"barcodes,omitempty"`
+	Nutrients          map[string]float64 `json:"nutrients,omitempty"`
+	Archived           bool               `json:"archived,omitempty"`
+	IsRecipe           bool               `json:"is_recipe,omitempty"`
 }
 
+// HandleListFoodItems lists food items, hiding archived ones unless
+// ?include_archived=true.
 func (a *App) HandleListFoodItems(w http.ResponseWriter, r *http.Request) {
+	includeArchived := r.URL.Query().Get("include_archived") == "true"
 	rows, err := a.DB.Query(r.Context(), `
-    SELECT id, name, COALESCE(brand,''), serving_label, calories_per_serving, protein_g_per_serving, carbs_g_per_serving, fat_g_per_serving, fiber_g_per_serving
-    FROM food_items ORDER BY name;
-  `)
+    SELECT id, name, COALESCE(brand,''), serving_label, calories_per_serving, protein_g_per_serving, carbs_g_per_serving, fat_g_per_serving, fiber_g_per_serving,
+           archived_at IS NOT NULL, is_recipe
+    FROM food_items
+    WHERE $1 OR archived_at IS NULL
+    ORDER BY name;
+  `, includeArchived)
 	if err != nil {
 		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
 		return
@@ -291,12 +433,20 @@ func (a *App) HandleListFoodItems(w http.ResponseWriter, r *http.Request) {
 	items := []FoodItem{}
 	for rows.Next() {
 		var it FoodItem
-		if err := rows.Scan(&it.ID, &it.Name, &it.Brand, &it.ServingLabel, &it.CaloriesPerServing, &it.ProteinPerServing, &it.CarbsPerServing, &it.FatPerServing, &it.FiberPerServing); err != nil {
+		if err := rows.Scan(&it.ID, &it.Name, &it.Brand, &it.ServingLabel, &it.CaloriesPerServing, &it.ProteinPerServing, &it.CarbsPerServing, &it.FatPerServing, &it.FiberPerServing, &it.Archived, &it.IsRecipe); err != nil {
 			writeJSON(w, 500, map[string]any{"error": "scan"})
 			return
 		}
 		items = append(items, it)
 	}
+	ptrs := make([]*FoodItem, len(items))
+	for i := range items {
+		ptrs[i] = &items[i]
+	}
+	if err := a.attachNutrients(r.Context(), ptrs); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("nutrients: %v", err)})
+		return
+	}
 	writeJSON(w, 200, items)
 }
 
@@ -308,14 +458,23 @@ func (a *App) HandleGetFoodItem(w http.ResponseWriter, r *http.Request) {
 	}
 	var it FoodItem
 	err := a.DB.QueryRow(r.Context(), `
-    SELECT id, name, COALESCE(brand,''), serving_label, calories_per_serving, protein_g_per_serving, carbs_g_per_serving, fat_g_per_serving, fiber_g_per_serving
+    SELECT id, name, COALESCE(brand,''), serving_label, calories_per_serving, protein_g_per_serving, carbs_g_per_serving, fat_g_per_serving, fiber_g_per_serving,
+           archived_at IS NOT NULL, is_recipe
     FROM food_items
     WHERE id = $1;
-  `, id).Scan(&it.ID, &it.Name, &it.Brand, &it.ServingLabel, &it.CaloriesPerServing, &it.ProteinPerServing, &it.CarbsPerServing, &it.FatPerServing, &it.FiberPerServing)
+  `, id).Scan(&it.ID, &it.Name, &it.Brand, &it.ServingLabel, &it.CaloriesPerServing, &it.ProteinPerServing, &it.CarbsPerServing, &it.FatPerServing, &it.FiberPerServing, &it.Archived, &it.IsRecipe)
 	if err != nil {
 		writeJSON(w, 404, map[string]any{"error": "food item not found"})
 		return
 	}
+	if it.Barcodes, err = a.foodItemBarcodes(r.Context(), id); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("barcodes: %v", err)})
+		return
+	}
+	if err := a.attachNutrients(r.Context(), []*FoodItem{&it}); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("nutrients: %v", err)})
+		return
+	}
 	writeJSON(w, 200, it)
 }
 
@@ -330,6 +489,16 @@ type UpdateFoodItemRequest struct {
 	FiberPerServing    float64 `json:"fiber_g_per_serving"`
 	RecipeInstructions string  `json:"recipe_instructions"`
 	RecipeYieldCount   int     `json:"recipe_yield_count"`
+	// IsRecipe turns the item into a recipe (true) or back into a plain food
+	// (false). A plain food keeps its recipe data but leaves the recipe list.
+	// Omit it to leave the flag untouched; instructions imply true.
+	IsRecipe *bool `json:"is_recipe"`
+	// Nutrients replaces the item's micronutrients when present; omit it to
+	// leave them untouched.
+	Nutrients map[string]float64 `json:"nutrients"`
+	// RecalculateHistory re-snapshots every past log entry of this item with
+	// the new values. By default edits only affect future logging.
+	RecalculateHistory bool `json:"recalculate_history"`
 }
 
 func (a *App) HandleUpdateFoodItem(w http.ResponseWriter, r *http.Request) {
@@ -380,6 +549,21 @@ func (a *App) HandleUpdateFoodItem(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, 404, map[string]any{"error": "food item not found"})
 		return
 	}
+	if req.IsRecipe == nil && strings.TrimSpace(req.RecipeInstructions) != "" {
+		promote := true
+		req.IsRecipe = &promote
+	}
+	if req.IsRecipe != nil {
+		if *req.IsRecipe {
+			_, err = promoteToRecipe(ctx, tx, id, DefaultUserID)
+		} else {
+			_, err = tx.Exec(ctx, `UPDATE food_items SET is_recipe = false WHERE id = $1;`, id)
+		}
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("update recipe flag: %v", err)})
+			return
+		}
+	}
 	_, _ = tx.Exec(ctx, `
     UPDATE recipes
     SET name = $1,
@@ -387,11 +571,30 @@ func (a *App) HandleUpdateFoodItem(w http.ResponseWriter, r *http.Request) {
         yield_count = CASE WHEN $3 > 0 THEN $3 ELSE yield_count END
     WHERE id = $4;
   `, req.Name, req.RecipeInstructions, req.RecipeYieldCount, id)
+	if req.Nutrients != nil {
+		if err := saveFoodNutrients(ctx, tx, id, req.Nutrients); err != nil {
+			writeJSON(w, nutrientErrorStatus(err), map[string]any{"error": fmt.Sprintf("save nutrients: %v", err)})
+			return
+		}
+	}
+	var recalculated int64
+	if req.RecalculateHistory {
+		ct, err := tx.Exec(ctx, `
+      UPDATE log_entries le SET`+logSnapshotSet+`
+      FROM food_items fi
+      WHERE fi.id = le.ref_id AND le.kind = 'food' AND le.ref_id = $1;
+    `, id)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("recalculate history: %v", err)})
+			return
+		}
+		recalculated = ct.RowsAffected()
+	}
 	if err := tx.Commit(ctx); err != nil {
 		writeJSON(w, 500, map[string]any{"error": "tx commit"})
 		return
 	}
-	writeJSON(w, 200, map[string]any{"ok": true})
+	writeJSON(w, 200, map[string]any{"ok": true, "recalculated_entries": recalculated})
 }
 
 func (a *App) HandleDeleteFoodItem(w http.ResponseWriter, r *http.Request) {
@@ -400,6 +603,15 @@ func (a *App) HandleDeleteFoodItem(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, 400, map[string]any{"error": "missing id"})
 		return
 	}
+	refs, err := a.foodItemReferences(r.Context(), id)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("check references: %v", err)})
+		return
+	}
+	if len(refs) > 0 {
+		writeJSON(w, 409, map[string]any{"error": "food item is in use; archive or merge it instead", "references": refs})
+		return
+	}
 	ct, err := a.DB.Exec(r.Context(), `DELETE FROM food_items WHERE id = $1;`, id)
 	if err != nil {
 		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete: %v", err)})
@@ -412,894 +624,1436 @@ func (a *App) HandleDeleteFoodItem(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, 200, map[string]any{"ok": true})
 }
 
-func (a *App) EnsureRecipePages(ctx context.Context) error {
-	_, err := a.DB.Exec(ctx, `
-    INSERT INTO recipes (id, user_id, name, instructions, yield_count, created_at)
-    SELECT fi.id,
-           COALESCE(fi.user_id, $1::uuid),
-           fi.name,
-           '',
-           1,
-           fi.created_at
-    FROM food_items fi
-    LEFT JOIN recipes r ON r.id = fi.id
-    WHERE r.id IS NULL;
-  `, DefaultUserID)
-	return err
+// foodItemReferences counts the rows that point at a food item. Deleting an
+// item with any of these would orphan history or fail on a foreign key.
+func (a *App) foodItemReferences(ctx context.Context, id string) (map[string]int, error) {
+	var logs, ingredients, presets, pantry, nudges int
+	err := a.DB.QueryRow(ctx, `
+    SELECT (SELECT COUNT(*) FROM log_entries WHERE kind = 'food' AND ref_id = $1),
+           (SELECT COUNT(*) FROM recipe_ingredients WHERE food_item_id = $1),
+           (SELECT COUNT(*) FROM preset_items WHERE kind = 'food' AND ref_id = $1),
+           (SELECT COUNT(*) FROM pantry_items WHERE food_item_id = $1),
+           (SELECT COUNT(*) FROM nudges WHERE food_item_id = $1);
+  `, id).Scan(&logs, &ingredients, &presets, &pantry, &nudges)
+	if err != nil {
+		return nil, err
+	}
+	refs := map[string]int{}
+	for k, v := range map[string]int{"log_entries": logs, "recipe_ingredients": ingredients, "preset_items": presets, "pantry_items": pantry, "nudges": nudges} {
+		if v > 0 {
+			refs[k] = v
+		}
+	}
+	return refs, nil
 }
 
-// ── Dashboard ─────────────────────────────────────────────────────────────────
+// HandleArchiveFoodItem hides a food from lists, search and parsing while
+// keeping it (and every log entry that uses it) intact. DELETE undoes it.
+func (a *App) HandleArchiveFoodItem(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	archive := r.Method != http.MethodDelete
+	ct, err := a.DB.Exec(r.Context(), `
+    UPDATE food_items
+    SET archived_at = CASE WHEN $2 THEN COALESCE(archived_at, now()) END,
+        merged_into = CASE WHEN $2 THEN merged_into END
+    WHERE id = $1;
+  `, id, archive)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("archive: %v", err)})
+		return
+	}
+	if ct.RowsAffected() == 0 {
+		writeJSON(w, 404, map[string]any{"error": "food item not found"})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true, "archived": archive})
+}
 
-type DashboardResponse struct {
-	Date          string  `json:"date"`
-	UserID        string  `json:"user_id"`
-	CaloriesIn    float64 `json:"calories_in"`
-	ProteinG      float64 `json:"protein_g"`
-	CarbsG        float64 `json:"carbs_g"`
-	FatG          float64 `json:"fat_g"`
-	FiberG        float64 `json:"fiber_g"`
-	Steps         int     `json:"steps"`
-	ActiveKcalEst float64 `json:"active_calories_est"`
+type MergeFoodItemRequest struct {
+	Into string `json:"into"`
 }
 
-func (a *App) HandleDashboardToday(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		userID = "00000000-0000-0000-0000-000000000001"
+// HandleMergeFoodItem folds a duplicate food item into a canonical one:
+// log entries, recipe ingredients, presets, pantry rows, nudges, barcodes and
+// missing nutrient values are repointed, then the duplicate is archived with
+// merged_into set. Log entries keep their macro snapshots, so past totals
+// don't move. The canonical item must not be archived.
+func (a *App) HandleMergeFoodItem(w http.ResponseWriter, r *http.Request) {
+	dupID := chi.URLParam(r, "id")
+	var req MergeFoodItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
 	}
-	dateStr := r.URL.Query().Get("date")
-	if dateStr == "" {
-		dateStr = a.now().Format("2006-01-02")
+	if req.Into == "" || req.Into == dupID {
+		writeJSON(w, 400, map[string]any{"error": "into must be a different food item id"})
+		return
 	}
-
-	dayStart, err := time.ParseInLocation("2006-01-02", dateStr, a.Loc)
+	ctx := r.Context()
+	tx, err := a.DB.Begin(ctx)
 	if err != nil {
-		writeJSON(w, 400, map[string]any{"error": "bad date"})
+		writeJSON(w, 500, map[string]any{"error": "tx begin"})
 		return
 	}
-	dayEnd := dayStart.Add(24 * time.Hour)
+	defer func() { _ = tx.Rollback(ctx) }()
 
-	ctx := r.Context()
-	var caloriesIn, protein, carbs, fat, fiber float64
-	q := `
-    SELECT COALESCE(SUM(le.servings * fi.calories_per_serving),0),
-           COALESCE(SUM(le.servings * fi.protein_g_per_serving),0),
-           COALESCE(SUM(le.servings * fi.carbs_g_per_serving),0),
-           COALESCE(SUM(le.servings * fi.fat_g_per_serving),0),
-           COALESCE(SUM(le.servings * fi.fiber_g_per_serving),0)
-    FROM log_entries le
-    JOIN food_items fi ON fi.id = le.ref_id
-    WHERE le.user_id = $1 AND le.kind = 'food' AND le.occurred_at >= $2 AND le.occurred_at < $3;
-  `
-	if err := a.DB.QueryRow(ctx, q, userID, dayStart, dayEnd).Scan(&caloriesIn, &protein, &carbs, &fat, &fiber); err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("dashboard query: %v", err)})
+	// The target must be live: merging into an archived item (including one
+	// already merged away, which would close a cycle) strands the history.
+	var found int
+	var intoArchived bool
+	var intoMergedInto string
+	err = tx.QueryRow(ctx, `
+    SELECT COUNT(*),
+           COALESCE(bool_or(archived_at IS NOT NULL) FILTER (WHERE id::text = $2), false),
+           COALESCE(max(merged_into::text) FILTER (WHERE id::text = $2), '')
+    FROM food_items WHERE id::text IN ($1, $2);
+  `, dupID, req.Into).Scan(&found, &intoArchived, &intoMergedInto)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("lookup: %v", err)})
 		return
 	}
-
-	var steps int
-	var activeKcal float64
-	_ = a.DB.QueryRow(ctx, `SELECT COALESCE(steps,0), COALESCE(active_calories_kcal_est,0) FROM daily_activity WHERE user_id=$1 AND date=$2;`, userID, dateStr).
-		Scan(&steps, &activeKcal)
-
-	writeJSON(w, 200, DashboardResponse{
-		Date: dateStr, UserID: userID,
-		CaloriesIn: caloriesIn, ProteinG: protein, CarbsG: carbs, FatG: fat, FiberG: fiber,
-		Steps: steps, ActiveKcalEst: activeKcal,
-	})
+	if found != 2 {
+		writeJSON(w, 404, map[string]any{"error": "food item not found"})
+		return
+	}
+	if intoArchived {
+		msg := "cannot merge into an archived food item"
+		if intoMergedInto != "" {
+			msg = fmt.Sprintf("%s; it was merged into %s", msg, intoMergedInto)
+		}
+		writeJSON(w, 409, map[string]any{"error": msg})
+		return
+	}
+
+	steps := []struct {
+		name string
+		sql  string
+	}{
+		{"log_entries", `UPDATE log_entries SET ref_id = $2 WHERE kind = 'food' AND ref_id = $1`},
+		{"recipe_ingredients", `UPDATE recipe_ingredients SET food_item_id = $2 WHERE food_item_id = $1`},
+		{"preset_items", `UPDATE preset_items SET ref_id = $2 WHERE kind = 'food' AND ref_id = $1`},
+		{"pantry_items", `
+      INSERT INTO pantry_items (user_id, food_item_id, quantity)
+      SELECT user_id, $2, quantity FROM pantry_items WHERE food_item_id = $1
+      ON CONFLICT (user_id, food_item_id) DO UPDATE SET
+        quantity = pantry_items.quantity + EXCLUDED.quantity, updated_at = now()`},
+		{"nudges", `
+      UPDATE nudges n SET food_item_id = $2
+      WHERE n.food_item_id = $1
+        AND NOT EXISTS (SELECT 1 FROM nudges k WHERE k.user_id = n.user_id AND k.food_item_id = $2)`},
+		{"food_barcodes", `UPDATE food_barcodes SET food_item_id = $2 WHERE food_item_id = $1`},
+		{"food_item_nutrients", `
+      INSERT INTO food_item_nutrients (food_item_id, nutrient_key, amount_per_serving)
+      SELECT $2, nutrient_key, amount_per_serving FROM food_item_nutrients WHERE food_item_id = $1
+      ON CONFLICT (food_item_id, nutrient_key) DO NOTHING`},
+	}
+	moved := map[string]int64{}
+	for _, st := range steps {
+		ct, err := tx.Exec(ctx, st.sql, dupID, req.Into)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("merge %s: %v", st.name, err)})
+			return
+		}
+		moved[st.name] = ct.RowsAffected()
+	}
+	// Pantry rows were folded into the canonical item above; nudges that would
+	// collide with an existing one for the canonical item are redundant.
+	if _, err := tx.Exec(ctx, `DELETE FROM pantry_items WHERE food_item_id = $1`, dupID); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("merge pantry_items: %v", err)})
+		return
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM nudges WHERE food_item_id = $1`, dupID); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("merge nudges: %v", err)})
+		return
+	}
+	if _, err := tx.Exec(ctx, `
+    UPDATE food_items SET archived_at = COALESCE(archived_at, now()), merged_into = $2 WHERE id = $1;
+  `, dupID, req.Into); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("archive duplicate: %v", err)})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx commit"})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true, "merged": dupID, "into": req.Into, "moved": moved})
 }
 
-// ── Day Totals ────────────────────────────────────────────────────────────────
+// DuplicateFood is one member of a suspected-duplicate group.
+type DuplicateFood struct {
+	FoodItem
+	Source   string `json:"source"`
+	LogCount int    `json:"log_count"`
+}
 
-type DayTotalsResponse struct {
-	Date       string  `json:"date"`
-	EntryCount int     `json:"entry_count"`
-	CaloriesIn float64 `json:"calories_in"`
-	ProteinG   float64 `json:"protein_g"`
-	CarbsG     float64 `json:"carbs_g"`
-	FatG       float64 `json:"fat_g"`
-	FiberG     float64 `json:"fiber_g"`
+// DuplicateGroup is a set of food items that look like the same food. The
+// suggested canonical item is the most-logged one.
+type DuplicateGroup struct {
+	SuggestedCanonicalID string          `json:"suggested_canonical_id"`
+	Similarity           float64         `json:"similarity"`
+	Items                []DuplicateFood `json:"items"`
 }
 
-func (a *App) HandleDayTotals(w http.ResponseWriter, r *http.Request) {
+const defaultDuplicateThreshold = 0.7
+
+// HandleFindDuplicateFoods groups non-archived food items whose name + brand
+// are trigram-similar above ?threshold= (default 0.7) and whose calories per
+// serving are within 15% of each other, so label variants of the same product
+// surface together while "Chicken breast" vs "Chicken thigh" do not.
+func (a *App) HandleFindDuplicateFoods(w http.ResponseWriter, r *http.Request) {
 	userID := r.URL.Query().Get("user_id")
 	if userID == "" {
 		userID = DefaultUserID
 	}
-	dateStr := r.URL.Query().Get("date")
-	if dateStr == "" {
-		dateStr = a.now().Format("2006-01-02")
+	threshold := defaultDuplicateThreshold
+	if v, err := strconv.ParseFloat(r.URL.Query().Get("threshold"), 64); err == nil && v > 0 && v <= 1 {
+		threshold = v
 	}
-
-	dayStart, err := time.ParseInLocation("2006-01-02", dateStr, a.Loc)
+	ctx := r.Context()
+	// search_text matches food_items_search_trgm_idx so the % join can use it.
+	rows, err := a.DB.Query(ctx, `
+    WITH visible AS (
+      SELECT fi.*, lower(fi.name || ' ' || COALESCE(fi.brand, '')) AS search_text
+      FROM food_items fi
+      WHERE (fi.user_id = $1 OR fi.user_id IS NULL) AND fi.archived_at IS NULL
+    )
+    SELECT a.id, b.id, similarity(a.search_text, b.search_text)::float8
+    FROM visible a
+    JOIN visible b ON a.id < b.id AND a.search_text % b.search_text
+    WHERE similarity(a.search_text, b.search_text) >= $2
+      AND ABS(a.calories_per_serving - b.calories_per_serving) <= 0.15 * GREATEST(a.calories_per_serving, b.calories_per_serving, 1);
+  `, userID, threshold)
 	if err != nil {
-		writeJSON(w, 400, map[string]any{"error": "bad date: use YYYY-MM-DD"})
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
 		return
 	}
-	dayEnd := dayStart.Add(24 * time.Hour)
+	defer rows.Close()
 
-	var count int
-	var calories, protein, carbs, fat, fiber float64
-	err = a.DB.QueryRow(r.Context(), `
-    SELECT COUNT(*),
-           COALESCE(SUM(le.servings * fi.calories_per_serving), 0),
-           COALESCE(SUM(le.servings * fi.protein_g_per_serving), 0),
-           COALESCE(SUM(le.servings * fi.carbs_g_per_serving), 0),
-           COALESCE(SUM(le.servings * fi.fat_g_per_serving), 0),
-           COALESCE(SUM(le.servings * fi.fiber_g_per_serving), 0)
-    FROM log_entries le
-    JOIN food_items fi ON fi.id = le.ref_id
-    WHERE le.user_id = $1 AND le.kind = 'food'
-      AND le.occurred_at >= $2 AND le.occurred_at < $3
-  `, userID, dayStart, dayEnd).Scan(&count, &calories, &protein, &carbs, &fat, &fiber)
-	if err != nil {
+	// Union pairs into groups.
+	parent := map[string]string{}
+	var find func(string) string
+	find = func(x string) string {
+		if p, ok := parent[x]; ok && p != x {
+			parent[x] = find(p)
+			return parent[x]
+		}
+		parent[x] = x
+		return x
+	}
+	bestSim := map[string]float64{}
+	type pair struct {
+		a, b string
+		sim  float64
+	}
+	var pairs []pair
+	for rows.Next() {
+		var p pair
+		if err := rows.Scan(&p.a, &p.b, &p.sim); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("scan: %v", err)})
+			return
+		}
+		parent[find(p.a)] = find(p.b)
+		pairs = append(pairs, p)
+	}
+	if err := rows.Err(); err != nil {
 		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
 		return
 	}
+	members := map[string][]string{}
+	var ids []string
+	for id := range parent {
+		root := find(id)
+		members[root] = append(members[root], id)
+		ids = append(ids, id)
+	}
+	for _, p := range pairs {
+		if root := find(p.a); p.sim > bestSim[root] {
+			bestSim[root] = p.sim
+		}
+	}
 
-	writeJSON(w, 200, DayTotalsResponse{
-		Date: dateStr, EntryCount: count,
-		CaloriesIn: calories, ProteinG: protein, CarbsG: carbs, FatG: fat, FiberG: fiber,
+	details := map[string]DuplicateFood{}
+	if len(ids) > 0 {
+		drows, err := a.DB.Query(ctx, `
+      SELECT fi.id, fi.name, COALESCE(fi.brand,''), fi.serving_label, fi.calories_per_serving, fi.protein_g_per_serving,
+             fi.carbs_g_per_serving, fi.fat_g_per_serving, fi.fiber_g_per_serving, fi.source,
+             (SELECT COUNT(*) FROM log_entries le WHERE le.kind = 'food' AND le.ref_id = fi.id)
+      FROM food_items fi
+      WHERE fi.id = ANY($1::uuid[]);
+    `, ids)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
+			return
+		}
+		defer drows.Close()
+		for drows.Next() {
+			var d DuplicateFood
+			if err := drows.Scan(&d.ID, &d.Name, &d.Brand, &d.ServingLabel, &d.CaloriesPerServing, &d.ProteinPerServing,
+				&d.CarbsPerServing, &d.FatPerServing, &d.FiberPerServing, &d.Source, &d.LogCount); err != nil {
+				writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("scan: %v", err)})
+				return
+			}
+			details[d.ID] = d
+		}
+	}
+
+	groups := []DuplicateGroup{}
+	for root, ids := range members {
+		g := DuplicateGroup{Similarity: math.Round(bestSim[root]*1000) / 1000}
+		for _, id := range ids {
+			g.Items = append(g.Items, details[id])
+		}
+		sort.Slice(g.Items, func(i, j int) bool {
+			if g.Items[i].LogCount != g.Items[j].LogCount {
+				return g.Items[i].LogCount > g.Items[j].LogCount
+			}
+			return g.Items[i].Name < g.Items[j].Name
+		})
+		g.SuggestedCanonicalID = g.Items[0].ID
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Similarity != groups[j].Similarity {
+			return groups[i].Similarity > groups[j].Similarity
+		}
+		return groups[i].Items[0].Name < groups[j].Items[0].Name
 	})
+	writeJSON(w, 200, groups)
 }
 
-// ── Log Food ──────────────────────────────────────────────────────────────────
+// FoodSearchResult is a food item annotated with how well it matched the
+// query and how often the user has logged it.
+type FoodSearchResult struct {
+	FoodItem
+	Score        float64 `json:"score"`
+	LogCount     int     `json:"log_count"`
+	LastLoggedAt *string `json:"last_logged_at"`
+}
 
-// ── Log Today ─────────────────────────────────────────────────────────────────
+const (
+	defaultSearchLimit = 25
+	maxSearchLimit     = 100
+)
 
-type LogEntry struct {
-	ID           string  `json:"id"`
-	Meal         string  `json:"meal"`
-	FoodItemID   string  `json:"food_item_id"`
-	FoodName     string  `json:"food_name"`
-	ServingLabel string  `json:"serving_label"`
-	Servings     float64 `json:"servings"`
-	Calories     float64 `json:"calories"`
-	ProteinG     float64 `json:"protein_g"`
-	CarbsG       float64 `json:"carbs_g"`
-	FatG         float64 `json:"fat_g"`
-	FiberG       float64 `json:"fiber_g"`
-	OccurredAt   string  `json:"occurred_at"`
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// queryInt reads a non-negative integer query parameter, falling back to def
+// when it is missing or malformed.
+func queryInt(r *http.Request, key string, def int) int {
+	v, err := strconv.Atoi(r.URL.Query().Get(key))
+	if err != nil || v < 0 {
+		return def
+	}
+	return v
 }
 
-func (a *App) HandleLogToday(w http.ResponseWriter, r *http.Request) {
+// foodSearchScored scores the user's live food items against the query $1
+// ($3 is it escaped for LIKE) in the scored CTE, for HandleSearchFoodItems.
+// search_text must stay in sync with food_items_search_trgm_idx so the
+// trigram and ILIKE filters can use the index.
+const foodSearchScored = `
+    WITH usage AS (
+      SELECT ref_id, COUNT(*) AS uses, MAX(occurred_at) AS last_used
+      FROM log_entries
+      WHERE user_id = $2 AND kind = 'food'
+      GROUP BY ref_id
+    ), candidates AS (
+      SELECT fi.*, lower(fi.name || ' ' || COALESCE(fi.brand, '')) AS search_text,
+             COALESCE(u.uses, 0) AS uses, u.last_used
+      FROM food_items fi
+      LEFT JOIN usage u ON u.ref_id = fi.id
+      WHERE (fi.user_id = $2 OR fi.user_id IS NULL) AND fi.archived_at IS NULL
+    ), scored AS (
+      SELECT c.*,
+             CASE WHEN $1::text = '' THEN 1 ELSE GREATEST(
+               similarity(lower(c.name), $1),
+               word_similarity($1, lower(c.name)),
+               similarity(c.search_text, $1) * 0.9,
+               CASE WHEN lower(c.name) LIKE $3 || '%' THEN 1.0
+                    WHEN c.search_text LIKE '%' || $3 || '%' THEN 0.8
+                    ELSE 0 END
+             ) END AS text_score,
+             0.1 * ln(1 + c.uses)
+               + CASE WHEN c.last_used IS NULL THEN 0
+                      ELSE 0.2 * exp(-EXTRACT(EPOCH FROM now() - c.last_used) / 86400.0 / 30.0) END AS usage_boost
+      FROM candidates c
+      WHERE $1 = ''
+         OR c.search_text % $1
+         OR $1 <% c.search_text
+         OR c.search_text LIKE '%' || $3 || '%'
+    )`
+
+// HandleSearchFoodItems ranks food items by trigram similarity over name and
+// brand, then boosts the ones the user logs often and recently. With an empty
+// q it simply returns the user's most-used foods first.
+func (a *App) HandleSearchFoodItems(w http.ResponseWriter, r *http.Request) {
 	userID := r.URL.Query().Get("user_id")
 	if userID == "" {
-		userID = "00000000-0000-0000-0000-000000000001"
-	}
-	dateStr := r.URL.Query().Get("date")
-	if dateStr == "" {
-		dateStr = a.now().Format("2006-01-02")
+		userID = DefaultUserID
 	}
-
-	dayStart, err := time.ParseInLocation("2006-01-02", dateStr, a.Loc)
+	q := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+	limit := queryInt(r, "limit", defaultSearchLimit)
+	if limit == 0 || limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+	offset := queryInt(r, "offset", 0)
+
+	rows, err := a.DB.Query(r.Context(), foodSearchScored+`
+    SELECT id, name, COALESCE(brand,''), serving_label, calories_per_serving, protein_g_per_serving,
+           carbs_g_per_serving, fat_g_per_serving, fiber_g_per_serving, is_recipe,
+           (text_score * (1 + usage_boost))::float8 AS score,
+           uses, last_used,
+           (SELECT COUNT(*) FROM scored)
+    FROM scored
+    ORDER BY score DESC, uses DESC, name
+    LIMIT $4 OFFSET $5;
+  `, q, userID, likeEscaper.Replace(q), limit, offset)
 	if err != nil {
-		writeJSON(w, 400, map[string]any{"error": "bad date"})
-		return
-	}
-	dayEnd := dayStart.Add(24 * time.Hour)
-
-	rows, err := a.DB.Query(r.Context(), `
-    SELECT le.id, le.meal, le.ref_id, fi.name, fi.serving_label, le.servings,
-           le.servings * fi.calories_per_serving,
-           le.servings * fi.protein_g_per_serving,
-           le.servings * fi.carbs_g_per_serving,
-           le.servings * fi.fat_g_per_serving,
-           le.servings * fi.fiber_g_per_serving,
-           le.occurred_at
-    FROM log_entries le
-    JOIN food_items fi ON fi.id = le.ref_id
-    WHERE le.user_id = $1 AND le.kind = 'food' AND le.occurred_at >= $2 AND le.occurred_at < $3
-    ORDER BY le.occurred_at;
-  `, userID, dayStart, dayEnd)
-	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("search: %v", err)})
 		return
 	}
 	defer rows.Close()
-
-	entries := []LogEntry{}
+	items := []FoodSearchResult{}
+	total := 0
 	for rows.Next() {
-		var e LogEntry
-		var ts time.Time
-		if err := rows.Scan(&e.ID, &e.Meal, &e.FoodItemID, &e.FoodName, &e.ServingLabel, &e.Servings,
-			&e.Calories, &e.ProteinG, &e.CarbsG, &e.FatG, &e.FiberG, &ts); err != nil {
-			writeJSON(w, 500, map[string]any{"error": "scan"})
+		var it FoodSearchResult
+		var lastUsed *time.Time
+		if err := rows.Scan(&it.ID, &it.Name, &it.Brand, &it.ServingLabel, &it.CaloriesPerServing, &it.ProteinPerServing,
+			&it.CarbsPerServing, &it.FatPerServing, &it.FiberPerServing, &it.IsRecipe, &it.Score, &it.LogCount, &lastUsed, &total); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("scan: %v", err)})
 			return
 		}
-		e.OccurredAt = ts.Format(time.RFC3339)
-		entries = append(entries, e)
+		if lastUsed != nil {
+			ts := lastUsed.In(a.Loc).Format(time.RFC3339)
+			it.LastLoggedAt = &ts
+		}
+		it.Score = math.Round(it.Score*1000) / 1000
+		items = append(items, it)
 	}
-	writeJSON(w, 200, entries)
-}
-
-func (a *App) HandleDeleteLogEntry(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	if id == "" {
-		writeJSON(w, 400, map[string]any{"error": "missing id"})
+	if err := rows.Err(); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("search: %v", err)})
 		return
 	}
-	ct, err := a.DB.Exec(r.Context(), `DELETE FROM log_entries WHERE id = $1;`, id)
-	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete: %v", err)})
-		return
+	// A page past the end has no rows to carry the total.
+	if len(items) == 0 && offset > 0 {
+		err := a.DB.QueryRow(r.Context(), foodSearchScored+`
+    SELECT COUNT(*) FROM scored;
+  `, q, userID, likeEscaper.Replace(q)).Scan(&total)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("search count: %v", err)})
+			return
+		}
 	}
-	if ct.RowsAffected() == 0 {
-		writeJSON(w, 404, map[string]any{"error": "not found"})
+	ptrs := make([]*FoodItem, len(items))
+	for i := range items {
+		ptrs[i] = &items[i].FoodItem
+	}
+	if err := a.attachNutrients(r.Context(), ptrs); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("nutrients: %v", err)})
 		return
 	}
-	writeJSON(w, 200, map[string]any{"ok": true})
+	writeJSON(w, 200, map[string]any{"items": items, "total": total, "limit": limit, "offset": offset})
 }
 
-// HandleLogRange returns per-day calorie totals for a date range (for the calendar view).
-// Query params: user_id, from (YYYY-MM-DD), to (YYYY-MM-DD)
-func (a *App) HandleLogRange(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		userID = "00000000-0000-0000-0000-000000000001"
+// QuickAddItem is a food the user habitually logs in a meal slot, with the
+// serving count they usually log it at.
+type QuickAddItem struct {
+	FoodItem
+	TypicalServings float64 `json:"typical_servings"`
+	LogCount        int     `json:"log_count"`
+	LastLoggedAt    string  `json:"last_logged_at"`
+
+	lastLogged time.Time
+}
+
+// QuickAddSlot holds the recent and frequent foods for a single meal slot.
+type QuickAddSlot struct {
+	Meal     string         `json:"meal"`
+	Recent   []QuickAddItem `json:"recent"`
+	Frequent []QuickAddItem `json:"frequent"`
+}
+
+const (
+	defaultQuickAddDays   = 60
+	defaultQuickAddLimit  = 6
+	defaultQuickAddWindow = 90 // minutes either side of ?at=
+)
+
+// mealLess orders meal slots the way the Ledger shows them: breakfast,
+// lunch, dinner, then snacks by number (snack_2 before snack_10), then any
+// other slot by name.
+func mealLess(a, b string) bool {
+	ra, na := mealOrder(a)
+	rb, nb := mealOrder(b)
+	if ra != rb {
+		return ra < rb
 	}
-	fromStr := r.URL.Query().Get("from")
-	toStr := r.URL.Query().Get("to")
-	if fromStr == "" || toStr == "" {
-		writeJSON(w, 400, map[string]any{"error": "from and to required"})
-		return
+	if na != nb {
+		return na < nb
 	}
-	from, err := time.ParseInLocation("2006-01-02", fromStr, a.Loc)
-	if err != nil {
-		writeJSON(w, 400, map[string]any{"error": "bad from date"})
-		return
+	return a < b
+}
+
+// mealOrder returns a slot's rank and, for snacks, its number.
+func mealOrder(meal string) (rank, n int) {
+	switch meal {
+	case "breakfast":
+		return 0, 0
+	case "lunch":
+		return 1, 0
+	case "dinner":
+		return 2, 0
+	case "snack":
+		return 3, 0
+	}
+	if num, ok := strings.CutPrefix(meal, "snack_"); ok {
+		if v, err := strconv.Atoi(num); err == nil {
+			return 3, v
+		}
 	}
-	to, err := time.ParseInLocation("2006-01-02", toStr, a.Loc)
-	if err != nil {
-		writeJSON(w, 400, map[string]any{"error": "bad to date"})
-		return
+	return 4, 0
+}
+
+// HandleQuickAdd returns, per meal slot, the foods most recently and most
+// frequently logged over the last ?days= days. ?meal= limits it to one slot;
+// ?at= (HH:MM or RFC3339) only counts entries logged within ?window= minutes
+// of that time of day and, without ?meal=, picks the slot for that time.
+func (a *App) HandleQuickAdd(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	meal := r.URL.Query().Get("meal")
+	days := queryInt(r, "days", defaultQuickAddDays)
+	if days == 0 {
+		days = defaultQuickAddDays
+	}
+	limit := queryInt(r, "limit", defaultQuickAddLimit)
+	if limit == 0 || limit > maxSearchLimit {
+		limit = defaultQuickAddLimit
+	}
+	window := queryInt(r, "window", defaultQuickAddWindow)
+
+	// -1 disables the time-of-day filter.
+	atMinute := -1
+	if at := r.URL.Query().Get("at"); at != "" {
+		var t time.Time
+		var err error
+		if len(at) == 5 {
+			t, err = time.ParseInLocation("15:04", at, a.Loc)
+		} else if t, err = time.Parse(time.RFC3339, at); err == nil {
+			t = t.In(a.Loc)
+		}
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": "invalid at (use HH:MM or RFC3339)"})
+			return
+		}
+		atMinute = t.Hour()*60 + t.Minute()
+		if meal == "" {
+			meal = mealForTime(t)
+		}
 	}
-	to = to.Add(24 * time.Hour) // inclusive
 
+	since := a.now().AddDate(0, 0, -days)
 	rows, err := a.DB.Query(r.Context(), `
-    SELECT DATE(le.occurred_at AT TIME ZONE $4) AS day, COALESCE(SUM(le.servings * fi.calories_per_serving), 0)
-    FROM log_entries le
-    JOIN food_items fi ON fi.id = le.ref_id
-    WHERE le.user_id = $1 AND le.kind = 'food' AND le.occurred_at >= $2 AND le.occurred_at < $3
-    GROUP BY day ORDER BY day;
-  `, userID, from, to, a.Loc.String())
+    WITH entries AS (
+      SELECT le.ref_id, le.meal, le.servings, le.occurred_at,
+             EXTRACT(HOUR FROM le.occurred_at AT TIME ZONE $5)::int * 60
+               + EXTRACT(MINUTE FROM le.occurred_at AT TIME ZONE $5)::int AS minute_of_day
+      FROM log_entries le
+      WHERE le.user_id = $1 AND le.kind = 'food' AND le.occurred_at >= $2
+        AND ($3::text = '' OR le.meal = $3)
+    )
+    SELECT e.meal, fi.id, fi.name, COALESCE(fi.brand,''), fi.serving_label,
+           fi.calories_per_serving, fi.protein_g_per_serving, fi.carbs_g_per_serving,
+           fi.fat_g_per_serving, fi.fiber_g_per_serving,
+           (mode() WITHIN GROUP (ORDER BY e.servings))::float8,
+           COUNT(*), MAX(e.occurred_at)
+    FROM entries e
+    JOIN food_items fi ON fi.id = e.ref_id AND fi.archived_at IS NULL
+    WHERE $4::int < 0
+       OR LEAST(ABS(e.minute_of_day - $4), 1440 - ABS(e.minute_of_day - $4)) <= $6
+    GROUP BY e.meal, fi.id;
+  `, userID, since, meal, atMinute, a.Loc.String(), window)
 	if err != nil {
 		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
 		return
 	}
 	defer rows.Close()
-
-	type DayTotal struct {
-		Date     string  `json:"date"`
-		Calories float64 `json:"calories"`
-	}
-	totals := []DayTotal{}
+	byMeal := map[string][]QuickAddItem{}
 	for rows.Next() {
-		var d DayTotal
-		var day time.Time
-		if err := rows.Scan(&day, &d.Calories); err != nil {
-			writeJSON(w, 500, map[string]any{"error": "scan"})
+		var m string
+		var it QuickAddItem
+		if err := rows.Scan(&m, &it.ID, &it.Name, &it.Brand, &it.ServingLabel,
+			&it.CaloriesPerServing, &it.ProteinPerServing, &it.CarbsPerServing, &it.FatPerServing, &it.FiberPerServing,
+			&it.TypicalServings, &it.LogCount, &it.lastLogged); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("scan: %v", err)})
 			return
 		}
-		d.Date = day.Format("2006-01-02")
-		totals = append(totals, d)
+		it.LastLoggedAt = it.lastLogged.In(a.Loc).Format(time.RFC3339)
+		byMeal[m] = append(byMeal[m], it)
 	}
-	writeJSON(w, 200, totals)
-}
-
-// ── Log Food ──────────────────────────────────────────────────────────────────
-
-type LogFoodRequest struct {
-	UserID     string  `json:"user_id"`
-	OccurredAt string  `json:"occurred_at"`
-	FoodItemID string  `json:"food_item_id"`
-	Servings   float64 `json:"servings"`
-	Meal       string  `json:"meal"`
-	Note       string  `json:"note"`
-}
-
-func (a *App) HandleLogFood(w http.ResponseWriter, r *http.Request) {
-	var req LogFoodRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+	if err := rows.Err(); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
 		return
 	}
-	if req.UserID == "" {
-		req.UserID = "00000000-0000-0000-0000-000000000001"
+	var ptrs []*FoodItem
+	for _, items := range byMeal {
+		for i := range items {
+			ptrs = append(ptrs, &items[i].FoodItem)
+		}
 	}
-	if req.OccurredAt == "" {
-		req.OccurredAt = a.now().Format(time.RFC3339)
+	if err := a.attachNutrients(r.Context(), ptrs); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("nutrients: %v", err)})
+		return
 	}
-	if req.Meal == "" {
-		req.Meal = "breakfast"
+
+	slots := []QuickAddSlot{}
+	for m, items := range byMeal {
+		recent := append([]QuickAddItem(nil), items...)
+		sort.Slice(recent, func(i, j int) bool { return recent[i].lastLogged.After(recent[j].lastLogged) })
+		frequent := append([]QuickAddItem(nil), items...)
+		sort.Slice(frequent, func(i, j int) bool {
+			if frequent[i].LogCount != frequent[j].LogCount {
+				return frequent[i].LogCount > frequent[j].LogCount
+			}
+			return frequent[i].lastLogged.After(frequent[j].lastLogged)
+		})
+		slots = append(slots, QuickAddSlot{Meal: m, Recent: recent[:min(limit, len(recent))], Frequent: frequent[:min(limit, len(frequent))]})
 	}
-	if req.FoodItemID == "" || req.Servings <= 0 {
-		writeJSON(w, 400, map[string]any{"error": "food_item_id and servings required"})
-		return
+	sort.Slice(slots, func(i, j int) bool { return mealLess(slots[i].Meal, slots[j].Meal) })
+	writeJSON(w, 200, map[string]any{"meal": meal, "days": days, "slots": slots})
+}
+
+// EnsureRecipePages gives every food item flagged is_recipe a recipe page.
+// Plain foods get none.
+func (a *App) EnsureRecipePages(ctx context.Context) error {
+	_, err := a.DB.Exec(ctx, `
+    INSERT INTO recipes (id, user_id, name, instructions, yield_count, created_at)
+    SELECT fi.id,
+           COALESCE(fi.user_id, $1::uuid),
+           fi.name,
+           '',
+           1,
+           fi.created_at
+    FROM food_items fi
+    LEFT JOIN recipes r ON r.id = fi.id
+    WHERE fi.is_recipe AND r.id IS NULL;
+  `, DefaultUserID)
+	return err
+}
+
+// ── Barcodes ──────────────────────────────────────────────────────────────────
+
+// normalizeBarcode strips separators, validates the GS1 check digit for
+// EAN-8, UPC-A and EAN-13, and returns the canonical form. UPC-A codes are
+// stored as EAN-13 with a leading zero so either scan of the same product
+// resolves to the same row.
+func normalizeBarcode(raw string) (string, error) {
+	code := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(raw))
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return "", fmt.Errorf("barcode must be digits only")
+		}
 	}
-	t, err := time.Parse(time.RFC3339, req.OccurredAt)
-	if err != nil {
-		writeJSON(w, 400, map[string]any{"error": "occurred_at must be RFC3339"})
-		return
+	switch len(code) {
+	case 8, 13:
+	case 12:
+		code = "0" + code
+	default:
+		return "", fmt.Errorf("barcode must be 8 (EAN-8), 12 (UPC-A) or 13 (EAN-13) digits")
 	}
+	if gs1CheckDigit(code[:len(code)-1]) != code[len(code)-1] {
+		return "", fmt.Errorf("invalid barcode check digit")
+	}
+	return code, nil
+}
 
-	_, err = a.DB.Exec(r.Context(),
-		`INSERT INTO log_entries (user_id, occurred_at, kind, ref_id, servings, meal, note) VALUES ($1,$2,'food',$3,$4,$5,$6);`,
-		req.UserID, t, req.FoodItemID, req.Servings, req.Meal, req.Note,
-	)
-	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("insert: %v", err)})
-		return
+// gs1CheckDigit computes the mod-10 check digit shared by the EAN/UPC family:
+// digits are weighted 3,1,3,1… starting from the right of the payload.
+func gs1CheckDigit(payload string) byte {
+	sum := 0
+	for i := 0; i < len(payload); i++ {
+		d := int(payload[len(payload)-1-i] - '0')
+		if i%2 == 0 {
+			d *= 3
+		}
+		sum += d
 	}
-	writeJSON(w, 201, map[string]any{"ok": true})
+	return byte('0' + (10-sum%10)%10)
 }
 
-// ── Body Weight ───────────────────────────────────────────────────────────────
+// CatalogProduct is a row from the locally imported product database
+// (see `api import-products`). Values are per serving_label.
+type CatalogProduct struct {
+	Code               string  `json:"code"`
+	Name               string  `json:"name"`
+	Brand              string  `json:"brand"`
+	ServingLabel       string  `json:"serving_label"`
+	CaloriesPerServing float64 `json:"calories_per_serving"`
+	ProteinPerServing  float64 `json:"protein_g_per_serving"`
+	CarbsPerServing    float64 `json:"carbs_g_per_serving"`
+	FatPerServing      float64 `json:"fat_g_per_serving"`
+	FiberPerServing    float64 `json:"fiber_g_per_serving"`
+	Source             string  `json:"source"`
+}
 
-type BodyWeightRequest struct {
-	UserID     string  `json:"user_id"`
-	MeasuredAt string  `json:"measured_at"`
-	WeightKg   float64 `json:"weight_kg"`
-	Note       string  `json:"note"`
+func (a *App) foodItemBarcodes(ctx context.Context, foodItemID string) ([]string, error) {
+	rows, err := a.DB.Query(ctx, `SELECT code FROM food_barcodes WHERE food_item_id = $1 ORDER BY created_at`, foodItemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	codes := []string{}
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		codes = append(codes, c)
+	}
+	return codes, rows.Err()
 }
 
-func (a *App) HandleBodyWeight(w http.ResponseWriter, r *http.Request) {
-	var req BodyWeightRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+// HandleGetFoodByBarcode resolves a scanned code to a linked food item. When
+// the code isn't linked yet but exists in the product catalog, the 404 body
+// carries the catalog product so the client can offer to create it.
+func (a *App) HandleGetFoodByBarcode(w http.ResponseWriter, r *http.Request) {
+	code, err := normalizeBarcode(chi.URLParam(r, "code"))
+	if err != nil {
+		writeJSON(w, 400, map[string]any{"error": err.Error()})
 		return
 	}
-	if req.UserID == "" {
-		req.UserID = "00000000-0000-0000-0000-000000000001"
-	}
-	if req.MeasuredAt == "" {
-		req.MeasuredAt = a.now().Format(time.RFC3339)
+	ctx := r.Context()
+	var it FoodItem
+	err = a.DB.QueryRow(ctx, `
+    SELECT fi.id, fi.name, COALESCE(fi.brand,''), fi.serving_label, fi.calories_per_serving, fi.protein_g_per_serving, fi.carbs_g_per_serving, fi.fat_g_per_serving, fi.fiber_g_per_serving
+    FROM food_barcodes fb
+    JOIN food_items fi ON fi.id = fb.food_item_id
+    WHERE fb.code = $1;
+  `, code).Scan(&it.ID, &it.Name, &it.Brand, &it.ServingLabel, &it.CaloriesPerServing, &it.ProteinPerServing, &it.CarbsPerServing, &it.FatPerServing, &it.FiberPerServing)
+	if err == nil {
+		if it.Barcodes, err = a.foodItemBarcodes(ctx, it.ID); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("barcodes: %v", err)})
+			return
+		}
+		if err := a.attachNutrients(ctx, []*FoodItem{&it}); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("nutrients: %v", err)})
+			return
+		}
+		writeJSON(w, 200, it)
+		return
 	}
-	if req.WeightKg <= 0 {
-		writeJSON(w, 400, map[string]any{"error": "weight_kg required"})
+	if !errors.Is(err, pgx.ErrNoRows) {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("lookup: %v", err)})
 		return
 	}
-	t, err := time.Parse(time.RFC3339, req.MeasuredAt)
-	if err != nil {
-		writeJSON(w, 400, map[string]any{"error": "measured_at must be RFC3339"})
+	p, err := a.lookupCatalogProduct(ctx, code)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeJSON(w, 404, map[string]any{"error": "barcode not found", "code": code})
 		return
 	}
-
-	_, err = a.DB.Exec(r.Context(),
-		`INSERT INTO body_weights (user_id, measured_at, weight_kg, note) VALUES ($1,$2,$3,$4);`,
-		req.UserID, t, req.WeightKg, req.Note,
-	)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("insert: %v", err)})
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("catalog lookup: %v", err)})
 		return
 	}
-	writeJSON(w, 201, map[string]any{"ok": true})
+	writeJSON(w, 404, map[string]any{"error": "barcode not linked to a food item", "code": code, "product": p})
 }
 
-// ── Daily Activity ────────────────────────────────────────────────────────────
+func (a *App) lookupCatalogProduct(ctx context.Context, code string) (CatalogProduct, error) {
+	var p CatalogProduct
+	err := a.DB.QueryRow(ctx, `
+    SELECT code, name, COALESCE(brand,''), serving_label, calories_per_serving, protein_g_per_serving, carbs_g_per_serving, fat_g_per_serving, fiber_g_per_serving, source
+    FROM product_catalog
+    WHERE code = $1;
+  `, code).Scan(&p.Code, &p.Name, &p.Brand, &p.ServingLabel, &p.CaloriesPerServing, &p.ProteinPerServing, &p.CarbsPerServing, &p.FatPerServing, &p.FiberPerServing, &p.Source)
+	return p, err
+}
 
-type DailyActivityRequest struct {
-	UserID        string  `json:"user_id"`
-	Date          string  `json:"date"`
-	Steps         int     `json:"steps"`
-	ActiveKcalEst float64 `json:"active_calories_est"`
+type LinkBarcodeRequest struct {
+	UserID     string `json:"user_id"`
+	FoodItemID string `json:"food_item_id"`
 }
 
-func (a *App) HandleDailyActivity(w http.ResponseWriter, r *http.Request) {
-	var req DailyActivityRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+// HandleLinkBarcode associates a code with a food item. With food_item_id it
+// links an existing item (re-pointing the code if it was linked elsewhere);
+// without one it creates a new item from the product catalog, offline.
+func (a *App) HandleLinkBarcode(w http.ResponseWriter, r *http.Request) {
+	code, err := normalizeBarcode(chi.URLParam(r, "code"))
+	if err != nil {
+		writeJSON(w, 400, map[string]any{"error": err.Error()})
 		return
 	}
+	var req LinkBarcodeRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, 400, map[string]any{"error": "invalid json"})
+			return
+		}
+	}
 	if req.UserID == "" {
-		req.UserID = "00000000-0000-0000-0000-000000000001"
+		req.UserID = DefaultUserID
 	}
-	if req.Date == "" {
-		req.Date = a.now().Format("2006-01-02")
+	ctx := r.Context()
+	tx, err := a.DB.Begin(ctx)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx begin"})
+		return
 	}
+	defer func() { _ = tx.Rollback(ctx) }()
 
-	_, err := a.DB.Exec(r.Context(), `
-    INSERT INTO daily_activity (user_id, date, steps, active_calories_kcal_est, source)
-    VALUES ($1,$2,$3,$4,'manual')
-    ON CONFLICT (user_id, date) DO UPDATE SET
-      steps = EXCLUDED.steps,
-      active_calories_kcal_est = EXCLUDED.active_calories_kcal_est;
-  `, req.UserID, req.Date, req.Steps, req.ActiveKcalEst)
+	created := false
+	if req.FoodItemID == "" {
+		p, err := a.lookupCatalogProduct(ctx, code)
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeJSON(w, 404, map[string]any{"error": "barcode not in product catalog; pass food_item_id to link an existing item"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("catalog lookup: %v", err)})
+			return
+		}
+		err = tx.QueryRow(ctx, `
+      INSERT INTO food_items (user_id, name, brand, serving_label, calories_per_serving, protein_g_per_serving, carbs_g_per_serving, fat_g_per_serving, fiber_g_per_serving, source)
+      VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING id;
+    `, req.UserID, p.Name, p.Brand, p.ServingLabel, p.CaloriesPerServing, p.ProteinPerServing, p.CarbsPerServing, p.FatPerServing, p.FiberPerServing, p.Source).Scan(&req.FoodItemID)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("insert food_item: %v", err)})
+			return
+		}
+		created = true
+	}
+	_, err = tx.Exec(ctx, `
+    INSERT INTO food_barcodes (code, food_item_id)
+    VALUES ($1,$2)
+    ON CONFLICT (code) DO UPDATE SET food_item_id = EXCLUDED.food_item_id;
+  `, code, req.FoodItemID)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("upsert: %v", err)})
+		writeJSON(w, 400, map[string]any{"error": fmt.Sprintf("link barcode: %v", err)})
 		return
 	}
-	writeJSON(w, 201, map[string]any{"ok": true})
-}
-
-func (a *App) HandleGetWater(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		userID = "00000000-0000-0000-0000-000000000001"
+	if err := tx.Commit(ctx); err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx commit"})
+		return
 	}
-	date := r.URL.Query().Get("date")
-	if date == "" {
-		date = a.now().Format("2006-01-02")
+	status := 200
+	if created {
+		status = 201
 	}
+	writeJSON(w, status, map[string]any{"ok": true, "code": code, "food_item_id": req.FoodItemID, "created": created})
+}
 
-	var glasses int
-	err := a.DB.QueryRow(r.Context(), `
-		SELECT COALESCE(water_glasses, 0)
-		FROM daily_activity
-		WHERE user_id = $1 AND date = $2
-	`, userID, date).Scan(&glasses)
+func (a *App) HandleUnlinkBarcode(w http.ResponseWriter, r *http.Request) {
+	code, err := normalizeBarcode(chi.URLParam(r, "code"))
 	if err != nil {
-		// No row means no water logged yet
-		glasses = 0
-	}
-	writeJSON(w, 200, map[string]any{"glasses": glasses})
-}
-
-type SetWaterRequest struct {
-	UserID  string `json:"user_id"`
-	Date    string `json:"date"`
-	Glasses int    `json:"glasses"`
-}
-
-func (a *App) HandleSetWater(w http.ResponseWriter, r *http.Request) {
-	var req SetWaterRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		writeJSON(w, 400, map[string]any{"error": err.Error()})
 		return
 	}
-	if req.UserID == "" {
-		req.UserID = "00000000-0000-0000-0000-000000000001"
-	}
-	if req.Date == "" {
-		req.Date = a.now().Format("2006-01-02")
-	}
-	if req.Glasses < 0 {
-		req.Glasses = 0
-	}
-
-	_, err := a.DB.Exec(r.Context(), `
-		INSERT INTO daily_activity (user_id, date, steps, active_calories_kcal_est, water_glasses, source)
-		VALUES ($1, $2, 0, 0, $3, 'manual')
-		ON CONFLICT (user_id, date) DO UPDATE SET
-			water_glasses = EXCLUDED.water_glasses;
-	`, req.UserID, req.Date, req.Glasses)
+	ct, err := a.DB.Exec(r.Context(), `DELETE FROM food_barcodes WHERE code = $1`, code)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("upsert water: %v", err)})
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete: %v", err)})
+		return
+	}
+	if ct.RowsAffected() == 0 {
+		writeJSON(w, 404, map[string]any{"error": "barcode not found"})
 		return
 	}
 	writeJSON(w, 200, map[string]any{"ok": true})
 }
 
-// ── Presets ───────────────────────────────────────────────────────────────────
-
-type CreatePresetRequest struct {
-	UserID string `json:"user_id"`
-	Name   string `json:"name"`
-	Pinned bool   `json:"pinned"`
-	Items  []struct {
-		Kind     string  `json:"kind"` // food|recipe_portion
-		RefID    string  `json:"ref_id"`
-		Servings float64 `json:"servings"`
-	} `json:"items"`
+// ── Nutrients ─────────────────────────────────────────────────────────────────
+
+// NutrientDef describes a tracked micronutrient. Per-food values live in
+// food_item_nutrients and surface as a key → amount map on FoodItem,
+// LogEntry and day totals, so clients that only know the macros are
+// unaffected.
+type NutrientDef struct {
+	Key       string `json:"key"`
+	Name      string `json:"name"`
+	Unit      string `json:"unit"`
+	USDANbr   string `json:"usda_nbr,omitempty"`
+	SortOrder int    `json:"sort_order"`
 }
 
-func (a *App) HandleCreatePreset(w http.ResponseWriter, r *http.Request) {
-	var req CreatePresetRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, 400, map[string]any{"error": "invalid json"})
-		return
-	}
-	if req.UserID == "" {
-		req.UserID = "00000000-0000-0000-0000-000000000001"
-	}
-	if req.Name == "" || len(req.Items) == 0 {
-		writeJSON(w, 400, map[string]any{"error": "name and items required"})
-		return
+var errUnknownNutrient = errors.New("unknown nutrient")
+
+func nutrientErrorStatus(err error) int {
+	if errors.Is(err, errUnknownNutrient) {
+		return 400
 	}
+	return 500
+}
 
-	ctx := r.Context()
-	tx, err := a.DB.Begin(ctx)
+func (a *App) loadNutrientDefs(ctx context.Context) ([]NutrientDef, error) {
+	rows, err := a.DB.Query(ctx, `SELECT key, name, unit, COALESCE(usda_nbr,''), sort_order FROM nutrients ORDER BY sort_order, key`)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": "tx begin"})
-		return
+		return nil, err
 	}
-	defer func() { _ = tx.Rollback(ctx) }()
-
-	var presetID string
-	if err := tx.QueryRow(ctx, `INSERT INTO presets (user_id, name, pinned) VALUES ($1,$2,$3) RETURNING id;`, req.UserID, req.Name, req.Pinned).Scan(&presetID); err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("preset insert: %v", err)})
-		return
+	defer rows.Close()
+	defs := []NutrientDef{}
+	for rows.Next() {
+		var d NutrientDef
+		if err := rows.Scan(&d.Key, &d.Name, &d.Unit, &d.USDANbr, &d.SortOrder); err != nil {
+			return nil, err
+		}
+		defs = append(defs, d)
 	}
+	return defs, rows.Err()
+}
 
-	for _, it := range req.Items {
-		if it.Kind != "food" && it.Kind != "recipe_portion" {
-			writeJSON(w, 400, map[string]any{"error": "invalid preset item kind"})
-			return
-		}
-		if it.Servings <= 0 {
-			it.Servings = 1
+// loadFoodNutrients returns per-serving nutrient amounts keyed by food item
+// ID. Foods without any recorded nutrients are absent from the map.
+func (a *App) loadFoodNutrients(ctx context.Context, foodItemIDs []string) (map[string]map[string]float64, error) {
+	out := map[string]map[string]float64{}
+	if len(foodItemIDs) == 0 {
+		return out, nil
+	}
+	rows, err := a.DB.Query(ctx, `
+    SELECT food_item_id::text, nutrient_key, amount_per_serving
+    FROM food_item_nutrients
+    WHERE food_item_id = ANY($1::uuid[]);
+  `, foodItemIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, key string
+		var amount float64
+		if err := rows.Scan(&id, &key, &amount); err != nil {
+			return nil, err
 		}
-		_, err := tx.Exec(ctx,
-			`INSERT INTO preset_items (preset_id, kind, ref_id, servings) VALUES ($1,$2,$3,$4);`,
-			presetID, it.Kind, it.RefID, it.Servings)
-		if err != nil {
-			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("preset item insert: %v", err)})
-			return
+		if out[id] == nil {
+			out[id] = map[string]float64{}
 		}
+		out[id][key] = amount
 	}
+	return out, rows.Err()
+}
 
-	if err := tx.Commit(ctx); err != nil {
-		writeJSON(w, 500, map[string]any{"error": "tx commit"})
-		return
+// attachNutrients fills the Nutrients map on each food item in place.
+func (a *App) attachNutrients(ctx context.Context, items []*FoodItem) error {
+	ids := make([]string, len(items))
+	for i, it := range items {
+		ids[i] = it.ID
 	}
-	writeJSON(w, 201, map[string]any{"ok": true, "preset_id": presetID})
+	byFood, err := a.loadFoodNutrients(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, it := range items {
+		it.Nutrients = byFood[it.ID]
+	}
+	return nil
 }
 
-func (a *App) HandleApplyPreset(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		userID = "00000000-0000-0000-0000-000000000001"
+// saveFoodNutrients replaces a food item's nutrient values. Amounts <= 0 are
+// treated as "not recorded" and dropped.
+func saveFoodNutrients(ctx context.Context, tx pgx.Tx, foodItemID string, nutrients map[string]float64) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM food_item_nutrients WHERE food_item_id = $1`, foodItemID); err != nil {
+		return err
 	}
-	presetID := chi.URLParam(r, "id")
-	if presetID == "" {
-		writeJSON(w, 400, map[string]any{"error": "missing preset id"})
-		return
+	for key, amount := range nutrients {
+		if amount <= 0 {
+			continue
+		}
+		ct, err := tx.Exec(ctx, `
+      INSERT INTO food_item_nutrients (food_item_id, nutrient_key, amount_per_serving)
+      SELECT $1, key, $3 FROM nutrients WHERE key = $2;
+    `, foodItemID, key, amount)
+		if err != nil {
+			return err
+		}
+		if ct.RowsAffected() == 0 {
+			return fmt.Errorf("%w %q", errUnknownNutrient, key)
+		}
 	}
-	occurredAt := time.Now().UTC()
+	return nil
+}
 
-	rows, err := a.DB.Query(r.Context(), `SELECT kind, ref_id, servings FROM preset_items WHERE preset_id=$1;`, presetID)
+// dailyNutrientTotals sums logged nutrients per local day over [from, to).
+func (a *App) dailyNutrientTotals(ctx context.Context, userID string, from, to time.Time) (map[string]map[string]float64, error) {
+	rows, err := a.DB.Query(ctx, `
+    SELECT DATE(le.occurred_at AT TIME ZONE $4) AS day, n.key,
+           SUM(le.servings * n.value::numeric)
+    FROM log_entries le
+    JOIN food_items fi ON fi.id = le.ref_id
+    CROSS JOIN LATERAL jsonb_each_text(le.nutrients_per_serving) AS n(key, value)
+    WHERE le.user_id = $1 AND le.kind = 'food'
+      AND le.occurred_at >= $2 AND le.occurred_at < $3
+      AND jsonb_typeof(le.nutrients_per_serving) = 'object'
+    GROUP BY day, n.key;
+  `, userID, from, to, a.Loc.String())
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": "query preset items"})
-		return
+		return nil, err
 	}
 	defer rows.Close()
-
-	n := 0
+	out := map[string]map[string]float64{}
 	for rows.Next() {
-		var kind, refID string
-		var servings float64
-		if err := rows.Scan(&kind, &refID, &servings); err != nil {
-			writeJSON(w, 500, map[string]any{"error": "scan"})
-			return
+		var day time.Time
+		var key string
+		var amount float64
+		if err := rows.Scan(&day, &key, &amount); err != nil {
+			return nil, err
 		}
-		_, err = a.DB.Exec(r.Context(),
-			`INSERT INTO log_entries (user_id, occurred_at, kind, ref_id, servings) VALUES ($1,$2,$3,$4,$5);`,
-			userID, occurredAt, kind, refID, servings)
-		if err != nil {
-			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("apply insert: %v", err)})
-			return
+		d := day.Format("2006-01-02")
+		if out[d] == nil {
+			out[d] = map[string]float64{}
 		}
-		n++
+		out[d][key] = amount
 	}
-	writeJSON(w, 200, map[string]any{"ok": true, "logged_items": n})
+	return out, rows.Err()
 }
 
-// ── Recipes ───────────────────────────────────────────────────────────────────
-
-type RecipeSummary struct {
-	ID                 string    `json:"id"`
-	Name               string    `json:"name"`
-	Brand              string    `json:"brand"`
-	ServingLabel       string    `json:"serving_label"`
-	Instructions       string    `json:"instructions"`
-	YieldCount         int       `json:"yield_count"`
-	CaloriesPerServing float64   `json:"calories_per_serving"`
-	ProteinPerServing  float64   `json:"protein_g_per_serving"`
-	CarbsPerServing    float64   `json:"carbs_g_per_serving"`
-	FatPerServing      float64   `json:"fat_g_per_serving"`
-	FiberPerServing    float64   `json:"fiber_g_per_serving"`
-	CreatedAt          time.Time `json:"created_at"`
-	IngredientCnt      int       `json:"ingredient_count"`
+func (a *App) HandleListNutrients(w http.ResponseWriter, r *http.Request) {
+	defs, err := a.loadNutrientDefs(r.Context())
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
+		return
+	}
+	writeJSON(w, 200, defs)
 }
 
-type RecipeIngredientDetail struct {
-	ID         string  `json:"id"`
-	FoodItemID string  `json:"food_item_id"`
-	FoodName   string  `json:"food_name"`
-	Brand      string  `json:"brand"`
-	AmountG    float64 `json:"amount_g"`
-}
+var nutrientKeyRe = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
 
-type RecipeDetail struct {
-	ID           string                   `json:"id"`
-	UserID       string                   `json:"user_id"`
-	Name         string                   `json:"name"`
-	Instructions string                   `json:"instructions"`
-	YieldCount   int                      `json:"yield_count"`
-	CreatedAt    time.Time                `json:"created_at"`
-	Ingredients  []RecipeIngredientDetail `json:"ingredients"`
+// HandleUpsertNutrient adds or renames a nutrient definition, which is how
+// the tracked set is extended beyond the seeded ones.
+func (a *App) HandleUpsertNutrient(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	if !nutrientKeyRe.MatchString(key) {
+		writeJSON(w, 400, map[string]any{"error": "key must be lower_snake_case"})
+		return
+	}
+	var d NutrientDef
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	if d.Name == "" || d.Unit == "" {
+		writeJSON(w, 400, map[string]any{"error": "name and unit required"})
+		return
+	}
+	if d.SortOrder == 0 {
+		d.SortOrder = 100
+	}
+	d.Key = key
+	_, err := a.DB.Exec(r.Context(), `
+    INSERT INTO nutrients (key, name, unit, usda_nbr, sort_order)
+    VALUES ($1,$2,$3,NULLIF($4,''),$5)
+    ON CONFLICT (key) DO UPDATE SET
+      name = EXCLUDED.name, unit = EXCLUDED.unit,
+      usda_nbr = EXCLUDED.usda_nbr, sort_order = EXCLUDED.sort_order;
+  `, d.Key, d.Name, d.Unit, d.USDANbr, d.SortOrder)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("upsert nutrient: %v", err)})
+		return
+	}
+	writeJSON(w, 200, d)
 }
 
-type CreateRecipeRequest struct {
-	UserID             string  `json:"user_id"`
-	Name               string  `json:"name"`
-	Brand              string  `json:"brand"`
-	ServingLabel       string  `json:"serving_label"`
-	CaloriesPerServing float64 `json:"calories_per_serving"`
-	ProteinPerServing  float64 `json:"protein_g_per_serving"`
-	CarbsPerServing    float64 `json:"carbs_g_per_serving"`
-	FatPerServing      float64 `json:"fat_g_per_serving"`
-	FiberPerServing    float64 `json:"fiber_g_per_serving"`
-	Instructions       string  `json:"instructions"`
-	YieldCount         int     `json:"yield_count"`
+// ── Dashboard ─────────────────────────────────────────────────────────────────
+
+type DashboardResponse struct {
+	Date          string  `json:"date"`
+	UserID        string  `json:"user_id"`
+	CaloriesIn    float64 `json:"calories_in"`
+	ProteinG      float64 `json:"protein_g"`
+	CarbsG        float64 `json:"carbs_g"`
+	FatG          float64 `json:"fat_g"`
+	FiberG        float64 `json:"fiber_g"`
+	Steps         int     `json:"steps"`
+	ActiveKcalEst float64 `json:"active_calories_est"`
+	// ActiveSource is the source active calories came from besides workouts,
+	// empty if only workouts were logged.
+	ActiveSource string  `json:"active_source"`
+	Workouts     int     `json:"workouts"`
+	WorkoutMin   float64 `json:"workout_minutes"`
+	WorkoutKcal  float64 `json:"workout_calories"`
+	NetCalories  float64 `json:"net_calories"`
 }
 
-func (a *App) HandleListRecipes(w http.ResponseWriter, r *http.Request) {
+// HandleDashboardToday reports the day's intake, activity and workouts.
+// Workout calories reach active_calories_est through daily activity's
+// "workouts" source, so net_calories is intake minus active calories. When
+// active_source is a device, its figure already includes the workouts.
+func (a *App) HandleDashboardToday(w http.ResponseWriter, r *http.Request) {
 	userID := r.URL.Query().Get("user_id")
 	if userID == "" {
 		userID = "00000000-0000-0000-0000-000000000001"
 	}
-	rows, err := a.DB.Query(r.Context(), `
-    SELECT r.id, fi.name, COALESCE(fi.brand,''), fi.serving_label,
-           COALESCE(r.instructions,''), r.yield_count,
-           fi.calories_per_serving, fi.protein_g_per_serving, fi.carbs_g_per_serving, fi.fat_g_per_serving, fi.fiber_g_per_serving,
-           r.created_at, COUNT(rsi.id) AS ingredient_count
-    FROM recipes r
-    INNER JOIN food_items fi ON fi.id = r.id
-    LEFT JOIN recipe_shopping_items rsi ON rsi.recipe_id = r.id
-    WHERE r.user_id = $1
-    GROUP BY r.id, fi.id
-    ORDER BY fi.name ASC;
-  `, userID)
-	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("list recipes: %v", err)})
-		return
-	}
-	defer rows.Close()
-	out := []RecipeSummary{}
-	for rows.Next() {
-		var it RecipeSummary
-		if err := rows.Scan(&it.ID, &it.Name, &it.Brand, &it.ServingLabel,
-			&it.Instructions, &it.YieldCount,
-			&it.CaloriesPerServing, &it.ProteinPerServing, &it.CarbsPerServing, &it.FatPerServing, &it.FiberPerServing,
-			&it.CreatedAt, &it.IngredientCnt); err != nil {
-			writeJSON(w, 500, map[string]any{"error": "scan recipes"})
-			return
-		}
-		out = append(out, it)
+	dateStr := r.URL.Query().Get("date")
+	if dateStr == "" {
+		dateStr = a.now().Format("2006-01-02")
 	}
-	writeJSON(w, 200, out)
-}
 
-func (a *App) HandleCreateRecipe(w http.ResponseWriter, r *http.Request) {
-	var req CreateRecipeRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+	dayStart, err := time.ParseInLocation("2006-01-02", dateStr, a.Loc)
+	if err != nil {
+		writeJSON(w, 400, map[string]any{"error": "bad date"})
 		return
 	}
-	if req.UserID == "" {
-		req.UserID = DefaultUserID
+	dayEnd := dayStart.Add(24 * time.Hour)
+
+	ctx := r.Context()
+	var caloriesIn, protein, carbs, fat, fiber float64
+	q := `
+    SELECT COALESCE(SUM(le.servings * le.calories_per_serving),0),
+           COALESCE(SUM(le.servings * le.protein_g_per_serving),0),
+           COALESCE(SUM(le.servings * le.carbs_g_per_serving),0),
+           COALESCE(SUM(le.servings * le.fat_g_per_serving),0),
+           COALESCE(SUM(le.servings * le.fiber_g_per_serving),0)
+    FROM log_entries le
+    JOIN food_items fi ON fi.id = le.ref_id
+    WHERE le.user_id = $1 AND le.kind = 'food' AND le.occurred_at >= $2 AND le.occurred_at < $3;
+  `
+	if err := a.DB.QueryRow(ctx, q, userID, dayStart, dayEnd).Scan(&caloriesIn, &protein, &carbs, &fat, &fiber); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("dashboard query: %v", err)})
+		return
 	}
-	if req.Name == "" {
-		writeJSON(w, 400, map[string]any{"error": "name required"})
+
+	var steps int
+	var activeKcal float64
+	_ = a.DB.QueryRow(ctx, `SELECT COALESCE(steps,0), COALESCE(active_calories_kcal_est,0) FROM daily_activity WHERE user_id=$1 AND date=$2;`, userID, dateStr).
+		Scan(&steps, &activeKcal)
+
+	out := DashboardResponse{
+		Date: dateStr, UserID: userID,
+		CaloriesIn: caloriesIn, ProteinG: protein, CarbsG: carbs, FatG: fat, FiberG: fiber,
+		Steps: steps, ActiveKcalEst: activeKcal, NetCalories: caloriesIn - activeKcal,
+	}
+	err = a.DB.QueryRow(ctx, `
+    SELECT source FROM daily_activity_sources
+    WHERE user_id = $1 AND date = $2::date AND source <> 'workouts' AND active_calories_kcal_est IS NOT NULL
+    ORDER BY COALESCE(array_position($3::text[], source), 1000), source
+    LIMIT 1;
+  `, userID, dateStr, activitySourcePriority).Scan(&out.ActiveSource)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("activity source query: %v", err)})
+		return
+	}
+	err = a.DB.QueryRow(ctx, `
+    SELECT COUNT(*), COALESCE(SUM(duration_min), 0)::float8, COALESCE(SUM(calories_kcal), 0)::float8
+    FROM workouts
+    WHERE user_id = $1 AND started_at >= $2 AND started_at < $3;
+  `, userID, dayStart, dayEnd).Scan(&out.Workouts, &out.WorkoutMin, &out.WorkoutKcal)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("workouts query: %v", err)})
 		return
 	}
-	if req.YieldCount <= 0 {
-		req.YieldCount = 1
+	writeJSON(w, 200, out)
+}
+
+// ── Day Totals ────────────────────────────────────────────────────────────────
+
+type DayTotalsResponse struct {
+	Date       string  `json:"date"`
+	EntryCount int     `json:"entry_count"`
+	CaloriesIn float64 `json:"calories_in"`
+	ProteinG   float64 `json:"protein_g"`
+	CarbsG     float64 `json:"carbs_g"`
+	FatG       float64 `json:"fat_g"`
+	FiberG     float64 `json:"fiber_g"`
+
+	Nutrients map[string]float64 `json:"nutrients,omitempty"`
+}
+
+func (a *App) HandleDayTotals(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
 	}
-	if req.ServingLabel == "" {
-		req.ServingLabel = "1 serving"
+	dateStr := r.URL.Query().Get("date")
+	if dateStr == "" {
+		dateStr = a.now().Format("2006-01-02")
 	}
-	// Always create food_item + recipe together so they share an ID.
-	ctx := r.Context()
-	tx, err := a.DB.Begin(ctx)
+
+	dayStart, err := time.ParseInLocation("2006-01-02", dateStr, a.Loc)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": "tx begin"})
+		writeJSON(w, 400, map[string]any{"error": "bad date: use YYYY-MM-DD"})
 		return
 	}
-	defer func() { _ = tx.Rollback(ctx) }()
-	var id string
-	err = tx.QueryRow(ctx, `
-    INSERT INTO food_items (user_id, name, brand, serving_label, calories_per_serving, protein_g_per_serving, carbs_g_per_serving, fat_g_per_serving, fiber_g_per_serving, source)
-    VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,'custom') RETURNING id;
-  `, req.UserID, req.Name, req.Brand, req.ServingLabel, req.CaloriesPerServing, req.ProteinPerServing, req.CarbsPerServing, req.FatPerServing, req.FiberPerServing).Scan(&id)
+	dayEnd := dayStart.Add(24 * time.Hour)
+
+	var count int
+	var calories, protein, carbs, fat, fiber float64
+	err = a.DB.QueryRow(r.Context(), `
+    SELECT COUNT(*),
+           COALESCE(SUM(le.servings * le.calories_per_serving), 0),
+           COALESCE(SUM(le.servings * le.protein_g_per_serving), 0),
+           COALESCE(SUM(le.servings * le.carbs_g_per_serving), 0),
+           COALESCE(SUM(le.servings * le.fat_g_per_serving), 0),
+           COALESCE(SUM(le.servings * le.fiber_g_per_serving), 0)
+    FROM log_entries le
+    JOIN food_items fi ON fi.id = le.ref_id
+    WHERE le.user_id = $1 AND le.kind = 'food'
+      AND le.occurred_at >= $2 AND le.occurred_at < $3
+  `, userID, dayStart, dayEnd).Scan(&count, &calories, &protein, &carbs, &fat, &fiber)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("create food item: %v", err)})
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
 		return
 	}
-	_, err = tx.Exec(ctx, `
-    INSERT INTO recipes (id, user_id, name, instructions, yield_count)
-    VALUES ($1,$2,$3,$4,$5)
-    ON CONFLICT (id) DO UPDATE SET name=EXCLUDED.name, instructions=EXCLUDED.instructions, yield_count=EXCLUDED.yield_count;
-  `, id, req.UserID, req.Name, req.Instructions, req.YieldCount)
+
+	nutrients, err := a.dailyNutrientTotals(r.Context(), userID, dayStart, dayEnd)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("create recipe: %v", err)})
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("nutrients: %v", err)})
 		return
 	}
-	if err := tx.Commit(ctx); err != nil {
-		writeJSON(w, 500, map[string]any{"error": "tx commit"})
-		return
-	}
-	writeJSON(w, 201, map[string]any{"ok": true, "id": id})
+
+	writeJSON(w, 200, DayTotalsResponse{
+		Date: dateStr, EntryCount: count,
+		CaloriesIn: calories, ProteinG: protein, CarbsG: carbs, FatG: fat, FiberG: fiber,
+		Nutrients: nutrients[dateStr],
+	})
 }
 
-func (a *App) HandleGetRecipe(w http.ResponseWriter, r *http.Request) {
+// ── Log Food ──────────────────────────────────────────────────────────────────
+
+// ── Log Today ─────────────────────────────────────────────────────────────────
+
+type LogEntry struct {
+	ID           string  `json:"id"`
+	Meal         string  `json:"meal"`
+	FoodItemID   string  `json:"food_item_id"`
+	FoodName     string  `json:"food_name"`
+	ServingLabel string  `json:"serving_label"`
+	Servings     float64 `json:"servings"`
+	Calories     float64 `json:"calories"`
+	ProteinG     float64 `json:"protein_g"`
+	CarbsG       float64 `json:"carbs_g"`
+	FatG         float64 `json:"fat_g"`
+	FiberG       float64 `json:"fiber_g"`
+	OccurredAt   string  `json:"occurred_at"`
+	Note         string  `json:"note"`
+
+	Nutrients map[string]float64 `json:"nutrients,omitempty"`
+}
+
+func (a *App) HandleLogToday(w http.ResponseWriter, r *http.Request) {
 	userID := r.URL.Query().Get("user_id")
 	if userID == "" {
 		userID = "00000000-0000-0000-0000-000000000001"
 	}
-	id := chi.URLParam(r, "id")
-	if id == "" {
-		writeJSON(w, 400, map[string]any{"error": "missing recipe id"})
-		return
+	dateStr := r.URL.Query().Get("date")
+	if dateStr == "" {
+		dateStr = a.now().Format("2006-01-02")
 	}
-	var out RecipeDetail
-	err := a.DB.QueryRow(r.Context(), `
-    SELECT id, user_id::text, name, COALESCE(instructions,''), yield_count, created_at
-    FROM recipes
-    WHERE id = $1 AND user_id = $2;
-  `, id, userID).Scan(&out.ID, &out.UserID, &out.Name, &out.Instructions, &out.YieldCount, &out.CreatedAt)
+
+	dayStart, err := time.ParseInLocation("2006-01-02", dateStr, a.Loc)
 	if err != nil {
-		writeJSON(w, 404, map[string]any{"error": "recipe not found"})
+		writeJSON(w, 400, map[string]any{"error": "bad date"})
 		return
 	}
+	dayEnd := dayStart.Add(24 * time.Hour)
+
 	rows, err := a.DB.Query(r.Context(), `
-    SELECT ri.id, fi.id, fi.name, COALESCE(fi.brand,''), ri.amount_g
-    FROM recipe_ingredients ri
-    JOIN food_items fi ON fi.id = ri.food_item_id
-    WHERE ri.recipe_id = $1
-    ORDER BY fi.name;
-  `, id)
+    SELECT le.id, le.meal, le.ref_id, fi.name, fi.serving_label, le.servings,
+           le.servings * le.calories_per_serving,
+           le.servings * le.protein_g_per_serving,
+           le.servings * le.carbs_g_per_serving,
+           le.servings * le.fat_g_per_serving,
+           le.servings * le.fiber_g_per_serving,
+           le.occurred_at, le.nutrients_per_serving, COALESCE(le.note, '')
+    FROM log_entries le
+    JOIN food_items fi ON fi.id = le.ref_id
+    WHERE le.user_id = $1 AND le.kind = 'food' AND le.occurred_at >= $2 AND le.occurred_at < $3
+    ORDER BY le.occurred_at;
+  `, userID, dayStart, dayEnd)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("list ingredients: %v", err)})
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
 		return
 	}
 	defer rows.Close()
+
+	entries := []LogEntry{}
 	for rows.Next() {
-		var it RecipeIngredientDetail
-		if err := rows.Scan(&it.ID, &it.FoodItemID, &it.FoodName, &it.Brand, &it.AmountG); err != nil {
-			writeJSON(w, 500, map[string]any{"error": "scan ingredients"})
+		var e LogEntry
+		var ts time.Time
+		if err := rows.Scan(&e.ID, &e.Meal, &e.FoodItemID, &e.FoodName, &e.ServingLabel, &e.Servings,
+			&e.Calories, &e.ProteinG, &e.CarbsG, &e.FatG, &e.FiberG, &ts, &e.Nutrients, &e.Note); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "scan"})
 			return
 		}
-		out.Ingredients = append(out.Ingredients, it)
+		e.OccurredAt = ts.Format(time.RFC3339)
+		for key, perServing := range e.Nutrients {
+			e.Nutrients[key] = perServing * e.Servings
+		}
+		entries = append(entries, e)
 	}
-	writeJSON(w, 200, out)
-}
-
-type UpdateRecipeRequest struct {
-	UserID       string `json:"user_id"`
-	Name         string `json:"name"`
-	Instructions string `json:"instructions"`
-	YieldCount   int    `json:"yield_count"`
+	writeJSON(w, 200, entries)
 }
 
-func (a *App) HandleUpdateRecipe(w http.ResponseWriter, r *http.Request) {
+func (a *App) HandleDeleteLogEntry(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
-		writeJSON(w, 400, map[string]any{"error": "missing recipe id"})
+		writeJSON(w, 400, map[string]any{"error": "missing id"})
 		return
 	}
-	var req UpdateRecipeRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+	ct, err := a.DB.Exec(r.Context(), `DELETE FROM log_entries WHERE id = $1;`, id)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete: %v", err)})
 		return
 	}
-	if req.UserID == "" {
-		req.UserID = "00000000-0000-0000-0000-000000000001"
+	if ct.RowsAffected() == 0 {
+		writeJSON(w, 404, map[string]any{"error": "not found"})
+		return
 	}
-	if req.Name == "" {
-		writeJSON(w, 400, map[string]any{"error": "name required"})
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+// HandleLogRange returns the days in a date range that have food, activity
+// or weight logged, with their totals and goal flags (for the calendar
+// view). group=week|month|year rolls the days up into StatusBuckets instead,
+// e.g. for a year heatmap without one call per day.
+// Query params: user_id, from (YYYY-MM-DD), to (YYYY-MM-DD), group
+func (a *App) HandleLogRange(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = "00000000-0000-0000-0000-000000000001"
+	}
+	from, end, err := a.parseDateRange(r)
+	if err != nil {
+		writeJSON(w, 400, map[string]any{"error": err.Error()})
 		return
 	}
-	if req.YieldCount <= 0 {
-		req.YieldCount = 1
+	group := r.URL.Query().Get("group")
+	if group == "" {
+		group = "day"
 	}
-	ct, err := a.DB.Exec(r.Context(), `
-    UPDATE recipes
-    SET name = $1, instructions = $2, yield_count = $3
-    WHERE id = $4 AND user_id = $5;
-  `, req.Name, req.Instructions, req.YieldCount, id, req.UserID)
+	if group != "day" && group != "week" && group != "month" && group != "year" {
+		writeJSON(w, 400, map[string]any{"error": "group must be day, week, month or year"})
+		return
+	}
+	goals, err := a.loadGoals(r.Context(), userID)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("update recipe: %v", err)})
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("load goals: %v", err)})
 		return
 	}
-	if ct.RowsAffected() == 0 {
-		writeJSON(w, 404, map[string]any{"error": "recipe not found"})
+	days, err := a.dayStatuses(r.Context(), userID, from, end, goals)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
 		return
 	}
-	writeJSON(w, 200, map[string]any{"ok": true})
+	if group == "day" {
+		writeJSON(w, 200, days)
+		return
+	}
+	writeJSON(w, 200, groupDayStatuses(days, from, end, group))
 }
 
-type AddRecipeIngredientRequest struct {
+// ── Log Food ──────────────────────────────────────────────────────────────────
+
+type LogFoodRequest struct {
 	UserID     string  `json:"user_id"`
+	OccurredAt string  `json:"occurred_at"`
 	FoodItemID string  `json:"food_item_id"`
-	AmountG    float64 `json:"amount_g"`
+	Servings   float64 `json:"servings"`
+	Meal       string  `json:"meal"`
+	Note       string  `json:"note"`
 }
 
-func (a *App) HandleAddRecipeIngredient(w http.ResponseWriter, r *http.Request) {
-	recipeID := chi.URLParam(r, "id")
-	if recipeID == "" {
-		writeJSON(w, 400, map[string]any{"error": "missing recipe id"})
-		return
-	}
-	var req AddRecipeIngredientRequest
+func (a *App) HandleLogFood(w http.ResponseWriter, r *http.Request) {
+	var req LogFoodRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, 400, map[string]any{"error": "invalid json"})
 		return
 	}
-	if req.UserID == "" {
-		req.UserID = "00000000-0000-0000-0000-000000000001"
-	}
-	if req.FoodItemID == "" || req.AmountG <= 0 {
-		writeJSON(w, 400, map[string]any{"error": "food_item_id and amount_g required"})
+	t, err := a.prepareLogFood(&req)
+	if err != nil {
+		writeJSON(w, 400, map[string]any{"error": err.Error()})
 		return
 	}
-	var exists bool
-	if err := a.DB.QueryRow(r.Context(), `SELECT EXISTS(SELECT 1 FROM recipes WHERE id=$1 AND user_id=$2);`, recipeID, req.UserID).Scan(&exists); err != nil || !exists {
-		writeJSON(w, 404, map[string]any{"error": "recipe not found"})
+	id, err := insertFoodLog(r.Context(), a.DB, req, t)
+	if errors.Is(err, errFoodItemNotFound) {
+		writeJSON(w, 404, map[string]any{"error": err.Error()})
 		return
 	}
-	var id string
-	err := a.DB.QueryRow(r.Context(), `
-    INSERT INTO recipe_ingredients (recipe_id, food_item_id, amount_g)
-    VALUES ($1,$2,$3)
-    RETURNING id;
-  `, recipeID, req.FoodItemID, req.AmountG).Scan(&id)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("add ingredient: %v", err)})
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("insert: %v", err)})
 		return
 	}
 	writeJSON(w, 201, map[string]any{"ok": true, "id": id})
 }
 
-type UpdateRecipeIngredientRequest struct {
-	UserID  string  `json:"user_id"`
-	AmountG float64 `json:"amount_g"`
+// rowQuerier is satisfied by both *pgxpool.Pool and pgx.Tx.
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
 }
 
-func (a *App) HandleUpdateRecipeIngredient(w http.ResponseWriter, r *http.Request) {
-	recipeID := chi.URLParam(r, "id")
-	ingredientID := chi.URLParam(r, "ingredient_id")
-	if recipeID == "" || ingredientID == "" {
-		writeJSON(w, 400, map[string]any{"error": "missing ids"})
-		return
+// prepareLogFood fills defaults on req and validates it, returning the parsed occurred_at.
+func (a *App) prepareLogFood(req *LogFoodRequest) (time.Time, error) {
+	if req.UserID == "" {
+		req.UserID = DefaultUserID
 	}
-	var req UpdateRecipeIngredientRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, 400, map[string]any{"error": "invalid json"})
-		return
+	if req.OccurredAt == "" {
+		req.OccurredAt = a.now().Format(time.RFC3339)
 	}
-	if req.UserID == "" {
-		req.UserID = "00000000-0000-0000-0000-000000000001"
+	if req.Meal == "" {
+		req.Meal = "breakfast"
 	}
-	if req.AmountG <= 0 {
-		writeJSON(w, 400, map[string]any{"error": "amount_g required"})
-		return
+	if req.FoodItemID == "" || req.Servings <= 0 {
+		return time.Time{}, errors.New("food_item_id and servings required")
 	}
-	ct, err := a.DB.Exec(r.Context(), `
-    UPDATE recipe_ingredients ri
-    SET amount_g = $1
-    FROM recipes r
-    WHERE ri.id = $2
-      AND ri.recipe_id = $3
-      AND r.id = ri.recipe_id
-      AND r.user_id = $4;
-  `, req.AmountG, ingredientID, recipeID, req.UserID)
+	t, err := time.Parse(time.RFC3339, req.OccurredAt)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("update ingredient: %v", err)})
-		return
+		return time.Time{}, errors.New("occurred_at must be RFC3339")
 	}
-	if ct.RowsAffected() == 0 {
-		writeJSON(w, 404, map[string]any{"error": "ingredient not found"})
-		return
+	return t, nil
+}
+
+var errFoodItemNotFound = errors.New("food item not found")
+
+// logSnapshotSet copies a food item's current per-serving macros and
+// nutrients onto a log entry (aliased le, joined to food_items fi). Totals
+// read these snapshot columns, so editing a food later doesn't rewrite past
+// days until history is explicitly recalculated.
+const logSnapshotSet = `
+    calories_per_serving = fi.calories_per_serving,
+    protein_g_per_serving = fi.protein_g_per_serving,
+    carbs_g_per_serving = fi.carbs_g_per_serving,
+    fat_g_per_serving = fi.fat_g_per_serving,
+    fiber_g_per_serving = fi.fiber_g_per_serving,
+    nutrients_per_serving = (
+      SELECT jsonb_object_agg(fin.nutrient_key, fin.amount_per_serving)
+      FROM food_item_nutrients fin WHERE fin.food_item_id = fi.id
+    )`
+
+// insertFoodLog is the single insert path for food log entries. It snapshots
+// the food's macros at log time.
+func insertFoodLog(ctx context.Context, q rowQuerier, req LogFoodRequest, occurredAt time.Time) (string, error) {
+	var id string
+	err := q.QueryRow(ctx, `
+    INSERT INTO log_entries (user_id, occurred_at, kind, ref_id, servings, meal, note,
+                             calories_per_serving, protein_g_per_serving, carbs_g_per_serving, fat_g_per_serving, fiber_g_per_serving,
+                             nutrients_per_serving)
+    SELECT $1, $2, 'food', fi.id, $4, $5, $6,
+           fi.calories_per_serving, fi.protein_g_per_serving, fi.carbs_g_per_serving, fi.fat_g_per_serving, fi.fiber_g_per_serving,
+           (SELECT jsonb_object_agg(fin.nutrient_key, fin.amount_per_serving) FROM food_item_nutrients fin WHERE fin.food_item_id = fi.id)
+    FROM food_items fi
+    WHERE fi.id = $3
+    RETURNING id;
+  `, req.UserID, occurredAt, req.FoodItemID, req.Servings, req.Meal, req.Note).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("%w: %s", errFoodItemNotFound, req.FoodItemID)
 	}
-	writeJSON(w, 200, map[string]any{"ok": true})
+	return id, err
 }
 
-type ReplaceRecipeIngredientsRequest struct {
-	UserID      string `json:"user_id"`
-	Ingredients []struct {
-		FoodItemID string  `json:"food_item_id"`
-		AmountG    float64 `json:"amount_g"`
-	} `json:"ingredients"`
+type RecalculateLogRequest struct {
+	UserID     string `json:"user_id"`
+	FoodItemID string `json:"food_item_id"`
+	From       string `json:"from"`
+	To         string `json:"to"`
 }
 
-func (a *App) HandleReplaceRecipeIngredients(w http.ResponseWriter, r *http.Request) {
-	recipeID := chi.URLParam(r, "id")
-	if recipeID == "" {
-		writeJSON(w, 400, map[string]any{"error": "missing recipe id"})
-		return
-	}
-	var req ReplaceRecipeIngredientsRequest
+// HandleRecalculateLog re-snapshots log entries from their food items'
+// current values. It is the explicit way to let a label correction flow back
+// into history; scope it with food_item_id and/or an inclusive from/to range.
+func (a *App) HandleRecalculateLog(w http.ResponseWriter, r *http.Request) {
+	var req RecalculateLogRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, 400, map[string]any{"error": "invalid json"})
 		return
@@ -1307,452 +2061,627 @@ func (a *App) HandleReplaceRecipeIngredients(w http.ResponseWriter, r *http.Requ
 	if req.UserID == "" {
 		req.UserID = DefaultUserID
 	}
-	ctx := r.Context()
-	tx, err := a.DB.Begin(ctx)
-	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": "tx begin"})
-		return
-	}
-	defer func() { _ = tx.Rollback(ctx) }()
-	var exists bool
-	if err := tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM recipes WHERE id=$1 AND user_id=$2);`, recipeID, req.UserID).Scan(&exists); err != nil || !exists {
-		writeJSON(w, 404, map[string]any{"error": "recipe not found"})
-		return
-	}
-	if _, err := tx.Exec(ctx, `DELETE FROM recipe_ingredients WHERE recipe_id = $1;`, recipeID); err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("clear ingredients: %v", err)})
-		return
+	where := []string{"le.user_id = $1"}
+	args := []any{req.UserID}
+	if req.FoodItemID != "" {
+		args = append(args, req.FoodItemID)
+		where = append(where, fmt.Sprintf("le.ref_id = $%d", len(args)))
 	}
-	inserted := 0
-	for _, it := range req.Ingredients {
-		if it.FoodItemID == "" || it.AmountG <= 0 {
-			continue
+	if req.From != "" {
+		from, err := time.ParseInLocation("2006-01-02", req.From, a.Loc)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": "bad from date"})
+			return
 		}
-		if _, err := tx.Exec(ctx, `
-      INSERT INTO recipe_ingredients (recipe_id, food_item_id, amount_g)
-      VALUES ($1,$2,$3);
-    `, recipeID, it.FoodItemID, it.AmountG); err != nil {
-			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("replace ingredient: %v", err)})
+		args = append(args, from)
+		where = append(where, fmt.Sprintf("le.occurred_at >= $%d", len(args)))
+	}
+	if req.To != "" {
+		to, err := time.ParseInLocation("2006-01-02", req.To, a.Loc)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": "bad to date"})
 			return
 		}
-		inserted++
+		args = append(args, to.AddDate(0, 0, 1))
+		where = append(where, fmt.Sprintf("le.occurred_at < $%d", len(args)))
 	}
-	if err := tx.Commit(ctx); err != nil {
-		writeJSON(w, 500, map[string]any{"error": "tx commit"})
+	ct, err := a.DB.Exec(r.Context(), `
+    UPDATE log_entries le SET`+logSnapshotSet+`
+    FROM food_items fi
+    WHERE fi.id = le.ref_id AND le.kind = 'food' AND `+strings.Join(where, " AND "), args...)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("recalculate: %v", err)})
 		return
 	}
-	writeJSON(w, 200, map[string]any{"ok": true, "ingredient_count": inserted})
+	writeJSON(w, 200, map[string]any{"ok": true, "updated": ct.RowsAffected()})
 }
 
-func (a *App) HandleDeleteRecipeIngredient(w http.ResponseWriter, r *http.Request) {
-	recipeID := chi.URLParam(r, "id")
-	ingredientID := chi.URLParam(r, "ingredient_id")
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		userID = "00000000-0000-0000-0000-000000000001"
-	}
-	if recipeID == "" || ingredientID == "" {
-		writeJSON(w, 400, map[string]any{"error": "missing ids"})
-		return
-	}
-	ct, err := a.DB.Exec(r.Context(), `
-    DELETE FROM recipe_ingredients ri
-    USING recipes r
-    WHERE ri.id = $1 AND ri.recipe_id = $2 AND r.id = ri.recipe_id AND r.user_id = $3;
-  `, ingredientID, recipeID, userID)
-	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete ingredient: %v", err)})
-		return
+// ── Natural-language Log Parsing ─────────────────────────────────────────────
+
+type unitDef struct {
+	Canonical string
+	Dimension string // mass | volume | count | serving
+	ToBase    float64
+}
+
+// foodUnits maps spellings to canonical units. Mass converts to grams and volume to millilitres.
+var foodUnits = map[string]unitDef{}
+
+func init() {
+	add := func(def unitDef, aliases ...string) {
+		for _, a := range aliases {
+			foodUnits[a] = def
+		}
 	}
-	if ct.RowsAffected() == 0 {
-		writeJSON(w, 404, map[string]any{"error": "ingredient not found"})
-		return
+	add(unitDef{"mg", "mass", 0.001}, "mg", "milligram", "milligrams")
+	add(unitDef{"g", "mass", 1}, "g", "gr", "gram", "grams", "gramme", "grammes")
+	add(unitDef{"kg", "mass", 1000}, "kg", "kgs", "kilo", "kilos", "kilogram", "kilograms")
+	add(unitDef{"oz", "mass", 28.3495}, "oz", "ounce", "ounces")
+	add(unitDef{"lb", "mass", 453.592}, "lb", "lbs", "pound", "pounds")
+	add(unitDef{"ml", "volume", 1}, "ml", "milliliter", "milliliters", "millilitre", "millilitres")
+	add(unitDef{"l", "volume", 1000}, "l", "liter", "liters", "litre", "litres")
+	add(unitDef{"tsp", "volume", 4.929}, "tsp", "tsps", "teaspoon", "teaspoons")
+	add(unitDef{"tbsp", "volume", 14.787}, "tbsp", "tbsps", "tbs", "tablespoon", "tablespoons")
+	add(unitDef{"fl oz", "volume", 29.574}, "floz")
+	add(unitDef{"cup", "volume", 240}, "cup", "cups")
+	add(unitDef{"pint", "volume", 473.176}, "pint", "pints")
+	add(unitDef{"quart", "volume", 946.353}, "quart", "quarts", "qt", "qts")
+	add(unitDef{"gallon", "volume", 3785.41}, "gallon", "gallons", "gal")
+	add(unitDef{"serving", "serving", 1}, "serving", "servings", "srv", "portion", "portions", "x")
+	for _, c := range []string{"slice", "piece", "scoop", "can", "bottle", "glass", "bar", "clove", "handful", "pinch", "stick", "bowl", "plate", "packet", "pack", "dash", "sprig", "bunch", "head", "stalk", "jar", "fillet", "sheet"} {
+		plural := c + "s"
+		if strings.HasSuffix(c, "s") || strings.HasSuffix(c, "ch") || strings.HasSuffix(c, "sh") {
+			plural = c + "es"
+		}
+		add(unitDef{c, "count", 1}, c, plural)
 	}
-	writeJSON(w, 200, map[string]any{"ok": true})
+	add(unitDef{"piece", "count", 1}, "pc", "pcs")
+	add(unitDef{"leaf", "count", 1}, "leaf", "leaves")
 }
 
-type ExportIngredientsRequest struct {
-	UserID    string   `json:"user_id"`
-	RecipeIDs []string `json:"recipe_ids"`
+var unicodeFractions = map[rune]string{
+	'½': "1/2", '⅓': "1/3", '⅔': "2/3", '¼': "1/4", '¾': "3/4",
+	'⅕': "1/5", '⅖': "2/5", '⅗': "3/5", '⅘': "4/5", '⅙': "1/6", '⅚': "5/6",
+	'⅛': "1/8", '⅜': "3/8", '⅝': "5/8", '⅞': "7/8",
 }
 
-type CombinedIngredient struct {
-	FoodItemID string  `json:"food_item_id"`
-	Name       string  `json:"name"`
-	Brand      string  `json:"brand"`
-	TotalG     float64 `json:"total_g"`
+var numberWords = map[string]float64{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+	"seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12,
+	"half": 0.5, "quarter": 0.25, "couple": 2, "few": 3, "dozen": 12,
 }
 
-func (a *App) HandleExportRecipeIngredients(w http.ResponseWriter, r *http.Request) {
-	var req ExportIngredientsRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, 400, map[string]any{"error": "invalid json"})
-		return
+// expandFractions turns "1½" into "1 1/2" so the amount parser only deals with ASCII.
+func expandFractions(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if f, ok := unicodeFractions[r]; ok {
+			sb.WriteString(" " + f + " ")
+			continue
+		}
+		if r == '⁄' { // fraction slash
+			r = '/'
+		}
+		sb.WriteRune(r)
 	}
-	if req.UserID == "" {
-		req.UserID = "00000000-0000-0000-0000-000000000001"
+	return sb.String()
+}
+
+var (
+	numberRe        = regexp.MustCompile(`^\d+(?:\.\d+)?$`)
+	fractionRe      = regexp.MustCompile(`^(\d+)/(\d+)$`)
+	numberUnitRe    = regexp.MustCompile(`^(\d+(?:\.\d+)?)([a-z]+)$`)
+	parentheticalRe = regexp.MustCompile(`\(([^)]*)\)`)
+)
+
+// parseNumberToken reads "2", "2.5" or "1/2".
+func parseNumberToken(tok string) (float64, bool) {
+	if numberRe.MatchString(tok) {
+		v, err := strconv.ParseFloat(tok, 64)
+		return v, err == nil
+	}
+	if m := fractionRe.FindStringSubmatch(tok); m != nil {
+		n, _ := strconv.ParseFloat(m[1], 64)
+		d, _ := strconv.ParseFloat(m[2], 64)
+		if d == 0 {
+			return 0, false
+		}
+		return n / d, true
 	}
-	if len(req.RecipeIDs) == 0 {
-		writeJSON(w, 400, map[string]any{"error": "recipe_ids required"})
-		return
+	return 0, false
+}
+
+type ParsedQuantity struct {
+	Amount float64 `json:"amount"` // 0 means unspecified
+	Unit   string  `json:"unit"`   // canonical unit, "" for a plain count
+}
+
+// parseLeadingAmount consumes an amount (digits, mixed fractions, or number
+// words) and an optional unit from the front of words.
+func parseLeadingAmount(words []string) (ParsedQuantity, int) {
+	var q ParsedQuantity
+	i := 0
+	if len(words) == 0 {
+		return q, 0
+	}
+	if m := numberUnitRe.FindStringSubmatch(words[0]); m != nil {
+		if u, ok := foodUnits[m[2]]; ok {
+			q.Amount, _ = strconv.ParseFloat(m[1], 64)
+			q.Unit = u.Canonical
+			return q, 1
+		}
 	}
-	rows, err := a.DB.Query(r.Context(), `
-    SELECT fi.id, fi.name, COALESCE(fi.brand,''), SUM(ri.amount_g)::float8 AS total_g
-    FROM recipe_ingredients ri
-    JOIN recipes r ON r.id = ri.recipe_id
-    JOIN food_items fi ON fi.id = ri.food_item_id
-    WHERE r.user_id = $1 AND r.id = ANY($2::uuid[])
-    GROUP BY fi.id, fi.name, fi.brand
-    ORDER BY fi.name;
-  `, req.UserID, req.RecipeIDs)
-	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export ingredients: %v", err)})
-		return
+	if v, ok := parseNumberToken(words[0]); ok {
+		q.Amount = v
+		i = 1
+		if i < len(words) && v == math.Trunc(v) && fractionRe.MatchString(words[i]) {
+			f, _ := parseNumberToken(words[i])
+			q.Amount += f
+			i++
+		}
+	} else if v, ok := numberWords[words[0]]; ok {
+		q.Amount = v
+		i = 1
+		// "a couple of", "half a", "a dozen"
+		for i < len(words) {
+			if nv, ok := numberWords[words[i]]; ok && words[i] != "a" && words[i] != "an" {
+				if words[i-1] == "a" || words[i-1] == "an" {
+					q.Amount = nv
+				} else {
+					q.Amount *= nv
+				}
+				i++
+				continue
+			}
+			if (words[i] == "a" || words[i] == "an") && q.Amount == 0.5 {
+				i++
+				continue
+			}
+			break
+		}
+		// "a couple of slices": the unit follows "of".
+		if i+1 < len(words) && words[i] == "of" {
+			if _, ok := foodUnits[words[i+1]]; ok {
+				i++
+			}
+		}
+	} else {
+		return q, 0
 	}
-	defer rows.Close()
-	out := []CombinedIngredient{}
-	for rows.Next() {
-		var it CombinedIngredient
-		if err := rows.Scan(&it.FoodItemID, &it.Name, &it.Brand, &it.TotalG); err != nil {
-			writeJSON(w, 500, map[string]any{"error": "scan combined ingredients"})
-			return
+	if i < len(words) {
+		if u, ok := foodUnits[words[i]]; ok && !(u.Canonical == "serving" && words[i] == "x" && i+1 >= len(words)) {
+			q.Unit = u.Canonical
+			i++
 		}
-		out = append(out, it)
 	}
-	writeJSON(w, 200, map[string]any{
-		"ok":          true,
-		"ingredients": out,
-	})
+	if i < len(words) && words[i] == "of" {
+		i++
+	}
+	return q, i
 }
 
-// ── Data Export / Import ─────────────────────────────────────────────────────
+// parseFoodPhrase splits "1 1/2 cups rice", "chicken breast 6oz" or "2 eggs"
+// into a food name and quantity.
+func parseFoodPhrase(text string) (string, ParsedQuantity) {
+	text = strings.ToLower(expandFractions(text))
+	text = parentheticalRe.ReplaceAllString(text, " ")
+	words := strings.Fields(strings.NewReplacer(",", " ", ";", " ").Replace(text))
+	for len(words) > 0 && (words[0] == "some" || words[0] == "the" || words[0] == "my") {
+		words = words[1:]
+	}
+	q, n := parseLeadingAmount(words)
+	words = words[n:]
+	if n == 0 && len(words) > 1 {
+		// Trailing quantity: "chicken breast 6oz", "rice 150 g", "eggs x2"
+		last := words[len(words)-1]
+		if m := numberUnitRe.FindStringSubmatch(last); m != nil {
+			if u, ok := foodUnits[m[2]]; ok {
+				q.Amount, _ = strconv.ParseFloat(m[1], 64)
+				q.Unit = u.Canonical
+				words = words[:len(words)-1]
+			}
+		} else if strings.HasPrefix(last, "x") && numberRe.MatchString(last[1:]) {
+			q.Amount, _ = strconv.ParseFloat(last[1:], 64)
+			q.Unit = "serving"
+			words = words[:len(words)-1]
+		} else if u, ok := foodUnits[last]; ok && len(words) > 2 {
+			if v, ok := parseNumberToken(words[len(words)-2]); ok {
+				q.Amount, q.Unit = v, u.Canonical
+				words = words[:len(words)-2]
+			}
+		} else if v, ok := parseNumberToken(last); ok {
+			q.Amount = v
+			words = words[:len(words)-1]
+		}
+	}
+	return strings.Join(words, " "), q
+}
 
-type ExportFoodItem struct {
-	ID                 string    `json:"id"`
-	UserID             string    `json:"user_id,omitempty"`
-	Name               string    `json:"name"`
-	Brand              string    `json:"brand"`
-	ServingLabel       string    `json:"serving_label"`
-	Source             string    `json:"source"`
-	CaloriesPerServing float64   `json:"calories_per_serving"`
-	ProteinPerServing  float64   `json:"protein_g_per_serving"`
-	CarbsPerServing    float64   `json:"carbs_g_per_serving"`
-	FatPerServing      float64   `json:"fat_g_per_serving"`
-	FiberPerServing    float64   `json:"fiber_g_per_serving"`
-	CreatedAt          time.Time `json:"created_at"`
+// servingsFor converts q into servings of a food whose serving is described by
+// servingLabel (e.g. "100 g", "1 cup (185 g)", "2 slices"). A non-empty
+// warning means the units could not be reconciled and one serving was assumed.
+func servingsFor(q ParsedQuantity, servingLabel string) (float64, string) {
+	if q.Amount <= 0 {
+		return 1, ""
+	}
+	u, known := foodUnits[q.Unit]
+	if q.Unit == "" || !known || u.Dimension == "serving" {
+		return q.Amount, ""
+	}
+	labels := []string{servingLabel}
+	for _, m := range parentheticalRe.FindAllStringSubmatch(servingLabel, -1) {
+		labels = append(labels, m[1])
+	}
+	for _, l := range labels {
+		_, lq := parseFoodPhrase(l)
+		lu, ok := foodUnits[lq.Unit]
+		if !ok || lq.Amount <= 0 || lu.Dimension != u.Dimension {
+			continue
+		}
+		if u.Dimension == "count" && lu.Canonical != u.Canonical {
+			continue
+		}
+		return math.Round(q.Amount*u.ToBase/(lq.Amount*lu.ToBase)*100) / 100, ""
+	}
+	if u.Dimension == "count" {
+		return q.Amount, ""
+	}
+	return 1, fmt.Sprintf("can't convert %s %s to servings of %q; assumed 1 serving", strconv.FormatFloat(q.Amount, 'f', -1, 64), q.Unit, servingLabel)
 }
 
-type ExportRecipe struct {
-	ID           string    `json:"id"`
-	UserID       string    `json:"user_id"`
-	Name         string    `json:"name"`
-	Instructions string    `json:"instructions"`
-	YieldCount   int       `json:"yield_count"`
-	CreatedAt    time.Time `json:"created_at"`
+var (
+	mealPhraseRe = regexp.MustCompile(`(?i)\b(?:for|at|during|as)\s+(?:my\s+|a\s+)?(breakfast|brunch|lunch|dinner|supper|snacks?)\b`)
+	mealPrefixRe = regexp.MustCompile(`(?i)^\s*(breakfast|brunch|lunch|dinner|supper|snacks?)\s*[:\-–]\s*`)
+	strongSepRe  = regexp.MustCompile(`\s*(?:[,;\n+]|\bthen\b)\s*`)
+	weakSepRe    = regexp.MustCompile(`(?i)\s+(?:and|with|plus|&)\s+`)
+)
+
+func canonicalMeal(word string) string {
+	switch strings.ToLower(word) {
+	case "breakfast", "brunch":
+		return "breakfast"
+	case "lunch":
+		return "lunch"
+	case "dinner", "supper":
+		return "dinner"
+	default:
+		return "snack_1"
+	}
 }
 
-type ExportRecipeIngredient struct {
-	ID         string    `json:"id"`
-	RecipeID   string    `json:"recipe_id"`
-	FoodItemID string    `json:"food_item_id"`
-	AmountG    float64   `json:"amount_g"`
-	CreatedAt  time.Time `json:"created_at"`
+// mealForTime picks the meal slot the web log would most likely use at t.
+func mealForTime(t time.Time) string {
+	switch h := t.Hour(); {
+	case h >= 4 && h < 11:
+		return "breakfast"
+	case h >= 11 && h < 15:
+		return "lunch"
+	case h >= 17 && h < 22:
+		return "dinner"
+	default:
+		return "snack_1"
+	}
 }
 
-type ExportRecipePortion struct {
-	ID           string    `json:"id"`
-	RecipeID     string    `json:"recipe_id"`
-	Name         string    `json:"name"`
-	PortionCount float64   `json:"portion_count"`
-	CreatedAt    time.Time `json:"created_at"`
+// extractMeal removes a meal phrase ("for breakfast", "lunch:") from text.
+func extractMeal(text string) (string, string) {
+	if m := mealPrefixRe.FindStringSubmatch(text); m != nil {
+		return strings.TrimSpace(text[len(m[0]):]), canonicalMeal(m[1])
+	}
+	if loc := mealPhraseRe.FindStringSubmatchIndex(text); loc != nil {
+		meal := canonicalMeal(text[loc[2]:loc[3]])
+		return strings.TrimSpace(text[:loc[0]] + " " + text[loc[1]:]), meal
+	}
+	return text, ""
 }
 
-type ExportPreset struct {
-	ID        string    `json:"id"`
-	UserID    string    `json:"user_id"`
-	Name      string    `json:"name"`
-	Pinned    bool      `json:"pinned"`
-	CreatedAt time.Time `json:"created_at"`
+func singularize(w string) string {
+	switch {
+	case len(w) > 4 && strings.HasSuffix(w, "ies"):
+		return w[:len(w)-3] + "y"
+	case len(w) > 4 && (strings.HasSuffix(w, "oes") || strings.HasSuffix(w, "ches") || strings.HasSuffix(w, "shes")):
+		return w[:len(w)-2]
+	case len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss"):
+		return w[:len(w)-1]
+	}
+	return w
 }
 
-type ExportPresetItem struct {
-	ID        string    `json:"id"`
-	PresetID  string    `json:"preset_id"`
-	Kind      string    `json:"kind"`
-	RefID     string    `json:"ref_id"`
-	Servings  float64   `json:"servings"`
-	CreatedAt time.Time `json:"created_at"`
+func matchTokens(s string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+	for i, f := range fields {
+		fields[i] = singularize(f)
+	}
+	return fields
 }
 
-type ExportLogEntry struct {
-	ID         string    `json:"id"`
-	UserID     string    `json:"user_id"`
-	OccurredAt time.Time `json:"occurred_at"`
-	Kind       string    `json:"kind"`
-	RefID      string    `json:"ref_id"`
-	Servings   float64   `json:"servings"`
-	Meal       string    `json:"meal"`
-	Note       string    `json:"note"`
-	CreatedAt  time.Time `json:"created_at"`
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
 }
 
-type ExportBodyWeight struct {
-	ID         string    `json:"id"`
-	UserID     string    `json:"user_id"`
-	MeasuredAt time.Time `json:"measured_at"`
-	WeightKg   float64   `json:"weight_kg"`
-	Source     string    `json:"source"`
-	Note       string    `json:"note"`
-	CreatedAt  time.Time `json:"created_at"`
+func tokenSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	if len(a) >= 3 && len(b) >= 3 && (strings.HasPrefix(a, b) || strings.HasPrefix(b, a)) {
+		return 0.85
+	}
+	longest := max(len([]rune(a)), len([]rune(b)))
+	if longest < 4 {
+		return 0
+	}
+	ratio := 1 - float64(levenshtein(a, b))/float64(longest)
+	if ratio < 0.75 {
+		return 0
+	}
+	return ratio * 0.9
 }
 
-type ExportDailyActivity struct {
-	UserID        string    `json:"user_id"`
-	Date          string    `json:"date"`
-	Steps         int       `json:"steps"`
-	ActiveKcalEst float64   `json:"active_calories_kcal_est"`
-	WaterGlasses  int       `json:"water_glasses"`
-	Source        string    `json:"source"`
-	CreatedAt     time.Time `json:"created_at"`
+// foodMatchScore rates how well query names a food, from 0 (no match) to 1
+// (exact). It tolerates plurals and small typos and prefers concise names.
+func foodMatchScore(query, name, brand string) float64 {
+	qt := matchTokens(query)
+	nt := matchTokens(name)
+	if len(qt) == 0 || len(nt) == 0 {
+		return 0
+	}
+	if strings.Join(qt, " ") == strings.Join(nt, " ") {
+		return 1
+	}
+	all := append(append([]string{}, nt...), matchTokens(brand)...)
+	used := make([]bool, len(nt))
+	var recall float64
+	for _, q := range qt {
+		best, bestIdx := 0.0, -1
+		for j, t := range all {
+			if s := tokenSimilarity(q, t); s > best {
+				best, bestIdx = s, j
+			}
+		}
+		recall += best
+		if bestIdx >= 0 && bestIdx < len(nt) {
+			used[bestIdx] = true
+		}
+	}
+	recall /= float64(len(qt))
+	if recall == 0 {
+		return 0
+	}
+	matched := 0
+	for _, u := range used {
+		if u {
+			matched++
+		}
+	}
+	precision := float64(matched) / float64(len(nt))
+	return math.Round((0.75*recall+0.25*precision)*0.99*1000) / 1000
 }
 
-type ExportBundle struct {
-	Version           int                      `json:"version"`
-	ExportedAt        time.Time                `json:"exported_at"`
-	UserID            string                   `json:"user_id"`
-	FoodItems         []ExportFoodItem         `json:"food_items"`
-	Recipes           []ExportRecipe           `json:"recipes"`
-	RecipeIngredients []ExportRecipeIngredient `json:"recipe_ingredients"`
-	RecipePortions    []ExportRecipePortion    `json:"recipe_portions"`
-	Presets           []ExportPreset           `json:"presets"`
-	PresetItems       []ExportPresetItem       `json:"preset_items"`
-	LogEntries        []ExportLogEntry         `json:"log_entries"`
-	BodyWeights       []ExportBodyWeight       `json:"body_weights"`
-	DailyActivity     []ExportDailyActivity    `json:"daily_activity"`
+// minFoodMatchScore is the lowest score reported as a candidate match.
+const minFoodMatchScore = 0.45
+
+type ParsedLogMatch struct {
+	FoodItemID   string  `json:"food_item_id"`
+	Name         string  `json:"name"`
+	Brand        string  `json:"brand"`
+	ServingLabel string  `json:"serving_label"`
+	Score        float64 `json:"score"`
+	Servings     float64 `json:"servings"`
+	Calories     float64 `json:"calories"`
+	ProteinG     float64 `json:"protein_g"`
+	CarbsG       float64 `json:"carbs_g"`
+	FatG         float64 `json:"fat_g"`
+	FiberG       float64 `json:"fiber_g"`
+	Warning      string  `json:"warning,omitempty"`
 }
 
-func (a *App) HandleExportData(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		userID = "00000000-0000-0000-0000-000000000001"
-	}
-	reqID := middleware.GetReqID(r.Context())
-	log.Printf("[api-debug] req_id=%s export start user_id=%s", reqID, userID)
-	ctx := r.Context()
-	out := ExportBundle{
-		Version:    1,
-		ExportedAt: time.Now().UTC(),
-		UserID:     userID,
-	}
+type ParsedLogItem struct {
+	Text       string           `json:"text"`
+	Name       string           `json:"name"`
+	Quantity   ParsedQuantity   `json:"quantity"`
+	Meal       string           `json:"meal"`
+	FoodItemID string           `json:"food_item_id"` // best match; empty when nothing matched
+	Servings   float64          `json:"servings"`
+	Matches    []ParsedLogMatch `json:"matches"`
+}
 
-	foodRows, err := a.DB.Query(ctx, `
-    SELECT id, COALESCE(user_id::text, ''), name, COALESCE(brand,''), serving_label, source,
-           calories_per_serving, protein_g_per_serving, carbs_g_per_serving, fat_g_per_serving, fiber_g_per_serving, created_at
-    FROM food_items
-    ORDER BY created_at, id;
-  `)
-	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export food_items: %v", err)})
-		return
-	}
-	defer foodRows.Close()
-	for foodRows.Next() {
-		var it ExportFoodItem
-		if err := foodRows.Scan(
-			&it.ID, &it.UserID, &it.Name, &it.Brand, &it.ServingLabel, &it.Source,
-			&it.CaloriesPerServing, &it.ProteinPerServing, &it.CarbsPerServing, &it.FatPerServing, &it.FiberPerServing, &it.CreatedAt,
-		); err != nil {
-			writeJSON(w, 500, map[string]any{"error": "export food_items scan"})
-			return
-		}
-		out.FoodItems = append(out.FoodItems, it)
-	}
+type ParseLogRequest struct {
+	UserID     string `json:"user_id"`
+	Text       string `json:"text"`
+	Meal       string `json:"meal"`
+	OccurredAt string `json:"occurred_at"`
+}
 
-	recipeRows, err := a.DB.Query(ctx, `
-    SELECT id, user_id::text, name, COALESCE(instructions,''), yield_count, created_at
-    FROM recipes
-    WHERE user_id = $1
-    ORDER BY created_at, id;
-  `, userID)
-	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export recipes: %v", err)})
-		return
+type ParseLogResponse struct {
+	Text       string          `json:"text"`
+	Meal       string          `json:"meal"`
+	OccurredAt string          `json:"occurred_at"`
+	Items      []ParsedLogItem `json:"items"`
+}
+
+func rankFoodMatches(query string, q ParsedQuantity, foods []FoodItem, limit int) []ParsedLogMatch {
+	out := []ParsedLogMatch{}
+	for _, fi := range foods {
+		score := foodMatchScore(query, fi.Name, fi.Brand)
+		if score < minFoodMatchScore {
+			continue
+		}
+		servings, warning := servingsFor(q, fi.ServingLabel)
+		out = append(out, ParsedLogMatch{
+			FoodItemID: fi.ID, Name: fi.Name, Brand: fi.Brand, ServingLabel: fi.ServingLabel,
+			Score: score, Servings: servings, Warning: warning,
+			Calories: servings * fi.CaloriesPerServing, ProteinG: servings * fi.ProteinPerServing,
+			CarbsG: servings * fi.CarbsPerServing, FatG: servings * fi.FatPerServing, FiberG: servings * fi.FiberPerServing,
+		})
 	}
-	defer recipeRows.Close()
-	for recipeRows.Next() {
-		var it ExportRecipe
-		if err := recipeRows.Scan(&it.ID, &it.UserID, &it.Name, &it.Instructions, &it.YieldCount, &it.CreatedAt); err != nil {
-			writeJSON(w, 500, map[string]any{"error": "export recipes scan"})
-			return
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
 		}
-		out.Recipes = append(out.Recipes, it)
+		return len(out[i].Name) < len(out[j].Name)
+	})
+	if len(out) > limit {
+		out = out[:limit]
 	}
+	return out
+}
 
-	ingredientRows, err := a.DB.Query(ctx, `
-    SELECT ri.id, ri.recipe_id::text, ri.food_item_id::text, ri.amount_g, ri.created_at
-    FROM recipe_ingredients ri
-    JOIN recipes r ON r.id = ri.recipe_id
-    WHERE r.user_id = $1
-    ORDER BY ri.created_at, ri.id;
-  `, userID)
-	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export recipe_ingredients: %v", err)})
-		return
-	}
-	defer ingredientRows.Close()
-	for ingredientRows.Next() {
-		var it ExportRecipeIngredient
-		if err := ingredientRows.Scan(&it.ID, &it.RecipeID, &it.FoodItemID, &it.AmountG, &it.CreatedAt); err != nil {
-			writeJSON(w, 500, map[string]any{"error": "export recipe_ingredients scan"})
-			return
+// splitFoodList breaks free text into one phrase per food. Commas and
+// semicolons always split; "and"/"with" only split when the joined phrase is
+// not itself a well-matching food ("mac and cheese").
+func splitFoodList(text string, foods []FoodItem) []string {
+	var out []string
+	for _, chunk := range strongSepRe.Split(text, -1) {
+		chunk = strings.TrimSpace(chunk)
+		if chunk == "" {
+			continue
 		}
-		out.RecipeIngredients = append(out.RecipeIngredients, it)
+		if weakSepRe.MatchString(chunk) {
+			name, _ := parseFoodPhrase(chunk)
+			keep := false
+			for _, fi := range foods {
+				if foodMatchScore(name, fi.Name, fi.Brand) >= 0.9 {
+					keep = true
+					break
+				}
+			}
+			if !keep {
+				for _, part := range weakSepRe.Split(chunk, -1) {
+					if part = strings.TrimSpace(part); part != "" {
+						out = append(out, part)
+					}
+				}
+				continue
+			}
+		}
+		out = append(out, chunk)
 	}
+	return out
+}
 
-	portionRows, err := a.DB.Query(ctx, `
-    SELECT rp.id, rp.recipe_id::text, rp.name, rp.portion_count, rp.created_at
-    FROM recipe_portions rp
-    JOIN recipes r ON r.id = rp.recipe_id
-    WHERE r.user_id = $1
-    ORDER BY rp.created_at, rp.id;
-  `, userID)
+func (a *App) loadFoodItemsForMatching(ctx context.Context, userID string) ([]FoodItem, error) {
+	rows, err := a.DB.Query(ctx, `
+		SELECT id, name, COALESCE(brand,''), serving_label, calories_per_serving, protein_g_per_serving, carbs_g_per_serving, fat_g_per_serving, fiber_g_per_serving
+		FROM food_items
+		WHERE (user_id = $1 OR user_id IS NULL) AND archived_at IS NULL
+	`, userID)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export recipe_portions: %v", err)})
-		return
+		return nil, err
 	}
-	defer portionRows.Close()
-	for portionRows.Next() {
-		var it ExportRecipePortion
-		if err := portionRows.Scan(&it.ID, &it.RecipeID, &it.Name, &it.PortionCount, &it.CreatedAt); err != nil {
-			writeJSON(w, 500, map[string]any{"error": "export recipe_portions scan"})
-			return
+	defer rows.Close()
+	var items []FoodItem
+	for rows.Next() {
+		var it FoodItem
+		if err := rows.Scan(&it.ID, &it.Name, &it.Brand, &it.ServingLabel, &it.CaloriesPerServing, &it.ProteinPerServing, &it.CarbsPerServing, &it.FatPerServing, &it.FiberPerServing); err != nil {
+			return nil, err
 		}
-		out.RecipePortions = append(out.RecipePortions, it)
+		items = append(items, it)
 	}
+	return items, rows.Err()
+}
 
-	presetRows, err := a.DB.Query(ctx, `
-    SELECT id, user_id::text, name, pinned, created_at
-    FROM presets
-    WHERE user_id = $1
-    ORDER BY created_at, id;
-  `, userID)
-	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export presets: %v", err)})
+// HandleParseLog turns free text such as "2 eggs, 1 slice toast and a coffee
+// with milk for breakfast" into candidate log entries. Nothing is written;
+// POST /log/parse/confirm commits the chosen candidates.
+func (a *App) HandleParseLog(w http.ResponseWriter, r *http.Request) {
+	var req ParseLogRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
 		return
 	}
-	defer presetRows.Close()
-	for presetRows.Next() {
-		var it ExportPreset
-		if err := presetRows.Scan(&it.ID, &it.UserID, &it.Name, &it.Pinned, &it.CreatedAt); err != nil {
-			writeJSON(w, 500, map[string]any{"error": "export presets scan"})
-			return
-		}
-		out.Presets = append(out.Presets, it)
+	if req.UserID == "" {
+		req.UserID = DefaultUserID
 	}
-
-	presetItemRows, err := a.DB.Query(ctx, `
-    SELECT pi.id, pi.preset_id::text, pi.kind, pi.ref_id::text, pi.servings, pi.created_at
-    FROM preset_items pi
-    JOIN presets p ON p.id = pi.preset_id
-    WHERE p.user_id = $1
-    ORDER BY pi.created_at, pi.id;
-  `, userID)
-	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export preset_items: %v", err)})
+	if strings.TrimSpace(req.Text) == "" {
+		writeJSON(w, 400, map[string]any{"error": "text required"})
 		return
 	}
-	defer presetItemRows.Close()
-	for presetItemRows.Next() {
-		var it ExportPresetItem
-		if err := presetItemRows.Scan(&it.ID, &it.PresetID, &it.Kind, &it.RefID, &it.Servings, &it.CreatedAt); err != nil {
-			writeJSON(w, 500, map[string]any{"error": "export preset_items scan"})
+	occurredAt := a.now()
+	if req.OccurredAt != "" {
+		t, err := time.Parse(time.RFC3339, req.OccurredAt)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": "occurred_at must be RFC3339"})
 			return
 		}
-		out.PresetItems = append(out.PresetItems, it)
+		occurredAt = t
 	}
 
-	logRows, err := a.DB.Query(ctx, `
-    SELECT id, user_id::text, occurred_at, kind, ref_id::text, servings, meal, COALESCE(note,''), created_at
-    FROM log_entries
-    WHERE user_id = $1
-    ORDER BY occurred_at, id;
-  `, userID)
+	foods, err := a.loadFoodItemsForMatching(r.Context(), req.UserID)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export log_entries: %v", err)})
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("load food items: %v", err)})
 		return
 	}
-	defer logRows.Close()
-	for logRows.Next() {
-		var it ExportLogEntry
-		if err := logRows.Scan(&it.ID, &it.UserID, &it.OccurredAt, &it.Kind, &it.RefID, &it.Servings, &it.Meal, &it.Note, &it.CreatedAt); err != nil {
-			writeJSON(w, 500, map[string]any{"error": "export log_entries scan"})
-			return
-		}
-		out.LogEntries = append(out.LogEntries, it)
-	}
 
-	weightRows, err := a.DB.Query(ctx, `
-    SELECT id, user_id::text, measured_at, weight_kg, source, COALESCE(note,''), created_at
-    FROM body_weights
-    WHERE user_id = $1
-    ORDER BY measured_at, id;
-  `, userID)
-	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export body_weights: %v", err)})
-		return
+	text, meal := extractMeal(req.Text)
+	if req.Meal != "" {
+		meal = req.Meal
 	}
-	defer weightRows.Close()
-	for weightRows.Next() {
-		var it ExportBodyWeight
-		if err := weightRows.Scan(&it.ID, &it.UserID, &it.MeasuredAt, &it.WeightKg, &it.Source, &it.Note, &it.CreatedAt); err != nil {
-			writeJSON(w, 500, map[string]any{"error": "export body_weights scan"})
-			return
-		}
-		out.BodyWeights = append(out.BodyWeights, it)
+	if meal == "" {
+		meal = mealForTime(occurredAt.In(a.Loc))
 	}
 
-	activityRows, err := a.DB.Query(ctx, `
-    SELECT user_id::text, date, steps, active_calories_kcal_est, COALESCE(water_glasses, 0), source, created_at
-    FROM daily_activity
-    WHERE user_id = $1
-    ORDER BY date;
-  `, userID)
-	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export daily_activity: %v", err)})
-		return
-	}
-	defer activityRows.Close()
-	for activityRows.Next() {
-		var it ExportDailyActivity
-		var dateVal time.Time
-		if err := activityRows.Scan(&it.UserID, &dateVal, &it.Steps, &it.ActiveKcalEst, &it.WaterGlasses, &it.Source, &it.CreatedAt); err != nil {
-			writeJSON(w, 500, map[string]any{"error": "export daily_activity scan"})
-			return
+	out := ParseLogResponse{Text: req.Text, Meal: meal, OccurredAt: occurredAt.Format(time.RFC3339), Items: []ParsedLogItem{}}
+	for _, phrase := range splitFoodList(text, foods) {
+		name, q := parseFoodPhrase(phrase)
+		if name == "" {
+			continue
 		}
-		it.Date = dateVal.Format("2006-01-02")
-		out.DailyActivity = append(out.DailyActivity, it)
+		item := ParsedLogItem{Text: phrase, Name: name, Quantity: q, Meal: meal, Servings: 1}
+		item.Matches = rankFoodMatches(name, q, foods, 3)
+		if len(item.Matches) > 0 {
+			item.FoodItemID = item.Matches[0].FoodItemID
+			item.Servings = item.Matches[0].Servings
+		} else if q.Amount > 0 && (q.Unit == "" || q.Unit == "serving") {
+			item.Servings = q.Amount
+		}
+		out.Items = append(out.Items, item)
 	}
-
-	log.Printf("[api-debug] req_id=%s export done food_items=%d recipes=%d recipe_ingredients=%d recipe_portions=%d presets=%d preset_items=%d log_entries=%d body_weights=%d daily_activity=%d",
-		reqID, len(out.FoodItems), len(out.Recipes), len(out.RecipeIngredients), len(out.RecipePortions), len(out.Presets), len(out.PresetItems), len(out.LogEntries), len(out.BodyWeights), len(out.DailyActivity))
 	writeJSON(w, 200, out)
 }
 
-func (a *App) HandleImportData(w http.ResponseWriter, r *http.Request) {
-	reqID := middleware.GetReqID(r.Context())
-	queryUserID := r.URL.Query().Get("user_id")
-	if queryUserID == "" {
-		queryUserID = "00000000-0000-0000-0000-000000000001"
-	}
+type ConfirmParsedLogRequest struct {
+	UserID     string `json:"user_id"`
+	OccurredAt string `json:"occurred_at"`
+	Items      []struct {
+		FoodItemID string  `json:"food_item_id"`
+		Servings   float64 `json:"servings"`
+		Meal       string  `json:"meal"`
+		Note       string  `json:"note"`
+	} `json:"items"`
+}
 
-	var req ExportBundle
+// HandleConfirmParsedLog commits parsed candidates in one transaction using the
+// same insert path as POST /log/food.
+func (a *App) HandleConfirmParsedLog(w http.ResponseWriter, r *http.Request) {
+	var req ConfirmParsedLogRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("[api-debug] req_id=%s import decode error: %v", reqID, err)
 		writeJSON(w, 400, map[string]any{"error": "invalid json"})
 		return
 	}
-
-	ctx := r.Context()
+	if len(req.Items) == 0 {
+		writeJSON(w, 400, map[string]any{"error": "items required"})
+		return
+	}
+	ctx := r.Context()
 	tx, err := a.DB.Begin(ctx)
 	if err != nil {
 		writeJSON(w, 500, map[string]any{"error": "tx begin"})
@@ -1760,1145 +2689,8839 @@ func (a *App) HandleImportData(w http.ResponseWriter, r *http.Request) {
 	}
 	defer func() { _ = tx.Rollback(ctx) }()
 
-	rowsImported := 0
-	now := time.Now().UTC()
-	effectiveUserID := queryUserID
-	if r.URL.Query().Get("user_id") == "" && req.UserID != "" {
-		effectiveUserID = req.UserID
+	ids := []string{}
+	for i, it := range req.Items {
+		lr := LogFoodRequest{
+			UserID: req.UserID, OccurredAt: req.OccurredAt,
+			FoodItemID: it.FoodItemID, Servings: it.Servings, Meal: it.Meal, Note: it.Note,
+		}
+		t, err := a.prepareLogFood(&lr)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": fmt.Sprintf("item %d: %v", i, err)})
+			return
+		}
+		id, err := insertFoodLog(ctx, tx, lr, t)
+		if errors.Is(err, errFoodItemNotFound) {
+			writeJSON(w, 404, map[string]any{"error": fmt.Sprintf("item %d: %v", i, err)})
+			return
+		}
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("insert item %d: %v", i, err)})
+			return
+		}
+		ids = append(ids, id)
 	}
-	log.Printf("[api-debug] req_id=%s import start query_user_id=%s payload_user_id=%s effective_user_id=%s food_items=%d recipes=%d recipe_ingredients=%d recipe_portions=%d presets=%d preset_items=%d log_entries=%d body_weights=%d daily_activity=%d",
-		reqID, queryUserID, req.UserID, effectiveUserID,
-		len(req.FoodItems), len(req.Recipes), len(req.RecipeIngredients), len(req.RecipePortions),
-		len(req.Presets), len(req.PresetItems), len(req.LogEntries), len(req.BodyWeights), len(req.DailyActivity))
+	if err := tx.Commit(ctx); err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx commit"})
+		return
+	}
+	writeJSON(w, 201, map[string]any{"ok": true, "ids": ids})
+}
 
-	// Ensure the target user exists so FK inserts don't fail on a fresh DB.
-	if _, err := tx.Exec(ctx, `
-      INSERT INTO users (id, display_name)
-      VALUES ($1, 'Imported User')
-      ON CONFLICT (id) DO NOTHING;
-    `, effectiveUserID); err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("ensure user: %v", err)})
+// ── Body Weight ───────────────────────────────────────────────────────────────
+
+type BodyWeightRequest struct {
+	UserID     string  `json:"user_id"`
+	MeasuredAt string  `json:"measured_at"`
+	WeightKg   float64 `json:"weight_kg"`
+	Note       string  `json:"note"`
+}
+
+func (a *App) HandleBodyWeight(w http.ResponseWriter, r *http.Request) {
+	var req BodyWeightRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	if req.UserID == "" {
+		req.UserID = "00000000-0000-0000-0000-000000000001"
+	}
+	if req.MeasuredAt == "" {
+		req.MeasuredAt = a.now().Format(time.RFC3339)
+	}
+	if req.WeightKg <= 0 {
+		writeJSON(w, 400, map[string]any{"error": "weight_kg required"})
+		return
+	}
+	t, err := time.Parse(time.RFC3339, req.MeasuredAt)
+	if err != nil {
+		writeJSON(w, 400, map[string]any{"error": "measured_at must be RFC3339"})
 		return
 	}
 
-	for _, it := range req.FoodItems {
-		createdAt := it.CreatedAt
-		if createdAt.IsZero() {
-			createdAt = now
+	_, err = a.DB.Exec(r.Context(),
+		`INSERT INTO body_weights (user_id, measured_at, weight_kg, note) VALUES ($1,$2,$3,$4);`,
+		req.UserID, t, req.WeightKg, req.Note,
+	)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("insert: %v", err)})
+		return
+	}
+	writeJSON(w, 201, map[string]any{"ok": true})
+}
+
+// ── Body Composition ──────────────────────────────────────────────────────────
+
+// BodyMeasurement is one body composition / tape measurement reading. Every
+// metric is optional. BodyFatMethod is "measured" or "navy" (estimated from
+// neck, waist, hips and height).
+type BodyMeasurement struct {
+	ID            string   `json:"id"`
+	MeasuredAt    string   `json:"measured_at"`
+	Sex           *string  `json:"sex"`
+	HeightCm      *float64 `json:"height_cm"`
+	BodyFatPct    *float64 `json:"body_fat_pct"`
+	BodyFatMethod *string  `json:"body_fat_method"`
+	LeanMassKg    *float64 `json:"lean_mass_kg"`
+	WaistCm       *float64 `json:"waist_cm"`
+	HipsCm        *float64 `json:"hips_cm"`
+	ChestCm       *float64 `json:"chest_cm"`
+	ArmCm         *float64 `json:"arm_cm"`
+	ThighCm       *float64 `json:"thigh_cm"`
+	NeckCm        *float64 `json:"neck_cm"`
+	Source        string   `json:"source"`
+	Note          string   `json:"note"`
+}
+
+// BodyMeasurementRequest creates a reading. sex and height_cm default to the
+// user's most recent values; weight_kg (default: the nearest weigh-in within
+// three days) is only used to derive lean mass and is not stored.
+type BodyMeasurementRequest struct {
+	UserID     string   `json:"user_id"`
+	MeasuredAt string   `json:"measured_at"`
+	Sex        string   `json:"sex"`
+	HeightCm   *float64 `json:"height_cm"`
+	WeightKg   *float64 `json:"weight_kg"`
+	BodyFatPct *float64 `json:"body_fat_pct"`
+	LeanMassKg *float64 `json:"lean_mass_kg"`
+	WaistCm    *float64 `json:"waist_cm"`
+	HipsCm     *float64 `json:"hips_cm"`
+	ChestCm    *float64 `json:"chest_cm"`
+	ArmCm      *float64 `json:"arm_cm"`
+	ThighCm    *float64 `json:"thigh_cm"`
+	NeckCm     *float64 `json:"neck_cm"`
+	Source     string   `json:"source"`
+	Note       string   `json:"note"`
+}
+
+const bodyMeasurementColumns = `id, measured_at, sex, height_cm::float8, body_fat_pct::float8, body_fat_method,
+    lean_mass_kg::float8, waist_cm::float8, hips_cm::float8, chest_cm::float8, arm_cm::float8, thigh_cm::float8,
+    neck_cm::float8, source, COALESCE(note, '')`
+
+func scanBodyMeasurement(row pgx.Row) (BodyMeasurement, error) {
+	var m BodyMeasurement
+	var measuredAt time.Time
+	err := row.Scan(&m.ID, &measuredAt, &m.Sex, &m.HeightCm, &m.BodyFatPct, &m.BodyFatMethod,
+		&m.LeanMassKg, &m.WaistCm, &m.HipsCm, &m.ChestCm, &m.ArmCm, &m.ThighCm, &m.NeckCm, &m.Source, &m.Note)
+	m.MeasuredAt = measuredAt.Format(time.RFC3339)
+	return m, err
+}
+
+// navyBodyFat estimates body fat % with the U.S. Navy circumference method
+// (metric form). Women also need hips. It fails when the inputs are missing
+// or give an implausible result.
+func navyBodyFat(sex string, heightCm, neckCm, waistCm, hipsCm float64) (float64, error) {
+	if heightCm <= 0 || neckCm <= 0 || waistCm <= 0 {
+		return 0, errors.New("height, neck and waist are required")
+	}
+	var pct float64
+	switch sex {
+	case "male":
+		if waistCm <= neckCm {
+			return 0, errors.New("waist must be larger than neck")
 		}
-		var foodUserID any
-		if it.UserID != "" {
-			foodUserID = effectiveUserID
+		pct = 495/(1.0324-0.19077*math.Log10(waistCm-neckCm)+0.15456*math.Log10(heightCm)) - 450
+	case "female":
+		if hipsCm <= 0 {
+			return 0, errors.New("hips are required")
 		}
-		_, err := tx.Exec(ctx, `
-      INSERT INTO food_items (
-        id, user_id, name, brand, serving_label, source,
-        calories_per_serving, protein_g_per_serving, carbs_g_per_serving, fat_g_per_serving, fiber_g_per_serving, created_at
-      ) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
-      ON CONFLICT (id) DO UPDATE SET
-        user_id = EXCLUDED.user_id,
-        name = EXCLUDED.name,
-        brand = EXCLUDED.brand,
-        serving_label = EXCLUDED.serving_label,
-        source = EXCLUDED.source,
-        calories_per_serving = EXCLUDED.calories_per_serving,
-        protein_g_per_serving = EXCLUDED.protein_g_per_serving,
-        carbs_g_per_serving = EXCLUDED.carbs_g_per_serving,
-        fat_g_per_serving = EXCLUDED.fat_g_per_serving,
-        fiber_g_per_serving = EXCLUDED.fiber_g_per_serving;
-    `, it.ID, foodUserID, it.Name, it.Brand, it.ServingLabel, it.Source,
-			it.CaloriesPerServing, it.ProteinPerServing, it.CarbsPerServing, it.FatPerServing, it.FiberPerServing, createdAt)
-		if err != nil {
-			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import food_items: %v", err)})
-			return
+		if waistCm+hipsCm <= neckCm {
+			return 0, errors.New("waist plus hips must be larger than neck")
 		}
-		rowsImported++
+		pct = 495/(1.29579-0.35004*math.Log10(waistCm+hipsCm-neckCm)+0.22100*math.Log10(heightCm)) - 450
+	default:
+		return 0, fmt.Errorf("unknown sex %q", sex)
 	}
+	if pct <= 0 || pct >= 75 {
+		return 0, fmt.Errorf("implausible estimate %.1f%%", pct)
+	}
+	return math.Round(pct*10) / 10, nil
+}
 
-	for _, it := range req.Recipes {
-		createdAt := it.CreatedAt
-		if createdAt.IsZero() {
-			createdAt = now
-		}
-		_, err := tx.Exec(ctx, `
-      INSERT INTO recipes (id, user_id, name, instructions, yield_count, created_at)
-      VALUES ($1,$2,$3,$4,$5,$6)
-      ON CONFLICT (id) DO UPDATE SET
-        user_id = EXCLUDED.user_id,
-        name = EXCLUDED.name,
-        instructions = EXCLUDED.instructions,
-        yield_count = EXCLUDED.yield_count;
-    `, it.ID, effectiveUserID, it.Name, it.Instructions, it.YieldCount, createdAt)
+func (a *App) HandleCreateBodyMeasurement(w http.ResponseWriter, r *http.Request) {
+	var req BodyMeasurementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	if req.UserID == "" {
+		req.UserID = DefaultUserID
+	}
+	if req.Source == "" {
+		req.Source = "manual"
+	}
+	measuredAt := a.now()
+	if req.MeasuredAt != "" {
+		t, err := time.Parse(time.RFC3339, req.MeasuredAt)
 		if err != nil {
-			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import recipes: %v", err)})
+			writeJSON(w, 400, map[string]any{"error": "measured_at must be RFC3339"})
 			return
 		}
-		rowsImported++
+		measuredAt = t
 	}
-
-	for _, it := range req.RecipeIngredients {
-		createdAt := it.CreatedAt
-		if createdAt.IsZero() {
-			createdAt = now
+	if req.Sex != "" && req.Sex != "male" && req.Sex != "female" {
+		writeJSON(w, 400, map[string]any{"error": "sex must be male or female"})
+		return
+	}
+	hasMetric := false
+	for i, v := range []*float64{req.BodyFatPct, req.LeanMassKg, req.WaistCm, req.HipsCm, req.ChestCm, req.ArmCm,
+		req.ThighCm, req.NeckCm, req.HeightCm, req.WeightKg} {
+		if v == nil {
+			continue
 		}
-		_, err := tx.Exec(ctx, `
-      INSERT INTO recipe_ingredients (id, recipe_id, food_item_id, amount_g, created_at)
-      VALUES ($1,$2,$3,$4,$5)
-      ON CONFLICT (id) DO UPDATE SET
-        recipe_id = EXCLUDED.recipe_id,
-        food_item_id = EXCLUDED.food_item_id,
-        amount_g = EXCLUDED.amount_g;
-    `, it.ID, it.RecipeID, it.FoodItemID, it.AmountG, createdAt)
-		if err != nil {
-			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import recipe_ingredients: %v", err)})
+		if *v <= 0 {
+			writeJSON(w, 400, map[string]any{"error": "measurements must be positive"})
 			return
 		}
-		rowsImported++
+		// The last two only feed derived values.
+		hasMetric = hasMetric || i < 8
+	}
+	if !hasMetric {
+		writeJSON(w, 400, map[string]any{"error": "at least one measurement required"})
+		return
+	}
+	if req.BodyFatPct != nil && *req.BodyFatPct >= 100 {
+		writeJSON(w, 400, map[string]any{"error": "body_fat_pct must be below 100"})
+		return
 	}
 
-	for _, it := range req.RecipePortions {
-		createdAt := it.CreatedAt
-		if createdAt.IsZero() {
-			createdAt = now
+	ctx := r.Context()
+	var lastSex *string
+	var lastHeight *float64
+	err := a.DB.QueryRow(ctx, `
+    SELECT (array_agg(sex ORDER BY measured_at DESC) FILTER (WHERE sex IS NOT NULL))[1],
+           (array_agg(height_cm::float8 ORDER BY measured_at DESC) FILTER (WHERE height_cm IS NOT NULL))[1]
+    FROM body_measurements
+    WHERE user_id = $1;
+  `, req.UserID).Scan(&lastSex, &lastHeight)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("load profile: %v", err)})
+		return
+	}
+	var sex *string
+	if req.Sex != "" {
+		sex = &req.Sex
+	} else {
+		sex = lastSex
+	}
+	height := req.HeightCm
+	if height == nil {
+		height = lastHeight
+	}
+
+	bodyFat, method := req.BodyFatPct, (*string)(nil)
+	if bodyFat != nil {
+		m := "measured"
+		method = &m
+	} else if sex != nil && height != nil && req.NeckCm != nil && req.WaistCm != nil {
+		hips := 0.0
+		if req.HipsCm != nil {
+			hips = *req.HipsCm
 		}
-		_, err := tx.Exec(ctx, `
-      INSERT INTO recipe_portions (id, recipe_id, name, portion_count, created_at)
-      VALUES ($1,$2,$3,$4,$5)
-      ON CONFLICT (id) DO UPDATE SET
-        recipe_id = EXCLUDED.recipe_id,
-        name = EXCLUDED.name,
-        portion_count = EXCLUDED.portion_count;
-    `, it.ID, it.RecipeID, it.Name, it.PortionCount, createdAt)
-		if err != nil {
-			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import recipe_portions: %v", err)})
-			return
+		// Inputs the formula can't use leave body fat unset rather than fail the save.
+		if pct, err := navyBodyFat(*sex, *height, *req.NeckCm, *req.WaistCm, hips); err == nil {
+			m := "navy"
+			bodyFat, method = &pct, &m
 		}
-		rowsImported++
 	}
 
-	for _, it := range req.Presets {
-		createdAt := it.CreatedAt
-		if createdAt.IsZero() {
-			createdAt = now
+	leanMass := req.LeanMassKg
+	if leanMass == nil && bodyFat != nil {
+		weight := req.WeightKg
+		if weight == nil {
+			var kg float64
+			err := a.DB.QueryRow(ctx, `
+        SELECT weight_kg::float8
+        FROM body_weights
+        WHERE user_id = $1 AND measured_at BETWEEN $2::timestamptz - interval '3 days' AND $2::timestamptz + interval '3 days'
+        ORDER BY abs(EXTRACT(EPOCH FROM measured_at - $2::timestamptz))
+        LIMIT 1;
+      `, req.UserID, measuredAt).Scan(&kg)
+			if err == nil {
+				weight = &kg
+			} else if !errors.Is(err, pgx.ErrNoRows) {
+				writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("load weight: %v", err)})
+				return
+			}
 		}
-		_, err := tx.Exec(ctx, `
-      INSERT INTO presets (id, user_id, name, pinned, created_at)
-      VALUES ($1,$2,$3,$4,$5)
-      ON CONFLICT (id) DO UPDATE SET
-        user_id = EXCLUDED.user_id,
-        name = EXCLUDED.name,
-        pinned = EXCLUDED.pinned;
-    `, it.ID, effectiveUserID, it.Name, it.Pinned, createdAt)
-		if err != nil {
-			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import presets: %v", err)})
-			return
+		if weight != nil {
+			lean := math.Round(*weight*(1-*bodyFat/100)*10) / 10
+			leanMass = &lean
 		}
-		rowsImported++
 	}
 
-	for _, it := range req.PresetItems {
-		createdAt := it.CreatedAt
-		if createdAt.IsZero() {
-			createdAt = now
-		}
-		_, err := tx.Exec(ctx, `
-      INSERT INTO preset_items (id, preset_id, kind, ref_id, servings, created_at)
-      VALUES ($1,$2,$3,$4,$5,$6)
-      ON CONFLICT (id) DO UPDATE SET
-        preset_id = EXCLUDED.preset_id,
-        kind = EXCLUDED.kind,
-        ref_id = EXCLUDED.ref_id,
-        servings = EXCLUDED.servings;
-    `, it.ID, it.PresetID, it.Kind, it.RefID, it.Servings, createdAt)
+	m, err := scanBodyMeasurement(a.DB.QueryRow(ctx, `
+    INSERT INTO body_measurements (user_id, measured_at, sex, height_cm, body_fat_pct, body_fat_method, lean_mass_kg,
+                                   waist_cm, hips_cm, chest_cm, arm_cm, thigh_cm, neck_cm, source, note)
+    VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,NULLIF($15, ''))
+    RETURNING `+bodyMeasurementColumns+`;
+  `, req.UserID, measuredAt, sex, height, bodyFat, method, leanMass,
+		req.WaistCm, req.HipsCm, req.ChestCm, req.ArmCm, req.ThighCm, req.NeckCm, req.Source, req.Note))
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("insert: %v", err)})
+		return
+	}
+	writeJSON(w, 201, m)
+}
+
+// HandleListBodyMeasurements returns readings oldest first, optionally
+// limited to ?from=&to= (inclusive local dates).
+func (a *App) HandleListBodyMeasurements(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	where := []string{"user_id = $1"}
+	args := []any{userID}
+	if r.URL.Query().Get("from") != "" || r.URL.Query().Get("to") != "" {
+		from, end, err := a.parseDateRange(r)
 		if err != nil {
-			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import preset_items: %v", err)})
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
 			return
 		}
-		rowsImported++
+		args = append(args, from, end)
+		where = append(where, "measured_at >= $2", "measured_at < $3")
 	}
-
-	for _, it := range req.LogEntries {
-		createdAt := it.CreatedAt
-		if createdAt.IsZero() {
-			createdAt = now
-		}
-		occurredAt := it.OccurredAt
-		if occurredAt.IsZero() {
-			occurredAt = now
-		}
-		_, err := tx.Exec(ctx, `
-      INSERT INTO log_entries (id, user_id, occurred_at, kind, ref_id, servings, meal, note, created_at)
-      VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
-      ON CONFLICT (id) DO UPDATE SET
-        user_id = EXCLUDED.user_id,
-        occurred_at = EXCLUDED.occurred_at,
-        kind = EXCLUDED.kind,
-        ref_id = EXCLUDED.ref_id,
-        servings = EXCLUDED.servings,
-        meal = EXCLUDED.meal,
-        note = EXCLUDED.note;
-    `, it.ID, effectiveUserID, occurredAt, it.Kind, it.RefID, it.Servings, it.Meal, it.Note, createdAt)
+	rows, err := a.DB.Query(r.Context(), `
+    SELECT `+bodyMeasurementColumns+`
+    FROM body_measurements
+    WHERE `+strings.Join(where, " AND ")+`
+    ORDER BY measured_at, id;
+  `, args...)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
+		return
+	}
+	defer rows.Close()
+	out := []BodyMeasurement{}
+	for rows.Next() {
+		m, err := scanBodyMeasurement(rows)
 		if err != nil {
-			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import log_entries: %v", err)})
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("scan: %v", err)})
 			return
 		}
-		rowsImported++
+		out = append(out, m)
+	}
+	if err := rows.Err(); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
+		return
 	}
+	writeJSON(w, 200, out)
+}
 
-	for _, it := range req.BodyWeights {
-		createdAt := it.CreatedAt
-		if createdAt.IsZero() {
-			createdAt = now
-		}
-		measuredAt := it.MeasuredAt
-		if measuredAt.IsZero() {
-			measuredAt = now
-		}
-		_, err := tx.Exec(ctx, `
-      INSERT INTO body_weights (id, user_id, measured_at, weight_kg, source, note, created_at)
-      VALUES ($1,$2,$3,$4,$5,$6,$7)
-      ON CONFLICT (id) DO UPDATE SET
-        user_id = EXCLUDED.user_id,
-        measured_at = EXCLUDED.measured_at,
-        weight_kg = EXCLUDED.weight_kg,
-        source = EXCLUDED.source,
-        note = EXCLUDED.note;
-    `, it.ID, effectiveUserID, measuredAt, it.WeightKg, it.Source, it.Note, createdAt)
-		if err != nil {
-			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import body_weights: %v", err)})
-			return
-		}
-		rowsImported++
+func (a *App) HandleDeleteBodyMeasurement(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
 	}
-
-	for _, it := range req.DailyActivity {
-		createdAt := it.CreatedAt
-		if createdAt.IsZero() {
-			createdAt = now
-		}
-		if _, err := time.Parse("2006-01-02", it.Date); err != nil {
-			writeJSON(w, 400, map[string]any{"error": fmt.Sprintf("invalid activity date: %s", it.Date)})
-			return
-		}
-		_, err := tx.Exec(ctx, `
-      INSERT INTO daily_activity (user_id, date, steps, active_calories_kcal_est, source, created_at)
-      VALUES ($1,$2,$3,$4,$5,$6)
-      ON CONFLICT (user_id, date) DO UPDATE SET
-        steps = EXCLUDED.steps,
-        active_calories_kcal_est = EXCLUDED.active_calories_kcal_est,
-        source = EXCLUDED.source;
-    `, effectiveUserID, it.Date, it.Steps, it.ActiveKcalEst, it.Source, createdAt)
-		if err != nil {
-			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import daily_activity: %v", err)})
-			return
-		}
-		rowsImported++
+	ct, err := a.DB.Exec(r.Context(), `DELETE FROM body_measurements WHERE id::text = $1 AND user_id = $2;`,
+		chi.URLParam(r, "id"), userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete: %v", err)})
+		return
 	}
-
-	if err := tx.Commit(ctx); err != nil {
-		log.Printf("[api-debug] req_id=%s import tx commit error: %v", reqID, err)
-		writeJSON(w, 500, map[string]any{"error": "tx commit"})
+	if ct.RowsAffected() == 0 {
+		writeJSON(w, 404, map[string]any{"error": "not found"})
 		return
 	}
-	log.Printf("[api-debug] req_id=%s import success imported_rows=%d", reqID, rowsImported)
-	writeJSON(w, 200, map[string]any{"ok": true, "imported_rows": rowsImported})
+	writeJSON(w, 200, map[string]any{"ok": true})
 }
 
-// ── Markdown Export ───────────────────────────────────────────────────────────
+// bodyTrendMetrics maps /body/trend's ?metric= to its table and column.
+var bodyTrendMetrics = map[string][2]string{
+	"weight_kg":    {"body_weights", "weight_kg"},
+	"body_fat_pct": {"body_measurements", "body_fat_pct"},
+	"lean_mass_kg": {"body_measurements", "lean_mass_kg"},
+	"waist_cm":     {"body_measurements", "waist_cm"},
+	"hips_cm":      {"body_measurements", "hips_cm"},
+	"chest_cm":     {"body_measurements", "chest_cm"},
+	"arm_cm":       {"body_measurements", "arm_cm"},
+	"thigh_cm":     {"body_measurements", "thigh_cm"},
+	"neck_cm":      {"body_measurements", "neck_cm"},
+}
 
-func (a *App) HandleExportMarkdown(w http.ResponseWriter, r *http.Request) {
+// BodyTrendPoint summarises the readings in one period; From/To span the
+// days that had readings.
+type BodyTrendPoint struct {
+	From     string  `json:"from"`
+	To       string  `json:"to"`
+	Readings int     `json:"readings"`
+	Avg      float64 `json:"avg"`
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max"`
+}
+
+// BodyTrend compares the first and last readings in the range. Start, End
+// and Change are null without readings.
+type BodyTrend struct {
+	Metric   string           `json:"metric"`
+	From     string           `json:"from"`
+	To       string           `json:"to"`
+	Group    string           `json:"group"`
+	Readings int              `json:"readings"`
+	Start    *float64         `json:"start"`
+	End      *float64         `json:"end"`
+	Change   *float64         `json:"change"`
+	Points   []BodyTrendPoint `json:"points"`
+}
+
+// HandleBodyTrend summarises one body metric (weight_kg, body_fat_pct,
+// lean_mass_kg or a tape measurement) over [from, to], per
+// group=day|week|month period (default week).
+func (a *App) HandleBodyTrend(w http.ResponseWriter, r *http.Request) {
 	userID := r.URL.Query().Get("user_id")
 	if userID == "" {
 		userID = DefaultUserID
 	}
-	fromStr := r.URL.Query().Get("from")
-	toStr := r.URL.Query().Get("to")
-	if fromStr == "" || toStr == "" {
-		writeJSON(w, 400, map[string]any{"error": "from and to required (YYYY-MM-DD)"})
-		return
+	metric := r.URL.Query().Get("metric")
+	if metric == "" {
+		metric = "weight_kg"
 	}
-	from, err := time.ParseInLocation("2006-01-02", fromStr, a.Loc)
-	if err != nil {
-		writeJSON(w, 400, map[string]any{"error": "bad from date"})
+	src, ok := bodyTrendMetrics[metric]
+	if !ok {
+		writeJSON(w, 400, map[string]any{"error": "unknown metric"})
 		return
 	}
-	to, err := time.ParseInLocation("2006-01-02", toStr, a.Loc)
+	from, end, err := a.parseDateRange(r)
 	if err != nil {
-		writeJSON(w, 400, map[string]any{"error": "bad to date"})
+		writeJSON(w, 400, map[string]any{"error": err.Error()})
 		return
 	}
-	if to.Before(from) {
-		writeJSON(w, 400, map[string]any{"error": "to must be >= from"})
+	group := r.URL.Query().Get("group")
+	if group == "" {
+		group = "week"
+	}
+	if group != "day" && group != "week" && group != "month" {
+		writeJSON(w, 400, map[string]any{"error": "group must be day, week or month"})
 		return
 	}
 
-	ctx := r.Context()
-
-	// Fetch all log entries in range in one query, ordered by day + meal + time
-	type mdEntry struct {
-		Date     string
-		Meal     string
-		FoodName string
-		Servings float64
-		Kcal     float64
-		ProteinG float64
-		CarbsG   float64
-		FatG     float64
-		FiberG   float64
-	}
-	rangeEnd := to.Add(24 * time.Hour)
-	logRows, err := a.DB.Query(ctx, `
-		SELECT DATE(le.occurred_at AT TIME ZONE $4) AS day,
-		       le.meal, fi.name, le.servings,
-		       le.servings * fi.calories_per_serving,
-		       le.servings * fi.protein_g_per_serving,
-		       le.servings * fi.carbs_g_per_serving,
-		       le.servings * fi.fat_g_per_serving,
-		       le.servings * fi.fiber_g_per_serving
-		FROM log_entries le
-		JOIN food_items fi ON fi.id = le.ref_id
-		WHERE le.user_id = $1 AND le.kind = 'food'
-		  AND le.occurred_at >= $2 AND le.occurred_at < $3
-		ORDER BY day, le.meal, le.occurred_at
-	`, userID, from, rangeEnd, a.Loc.String())
+	rows, err := a.DB.Query(r.Context(), fmt.Sprintf(`
+    WITH readings AS (
+      SELECT measured_at, (measured_at AT TIME ZONE $4)::date AS day, %[2]s::float8 AS v
+      FROM %[1]s
+      WHERE user_id = $1 AND measured_at >= $2 AND measured_at < $3 AND %[2]s IS NOT NULL
+    )
+    SELECT MIN(day), MAX(day), COUNT(*), AVG(v), MIN(v), MAX(v),
+           (array_agg(v ORDER BY measured_at))[1], (array_agg(v ORDER BY measured_at DESC))[1]
+    FROM readings
+    GROUP BY date_trunc($5::text, day::timestamp)
+    ORDER BY 1;
+  `, src[0], src[1]), userID, from, end, a.Loc.String(), group)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query log: %v", err)})
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
 		return
 	}
-	defer logRows.Close()
-
-	entriesByDay := map[string][]mdEntry{}
-	for logRows.Next() {
-		var e mdEntry
-		var day time.Time
-		if err := logRows.Scan(&day, &e.Meal, &e.FoodName, &e.Servings,
-			&e.Kcal, &e.ProteinG, &e.CarbsG, &e.FatG, &e.FiberG); err != nil {
-			writeJSON(w, 500, map[string]any{"error": "scan log"})
+	defer rows.Close()
+	out := BodyTrend{
+		Metric: metric, From: from.Format("2006-01-02"), To: end.AddDate(0, 0, -1).Format("2006-01-02"),
+		Group: group, Points: []BodyTrendPoint{},
+	}
+	round := func(v float64) float64 { return math.Round(v*100) / 100 }
+	for rows.Next() {
+		var p BodyTrendPoint
+		var first, last time.Time
+		var startV, endV float64
+		if err := rows.Scan(&first, &last, &p.Readings, &p.Avg, &p.Min, &p.Max, &startV, &endV); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("scan: %v", err)})
 			return
 		}
-		e.Date = day.Format("2006-01-02")
-		entriesByDay[e.Date] = append(entriesByDay[e.Date], e)
-	}
-	logRows.Close()
-
-	// Fetch body weights in range
-	type mdWeight struct {
-		Date     string
-		WeightKg float64
-	}
-	weightByDay := map[string]mdWeight{}
-	wRows, err := a.DB.Query(ctx, `
-		SELECT DATE(measured_at AT TIME ZONE $4), AVG(weight_kg)
-		FROM body_weights
-		WHERE user_id = $1 AND measured_at >= $2 AND measured_at < $3
-		GROUP BY 1 ORDER BY 1
-	`, userID, from, rangeEnd, a.Loc.String())
-	if err == nil {
-		defer wRows.Close()
-		for wRows.Next() {
-			var d time.Time
-			var kg float64
-			if wRows.Scan(&d, &kg) == nil {
-				weightByDay[d.Format("2006-01-02")] = mdWeight{Date: d.Format("2006-01-02"), WeightKg: kg}
-			}
+		p.From, p.To = first.Format("2006-01-02"), last.Format("2006-01-02")
+		p.Avg, p.Min, p.Max = round(p.Avg), round(p.Min), round(p.Max)
+		if out.Start == nil {
+			out.Start = &startV
 		}
-		wRows.Close()
+		out.End = &endV
+		out.Readings += p.Readings
+		out.Points = append(out.Points, p)
 	}
-
-	// Fetch activity in range
-	type mdActivity struct {
-		Steps      int
-		ActiveKcal float64
+	if err := rows.Err(); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
+		return
 	}
-	activityByDay := map[string]mdActivity{}
-	aRows, err := a.DB.Query(ctx, `
-		SELECT date, steps, active_calories_kcal_est
-		FROM daily_activity
-		WHERE user_id = $1 AND date >= $2 AND date <= $3
-		ORDER BY date
-	`, userID, fromStr, toStr)
-	if err == nil {
-		defer aRows.Close()
-		for aRows.Next() {
-			var d time.Time
-			var act mdActivity
-			if aRows.Scan(&d, &act.Steps, &act.ActiveKcal) == nil {
-				activityByDay[d.Format("2006-01-02")] = act
-			}
-		}
-		aRows.Close()
+	if out.Start != nil {
+		change := round(*out.End - *out.Start)
+		out.Change = &change
 	}
+	writeJSON(w, 200, out)
+}
 
-	// Build zip in memory
-	var buf bytes.Buffer
-	zw := zip.NewWriter(&buf)
+// ── Daily Activity ────────────────────────────────────────────────────────────
 
-	for cur := from; !cur.After(to); cur = cur.Add(24 * time.Hour) {
-		dateStr := cur.Format("2006-01-02")
-		entries := entriesByDay[dateStr]
-		weight := weightByDay[dateStr]
-		activity := activityByDay[dateStr]
+// activitySourcePriority ranks the sources that can report a day's steps and
+// active calories; per field, the first source with a value wins. Manual
+// entries are corrections, so they beat devices. Unlisted sources rank after
+// these, alphabetically.
+var activitySourcePriority = []string{"manual", "watch", "phone", "workouts"}
 
-		var sb strings.Builder
-		sb.WriteString("# " + dateStr + "\n\n")
+// activityExcludesWorkouts lists the sources whose active calories do not
+// count logged workouts. When one of them wins, the "workouts" source is
+// added on top; any other source is a device that already tracked the
+// workout, so adding it would count it twice.
+var activityExcludesWorkouts = []string{"manual"}
 
-		// Summary totals
-		var totalKcal, totalProtein, totalCarbs, totalFat, totalFiber float64
-		for _, e := range entries {
-			totalKcal += e.Kcal
-			totalProtein += e.ProteinG
-			totalCarbs += e.CarbsG
-			totalFat += e.FatG
-			totalFiber += e.FiberG
-		}
+var activitySourceRe = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
 
-		sb.WriteString("## Summary\n\n")
-		sb.WriteString(fmt.Sprintf("| | |\n|---|---|\n"))
-		sb.WriteString(fmt.Sprintf("| Calories | %.0f kcal |\n", totalKcal))
-		sb.WriteString(fmt.Sprintf("| Protein | %.1f g |\n", totalProtein))
-		sb.WriteString(fmt.Sprintf("| Carbs | %.1f g |\n", totalCarbs))
-		sb.WriteString(fmt.Sprintf("| Fat | %.1f g |\n", totalFat))
-		sb.WriteString(fmt.Sprintf("| Fiber | %.1f g |\n", totalFiber))
-		if weight.WeightKg > 0 {
-			sb.WriteString(fmt.Sprintf("| Weight | %.2f kg |\n", weight.WeightKg))
-		}
-		if activity.Steps > 0 {
-			sb.WriteString(fmt.Sprintf("| Steps | %d |\n", activity.Steps))
-		}
-		if activity.ActiveKcal > 0 {
-			sb.WriteString(fmt.Sprintf("| Active kcal | %.0f |\n", activity.ActiveKcal))
-		}
-		sb.WriteString("\n")
+// ActivitySource is what one source reported for a day. A nil field was
+// never reported by that source.
+type ActivitySource struct {
+	Source        string    `json:"source"`
+	Steps         *int      `json:"steps"`
+	ActiveKcalEst *float64  `json:"active_calories_est"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
 
-		// Food log grouped by meal
-		if len(entries) > 0 {
-			sb.WriteString("## Food Log\n\n")
-			currentMeal := ""
-			var mealKcal, mealProtein float64
-			mealEntries := []mdEntry{}
+// DailyActivity is a day's resolved activity; Source is where the steps
+// came from.
+type DailyActivity struct {
+	Date          string           `json:"date"`
+	Steps         int              `json:"steps"`
+	ActiveKcalEst float64          `json:"active_calories_est"`
+	WaterGlasses  int              `json:"water_glasses"`
+	Source        string           `json:"source"`
+	Sources       []ActivitySource `json:"sources"`
+}
 
-			flushMeal := func() {
-				if currentMeal == "" {
-					return
-				}
-				sb.WriteString("### " + strings.Title(strings.ReplaceAll(currentMeal, "_", " ")) + "\n\n")
-				sb.WriteString("| Food | Servings | kcal | Protein | Carbs | Fat |\n")
-				sb.WriteString("|---|---|---|---|---|---|\n")
-				for _, me := range mealEntries {
-					sb.WriteString(fmt.Sprintf("| %s | %.2g | %.0f | %.1fg | %.1fg | %.1fg |\n",
-						me.FoodName, me.Servings, me.Kcal, me.ProteinG, me.CarbsG, me.FatG))
-				}
-				sb.WriteString(fmt.Sprintf("\n**Meal total:** %.0f kcal · %.1fg protein\n\n", mealKcal, mealProtein))
-			}
+// DailyActivityRequest sets a day's figures from one source (default
+// manual). Only fields present in the request change.
+type DailyActivityRequest struct {
+	UserID        string   `json:"user_id"`
+	Date          string   `json:"date"`
+	Source        string   `json:"source"`
+	Steps         *int     `json:"steps"`
+	ActiveKcalEst *float64 `json:"active_calories_est"`
+	WaterGlasses  *int     `json:"water_glasses"`
+}
 
-			for _, e := range entries {
-				if e.Meal != currentMeal {
-					flushMeal()
-					currentMeal = e.Meal
-					mealKcal = 0
-					mealProtein = 0
-					mealEntries = nil
-				}
-				mealKcal += e.Kcal
-				mealProtein += e.ProteinG
-				mealEntries = append(mealEntries, e)
-			}
-			flushMeal()
-		} else {
-			sb.WriteString("_No food logged._\n\n")
-		}
+// resolveDailyActivity recomputes daily_activity's steps and active calories
+// for date from its sources, by activitySourcePriority. Workout calories are
+// added to the winning active-calorie figure unless it came from a device,
+// see activityExcludesWorkouts.
+func resolveDailyActivity(ctx context.Context, tx pgx.Tx, userID, date string) error {
+	_, err := tx.Exec(ctx, `
+    WITH s AS (
+      SELECT s.*, COALESCE(array_position($3::text[], s.source), 1000) AS rank
+      FROM daily_activity_sources s
+      WHERE s.user_id = $1 AND s.date = $2::date
+    ), active AS (
+      SELECT source, active_calories_kcal_est AS kcal
+      FROM s
+      WHERE source <> 'workouts' AND active_calories_kcal_est IS NOT NULL
+      ORDER BY rank, source
+      LIMIT 1
+    )
+    INSERT INTO daily_activity (user_id, date, steps, active_calories_kcal_est, source)
+    SELECT $1, $2::date,
+           COALESCE((array_agg(steps ORDER BY rank, source) FILTER (WHERE steps IS NOT NULL))[1], 0),
+           COALESCE((SELECT kcal FROM active), 0) +
+             CASE WHEN COALESCE((SELECT source FROM active) = ANY($4::text[]), true)
+                  THEN COALESCE(SUM(active_calories_kcal_est) FILTER (WHERE source = 'workouts'), 0)
+                  ELSE 0 END,
+           COALESCE((array_agg(source ORDER BY rank, source) FILTER (WHERE steps IS NOT NULL))[1],
+                    (array_agg(source ORDER BY rank, source))[1], 'manual')
+    FROM s
+    ON CONFLICT (user_id, date) DO UPDATE SET
+      steps = EXCLUDED.steps,
+      active_calories_kcal_est = EXCLUDED.active_calories_kcal_est,
+      source = EXCLUDED.source;
+  `, userID, date, activitySourcePriority, activityExcludesWorkouts)
+	return err
+}
 
-		f, err := zw.Create(dateStr + ".md")
+// applyDailyActivity writes req's fields for date in tx.
+func applyDailyActivity(ctx context.Context, tx pgx.Tx, userID, date string, req DailyActivityRequest) error {
+	if req.Steps != nil || req.ActiveKcalEst != nil {
+		_, err := tx.Exec(ctx, `
+      INSERT INTO daily_activity_sources (user_id, date, source, steps, active_calories_kcal_est)
+      VALUES ($1, $2::date, $3, $4, $5)
+      ON CONFLICT (user_id, date, source) DO UPDATE SET
+        steps = COALESCE(EXCLUDED.steps, daily_activity_sources.steps),
+        active_calories_kcal_est = COALESCE(EXCLUDED.active_calories_kcal_est, daily_activity_sources.active_calories_kcal_est),
+        updated_at = now();
+    `, userID, date, req.Source, req.Steps, req.ActiveKcalEst)
 		if err != nil {
-			writeJSON(w, 500, map[string]any{"error": "zip create"})
-			return
+			return err
 		}
-		if _, err := f.Write([]byte(sb.String())); err != nil {
-			writeJSON(w, 500, map[string]any{"error": "zip write"})
-			return
+		if err := resolveDailyActivity(ctx, tx, userID, date); err != nil {
+			return err
 		}
 	}
-
+	if req.WaterGlasses != nil {
+		_, err := tx.Exec(ctx, `
+      INSERT INTO daily_activity (user_id, date, steps, active_calories_kcal_est, water_glasses, source)
+      VALUES ($1, $2::date, 0, 0, $3, 'manual')
+      ON CONFLICT (user_id, date) DO UPDATE SET
+        water_glasses = EXCLUDED.water_glasses;
+    `, userID, date, *req.WaterGlasses)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateDailyActivity fills req's source default and checks its fields.
+func validateDailyActivity(req *DailyActivityRequest) error {
+	req.Source = strings.ToLower(strings.TrimSpace(req.Source))
+	if req.Source == "" {
+		req.Source = "manual"
+	}
+	if !activitySourceRe.MatchString(req.Source) {
+		return errors.New("source must be 1-32 lower-case letters, digits, - or _")
+	}
+	if req.Source == "workouts" {
+		return errors.New("the workouts source is computed from /workouts")
+	}
+	if req.Steps == nil && req.ActiveKcalEst == nil && req.WaterGlasses == nil {
+		return errors.New("nothing to update: give steps, active_calories_est or water_glasses")
+	}
+	if (req.Steps != nil && *req.Steps < 0) || (req.ActiveKcalEst != nil && *req.ActiveKcalEst < 0) ||
+		(req.WaterGlasses != nil && *req.WaterGlasses < 0) {
+		return errors.New("values must not be negative")
+	}
+	return nil
+}
+
+// loadDailyActivity returns the days in [from, to] (YYYY-MM-DD, inclusive)
+// that have an activity row, oldest first, with their sources.
+func (a *App) loadDailyActivity(ctx context.Context, userID, from, to string) ([]DailyActivity, error) {
+	rows, err := a.DB.Query(ctx, `
+    SELECT date, steps, active_calories_kcal_est::float8, COALESCE(water_glasses, 0), source
+    FROM daily_activity
+    WHERE user_id = $1 AND date BETWEEN $2::date AND $3::date
+    ORDER BY date;
+  `, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []DailyActivity{}
+	index := map[string]int{}
+	for rows.Next() {
+		var d DailyActivity
+		var date time.Time
+		if err := rows.Scan(&date, &d.Steps, &d.ActiveKcalEst, &d.WaterGlasses, &d.Source); err != nil {
+			return nil, err
+		}
+		d.Date = date.Format("2006-01-02")
+		d.Sources = []ActivitySource{}
+		index[d.Date] = len(out)
+		out = append(out, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	rows, err = a.DB.Query(ctx, `
+    SELECT date, source, steps, active_calories_kcal_est::float8, updated_at
+    FROM daily_activity_sources
+    WHERE user_id = $1 AND date BETWEEN $2::date AND $3::date
+    ORDER BY date, COALESCE(array_position($4::text[], source), 1000), source;
+  `, userID, from, to, activitySourcePriority)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s ActivitySource
+		var date time.Time
+		if err := rows.Scan(&date, &s.Source, &s.Steps, &s.ActiveKcalEst, &s.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if i, ok := index[date.Format("2006-01-02")]; ok {
+			out[i].Sources = append(out[i].Sources, s)
+		}
+	}
+	return out, rows.Err()
+}
+
+// writeDailyActivity applies req to date in a transaction and responds with
+// the resolved day.
+func (a *App) writeDailyActivity(w http.ResponseWriter, r *http.Request, userID, date string, req DailyActivityRequest, status int) {
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "date must be YYYY-MM-DD"})
+		return
+	}
+	if err := validateDailyActivity(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": err.Error()})
+		return
+	}
+	ctx := r.Context()
+	tx, err := a.DB.Begin(ctx)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx begin"})
+		return
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	if err := applyDailyActivity(ctx, tx, userID, date, req); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("upsert: %v", err)})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx commit"})
+		return
+	}
+	days, err := a.loadDailyActivity(ctx, userID, date, date)
+	if err != nil || len(days) == 0 {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("reload: %v", err)})
+		return
+	}
+	writeJSON(w, status, days[0])
+}
+
+// HandleDailyActivity records a day's activity from {date, source, steps,
+// active_calories_est, water_glasses}; date defaults to today.
+func (a *App) HandleDailyActivity(w http.ResponseWriter, r *http.Request) {
+	var req DailyActivityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	if req.UserID == "" {
+		req.UserID = "00000000-0000-0000-0000-000000000001"
+	}
+	if req.Date == "" {
+		req.Date = a.now().Format("2006-01-02")
+	}
+	a.writeDailyActivity(w, r, req.UserID, req.Date, req, 201)
+}
+
+// HandlePatchDailyActivity is HandleDailyActivity for the day in the path.
+func (a *App) HandlePatchDailyActivity(w http.ResponseWriter, r *http.Request) {
+	var req DailyActivityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	userID := req.UserID
+	if userID == "" {
+		userID = r.URL.Query().Get("user_id")
+	}
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	a.writeDailyActivity(w, r, userID, chi.URLParam(r, "date"), req, 200)
+}
+
+// HandleListDailyActivity lists the days in ?from=&to= with activity.
+func (a *App) HandleListDailyActivity(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	from, end, err := a.parseDateRange(r)
+	if err != nil {
+		writeJSON(w, 400, map[string]any{"error": err.Error()})
+		return
+	}
+	days, err := a.loadDailyActivity(r.Context(), userID, from.Format("2006-01-02"), end.AddDate(0, 0, -1).Format("2006-01-02"))
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
+		return
+	}
+	writeJSON(w, 200, days)
+}
+
+func (a *App) HandleGetDailyActivity(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	date := chi.URLParam(r, "date")
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "date must be YYYY-MM-DD"})
+		return
+	}
+	days, err := a.loadDailyActivity(r.Context(), userID, date, date)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
+		return
+	}
+	if len(days) == 0 {
+		writeJSON(w, 404, map[string]any{"error": "no activity for that day"})
+		return
+	}
+	writeJSON(w, 200, days[0])
+}
+
+// HandleDeleteDailyActivity removes one source's figures for the day
+// (?source=), re-resolving the rest, or the whole day including water.
+func (a *App) HandleDeleteDailyActivity(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	date := chi.URLParam(r, "date")
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "date must be YYYY-MM-DD"})
+		return
+	}
+	source := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("source")))
+	ctx := r.Context()
+	tx, err := a.DB.Begin(ctx)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx begin"})
+		return
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	var removed int64
+	if source != "" {
+		ct, err := tx.Exec(ctx, `DELETE FROM daily_activity_sources WHERE user_id = $1 AND date = $2::date AND source = $3;`,
+			userID, date, source)
+		if err == nil && ct.RowsAffected() > 0 {
+			err = resolveDailyActivity(ctx, tx, userID, date)
+		}
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete: %v", err)})
+			return
+		}
+		removed = ct.RowsAffected()
+	} else {
+		if _, err := tx.Exec(ctx, `DELETE FROM daily_activity_sources WHERE user_id = $1 AND date = $2::date;`, userID, date); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete: %v", err)})
+			return
+		}
+		ct, err := tx.Exec(ctx, `DELETE FROM daily_activity WHERE user_id = $1 AND date = $2::date;`, userID, date)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete: %v", err)})
+			return
+		}
+		removed = ct.RowsAffected()
+	}
+	if removed == 0 {
+		writeJSON(w, 404, map[string]any{"error": "not found"})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx commit"})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+func (a *App) HandleGetWater(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = "00000000-0000-0000-0000-000000000001"
+	}
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = a.now().Format("2006-01-02")
+	}
+
+	var glasses int
+	err := a.DB.QueryRow(r.Context(), `
+		SELECT COALESCE(water_glasses, 0)
+		FROM daily_activity
+		WHERE user_id = $1 AND date = $2
+	`, userID, date).Scan(&glasses)
+	if err != nil {
+		// No row means no water logged yet
+		glasses = 0
+	}
+	writeJSON(w, 200, map[string]any{"glasses": glasses})
+}
+
+type SetWaterRequest struct {
+	UserID  string `json:"user_id"`
+	Date    string `json:"date"`
+	Glasses int    `json:"glasses"`
+}
+
+func (a *App) HandleSetWater(w http.ResponseWriter, r *http.Request) {
+	var req SetWaterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	if req.UserID == "" {
+		req.UserID = "00000000-0000-0000-0000-000000000001"
+	}
+	if req.Date == "" {
+		req.Date = a.now().Format("2006-01-02")
+	}
+	if req.Glasses < 0 {
+		req.Glasses = 0
+	}
+
+	_, err := a.DB.Exec(r.Context(), `
+		INSERT INTO daily_activity (user_id, date, steps, active_calories_kcal_est, water_glasses, source)
+		VALUES ($1, $2, 0, 0, $3, 'manual')
+		ON CONFLICT (user_id, date) DO UPDATE SET
+			water_glasses = EXCLUDED.water_glasses;
+	`, req.UserID, req.Date, req.Glasses)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("upsert water: %v", err)})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+// ── Workouts ──────────────────────────────────────────────────────────────────
+
+// workoutMETs holds metabolic equivalents for each activity at light,
+// moderate and vigorous intensity, after the Compendium of Physical
+// Activities.
+var workoutMETs = map[string][3]float64{
+	"walking":    {2.8, 3.5, 5.0},
+	"running":    {7.0, 9.8, 11.5},
+	"cycling":    {4.0, 6.8, 10.0},
+	"swimming":   {5.8, 7.0, 9.8},
+	"rowing":     {4.8, 7.0, 8.5},
+	"hiking":     {5.3, 6.0, 7.8},
+	"elliptical": {4.6, 5.0, 6.5},
+	"strength":   {3.5, 5.0, 6.0},
+	"hiit":       {6.0, 8.0, 10.0},
+	"yoga":       {2.5, 3.0, 4.0},
+	"dancing":    {4.5, 5.5, 7.3},
+	"sports":     {4.0, 6.0, 8.0},
+	"other":      {3.0, 4.5, 6.0},
+}
+
+var workoutIntensities = []string{"light", "moderate", "vigorous"}
+
+// defaultWorkoutWeightKg stands in for body weight until one is logged.
+const defaultWorkoutWeightKg = 70.0
+
+// workoutMET picks the MET for an activity. For walking and running with a
+// distance it uses the ACSM level-ground equations on the average speed
+// instead, which track effort better than an intensity label.
+func workoutMET(activity, intensity string, durationMin float64, distanceKm *float64) float64 {
+	if distanceKm != nil && *distanceKm > 0 && durationMin > 0 {
+		metersPerMin := *distanceKm * 1000 / durationMin
+		switch {
+		case activity == "walking" && metersPerMin >= 50 && metersPerMin <= 130:
+			return math.Round((3.5+0.1*metersPerMin)/3.5*10) / 10
+		case activity == "running" && metersPerMin >= 130 && metersPerMin <= 450:
+			return math.Round((3.5+0.2*metersPerMin)/3.5*10) / 10
+		}
+	}
+	mets, ok := workoutMETs[activity]
+	if !ok {
+		mets = workoutMETs["other"]
+	}
+	for i, name := range workoutIntensities {
+		if name == intensity {
+			return mets[i]
+		}
+	}
+	return mets[1]
+}
+
+type Workout struct {
+	ID             string   `json:"id"`
+	StartedAt      string   `json:"started_at"`
+	Date           string   `json:"date"`
+	Activity       string   `json:"activity"`
+	DurationMin    float64  `json:"duration_min"`
+	DistanceKm     *float64 `json:"distance_km"`
+	Intensity      string   `json:"intensity"`
+	AvgHeartRate   *int     `json:"avg_heart_rate"`
+	MaxHeartRate   *int     `json:"max_heart_rate"`
+	MET            *float64 `json:"met"`
+	WeightKg       *float64 `json:"weight_kg"`
+	CaloriesKcal   float64  `json:"calories_kcal"`
+	CaloriesSource string   `json:"calories_source"`
+	Note           string   `json:"note"`
+}
+
+// WorkoutRequest creates or replaces a workout. Without calories_kcal the
+// calories are estimated as MET x weight x hours, using the last weigh-in
+// at or before started_at (or the first one after, or 70 kg).
+type WorkoutRequest struct {
+	UserID       string   `json:"user_id"`
+	StartedAt    string   `json:"started_at"`
+	Activity     string   `json:"activity"`
+	DurationMin  float64  `json:"duration_min"`
+	DistanceKm   *float64 `json:"distance_km"`
+	Intensity    string   `json:"intensity"`
+	AvgHeartRate *int     `json:"avg_heart_rate"`
+	MaxHeartRate *int     `json:"max_heart_rate"`
+	CaloriesKcal *float64 `json:"calories_kcal"`
+	Note         string   `json:"note"`
+}
+
+const workoutColumns = `id, started_at, (started_at AT TIME ZONE $TZ)::date, activity, duration_min::float8,
+    distance_km::float8, intensity, avg_heart_rate, max_heart_rate, met::float8, weight_kg::float8,
+    calories_kcal::float8, calories_source, note`
+
+// workoutSelect returns workoutColumns with the time zone parameter set to
+// $n.
+func workoutSelect(n int) string {
+	return strings.ReplaceAll(workoutColumns, "$TZ", fmt.Sprintf("$%d::text", n))
+}
+
+func scanWorkout(row pgx.Row) (Workout, error) {
+	var wo Workout
+	var startedAt, date time.Time
+	err := row.Scan(&wo.ID, &startedAt, &date, &wo.Activity, &wo.DurationMin, &wo.DistanceKm, &wo.Intensity,
+		&wo.AvgHeartRate, &wo.MaxHeartRate, &wo.MET, &wo.WeightKg, &wo.CaloriesKcal, &wo.CaloriesSource, &wo.Note)
+	wo.StartedAt = startedAt.Format(time.RFC3339)
+	wo.Date = date.Format("2006-01-02")
+	return wo, err
+}
+
+// prepareWorkout fills req's defaults and validates it, returning started_at.
+func (a *App) prepareWorkout(req *WorkoutRequest) (time.Time, error) {
+	if req.UserID == "" {
+		req.UserID = DefaultUserID
+	}
+	startedAt := a.now()
+	if req.StartedAt != "" {
+		t, err := time.Parse(time.RFC3339, req.StartedAt)
+		if err != nil {
+			return startedAt, errors.New("started_at must be RFC3339")
+		}
+		startedAt = t
+	}
+	req.Activity = strings.ToLower(strings.TrimSpace(req.Activity))
+	if _, ok := workoutMETs[req.Activity]; !ok {
+		return startedAt, errors.New("unknown activity (see GET /workouts/activities)")
+	}
+	if req.Intensity == "" {
+		req.Intensity = "moderate"
+	}
+	valid := false
+	for _, name := range workoutIntensities {
+		valid = valid || name == req.Intensity
+	}
+	if !valid {
+		return startedAt, errors.New("intensity must be light, moderate or vigorous")
+	}
+	if req.DurationMin <= 0 || req.DurationMin > 24*60 {
+		return startedAt, errors.New("duration_min must be between 0 and 1440")
+	}
+	if req.DistanceKm != nil && *req.DistanceKm < 0 {
+		return startedAt, errors.New("distance_km must not be negative")
+	}
+	for _, hr := range []*int{req.AvgHeartRate, req.MaxHeartRate} {
+		if hr != nil && (*hr < 30 || *hr > 250) {
+			return startedAt, errors.New("heart rate must be between 30 and 250 bpm")
+		}
+	}
+	if req.CaloriesKcal != nil && *req.CaloriesKcal < 0 {
+		return startedAt, errors.New("calories_kcal must not be negative")
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	return startedAt, nil
+}
+
+// saveWorkout inserts a workout, or replaces id's when id is non-empty, and
+// rolls the affected days up into daily activity. It reports false when id
+// does not exist.
+func (a *App) saveWorkout(ctx context.Context, tx pgx.Tx, id string, req WorkoutRequest, startedAt time.Time) (Workout, bool, error) {
+	tz := a.Loc.String()
+	var met, weight *float64
+	calories, source := req.CaloriesKcal, "manual"
+	if calories == nil {
+		var kg float64
+		err := tx.QueryRow(ctx, `
+      SELECT weight_kg::float8 FROM body_weights
+      WHERE user_id = $1
+      ORDER BY measured_at > $2, abs(EXTRACT(EPOCH FROM measured_at - $2::timestamptz))
+      LIMIT 1;
+    `, req.UserID, startedAt).Scan(&kg)
+		if errors.Is(err, pgx.ErrNoRows) {
+			kg, err = defaultWorkoutWeightKg, nil
+		}
+		if err != nil {
+			return Workout{}, false, err
+		}
+		m := workoutMET(req.Activity, req.Intensity, req.DurationMin, req.DistanceKm)
+		kcal := math.Round(m * kg * req.DurationMin / 60)
+		met, weight, calories, source = &m, &kg, &kcal, "met"
+	}
+
+	var oldDate *time.Time
+	if id != "" {
+		err := tx.QueryRow(ctx, `
+      SELECT (started_at AT TIME ZONE $3)::date FROM workouts WHERE id::text = $1 AND user_id = $2 FOR UPDATE;
+    `, id, req.UserID, tz).Scan(&oldDate)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Workout{}, false, nil
+		}
+		if err != nil {
+			return Workout{}, false, err
+		}
+	}
+	wo, err := scanWorkout(tx.QueryRow(ctx, `
+    INSERT INTO workouts (id, user_id, started_at, activity, duration_min, distance_km, intensity,
+                          avg_heart_rate, max_heart_rate, met, weight_kg, calories_kcal, calories_source, note)
+    VALUES (COALESCE(NULLIF($1, '')::uuid, uuid_generate_v4()), $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+    ON CONFLICT (id) DO UPDATE SET
+      started_at = EXCLUDED.started_at,
+      activity = EXCLUDED.activity,
+      duration_min = EXCLUDED.duration_min,
+      distance_km = EXCLUDED.distance_km,
+      intensity = EXCLUDED.intensity,
+      avg_heart_rate = EXCLUDED.avg_heart_rate,
+      max_heart_rate = EXCLUDED.max_heart_rate,
+      met = EXCLUDED.met,
+      weight_kg = EXCLUDED.weight_kg,
+      calories_kcal = EXCLUDED.calories_kcal,
+      calories_source = EXCLUDED.calories_source,
+      note = EXCLUDED.note
+    RETURNING `+workoutSelect(15)+`;
+  `, id, req.UserID, startedAt, req.Activity, req.DurationMin, req.DistanceKm, req.Intensity,
+		req.AvgHeartRate, req.MaxHeartRate, met, weight, *calories, source, req.Note, tz))
+	if err != nil {
+		return Workout{}, false, err
+	}
+	if err := a.rollupWorkouts(ctx, tx, req.UserID, wo.Date); err != nil {
+		return Workout{}, false, err
+	}
+	if oldDate != nil && oldDate.Format("2006-01-02") != wo.Date {
+		if err := a.rollupWorkouts(ctx, tx, req.UserID, oldDate.Format("2006-01-02")); err != nil {
+			return Workout{}, false, err
+		}
+	}
+	return wo, true, nil
+}
+
+// rollupWorkouts sets the 'workouts' activity source for date to that day's
+// workout calories, or removes it when none are left.
+func (a *App) rollupWorkouts(ctx context.Context, tx pgx.Tx, userID, date string) error {
+	var kcal *float64
+	err := tx.QueryRow(ctx, `
+    SELECT SUM(calories_kcal)::float8 FROM workouts
+    WHERE user_id = $1 AND (started_at AT TIME ZONE $3)::date = $2::date;
+  `, userID, date, a.Loc.String()).Scan(&kcal)
+	if err != nil {
+		return err
+	}
+	if kcal == nil {
+		_, err = tx.Exec(ctx, `DELETE FROM daily_activity_sources WHERE user_id = $1 AND date = $2::date AND source = 'workouts';`, userID, date)
+	} else {
+		_, err = tx.Exec(ctx, `
+      INSERT INTO daily_activity_sources (user_id, date, source, active_calories_kcal_est)
+      VALUES ($1, $2::date, 'workouts', $3)
+      ON CONFLICT (user_id, date, source) DO UPDATE SET
+        active_calories_kcal_est = EXCLUDED.active_calories_kcal_est,
+        updated_at = now();
+    `, userID, date, *kcal)
+	}
+	if err != nil {
+		return err
+	}
+	return resolveDailyActivity(ctx, tx, userID, date)
+}
+
+func (a *App) writeWorkout(w http.ResponseWriter, r *http.Request, id string, status int) {
+	var req WorkoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	if req.UserID == "" {
+		req.UserID = r.URL.Query().Get("user_id")
+	}
+	startedAt, err := a.prepareWorkout(&req)
+	if err != nil {
+		writeJSON(w, 400, map[string]any{"error": err.Error()})
+		return
+	}
+	ctx := r.Context()
+	tx, err := a.DB.Begin(ctx)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx begin"})
+		return
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	wo, found, err := a.saveWorkout(ctx, tx, id, req, startedAt)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("save workout: %v", err)})
+		return
+	}
+	if !found {
+		writeJSON(w, 404, map[string]any{"error": "workout not found"})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx commit"})
+		return
+	}
+	writeJSON(w, status, wo)
+}
+
+func (a *App) HandleCreateWorkout(w http.ResponseWriter, r *http.Request) {
+	a.writeWorkout(w, r, "", 201)
+}
+
+func (a *App) HandleUpdateWorkout(w http.ResponseWriter, r *http.Request) {
+	a.writeWorkout(w, r, chi.URLParam(r, "id"), 200)
+}
+
+// HandleListWorkouts lists workouts oldest first, optionally limited to
+// ?from=&to=.
+func (a *App) HandleListWorkouts(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	where := []string{"user_id = $1"}
+	args := []any{userID, a.Loc.String()}
+	if r.URL.Query().Get("from") != "" || r.URL.Query().Get("to") != "" {
+		from, end, err := a.parseDateRange(r)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
+			return
+		}
+		args = append(args, from, end)
+		where = append(where, "started_at >= $3", "started_at < $4")
+	}
+	rows, err := a.DB.Query(r.Context(), `
+    SELECT `+workoutSelect(2)+`
+    FROM workouts
+    WHERE `+strings.Join(where, " AND ")+`
+    ORDER BY started_at, id;
+  `, args...)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
+		return
+	}
+	defer rows.Close()
+	out := []Workout{}
+	for rows.Next() {
+		wo, err := scanWorkout(rows)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("scan: %v", err)})
+			return
+		}
+		out = append(out, wo)
+	}
+	if err := rows.Err(); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
+		return
+	}
+	writeJSON(w, 200, out)
+}
+
+func (a *App) HandleDeleteWorkout(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	ctx := r.Context()
+	tx, err := a.DB.Begin(ctx)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx begin"})
+		return
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	var date time.Time
+	err = tx.QueryRow(ctx, `
+    DELETE FROM workouts WHERE id::text = $1 AND user_id = $2
+    RETURNING (started_at AT TIME ZONE $3)::date;
+  `, chi.URLParam(r, "id"), userID, a.Loc.String()).Scan(&date)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeJSON(w, 404, map[string]any{"error": "workout not found"})
+		return
+	}
+	if err == nil {
+		err = a.rollupWorkouts(ctx, tx, userID, date.Format("2006-01-02"))
+	}
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete: %v", err)})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx commit"})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+// HandleWorkoutActivities lists the activity types with their MET values by
+// intensity, for pickers.
+func (a *App) HandleWorkoutActivities(w http.ResponseWriter, r *http.Request) {
+	type activity struct {
+		Activity string             `json:"activity"`
+		METs     map[string]float64 `json:"mets"`
+	}
+	out := []activity{}
+	for name, mets := range workoutMETs {
+		m := map[string]float64{}
+		for i, intensity := range workoutIntensities {
+			m[intensity] = mets[i]
+		}
+		out = append(out, activity{Activity: name, METs: m})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Activity < out[j].Activity })
+	writeJSON(w, 200, out)
+}
+
+// ── Presets ───────────────────────────────────────────────────────────────────
+
+type CreatePresetRequest struct {
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
+	Pinned bool   `json:"pinned"`
+	Items  []struct {
+		Kind     string  `json:"kind"` // food|recipe_portion
+		RefID    string  `json:"ref_id"`
+		Servings float64 `json:"servings"`
+	} `json:"items"`
+}
+
+func (a *App) HandleCreatePreset(w http.ResponseWriter, r *http.Request) {
+	var req CreatePresetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	if req.UserID == "" {
+		req.UserID = "00000000-0000-0000-0000-000000000001"
+	}
+	if req.Name == "" || len(req.Items) == 0 {
+		writeJSON(w, 400, map[string]any{"error": "name and items required"})
+		return
+	}
+
+	ctx := r.Context()
+	tx, err := a.DB.Begin(ctx)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx begin"})
+		return
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var presetID string
+	if err := tx.QueryRow(ctx, `INSERT INTO presets (user_id, name, pinned) VALUES ($1,$2,$3) RETURNING id;`, req.UserID, req.Name, req.Pinned).Scan(&presetID); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("preset insert: %v", err)})
+		return
+	}
+
+	for _, it := range req.Items {
+		if it.Kind != "food" && it.Kind != "recipe_portion" {
+			writeJSON(w, 400, map[string]any{"error": "invalid preset item kind"})
+			return
+		}
+		if it.Servings <= 0 {
+			it.Servings = 1
+		}
+		_, err := tx.Exec(ctx,
+			`INSERT INTO preset_items (preset_id, kind, ref_id, servings) VALUES ($1,$2,$3,$4);`,
+			presetID, it.Kind, it.RefID, it.Servings)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("preset item insert: %v", err)})
+			return
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx commit"})
+		return
+	}
+	writeJSON(w, 201, map[string]any{"ok": true, "preset_id": presetID})
+}
+
+func (a *App) HandleApplyPreset(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = "00000000-0000-0000-0000-000000000001"
+	}
+	presetID := chi.URLParam(r, "id")
+	if presetID == "" {
+		writeJSON(w, 400, map[string]any{"error": "missing preset id"})
+		return
+	}
+	occurredAt := time.Now().UTC()
+
+	rows, err := a.DB.Query(r.Context(), `SELECT kind, ref_id, servings FROM preset_items WHERE preset_id=$1;`, presetID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": "query preset items"})
+		return
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var kind, refID string
+		var servings float64
+		if err := rows.Scan(&kind, &refID, &servings); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "scan"})
+			return
+		}
+		if kind == "food" {
+			_, err = insertFoodLog(r.Context(), a.DB, LogFoodRequest{UserID: userID, FoodItemID: refID, Servings: servings, Meal: "breakfast"}, occurredAt)
+		} else {
+			_, err = a.DB.Exec(r.Context(),
+				`INSERT INTO log_entries (user_id, occurred_at, kind, ref_id, servings) VALUES ($1,$2,$3,$4,$5);`,
+				userID, occurredAt, kind, refID, servings)
+		}
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("apply insert: %v", err)})
+			return
+		}
+		n++
+	}
+	writeJSON(w, 200, map[string]any{"ok": true, "logged_items": n})
+}
+
+// ── Recipes ───────────────────────────────────────────────────────────────────
+
+type RecipeSummary struct {
+	ID                 string    `json:"id"`
+	Name               string    `json:"name"`
+	Brand              string    `json:"brand"`
+	ServingLabel       string    `json:"serving_label"`
+	Instructions       string    `json:"instructions"`
+	YieldCount         int       `json:"yield_count"`
+	CaloriesPerServing float64   `json:"calories_per_serving"`
+	ProteinPerServing  float64   `json:"protein_g_per_serving"`
+	CarbsPerServing    float64   `json:"carbs_g_per_serving"`
+	FatPerServing      float64   `json:"fat_g_per_serving"`
+	FiberPerServing    float64   `json:"fiber_g_per_serving"`
+	CreatedAt          time.Time `json:"created_at"`
+	IngredientCnt      int       `json:"ingredient_count"`
+	PhotoThumbURL      string    `json:"photo_thumb_url,omitempty"`
+	Tags               []string  `json:"tags"`
+}
+
+type RecipeIngredientDetail struct {
+	ID         string  `json:"id"`
+	FoodItemID string  `json:"food_item_id"`
+	FoodName   string  `json:"food_name"`
+	Brand      string  `json:"brand"`
+	AmountG    float64 `json:"amount_g"`
+}
+
+type RecipeDetail struct {
+	ID           string                   `json:"id"`
+	UserID       string                   `json:"user_id"`
+	Name         string                   `json:"name"`
+	Instructions string                   `json:"instructions"`
+	YieldCount   int                      `json:"yield_count"`
+	CreatedAt    time.Time                `json:"created_at"`
+	Ingredients  []RecipeIngredientDetail `json:"ingredients"`
+	Tags         []string                 `json:"tags"`
+	Collections  []string                 `json:"collection_ids"`
+}
+
+// promoteToRecipe flags a food item as a recipe and gives it a recipe page if
+// it has none yet. It reports false when the food item does not exist.
+func promoteToRecipe(ctx context.Context, tx pgx.Tx, id, userID string) (bool, error) {
+	ct, err := tx.Exec(ctx, `UPDATE food_items SET is_recipe = true WHERE id = $1;`, id)
+	if err != nil {
+		return false, err
+	}
+	if ct.RowsAffected() == 0 {
+		return false, nil
+	}
+	_, err = tx.Exec(ctx, `
+    INSERT INTO recipes (id, user_id, name, instructions, yield_count)
+    SELECT id, COALESCE(user_id, $2::uuid), name, '', 1
+    FROM food_items
+    WHERE id = $1
+    ON CONFLICT (id) DO NOTHING;
+  `, id, userID)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+type CreateRecipeRequest struct {
+	UserID             string  `json:"user_id"`
+	Name               string  `json:"name"`
+	Brand              string  `json:"brand"`
+	ServingLabel       string  `json:"serving_label"`
+	CaloriesPerServing float64 `json:"calories_per_serving"`
+	ProteinPerServing  float64 `json:"protein_g_per_serving"`
+	CarbsPerServing    float64 `json:"carbs_g_per_serving"`
+	FatPerServing      float64 `json:"fat_g_per_serving"`
+	FiberPerServing    float64 `json:"fiber_g_per_serving"`
+	Instructions       string  `json:"instructions"`
+	YieldCount         int     `json:"yield_count"`
+}
+
+// recipeMacroFilters maps the min_/max_ query parameters of GET /recipes to
+// per-serving columns.
+var recipeMacroFilters = []struct{ Param, Column string }{
+	{"calories", "fi.calories_per_serving"},
+	{"protein", "fi.protein_g_per_serving"},
+	{"carbs", "fi.carbs_g_per_serving"},
+	{"fat", "fi.fat_g_per_serving"},
+	{"fiber", "fi.fiber_g_per_serving"},
+}
+
+// recipeIngredientMatch is true when a recipe's shopping list or linked
+// ingredients mention the LIKE pattern in %[1]s.
+const recipeIngredientMatch = `(
+      EXISTS (SELECT 1 FROM recipe_shopping_items s WHERE s.recipe_id = r.id AND lower(s.name) LIKE %[1]s)
+      OR EXISTS (SELECT 1 FROM recipe_ingredients ri JOIN food_items f ON f.id = ri.food_item_id
+                 WHERE ri.recipe_id = r.id AND lower(f.name) LIKE %[1]s))`
+
+// queryList reads a list query parameter given either repeated or
+// comma-separated, dropping blanks.
+func queryList(r *http.Request, key string) []string {
+	var out []string
+	for _, v := range r.URL.Query()[key] {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+// HandleListRecipes lists the user's recipes. Optional filters, all combined
+// with AND:
+//   - q: every word appears in the name or instructions
+//   - tag: has all of these tags
+//   - ingredient / exclude_ingredient: shopping items or linked foods do / do
+//     not mention each of these
+//   - collection_id: is in this collection
+//   - min_/max_ calories, protein, carbs, fat, fiber: per-serving ranges
+func (a *App) HandleListRecipes(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = "00000000-0000-0000-0000-000000000001"
+	}
+	where := []string{"r.user_id = $1", "fi.is_recipe", "fi.archived_at IS NULL"}
+	args := []any{userID}
+	q := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+	for _, word := range strings.Fields(q) {
+		args = append(args, "%"+likeEscaper.Replace(word)+"%")
+		where = append(where, fmt.Sprintf("(lower(fi.name) LIKE $%[1]d OR lower(COALESCE(r.instructions,'')) LIKE $%[1]d)", len(args)))
+	}
+	if tags := normalizeTags(queryList(r, "tag")); len(tags) > 0 {
+		args = append(args, tags)
+		where = append(where, fmt.Sprintf("(SELECT COUNT(*) FROM recipe_tags t WHERE t.recipe_id = r.id AND t.tag = ANY($%d)) = %d", len(args), len(tags)))
+	}
+	for _, ing := range queryList(r, "ingredient") {
+		args = append(args, "%"+likeEscaper.Replace(strings.ToLower(ing))+"%")
+		where = append(where, fmt.Sprintf(recipeIngredientMatch, fmt.Sprintf("$%d", len(args))))
+	}
+	for _, ing := range queryList(r, "exclude_ingredient") {
+		args = append(args, "%"+likeEscaper.Replace(strings.ToLower(ing))+"%")
+		where = append(where, "NOT "+fmt.Sprintf(recipeIngredientMatch, fmt.Sprintf("$%d", len(args))))
+	}
+	if cid := r.URL.Query().Get("collection_id"); cid != "" {
+		args = append(args, cid)
+		where = append(where, fmt.Sprintf("EXISTS (SELECT 1 FROM recipe_collection_items c WHERE c.recipe_id = r.id AND c.collection_id::text = $%d)", len(args)))
+	}
+	for _, m := range recipeMacroFilters {
+		for _, bound := range []struct{ prefix, op string }{{"min_", ">="}, {"max_", "<="}} {
+			raw := r.URL.Query().Get(bound.prefix + m.Param)
+			if raw == "" {
+				continue
+			}
+			v, err := strconv.ParseFloat(raw, 64)
+			if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+				writeJSON(w, 400, map[string]any{"error": fmt.Sprintf("bad %s%s", bound.prefix, m.Param)})
+				return
+			}
+			args = append(args, v)
+			where = append(where, fmt.Sprintf("%s %s $%d", m.Column, bound.op, len(args)))
+		}
+	}
+	// With a search, recipes whose name matches come before those matching
+	// only in the instructions.
+	order := "fi.name ASC"
+	if q != "" {
+		args = append(args, "%"+likeEscaper.Replace(q)+"%")
+		order = fmt.Sprintf("(lower(fi.name) LIKE $%d) DESC, fi.name ASC", len(args))
+	}
+	rows, err := a.DB.Query(r.Context(), `
+    SELECT r.id, fi.name, COALESCE(fi.brand,''), fi.serving_label,
+           COALESCE(r.instructions,''), r.yield_count,
+           fi.calories_per_serving, fi.protein_g_per_serving, fi.carbs_g_per_serving, fi.fat_g_per_serving, fi.fiber_g_per_serving,
+           r.created_at, COUNT(rsi.id) AS ingredient_count, COALESCE(cover.id::text, ''),
+           COALESCE((SELECT array_agg(t.tag ORDER BY t.tag) FROM recipe_tags t WHERE t.recipe_id = r.id), '{}')
+    FROM recipes r
+    INNER JOIN food_items fi ON fi.id = r.id
+    LEFT JOIN recipe_shopping_items rsi ON rsi.recipe_id = r.id
+    LEFT JOIN LATERAL (
+      SELECT id FROM recipe_images WHERE recipe_id = r.id ORDER BY sort_order, created_at LIMIT 1
+    ) cover ON true
+    WHERE `+strings.Join(where, " AND ")+`
+    GROUP BY r.id, fi.id, cover.id
+    ORDER BY `+order+`;
+  `, args...)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("list recipes: %v", err)})
+		return
+	}
+	defer rows.Close()
+	out := []RecipeSummary{}
+	for rows.Next() {
+		var it RecipeSummary
+		var coverID string
+		if err := rows.Scan(&it.ID, &it.Name, &it.Brand, &it.ServingLabel,
+			&it.Instructions, &it.YieldCount,
+			&it.CaloriesPerServing, &it.ProteinPerServing, &it.CarbsPerServing, &it.FatPerServing, &it.FiberPerServing,
+			&it.CreatedAt, &it.IngredientCnt, &coverID, &it.Tags); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "scan recipes"})
+			return
+		}
+		if coverID != "" {
+			it.PhotoThumbURL = recipePhotoURL(it.ID, coverID, "thumb")
+		}
+		out = append(out, it)
+	}
+	writeJSON(w, 200, out)
+}
+
+func (a *App) HandleCreateRecipe(w http.ResponseWriter, r *http.Request) {
+	var req CreateRecipeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	if req.UserID == "" {
+		req.UserID = DefaultUserID
+	}
+	if req.Name == "" {
+		writeJSON(w, 400, map[string]any{"error": "name required"})
+		return
+	}
+	if req.YieldCount <= 0 {
+		req.YieldCount = 1
+	}
+	if req.ServingLabel == "" {
+		req.ServingLabel = "1 serving"
+	}
+	// The recipe page shares its food item's ID.
+	ctx := r.Context()
+	tx, err := a.DB.Begin(ctx)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx begin"})
+		return
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	var id string
+	err = tx.QueryRow(ctx, `
+    INSERT INTO food_items (user_id, name, brand, serving_label, calories_per_serving, protein_g_per_serving, carbs_g_per_serving, fat_g_per_serving, fiber_g_per_serving, source, is_recipe)
+    VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,'custom',true) RETURNING id;
+  `, req.UserID, req.Name, req.Brand, req.ServingLabel, req.CaloriesPerServing, req.ProteinPerServing, req.CarbsPerServing, req.FatPerServing, req.FiberPerServing).Scan(&id)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("create food item: %v", err)})
+		return
+	}
+	_, err = tx.Exec(ctx, `
+    INSERT INTO recipes (id, user_id, name, instructions, yield_count)
+    VALUES ($1,$2,$3,$4,$5);
+  `, id, req.UserID, req.Name, req.Instructions, req.YieldCount)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("create recipe: %v", err)})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx commit"})
+		return
+	}
+	writeJSON(w, 201, map[string]any{"ok": true, "id": id})
+}
+
+func (a *App) HandleGetRecipe(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = "00000000-0000-0000-0000-000000000001"
+	}
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeJSON(w, 400, map[string]any{"error": "missing recipe id"})
+		return
+	}
+	var out RecipeDetail
+	err := a.DB.QueryRow(r.Context(), `
+    SELECT id, user_id::text, name, COALESCE(instructions,''), yield_count, created_at,
+           COALESCE((SELECT array_agg(t.tag ORDER BY t.tag) FROM recipe_tags t WHERE t.recipe_id = recipes.id), '{}'),
+           COALESCE((SELECT array_agg(c.collection_id::text ORDER BY c.added_at) FROM recipe_collection_items c WHERE c.recipe_id = recipes.id), '{}')
+    FROM recipes
+    WHERE id = $1 AND user_id = $2;
+  `, id, userID).Scan(&out.ID, &out.UserID, &out.Name, &out.Instructions, &out.YieldCount, &out.CreatedAt, &out.Tags, &out.Collections)
+	if err != nil {
+		writeJSON(w, 404, map[string]any{"error": "recipe not found"})
+		return
+	}
+	rows, err := a.DB.Query(r.Context(), `
+    SELECT ri.id, fi.id, fi.name, COALESCE(fi.brand,''), ri.amount_g
+    FROM recipe_ingredients ri
+    JOIN food_items fi ON fi.id = ri.food_item_id
+    WHERE ri.recipe_id = $1
+    ORDER BY fi.name;
+  `, id)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("list ingredients: %v", err)})
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var it RecipeIngredientDetail
+		if err := rows.Scan(&it.ID, &it.FoodItemID, &it.FoodName, &it.Brand, &it.AmountG); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "scan ingredients"})
+			return
+		}
+		out.Ingredients = append(out.Ingredients, it)
+	}
+	writeJSON(w, 200, out)
+}
+
+type UpdateRecipeRequest struct {
+	UserID       string `json:"user_id"`
+	Name         string `json:"name"`
+	Instructions string `json:"instructions"`
+	YieldCount   int    `json:"yield_count"`
+}
+
+func (a *App) HandleUpdateRecipe(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeJSON(w, 400, map[string]any{"error": "missing recipe id"})
+		return
+	}
+	var req UpdateRecipeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	if req.UserID == "" {
+		req.UserID = "00000000-0000-0000-0000-000000000001"
+	}
+	if req.Name == "" {
+		writeJSON(w, 400, map[string]any{"error": "name required"})
+		return
+	}
+	if req.YieldCount <= 0 {
+		req.YieldCount = 1
+	}
+	// Saving a recipe page for a plain food item turns it into a recipe.
+	ctx := r.Context()
+	tx, err := a.DB.Begin(ctx)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx begin"})
+		return
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	found, err := promoteToRecipe(ctx, tx, id, req.UserID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("promote recipe: %v", err)})
+		return
+	}
+	if !found {
+		writeJSON(w, 404, map[string]any{"error": "recipe not found"})
+		return
+	}
+	ct, err := tx.Exec(ctx, `
+    UPDATE recipes
+    SET name = $1, instructions = $2, yield_count = $3
+    WHERE id = $4 AND user_id = $5;
+  `, req.Name, req.Instructions, req.YieldCount, id, req.UserID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("update recipe: %v", err)})
+		return
+	}
+	if ct.RowsAffected() == 0 {
+		writeJSON(w, 404, map[string]any{"error": "recipe not found"})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx commit"})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+type AddRecipeIngredientRequest struct {
+	UserID     string  `json:"user_id"`
+	FoodItemID string  `json:"food_item_id"`
+	AmountG    float64 `json:"amount_g"`
+}
+
+func (a *App) HandleAddRecipeIngredient(w http.ResponseWriter, r *http.Request) {
+	recipeID := chi.URLParam(r, "id")
+	if recipeID == "" {
+		writeJSON(w, 400, map[string]any{"error": "missing recipe id"})
+		return
+	}
+	var req AddRecipeIngredientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	if req.UserID == "" {
+		req.UserID = "00000000-0000-0000-0000-000000000001"
+	}
+	if req.FoodItemID == "" || req.AmountG <= 0 {
+		writeJSON(w, 400, map[string]any{"error": "food_item_id and amount_g required"})
+		return
+	}
+	var exists bool
+	if err := a.DB.QueryRow(r.Context(), `SELECT EXISTS(SELECT 1 FROM recipes WHERE id=$1 AND user_id=$2);`, recipeID, req.UserID).Scan(&exists); err != nil || !exists {
+		writeJSON(w, 404, map[string]any{"error": "recipe not found"})
+		return
+	}
+	var id string
+	err := a.DB.QueryRow(r.Context(), `
+    INSERT INTO recipe_ingredients (recipe_id, food_item_id, amount_g)
+    VALUES ($1,$2,$3)
+    RETURNING id;
+  `, recipeID, req.FoodItemID, req.AmountG).Scan(&id)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("add ingredient: %v", err)})
+		return
+	}
+	writeJSON(w, 201, map[string]any{"ok": true, "id": id})
+}
+
+type UpdateRecipeIngredientRequest struct {
+	UserID  string  `json:"user_id"`
+	AmountG float64 `json:"amount_g"`
+}
+
+func (a *App) HandleUpdateRecipeIngredient(w http.ResponseWriter, r *http.Request) {
+	recipeID := chi.URLParam(r, "id")
+	ingredientID := chi.URLParam(r, "ingredient_id")
+	if recipeID == "" || ingredientID == "" {
+		writeJSON(w, 400, map[string]any{"error": "missing ids"})
+		return
+	}
+	var req UpdateRecipeIngredientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	if req.UserID == "" {
+		req.UserID = "00000000-0000-0000-0000-000000000001"
+	}
+	if req.AmountG <= 0 {
+		writeJSON(w, 400, map[string]any{"error": "amount_g required"})
+		return
+	}
+	ct, err := a.DB.Exec(r.Context(), `
+    UPDATE recipe_ingredients ri
+    SET amount_g = $1
+    FROM recipes r
+    WHERE ri.id = $2
+      AND ri.recipe_id = $3
+      AND r.id = ri.recipe_id
+      AND r.user_id = $4;
+  `, req.AmountG, ingredientID, recipeID, req.UserID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("update ingredient: %v", err)})
+		return
+	}
+	if ct.RowsAffected() == 0 {
+		writeJSON(w, 404, map[string]any{"error": "ingredient not found"})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+type ReplaceRecipeIngredientsRequest struct {
+	UserID      string `json:"user_id"`
+	Ingredients []struct {
+		FoodItemID string  `json:"food_item_id"`
+		AmountG    float64 `json:"amount_g"`
+	} `json:"ingredients"`
+}
+
+func (a *App) HandleReplaceRecipeIngredients(w http.ResponseWriter, r *http.Request) {
+	recipeID := chi.URLParam(r, "id")
+	if recipeID == "" {
+		writeJSON(w, 400, map[string]any{"error": "missing recipe id"})
+		return
+	}
+	var req ReplaceRecipeIngredientsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	if req.UserID == "" {
+		req.UserID = DefaultUserID
+	}
+	ctx := r.Context()
+	tx, err := a.DB.Begin(ctx)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx begin"})
+		return
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM recipes WHERE id=$1 AND user_id=$2);`, recipeID, req.UserID).Scan(&exists); err != nil || !exists {
+		writeJSON(w, 404, map[string]any{"error": "recipe not found"})
+		return
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM recipe_ingredients WHERE recipe_id = $1;`, recipeID); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("clear ingredients: %v", err)})
+		return
+	}
+	inserted := 0
+	for _, it := range req.Ingredients {
+		if it.FoodItemID == "" || it.AmountG <= 0 {
+			continue
+		}
+		if _, err := tx.Exec(ctx, `
+      INSERT INTO recipe_ingredients (recipe_id, food_item_id, amount_g)
+      VALUES ($1,$2,$3);
+    `, recipeID, it.FoodItemID, it.AmountG); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("replace ingredient: %v", err)})
+			return
+		}
+		inserted++
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx commit"})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true, "ingredient_count": inserted})
+}
+
+func (a *App) HandleDeleteRecipeIngredient(w http.ResponseWriter, r *http.Request) {
+	recipeID := chi.URLParam(r, "id")
+	ingredientID := chi.URLParam(r, "ingredient_id")
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = "00000000-0000-0000-0000-000000000001"
+	}
+	if recipeID == "" || ingredientID == "" {
+		writeJSON(w, 400, map[string]any{"error": "missing ids"})
+		return
+	}
+	ct, err := a.DB.Exec(r.Context(), `
+    DELETE FROM recipe_ingredients ri
+    USING recipes r
+    WHERE ri.id = $1 AND ri.recipe_id = $2 AND r.id = ri.recipe_id AND r.user_id = $3;
+  `, ingredientID, recipeID, userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete ingredient: %v", err)})
+		return
+	}
+	if ct.RowsAffected() == 0 {
+		writeJSON(w, 404, map[string]any{"error": "ingredient not found"})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+type ExportIngredientsRequest struct {
+	UserID    string   `json:"user_id"`
+	RecipeIDs []string `json:"recipe_ids"`
+}
+
+type CombinedIngredient struct {
+	FoodItemID string  `json:"food_item_id"`
+	Name       string  `json:"name"`
+	Brand      string  `json:"brand"`
+	TotalG     float64 `json:"total_g"`
+}
+
+func (a *App) HandleExportRecipeIngredients(w http.ResponseWriter, r *http.Request) {
+	var req ExportIngredientsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	if req.UserID == "" {
+		req.UserID = "00000000-0000-0000-0000-000000000001"
+	}
+	if len(req.RecipeIDs) == 0 {
+		writeJSON(w, 400, map[string]any{"error": "recipe_ids required"})
+		return
+	}
+	rows, err := a.DB.Query(r.Context(), `
+    SELECT fi.id, fi.name, COALESCE(fi.brand,''), SUM(ri.amount_g)::float8 AS total_g
+    FROM recipe_ingredients ri
+    JOIN recipes r ON r.id = ri.recipe_id
+    JOIN food_items fi ON fi.id = ri.food_item_id
+    WHERE r.user_id = $1 AND r.id = ANY($2::uuid[])
+    GROUP BY fi.id, fi.name, fi.brand
+    ORDER BY fi.name;
+  `, req.UserID, req.RecipeIDs)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export ingredients: %v", err)})
+		return
+	}
+	defer rows.Close()
+	out := []CombinedIngredient{}
+	for rows.Next() {
+		var it CombinedIngredient
+		if err := rows.Scan(&it.FoodItemID, &it.Name, &it.Brand, &it.TotalG); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "scan combined ingredients"})
+			return
+		}
+		out = append(out, it)
+	}
+	writeJSON(w, 200, map[string]any{
+		"ok":          true,
+		"ingredients": out,
+	})
+}
+
+// ── Recipe Tags & Collections ─────────────────────────────────────────────────
+
+const maxTagLen = 40
+
+// normalizeTag lower-cases a tag and joins its words with hyphens, so
+// "High Protein" and "high_protein" both become "high-protein".
+func normalizeTag(tag string) string {
+	tag = strings.TrimLeft(strings.ToLower(strings.TrimSpace(tag)), "#")
+	tag = strings.Join(strings.FieldsFunc(tag, func(r rune) bool {
+		return r == '-' || r == '_' || r == ',' || unicode.IsSpace(r)
+	}), "-")
+	if runes := []rune(tag); len(runes) > maxTagLen {
+		tag = strings.TrimRight(string(runes[:maxTagLen]), "-")
+	}
+	return tag
+}
+
+// normalizeTags normalises and de-duplicates tags, keeping their order.
+func normalizeTags(tags []string) []string {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, t := range tags {
+		if t = normalizeTag(t); t != "" && !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// replaceRecipeTags sets a recipe's tags to exactly tags (already normalised).
+func replaceRecipeTags(ctx context.Context, tx pgx.Tx, recipeID string, tags []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM recipe_tags WHERE recipe_id = $1`, recipeID); err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(ctx, `
+    INSERT INTO recipe_tags (recipe_id, tag)
+    SELECT $1, unnest($2::text[])
+    ON CONFLICT DO NOTHING;
+  `, recipeID, tags)
+	return err
+}
+
+type RecipeTagsRequest struct {
+	UserID string   `json:"user_id"`
+	Tags   []string `json:"tags"`
+}
+
+// HandleReplaceRecipeTags sets a recipe's tags. Tagging a plain food item
+// the user can see turns it into a recipe; clearing tags needs an existing
+// recipe of the user's.
+func (a *App) HandleReplaceRecipeTags(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req RecipeTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	if req.UserID == "" {
+		req.UserID = DefaultUserID
+	}
+	tags := normalizeTags(req.Tags)
+	ctx := r.Context()
+	tx, err := a.DB.Begin(ctx)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx begin"})
+		return
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	var isFood, isRecipe bool
+	err = tx.QueryRow(ctx, `
+    SELECT EXISTS (SELECT 1 FROM food_items WHERE id::text = $1 AND (user_id = $2 OR user_id IS NULL)),
+           EXISTS (SELECT 1 FROM recipes WHERE id::text = $1 AND user_id = $2);
+  `, id, req.UserID).Scan(&isFood, &isRecipe)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("find recipe: %v", err)})
+		return
+	}
+	if !isRecipe && (len(tags) == 0 || !isFood) {
+		writeJSON(w, 404, map[string]any{"error": "recipe not found"})
+		return
+	}
+	if len(tags) > 0 {
+		if _, err := promoteToRecipe(ctx, tx, id, req.UserID); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("promote recipe: %v", err)})
+			return
+		}
+	}
+	if err := replaceRecipeTags(ctx, tx, id, tags); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("save tags: %v", err)})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx commit"})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true, "tags": tags})
+}
+
+type RecipeTagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// HandleListRecipeTags returns every tag the user has used, most used first,
+// for filters and autocomplete.
+func (a *App) HandleListRecipeTags(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	rows, err := a.DB.Query(r.Context(), `
+    SELECT t.tag, COUNT(*)
+    FROM recipe_tags t
+    JOIN recipes r ON r.id = t.recipe_id
+    JOIN food_items fi ON fi.id = r.id
+    WHERE r.user_id = $1 AND fi.is_recipe AND fi.archived_at IS NULL
+    GROUP BY t.tag
+    ORDER BY COUNT(*) DESC, t.tag;
+  `, userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("list tags: %v", err)})
+		return
+	}
+	defer rows.Close()
+	out := []RecipeTagCount{}
+	for rows.Next() {
+		var it RecipeTagCount
+		if err := rows.Scan(&it.Tag, &it.Count); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "scan tags"})
+			return
+		}
+		out = append(out, it)
+	}
+	writeJSON(w, 200, out)
+}
+
+type RecipeCollection struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	RecipeCount int       `json:"recipe_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type RecipeCollectionRequest struct {
+	UserID      string `json:"user_id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// isUniqueViolation reports whether err is a Postgres unique-constraint error.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func (a *App) HandleListRecipeCollections(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	rows, err := a.DB.Query(r.Context(), `
+    SELECT c.id, c.name, c.description, COUNT(ci.recipe_id), c.created_at
+    FROM recipe_collections c
+    LEFT JOIN recipe_collection_items ci ON ci.collection_id = c.id
+    WHERE c.user_id = $1
+    GROUP BY c.id
+    ORDER BY lower(c.name);
+  `, userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("list collections: %v", err)})
+		return
+	}
+	defer rows.Close()
+	out := []RecipeCollection{}
+	for rows.Next() {
+		var it RecipeCollection
+		if err := rows.Scan(&it.ID, &it.Name, &it.Description, &it.RecipeCount, &it.CreatedAt); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "scan collections"})
+			return
+		}
+		out = append(out, it)
+	}
+	writeJSON(w, 200, out)
+}
+
+func (a *App) HandleCreateRecipeCollection(w http.ResponseWriter, r *http.Request) {
+	var req RecipeCollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	if req.UserID == "" {
+		req.UserID = DefaultUserID
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		writeJSON(w, 400, map[string]any{"error": "name required"})
+		return
+	}
+	var id string
+	err := a.DB.QueryRow(r.Context(), `
+    INSERT INTO recipe_collections (user_id, name, description)
+    VALUES ($1,$2,$3) RETURNING id;
+  `, req.UserID, req.Name, strings.TrimSpace(req.Description)).Scan(&id)
+	if isUniqueViolation(err) {
+		writeJSON(w, 409, map[string]any{"error": "a collection with that name already exists"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("create collection: %v", err)})
+		return
+	}
+	writeJSON(w, 201, map[string]any{"ok": true, "id": id})
+}
+
+func (a *App) HandleUpdateRecipeCollection(w http.ResponseWriter, r *http.Request) {
+	var req RecipeCollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	if req.UserID == "" {
+		req.UserID = DefaultUserID
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		writeJSON(w, 400, map[string]any{"error": "name required"})
+		return
+	}
+	ct, err := a.DB.Exec(r.Context(), `
+    UPDATE recipe_collections SET name = $1, description = $2
+    WHERE id::text = $3 AND user_id = $4;
+  `, req.Name, strings.TrimSpace(req.Description), chi.URLParam(r, "id"), req.UserID)
+	if isUniqueViolation(err) {
+		writeJSON(w, 409, map[string]any{"error": "a collection with that name already exists"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("update collection: %v", err)})
+		return
+	}
+	if ct.RowsAffected() == 0 {
+		writeJSON(w, 404, map[string]any{"error": "collection not found"})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+// HandleDeleteRecipeCollection deletes a collection; its recipes stay.
+func (a *App) HandleDeleteRecipeCollection(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	ct, err := a.DB.Exec(r.Context(), `DELETE FROM recipe_collections WHERE id::text = $1 AND user_id = $2`, chi.URLParam(r, "id"), userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete collection: %v", err)})
+		return
+	}
+	if ct.RowsAffected() == 0 {
+		writeJSON(w, 404, map[string]any{"error": "collection not found"})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+type AddToCollectionRequest struct {
+	UserID   string `json:"user_id"`
+	RecipeID string `json:"recipe_id"`
+}
+
+func (a *App) HandleAddToRecipeCollection(w http.ResponseWriter, r *http.Request) {
+	var req AddToCollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RecipeID == "" {
+		writeJSON(w, 400, map[string]any{"error": "recipe_id required"})
+		return
+	}
+	if req.UserID == "" {
+		req.UserID = DefaultUserID
+	}
+	// Both sides must belong to the user. The no-op update on conflict keeps
+	// re-adding idempotent while still counting as a row.
+	ct, err := a.DB.Exec(r.Context(), `
+    INSERT INTO recipe_collection_items (collection_id, recipe_id)
+    SELECT c.id, rc.id
+    FROM recipe_collections c, recipes rc
+    WHERE c.id::text = $1 AND c.user_id = $3 AND rc.id::text = $2 AND rc.user_id = $3
+    ON CONFLICT (collection_id, recipe_id) DO UPDATE SET added_at = recipe_collection_items.added_at;
+  `, chi.URLParam(r, "id"), req.RecipeID, req.UserID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("add to collection: %v", err)})
+		return
+	}
+	if ct.RowsAffected() == 0 {
+		writeJSON(w, 404, map[string]any{"error": "collection or recipe not found"})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+func (a *App) HandleRemoveFromRecipeCollection(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	ct, err := a.DB.Exec(r.Context(), `
+    DELETE FROM recipe_collection_items ci
+    USING recipe_collections c
+    WHERE c.id = ci.collection_id AND c.user_id = $3
+      AND ci.collection_id::text = $1 AND ci.recipe_id::text = $2;
+  `, chi.URLParam(r, "id"), chi.URLParam(r, "recipe_id"), userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("remove from collection: %v", err)})
+		return
+	}
+	if ct.RowsAffected() == 0 {
+		writeJSON(w, 404, map[string]any{"error": "recipe not in collection"})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+// ── Recipe Import ─────────────────────────────────────────────────────────────
+
+// recipeImportMaxBytes caps fetched pages and images.
+const recipeImportMaxBytes = 5 << 20
+
+// recipeImportClient fetches URLs given by users and, for images, by the
+// pages themselves. Its dialer refuses non-public addresses after DNS
+// resolution, which covers every redirect hop too, and it ignores proxy
+// settings so the check applies to the real target.
+var recipeImportClient = newPublicOnlyClient(15 * time.Second)
+
+var errNonPublicAddress = errors.New("refusing to fetch a private, loopback or link-local address")
+
+// nonPublicPrefixes are blocks that netip's helpers don't already cover.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+}
+
+// isPublicAddr reports whether ip is a globally routable unicast address.
+func isPublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, p := range nonPublicPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func newPublicOnlyClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !isPublicAddr(ip) {
+				return fmt.Errorf("%w: %s", errNonPublicAddress, ip)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("stopped after 5 redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+type ImportRecipeRequest struct {
+	UserID string `json:"user_id"`
+	// URL is fetched server-side unless HTML is given. With both, URL only
+	// resolves relative links and is kept as the source.
+	URL    string `json:"url"`
+	HTML   string `json:"html"`
+	DryRun bool   `json:"dry_run"`
+}
+
+type ImportedIngredient struct {
+	Line   string  `json:"line"`
+	Name   string  `json:"name"`
+	Amount float64 `json:"amount"`
+	Unit   string  `json:"unit"`
+	Note   string  `json:"note,omitempty"`
+}
+
+// ImportedRecipe is what could be read from a page's schema.org Recipe.
+// Nutrition is per serving, where yield_count servings make the recipe.
+type ImportedRecipe struct {
+	Name               string               `json:"name"`
+	SourceURL          string               `json:"source_url,omitempty"`
+	YieldCount         int                  `json:"yield_count"`
+	ServingLabel       string               `json:"serving_label"`
+	Instructions       string               `json:"instructions"`
+	Ingredients        []ImportedIngredient `json:"ingredients"`
+	HasNutrition       bool                 `json:"has_nutrition"`
+	CaloriesPerServing float64              `json:"calories_per_serving"`
+	ProteinPerServing  float64              `json:"protein_g_per_serving"`
+	CarbsPerServing    float64              `json:"carbs_g_per_serving"`
+	FatPerServing      float64              `json:"fat_g_per_serving"`
+	FiberPerServing    float64              `json:"fiber_g_per_serving"`
+	Nutrients          map[string]float64   `json:"nutrients,omitempty"`
+	ImageURL           string               `json:"image_url,omitempty"`
+	Tags               []string             `json:"tags"`
+}
+
+var errNoRecipe = errors.New("no schema.org Recipe found on the page")
+
+// HandleImportRecipe creates a recipe from a page's schema.org Recipe data
+// (JSON-LD, or microdata as a fallback). With dry_run it only returns what
+// was parsed.
+func (a *App) HandleImportRecipe(w http.ResponseWriter, r *http.Request) {
+	var req ImportRecipeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	if req.UserID == "" {
+		req.UserID = DefaultUserID
+	}
+	var base *url.URL
+	if req.URL != "" {
+		u, err := url.Parse(strings.TrimSpace(req.URL))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			writeJSON(w, 400, map[string]any{"error": "url must be an absolute http(s) URL"})
+			return
+		}
+		base = u
+	}
+	ctx := r.Context()
+	page := req.HTML
+	if page == "" {
+		if base == nil {
+			writeJSON(w, 400, map[string]any{"error": "url or html required"})
+			return
+		}
+		body, contentType, err := fetchLimited(ctx, base.String(), "text/html,application/xhtml+xml")
+		if errors.Is(err, errNonPublicAddress) {
+			writeJSON(w, 400, map[string]any{"error": fmt.Sprintf("fetch page: %v", err)})
+			return
+		}
+		if err != nil {
+			writeJSON(w, 502, map[string]any{"error": fmt.Sprintf("fetch page: %v", err)})
+			return
+		}
+		if !isHTMLContent(contentType, body) {
+			writeJSON(w, 422, map[string]any{"error": fmt.Sprintf("%s is not an HTML page (%s)", base, contentType)})
+			return
+		}
+		page = string(body)
+	}
+	rec, err := scrapeRecipe(page, base)
+	if errors.Is(err, errNoRecipe) {
+		writeJSON(w, 422, map[string]any{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, 400, map[string]any{"error": err.Error()})
+		return
+	}
+	if req.DryRun {
+		writeJSON(w, 200, map[string]any{"recipe": rec})
+		return
+	}
+
+	warnings := []string{}
+	if !rec.HasNutrition {
+		warnings = append(warnings, "no nutrition data on the page; macros left at zero")
+	}
+	var photo []byte
+	if rec.ImageURL != "" {
+		if photo, err = fetchImage(ctx, rec.ImageURL); err != nil {
+			warnings = append(warnings, fmt.Sprintf("image not saved: %v", err))
+		}
+	}
+
+	tx, err := a.DB.Begin(ctx)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx begin"})
+		return
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	var id string
+	err = tx.QueryRow(ctx, `
+    INSERT INTO food_items (user_id, name, brand, serving_label, calories_per_serving, protein_g_per_serving, carbs_g_per_serving, fat_g_per_serving, fiber_g_per_serving, source, is_recipe)
+    VALUES ($1,$2,'',$3,$4,$5,$6,$7,$8,'web',true) RETURNING id;
+  `, req.UserID, rec.Name, rec.ServingLabel, rec.CaloriesPerServing, rec.ProteinPerServing, rec.CarbsPerServing, rec.FatPerServing, rec.FiberPerServing).Scan(&id)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("create food item: %v", err)})
+		return
+	}
+	_, err = tx.Exec(ctx, `
+    INSERT INTO recipes (id, user_id, name, instructions, yield_count)
+    VALUES ($1,$2,$3,$4,$5);
+  `, id, req.UserID, rec.Name, rec.Instructions, rec.YieldCount)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("create recipe: %v", err)})
+		return
+	}
+	for i, it := range rec.Ingredients {
+		if _, err := tx.Exec(ctx, `
+      INSERT INTO recipe_shopping_items (recipe_id, name, amount, unit, sort_order)
+      VALUES ($1,$2,$3,$4,$5);
+    `, id, it.Name, it.Amount, it.Unit, i); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("insert shopping item: %v", err)})
+			return
+		}
+	}
+	if err := saveFoodNutrients(ctx, tx, id, rec.Nutrients); err != nil {
+		writeJSON(w, nutrientErrorStatus(err), map[string]any{"error": fmt.Sprintf("save nutrients: %v", err)})
+		return
+	}
+	if err := replaceRecipeTags(ctx, tx, id, rec.Tags); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("save tags: %v", err)})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx commit"})
+		return
+	}
+	// The photo is saved after the recipe exists; failing it only warns.
+	photoSaved := false
+	if photo != nil {
+		if _, err := a.saveRecipePhoto(ctx, id, photo); err != nil {
+			warnings = append(warnings, fmt.Sprintf("image not saved: %v", err))
+		} else {
+			photoSaved = true
+		}
+	}
+	writeJSON(w, 201, map[string]any{"ok": true, "id": id, "recipe": rec, "photo_saved": photoSaved, "warnings": warnings})
+}
+
+// fetchLimited GETs rawURL and returns its body and Content-Type, refusing
+// anything larger than recipeImportMaxBytes.
+func fetchLimited(ctx context.Context, rawURL, accept string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", "intake-recipe-import/1.0")
+	req.Header.Set("Accept", accept)
+	resp, err := recipeImportClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("%s returned %s", rawURL, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, recipeImportMaxBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(body) > recipeImportMaxBytes {
+		return nil, "", fmt.Errorf("%s is larger than %d MB", rawURL, recipeImportMaxBytes>>20)
+	}
+	return body, resp.Header.Get("Content-Type"), nil
+}
+
+// isHTMLContent reports whether a fetched page is HTML, sniffing the body
+// when the server sent no Content-Type.
+func isHTMLContent(contentType string, body []byte) bool {
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	mime, _, _ := strings.Cut(contentType, ";")
+	switch strings.TrimSpace(strings.ToLower(mime)) {
+	case "text/html", "application/xhtml+xml":
+		return true
+	}
+	return false
+}
+
+// fetchImage downloads an image, checking that it really is one.
+func fetchImage(ctx context.Context, rawURL string) ([]byte, error) {
+	data, contentType, err := fetchLimited(ctx, rawURL, "image/*")
+	if err != nil {
+		return nil, err
+	}
+	mime, _, _ := strings.Cut(contentType, ";")
+	mime = strings.TrimSpace(strings.ToLower(mime))
+	if !strings.HasPrefix(mime, "image/") {
+		mime = http.DetectContentType(data)
+	}
+	if !strings.HasPrefix(mime, "image/") {
+		return nil, fmt.Errorf("%s is not an image (%s)", rawURL, mime)
+	}
+	return data, nil
+}
+
+// scrapeRecipe reads the first schema.org Recipe on the page. base, when
+// set, resolves relative image links.
+func scrapeRecipe(page string, base *url.URL) (ImportedRecipe, error) {
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		return ImportedRecipe{}, fmt.Errorf("parse html: %w", err)
+	}
+	node := findJSONLDRecipe(doc)
+	if node == nil {
+		node = findMicrodataRecipe(doc)
+	}
+	if node == nil {
+		return ImportedRecipe{}, errNoRecipe
+	}
+	rec := ImportedRecipe{
+		Name:         ldText(node["name"]),
+		YieldCount:   ldYield(node["recipeYield"]),
+		ServingLabel: "1 serving",
+		Ingredients:  []ImportedIngredient{},
+	}
+	if rec.Name == "" {
+		return ImportedRecipe{}, errors.New("recipe has no name")
+	}
+	if base != nil {
+		rec.SourceURL = base.String()
+	}
+
+	lines := ldValues(node["recipeIngredient"])
+	if len(lines) == 0 {
+		lines = ldValues(node["ingredients"])
+	}
+	for _, v := range lines {
+		line := ldText(v)
+		if line == "" {
+			continue
+		}
+		p := parseIngredientLine(line)
+		if p.Name == "" {
+			p.Name = strings.ToLower(line)
+		}
+		rec.Ingredients = append(rec.Ingredients, ImportedIngredient{Line: line, Name: p.Name, Amount: p.Amount, Unit: p.Unit, Note: p.Note})
+	}
+
+	var md []string
+	if desc := ldText(node["description"]); desc != "" {
+		md = append(md, desc)
+	}
+	var times []string
+	for _, t := range []struct{ label, key string }{{"Prep", "prepTime"}, {"Cook", "cookTime"}, {"Total", "totalTime"}} {
+		if d := formatISODuration(ldText(node[t.key])); d != "" {
+			times = append(times, fmt.Sprintf("**%s:** %s", t.label, d))
+		}
+	}
+	if len(times) > 0 {
+		md = append(md, strings.Join(times, " · "))
+	}
+	if steps := ldInstructions(node["recipeInstructions"]); steps != "" {
+		md = append(md, steps)
+	}
+	if rec.SourceURL != "" {
+		md = append(md, "Source: "+rec.SourceURL)
+	}
+	rec.Instructions = strings.Join(md, "\n\n")
+
+	if nutrition, ok := ldFirst(node["nutrition"]).(map[string]any); ok {
+		rec.readNutrition(nutrition)
+	}
+	rec.ImageURL = ldImage(node["image"], base)
+
+	// Category and cuisine ("Dinner", "Italian") become tags; keywords are
+	// left out as sites fill them with SEO phrases.
+	var tags []string
+	for _, key := range []string{"recipeCategory", "recipeCuisine"} {
+		for _, v := range ldValues(node[key]) {
+			tags = append(tags, strings.Split(ldText(v), ",")...)
+		}
+	}
+	rec.Tags = normalizeTags(tags)
+	return rec, nil
+}
+
+// readNutrition fills macros and micronutrients from a NutritionInformation
+// object, converting to the units the food tables use.
+func (rec *ImportedRecipe) readNutrition(n map[string]any) {
+	if size := ldText(n["servingSize"]); size != "" {
+		rec.ServingLabel = size
+	}
+	if v, unit, ok := parseMeasure(ldText(n["calories"])); ok {
+		if unit == "kj" {
+			v /= 4.184
+		}
+		rec.CaloriesPerServing = math.Round(v)
+		rec.HasNutrition = true
+	}
+	for key, dst := range map[string]*float64{
+		"proteinContent":      &rec.ProteinPerServing,
+		"carbohydrateContent": &rec.CarbsPerServing,
+		"fatContent":          &rec.FatPerServing,
+		"fiberContent":        &rec.FiberPerServing,
+	} {
+		if v, unit, ok := parseMeasure(ldText(n[key])); ok {
+			if g, ok := convertMass(v, unit, "g"); ok {
+				*dst = math.Round(g*10) / 10
+				rec.HasNutrition = true
+			}
+		}
+	}
+	for key, nut := range schemaNutrients {
+		if v, unit, ok := parseMeasure(ldText(n[key])); ok {
+			if amt, ok := convertMass(v, unit, nut.unit); ok {
+				if rec.Nutrients == nil {
+					rec.Nutrients = map[string]float64{}
+				}
+				rec.Nutrients[nut.key] = math.Round(amt*10) / 10
+			}
+		}
+	}
+}
+
+// schemaNutrients maps NutritionInformation properties to seeded nutrient
+// keys and their units.
+var schemaNutrients = map[string]struct{ key, unit string }{
+	"sugarContent":        {"sugar", "g"},
+	"sodiumContent":       {"sodium", "mg"},
+	"saturatedFatContent": {"saturated_fat", "g"},
+	"cholesterolContent":  {"cholesterol", "mg"},
+}
+
+var massUnits = map[string]float64{"g": 1, "gram": 1, "grams": 1, "mg": 0.001, "mcg": 1e-6, "µg": 1e-6, "μg": 1e-6, "ug": 1e-6, "kg": 1000}
+
+// convertMass converts v from one mass unit to another. A missing unit is
+// taken to already be in the target unit.
+func convertMass(v float64, from, to string) (float64, bool) {
+	if from == "" {
+		return v, true
+	}
+	f, ok := massUnits[from]
+	t, ok2 := massUnits[to]
+	if !ok || !ok2 {
+		return 0, false
+	}
+	return v * f / t, true
+}
+
+var (
+	measureRe        = regexp.MustCompile(`(\d+(?:[.,]\d+)*)\s*([a-zµμ]*)`)
+	thousandsGroupRe = regexp.MustCompile(`^\d{1,3}(,\d{3})+$`)
+)
+
+// parseMeasure reads "12 g", "250 kcal" or "1,200mg" into a number and a
+// lower-case unit.
+func parseMeasure(s string) (float64, string, bool) {
+	m := measureRe.FindStringSubmatch(strings.ToLower(s))
+	if m == nil {
+		return 0, "", false
+	}
+	num := m[1]
+	if thousandsGroupRe.MatchString(num) {
+		num = strings.ReplaceAll(num, ",", "")
+	} else {
+		num = strings.ReplaceAll(num, ",", ".")
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return v, m[2], true
+}
+
+var isoDurationRe = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:\d+(?:\.\d+)?S)?)?$`)
+
+// formatISODuration turns "PT1H30M" into "1 h 30 min".
+func formatISODuration(s string) string {
+	m := isoDurationRe.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(s)))
+	if m == nil {
+		return ""
+	}
+	var parts []string
+	for i, unit := range []string{"d", "h", "min"} {
+		if n, _ := strconv.Atoi(m[i+1]); n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, unit))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// ldYield reads recipeYield ("4", 4, "Serves 4", ["4", "4 servings"]) as a
+// serving count, defaulting to 1.
+func ldYield(v any) int {
+	for _, y := range ldValues(v) {
+		if n, _, ok := parseMeasure(ldText(y)); ok && n >= 1 {
+			return int(math.Round(n))
+		}
+	}
+	return 1
+}
+
+// ldInstructions renders recipeInstructions (text, HowToStep and
+// HowToSection in any nesting) as a numbered Markdown list, one heading per
+// section.
+func ldInstructions(v any) string {
+	var sb strings.Builder
+	n := 0
+	var walk func(v any)
+	walk = func(v any) {
+		for _, it := range ldValues(v) {
+			m, ok := it.(map[string]any)
+			if !ok {
+				for _, line := range htmlLines(ldString(it)) {
+					n++
+					fmt.Fprintf(&sb, "%d. %s\n", n, line)
+				}
+				continue
+			}
+			if ldHasType(m, "HowToSection") {
+				if sb.Len() > 0 {
+					sb.WriteString("\n")
+				}
+				if name := ldText(m["name"]); name != "" {
+					fmt.Fprintf(&sb, "### %s\n\n", name)
+				}
+				n = 0
+				walk(m["itemListElement"])
+				continue
+			}
+			if m["itemListElement"] != nil {
+				walk(m["itemListElement"])
+				continue
+			}
+			text := m["text"]
+			if text == nil {
+				text = m["name"]
+			}
+			walk(text)
+		}
+	}
+	walk(v)
+	return strings.TrimSpace(sb.String())
+}
+
+// ldImage returns the first usable absolute image URL.
+func ldImage(v any, base *url.URL) string {
+	for _, it := range ldValues(v) {
+		ref := ldString(it)
+		if m, ok := it.(map[string]any); ok {
+			ref = ldString(m["url"])
+			if ref == "" {
+				ref = ldString(m["contentUrl"])
+			}
+		}
+		u, err := url.Parse(strings.TrimSpace(ref))
+		if err != nil || ref == "" {
+			continue
+		}
+		if base != nil {
+			u = base.ResolveReference(u)
+		}
+		if u.Scheme == "http" || u.Scheme == "https" {
+			return u.String()
+		}
+	}
+	return ""
+}
+
+// findJSONLDRecipe returns the first Recipe object in the page's
+// application/ld+json blocks, looking through arrays and @graph.
+func findJSONLDRecipe(doc *html.Node) map[string]any {
+	var found map[string]any
+	walkHTML(doc, func(n *html.Node) bool {
+		if found != nil {
+			return false
+		}
+		if n.Type != html.ElementNode || n.Data != "script" {
+			return true
+		}
+		if strings.Contains(strings.ToLower(htmlAttr(n, "type")), "ld+json") && n.FirstChild != nil {
+			var v any
+			if json.Unmarshal([]byte(n.FirstChild.Data), &v) == nil {
+				found = ldFindRecipe(v)
+			}
+		}
+		return false
+	})
+	return found
+}
+
+func ldFindRecipe(v any) map[string]any {
+	switch t := v.(type) {
+	case []any:
+		for _, it := range t {
+			if m := ldFindRecipe(it); m != nil {
+				return m
+			}
+		}
+	case map[string]any:
+		if ldHasType(t, "Recipe") {
+			return t
+		}
+		for _, key := range []string{"@graph", "mainEntity"} {
+			if m := ldFindRecipe(t[key]); m != nil {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+// findMicrodataRecipe converts the first itemscope of type Recipe into the
+// same shape JSON-LD decodes to: every property is a list of strings or
+// nested items.
+func findMicrodataRecipe(doc *html.Node) map[string]any {
+	var found map[string]any
+	walkHTML(doc, func(n *html.Node) bool {
+		if found != nil {
+			return false
+		}
+		if n.Type == html.ElementNode && hasHTMLAttr(n, "itemscope") && schemaType(htmlAttr(n, "itemtype")) == "Recipe" {
+			found = microdataItem(n)
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+func microdataItem(scope *html.Node) map[string]any {
+	item := map[string]any{"@type": schemaType(htmlAttr(scope, "itemtype"))}
+	var collect func(n *html.Node)
+	collect = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			nested := hasHTMLAttr(c, "itemscope")
+			if props := strings.Fields(htmlAttr(c, "itemprop")); len(props) > 0 {
+				var v any
+				if nested {
+					v = microdataItem(c)
+				} else {
+					v = microdataValue(c)
+				}
+				for _, p := range props {
+					list, _ := item[p].([]any)
+					item[p] = append(list, v)
+				}
+			}
+			if !nested {
+				collect(c)
+			}
+		}
+	}
+	collect(scope)
+	return item
+}
+
+func microdataValue(n *html.Node) string {
+	if hasHTMLAttr(n, "content") {
+		return htmlAttr(n, "content")
+	}
+	switch n.Data {
+	case "a", "link", "area":
+		return htmlAttr(n, "href")
+	case "img", "audio", "video", "source", "iframe", "embed", "track":
+		return htmlAttr(n, "src")
+	case "time":
+		if hasHTMLAttr(n, "datetime") {
+			return htmlAttr(n, "datetime")
+		}
+	case "data", "meter":
+		return htmlAttr(n, "value")
+	}
+	return nodeText(n)
+}
+
+// schemaType reduces an itemtype like "https://schema.org/Recipe" to "Recipe".
+func schemaType(itemtype string) string {
+	fields := strings.Fields(itemtype)
+	if len(fields) == 0 {
+		return ""
+	}
+	t := strings.TrimRight(fields[0], "/")
+	return t[strings.LastIndex(t, "/")+1:]
+}
+
+// walkHTML visits n depth-first, descending only where fn returns true.
+func walkHTML(n *html.Node, fn func(*html.Node) bool) {
+	if !fn(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walkHTML(c, fn)
+	}
+}
+
+func htmlAttr(n *html.Node, key string) string {
+	for _, at := range n.Attr {
+		if at.Key == key {
+			return at.Val
+		}
+	}
+	return ""
+}
+
+func hasHTMLAttr(n *html.Node, key string) bool {
+	for _, at := range n.Attr {
+		if at.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+var htmlBlockTags = map[string]bool{"p": true, "li": true, "div": true, "br": true, "tr": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true}
+
+// nodeText is the element's text with a line break after each block.
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	walkHTML(n, func(c *html.Node) bool {
+		switch {
+		case c.Type == html.TextNode:
+			sb.WriteString(c.Data)
+		case c.Type == html.ElementNode && (c.Data == "script" || c.Data == "style"):
+			return false
+		case c.Type == html.ElementNode && htmlBlockTags[c.Data]:
+			sb.WriteString("\n")
+		}
+		return true
+	})
+	return sb.String()
+}
+
+var (
+	htmlBreakRe   = regexp.MustCompile(`(?i)<br\s*/?>|</(?:p|li|div|h[1-6])>`)
+	htmlTagRe     = regexp.MustCompile(`<[^>]*>`)
+	stepNumberRe  = regexp.MustCompile(`(?i)^(?:step\s*)?\d+[.):]\s+`)
+	htmlSpaceRepl = strings.NewReplacer("\u00a0", " ", "\r", "")
+)
+
+// htmlToText strips markup from a JSON-LD string, keeping block breaks as
+// newlines.
+func htmlToText(s string) string {
+	s = htmlBreakRe.ReplaceAllString(s, "\n")
+	s = htmlTagRe.ReplaceAllString(s, "")
+	return htmlSpaceRepl.Replace(html.UnescapeString(s))
+}
+
+// htmlLines splits text into trimmed, non-empty lines without any leading
+// "1." or "Step 1:" numbering.
+func htmlLines(s string) []string {
+	var out []string
+	for _, line := range strings.Split(htmlToText(s), "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		line = stepNumberRe.ReplaceAllString(line, "")
+		if line != "" {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+// ldValues treats a single value and a list the same way.
+func ldValues(v any) []any {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case []any:
+		return t
+	default:
+		return []any{v}
+	}
+}
+
+func ldFirst(v any) any {
+	if vs := ldValues(v); len(vs) > 0 {
+		return vs[0]
+	}
+	return nil
+}
+
+// ldString returns the first value as a raw string; objects yield their
+// @value, text, name or url.
+func ldString(v any) string {
+	switch t := ldFirst(v).(type) {
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case map[string]any:
+		for _, key := range []string{"@value", "text", "name", "url"} {
+			if s := ldString(t[key]); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// ldText is ldString without markup and with whitespace collapsed.
+func ldText(v any) string {
+	return strings.Join(strings.Fields(htmlToText(ldString(v))), " ")
+}
+
+func ldHasType(m map[string]any, typ string) bool {
+	for _, t := range ldValues(m["@type"]) {
+		if s, ok := t.(string); ok && (s == typ || strings.HasSuffix(s, "/"+typ)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ── Recipe Ingredient Parsing ─────────────────────────────────────────────────
+
+type IngredientMatch struct {
+	FoodItemID   string  `json:"food_item_id"`
+	Name         string  `json:"name"`
+	Brand        string  `json:"brand"`
+	ServingLabel string  `json:"serving_label"`
+	Score        float64 `json:"score"`
+	AmountG      float64 `json:"amount_g"` // 0 when the quantity can't be weighed
+	Warning      string  `json:"warning,omitempty"`
+}
+
+// ParsedIngredient is one recipe line split into its parts. Amount is the low
+// end of a range such as "2-3"; AmountMax is the high end.
+type ParsedIngredient struct {
+	Line       string            `json:"line"`
+	Amount     float64           `json:"amount"` // 0 means unspecified
+	AmountMax  float64           `json:"amount_max,omitempty"`
+	Unit       string            `json:"unit"` // canonical unit, "" for a plain count
+	Name       string            `json:"name"`
+	Note       string            `json:"note,omitempty"`
+	FoodItemID string            `json:"food_item_id,omitempty"` // best match, when matching
+	AmountG    float64           `json:"amount_g,omitempty"`
+	Matches    []IngredientMatch `json:"matches,omitempty"`
+	Warning    string            `json:"warning,omitempty"` // set when no name could be read
+}
+
+var (
+	amountPattern     = `\d+\s+\d+/\d+|\d+/\d+|\d+(?:\.\d+)?`
+	ingredientRangeRe = regexp.MustCompile(`^(` + amountPattern + `)\s*(?:-|–|—|to|or)\s*(` + amountPattern + `)\b`)
+	fluidOunceRe      = regexp.MustCompile(`\bfl(?:uid)?\.?\s*(?:oz|ounces?)\b`)
+	abbrevDotRe       = regexp.MustCompile(`\b([a-z]+)\.`)
+	trailingNoteRe    = regexp.MustCompile(`^(.*?)\s+(to taste|for (?:garnish|serving|dusting|frying|greasing)|as needed|optional|if desired|or more|plus (?:more|extra)\b.*|divided)$`)
+)
+
+// prepWords describe how an ingredient is prepared rather than what it is,
+// so "diced yellow onion" matches the food "yellow onion". Words that change
+// the food itself (cooked, dried, ground) are deliberately absent.
+var prepWords = map[string]bool{
+	"chopped": true, "diced": true, "minced": true, "sliced": true, "grated": true, "shredded": true,
+	"crushed": true, "peeled": true, "cubed": true, "halved": true, "quartered": true, "julienned": true,
+	"mashed": true, "melted": true, "softened": true, "beaten": true, "whisked": true, "toasted": true,
+	"rinsed": true, "drained": true, "trimmed": true, "pitted": true, "seeded": true, "cored": true,
+	"zested": true, "juiced": true, "sifted": true, "packed": true, "room-temperature": true,
+	"small": true, "medium": true, "large": true, "extra-large": true, "jumbo": true,
+	"heaping": true, "heaped": true, "level": true, "scant": true, "generous": true,
+}
+
+// parseAmountText reads a whole string such as "1 1/2" as a number.
+func parseAmountText(s string) (float64, bool) {
+	words := strings.Fields(s)
+	q, n := parseLeadingAmount(words)
+	return q.Amount, n == len(words) && q.Amount > 0
+}
+
+// parseIngredientLine splits "1 1/2 cups diced yellow onion (about 1 large)"
+// into amount 1.5, unit "cup", name "yellow onion" and note
+// "diced, about 1 large".
+func parseIngredientLine(line string) ParsedIngredient {
+	p := ParsedIngredient{Line: strings.TrimSpace(line)}
+	text := strings.Join(strings.Fields(strings.ToLower(expandFractions(p.Line))), " ")
+	text = strings.TrimLeft(text, "-*•· ")
+
+	var notes []string
+	for _, m := range parentheticalRe.FindAllStringSubmatch(text, -1) {
+		if n := strings.TrimSpace(m[1]); n != "" {
+			notes = append(notes, n)
+		}
+	}
+	text = parentheticalRe.ReplaceAllString(text, " ")
+	text = fluidOunceRe.ReplaceAllString(text, "floz")
+	text = abbrevDotRe.ReplaceAllString(text, "$1")
+	if head, tail, ok := strings.Cut(text, ","); ok {
+		text = head
+		if tail = strings.TrimSpace(tail); tail != "" {
+			notes = append(notes, tail)
+		}
+	}
+	text = strings.TrimSpace(text)
+	if m := ingredientRangeRe.FindStringSubmatch(text); m != nil {
+		lo, okLo := parseAmountText(m[1])
+		hi, okHi := parseAmountText(m[2])
+		if okLo && okHi && hi > lo {
+			p.AmountMax = hi
+			text = m[1] + text[len(m[0]):]
+		}
+	}
+
+	words := strings.Fields(text)
+	q, n := parseLeadingAmount(words)
+	words = words[n:]
+	var prep []string
+	for len(words) > 1 {
+		w := words[0]
+		if prepWords[w] || (strings.HasSuffix(w, "ly") && prepWords[words[1]]) {
+			prep = append(prep, w)
+			words = words[1:]
+			continue
+		}
+		// "2 large cloves garlic": the unit follows a size word.
+		if u, ok := foodUnits[w]; ok && q.Amount > 0 && q.Unit == "" && len(prep) > 0 {
+			q.Unit = u.Canonical
+			words = words[1:]
+			if len(words) > 1 && words[0] == "of" {
+				words = words[1:]
+			}
+			continue
+		}
+		break
+	}
+	name := strings.Join(words, " ")
+	if m := trailingNoteRe.FindStringSubmatch(name); m != nil {
+		name = m[1]
+		notes = append(notes, m[2])
+	}
+	if len(prep) > 0 {
+		notes = append([]string{strings.Join(prep, " ")}, notes...)
+	}
+	p.Name = strings.TrimSpace(name)
+	p.Note = strings.Join(notes, ", ")
+	p.Amount, p.Unit = q.Amount, q.Unit
+	return p
+}
+
+// servingGrams finds the gram weight of one serving from a label such as
+// "100 g" or "2 slices (56 g)".
+func servingGrams(servingLabel string) (float64, bool) {
+	labels := []string{servingLabel}
+	for _, m := range parentheticalRe.FindAllStringSubmatch(servingLabel, -1) {
+		labels = append(labels, m[1])
+	}
+	for _, l := range labels {
+		_, lq := parseFoodPhrase(l)
+		if u, ok := foodUnits[lq.Unit]; ok && u.Dimension == "mass" && lq.Amount > 0 {
+			return lq.Amount * u.ToBase, true
+		}
+	}
+	return 0, false
+}
+
+// gramsFor converts q into grams of a food with the given serving label, as
+// recipe_ingredients stores. Volumes without a known weight assume the
+// density of water; a non-empty warning says so or explains a zero result.
+func gramsFor(q ParsedQuantity, servingLabel string) (float64, string) {
+	if q.Amount <= 0 {
+		return 0, "no amount given"
+	}
+	u, known := foodUnits[q.Unit]
+	if known && u.Dimension == "mass" {
+		return math.Round(q.Amount*u.ToBase*10) / 10, ""
+	}
+	if perServing, ok := servingGrams(servingLabel); ok {
+		if servings, warning := servingsFor(q, servingLabel); warning == "" {
+			return math.Round(servings*perServing*10) / 10, ""
+		}
+	}
+	if known && u.Dimension == "volume" {
+		return math.Round(q.Amount*u.ToBase*10) / 10, fmt.Sprintf("no gram weight for %q; assumed 1 g per ml", servingLabel)
+	}
+	return 0, fmt.Sprintf("can't weigh %s %s of %q", strconv.FormatFloat(q.Amount, 'f', -1, 64), q.Unit, servingLabel)
+}
+
+// autoMatchScore is the lowest match score used to fill recipe_ingredients
+// without asking.
+const autoMatchScore = 0.75
+
+func rankIngredientMatches(p ParsedIngredient, foods []FoodItem, limit int) []IngredientMatch {
+	q := ParsedQuantity{Amount: p.Amount, Unit: p.Unit}
+	out := []IngredientMatch{}
+	for _, m := range rankFoodMatches(p.Name, q, foods, limit) {
+		grams, warning := gramsFor(q, m.ServingLabel)
+		out = append(out, IngredientMatch{
+			FoodItemID: m.FoodItemID, Name: m.Name, Brand: m.Brand, ServingLabel: m.ServingLabel,
+			Score: m.Score, AmountG: grams, Warning: warning,
+		})
+	}
+	return out
+}
+
+type ParseIngredientsRequest struct {
+	UserID string   `json:"user_id"`
+	Text   string   `json:"text"` // one ingredient per line
+	Lines  []string `json:"lines"`
+	Match  bool     `json:"match"`
+	// RecipeID adds every line with a confident match and a gram weight to
+	// that recipe's ingredients. It implies match.
+	RecipeID string `json:"recipe_id"`
+}
+
+// HandleParseIngredients splits recipe ingredient lines into amount, unit,
+// name and preparation note, optionally matching each to a food item.
+func (a *App) HandleParseIngredients(w http.ResponseWriter, r *http.Request) {
+	var req ParseIngredientsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	if req.UserID == "" {
+		req.UserID = DefaultUserID
+	}
+	lines := append(strings.Split(req.Text, "\n"), req.Lines...)
+	items := []ParsedIngredient{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		// Blank lines and section headers ("For the sauce:") carry no ingredient.
+		if line == "" || strings.HasSuffix(line, ":") {
+			continue
+		}
+		// A line such as "1 1/2 cups" is still returned so the caller can
+		// see what was not understood.
+		p := parseIngredientLine(line)
+		if p.Name == "" {
+			p.Warning = "no ingredient name found"
+		}
+		items = append(items, p)
+	}
+	if len(items) == 0 {
+		writeJSON(w, 400, map[string]any{"error": "text or lines required"})
+		return
+	}
+	if !req.Match && req.RecipeID == "" {
+		writeJSON(w, 200, map[string]any{"items": items})
+		return
+	}
+
+	ctx := r.Context()
+	foods, err := a.loadFoodItemsForMatching(ctx, req.UserID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("load food items: %v", err)})
+		return
+	}
+	for i := range items {
+		p := &items[i]
+		if p.Name == "" {
+			continue
+		}
+		p.Matches = rankIngredientMatches(*p, foods, 3)
+		if len(p.Matches) > 0 && p.Matches[0].Score >= autoMatchScore {
+			p.FoodItemID = p.Matches[0].FoodItemID
+			p.AmountG = p.Matches[0].AmountG
+		}
+	}
+	if req.RecipeID == "" {
+		writeJSON(w, 200, map[string]any{"items": items})
+		return
+	}
+
+	tx, err := a.DB.Begin(ctx)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx begin"})
+		return
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM recipes WHERE id=$1 AND user_id=$2);`, req.RecipeID, req.UserID).Scan(&exists); err != nil || !exists {
+		writeJSON(w, 404, map[string]any{"error": "recipe not found"})
+		return
+	}
+	added := 0
+	for _, p := range items {
+		if p.FoodItemID == "" || p.AmountG <= 0 || p.FoodItemID == req.RecipeID {
+			continue
+		}
+		if _, err := tx.Exec(ctx, `
+      INSERT INTO recipe_ingredients (recipe_id, food_item_id, amount_g)
+      VALUES ($1,$2,$3);
+    `, req.RecipeID, p.FoodItemID, p.AmountG); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("add ingredient: %v", err)})
+			return
+		}
+		added++
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx commit"})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"items": items, "added": added})
+}
+
+// ── Data Export / Import ─────────────────────────────────────────────────────
+
+type ExportFoodItem struct {
+	ID                 string    `json:"id"`
+	UserID             string    `json:"user_id,omitempty"`
+	Name               string    `json:"name"`
+	Brand              string    `json:"brand"`
+	ServingLabel       string    `json:"serving_label"`
+	Source             string    `json:"source"`
+	CaloriesPerServing float64   `json:"calories_per_serving"`
+	ProteinPerServing  float64   `json:"protein_g_per_serving"`
+	CarbsPerServing    float64   `json:"carbs_g_per_serving"`
+	FatPerServing      float64   `json:"fat_g_per_serving"`
+	FiberPerServing    float64   `json:"fiber_g_per_serving"`
+	CreatedAt          time.Time `json:"created_at"`
+
+	Nutrients map[string]float64 `json:"nutrients,omitempty"`
+	// IsRecipe is nil in bundles exported before recipes were decoupled from
+	// food items; import then infers it from the recipe data.
+	IsRecipe *bool `json:"is_recipe,omitempty"`
+}
+
+type ExportRecipe struct {
+	ID           string    `json:"id"`
+	UserID       string    `json:"user_id"`
+	Name         string    `json:"name"`
+	Instructions string    `json:"instructions"`
+	YieldCount   int       `json:"yield_count"`
+	CreatedAt    time.Time `json:"created_at"`
+	// Tags is nil in bundles from before recipe tags; import then leaves the
+	// existing tags alone. Exports always write it, as [] for no tags.
+	Tags []string `json:"tags"`
+}
+
+type ExportRecipeIngredient struct {
+	ID         string    `json:"id"`
+	RecipeID   string    `json:"recipe_id"`
+	FoodItemID string    `json:"food_item_id"`
+	AmountG    float64   `json:"amount_g"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type ExportRecipePortion struct {
+	ID           string    `json:"id"`
+	RecipeID     string    `json:"recipe_id"`
+	Name         string    `json:"name"`
+	PortionCount float64   `json:"portion_count"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type ExportPreset struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	Pinned    bool      `json:"pinned"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ExportPresetItem struct {
+	ID        string    `json:"id"`
+	PresetID  string    `json:"preset_id"`
+	Kind      string    `json:"kind"`
+	RefID     string    `json:"ref_id"`
+	Servings  float64   `json:"servings"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ExportLogEntry struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Kind       string    `json:"kind"`
+	RefID      string    `json:"ref_id"`
+	Servings   float64   `json:"servings"`
+	Meal       string    `json:"meal"`
+	Note       string    `json:"note"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	// Macro snapshot taken at log time; absent in older bundles, in which case
+	// import snapshots from the current food item.
+	CaloriesPerServing  *float64           `json:"calories_per_serving,omitempty"`
+	ProteinPerServing   *float64           `json:"protein_g_per_serving,omitempty"`
+	CarbsPerServing     *float64           `json:"carbs_g_per_serving,omitempty"`
+	FatPerServing       *float64           `json:"fat_g_per_serving,omitempty"`
+	FiberPerServing     *float64           `json:"fiber_g_per_serving,omitempty"`
+	NutrientsPerServing map[string]float64 `json:"nutrients_per_serving,omitempty"`
+}
+
+type ExportBodyWeight struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	MeasuredAt time.Time `json:"measured_at"`
+	WeightKg   float64   `json:"weight_kg"`
+	Source     string    `json:"source"`
+	Note       string    `json:"note"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type ExportBodyMeasurement struct {
+	ID            string    `json:"id"`
+	UserID        string    `json:"user_id"`
+	MeasuredAt    time.Time `json:"measured_at"`
+	Sex           *string   `json:"sex,omitempty"`
+	HeightCm      *float64  `json:"height_cm,omitempty"`
+	BodyFatPct    *float64  `json:"body_fat_pct,omitempty"`
+	BodyFatMethod *string   `json:"body_fat_method,omitempty"`
+	LeanMassKg    *float64  `json:"lean_mass_kg,omitempty"`
+	WaistCm       *float64  `json:"waist_cm,omitempty"`
+	HipsCm        *float64  `json:"hips_cm,omitempty"`
+	ChestCm       *float64  `json:"chest_cm,omitempty"`
+	ArmCm         *float64  `json:"arm_cm,omitempty"`
+	ThighCm       *float64  `json:"thigh_cm,omitempty"`
+	NeckCm        *float64  `json:"neck_cm,omitempty"`
+	Source        string    `json:"source"`
+	Note          string    `json:"note"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ExportProgressPhoto is a progress photo's metadata. File names the
+// original inside a ZIP export; plain JSON exports leave it empty, and
+// importing such an entry restores nothing.
+type ExportProgressPhoto struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	TakenOn     string    `json:"taken_on"`
+	Pose        string    `json:"pose"`
+	Note        string    `json:"note"`
+	ContentType string    `json:"content_type"`
+	CreatedAt   time.Time `json:"created_at"`
+	File        string    `json:"file,omitempty"`
+}
+
+type ExportWorkout struct {
+	ID             string    `json:"id"`
+	StartedAt      time.Time `json:"started_at"`
+	Activity       string    `json:"activity"`
+	DurationMin    float64   `json:"duration_min"`
+	DistanceKm     *float64  `json:"distance_km,omitempty"`
+	Intensity      string    `json:"intensity"`
+	AvgHeartRate   *int      `json:"avg_heart_rate,omitempty"`
+	MaxHeartRate   *int      `json:"max_heart_rate,omitempty"`
+	MET            *float64  `json:"met,omitempty"`
+	WeightKg       *float64  `json:"weight_kg,omitempty"`
+	CaloriesKcal   float64   `json:"calories_kcal"`
+	CaloriesSource string    `json:"calories_source"`
+	Note           string    `json:"note"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ExportDailyActivity is a day's resolved activity. Sources holds what each
+// source reported; older bundles lack it, and import then treats the day's
+// figures as coming from Source.
+type ExportDailyActivity struct {
+	UserID        string                 `json:"user_id"`
+	Date          string                 `json:"date"`
+	Steps         int                    `json:"steps"`
+	ActiveKcalEst float64                `json:"active_calories_kcal_est"`
+	WaterGlasses  int                    `json:"water_glasses"`
+	Source        string                 `json:"source"`
+	CreatedAt     time.Time              `json:"created_at"`
+	Sources       []ExportActivitySource `json:"sources,omitempty"`
+}
+
+type ExportActivitySource struct {
+	Source        string    `json:"source"`
+	Steps         *int      `json:"steps,omitempty"`
+	ActiveKcalEst *float64  `json:"active_calories_kcal_est,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type ExportBundle struct {
+	Version           int                      `json:"version"`
+	ExportedAt        time.Time                `json:"exported_at"`
+	UserID            string                   `json:"user_id"`
+	FoodItems         []ExportFoodItem         `json:"food_items"`
+	Recipes           []ExportRecipe           `json:"recipes"`
+	RecipeIngredients []ExportRecipeIngredient `json:"recipe_ingredients"`
+	RecipePortions    []ExportRecipePortion    `json:"recipe_portions"`
+	Presets           []ExportPreset           `json:"presets"`
+	PresetItems       []ExportPresetItem       `json:"preset_items"`
+	LogEntries        []ExportLogEntry         `json:"log_entries"`
+	BodyWeights       []ExportBodyWeight       `json:"body_weights"`
+	BodyMeasurements  []ExportBodyMeasurement  `json:"body_measurements"`
+	ProgressPhotos    []ExportProgressPhoto    `json:"progress_photos"`
+	DailyActivity     []ExportDailyActivity    `json:"daily_activity"`
+	Workouts          []ExportWorkout          `json:"workouts"`
+	NutrientDefs      []NutrientDef            `json:"nutrient_definitions,omitempty"`
+}
+
+func (a *App) HandleExportData(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = "00000000-0000-0000-0000-000000000001"
+	}
+	reqID := middleware.GetReqID(r.Context())
+	log.Printf("[api-debug] req_id=%s export start user_id=%s", reqID, userID)
+	ctx := r.Context()
+	out := ExportBundle{
+		Version:    1,
+		ExportedAt: time.Now().UTC(),
+		UserID:     userID,
+	}
+
+	foodRows, err := a.DB.Query(ctx, `
+    SELECT id, COALESCE(user_id::text, ''), name, COALESCE(brand,''), serving_label, source,
+           calories_per_serving, protein_g_per_serving, carbs_g_per_serving, fat_g_per_serving, fiber_g_per_serving, created_at,
+           is_recipe
+    FROM food_items
+    ORDER BY created_at, id;
+  `)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export food_items: %v", err)})
+		return
+	}
+	defer foodRows.Close()
+	for foodRows.Next() {
+		var it ExportFoodItem
+		if err := foodRows.Scan(
+			&it.ID, &it.UserID, &it.Name, &it.Brand, &it.ServingLabel, &it.Source,
+			&it.CaloriesPerServing, &it.ProteinPerServing, &it.CarbsPerServing, &it.FatPerServing, &it.FiberPerServing, &it.CreatedAt,
+			&it.IsRecipe,
+		); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "export food_items scan"})
+			return
+		}
+		out.FoodItems = append(out.FoodItems, it)
+	}
+	foodRows.Close()
+	foodIDs := make([]string, len(out.FoodItems))
+	for i, it := range out.FoodItems {
+		foodIDs[i] = it.ID
+	}
+	foodNutrients, err := a.loadFoodNutrients(ctx, foodIDs)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export food_item_nutrients: %v", err)})
+		return
+	}
+	for i := range out.FoodItems {
+		out.FoodItems[i].Nutrients = foodNutrients[out.FoodItems[i].ID]
+	}
+	if out.NutrientDefs, err = a.loadNutrientDefs(ctx); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export nutrients: %v", err)})
+		return
+	}
+
+	recipeRows, err := a.DB.Query(ctx, `
+    SELECT id, user_id::text, name, COALESCE(instructions,''), yield_count, created_at,
+           COALESCE((SELECT array_agg(t.tag ORDER BY t.tag) FROM recipe_tags t WHERE t.recipe_id = recipes.id), '{}')
+    FROM recipes
+    WHERE user_id = $1
+    ORDER BY created_at, id;
+  `, userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export recipes: %v", err)})
+		return
+	}
+	defer recipeRows.Close()
+	for recipeRows.Next() {
+		var it ExportRecipe
+		if err := recipeRows.Scan(&it.ID, &it.UserID, &it.Name, &it.Instructions, &it.YieldCount, &it.CreatedAt, &it.Tags); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "export recipes scan"})
+			return
+		}
+		if it.Tags == nil {
+			it.Tags = []string{}
+		}
+		out.Recipes = append(out.Recipes, it)
+	}
+
+	ingredientRows, err := a.DB.Query(ctx, `
+    SELECT ri.id, ri.recipe_id::text, ri.food_item_id::text, ri.amount_g, ri.created_at
+    FROM recipe_ingredients ri
+    JOIN recipes r ON r.id = ri.recipe_id
+    WHERE r.user_id = $1
+    ORDER BY ri.created_at, ri.id;
+  `, userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export recipe_ingredients: %v", err)})
+		return
+	}
+	defer ingredientRows.Close()
+	for ingredientRows.Next() {
+		var it ExportRecipeIngredient
+		if err := ingredientRows.Scan(&it.ID, &it.RecipeID, &it.FoodItemID, &it.AmountG, &it.CreatedAt); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "export recipe_ingredients scan"})
+			return
+		}
+		out.RecipeIngredients = append(out.RecipeIngredients, it)
+	}
+
+	portionRows, err := a.DB.Query(ctx, `
+    SELECT rp.id, rp.recipe_id::text, rp.name, rp.portion_count, rp.created_at
+    FROM recipe_portions rp
+    JOIN recipes r ON r.id = rp.recipe_id
+    WHERE r.user_id = $1
+    ORDER BY rp.created_at, rp.id;
+  `, userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export recipe_portions: %v", err)})
+		return
+	}
+	defer portionRows.Close()
+	for portionRows.Next() {
+		var it ExportRecipePortion
+		if err := portionRows.Scan(&it.ID, &it.RecipeID, &it.Name, &it.PortionCount, &it.CreatedAt); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "export recipe_portions scan"})
+			return
+		}
+		out.RecipePortions = append(out.RecipePortions, it)
+	}
+
+	presetRows, err := a.DB.Query(ctx, `
+    SELECT id, user_id::text, name, pinned, created_at
+    FROM presets
+    WHERE user_id = $1
+    ORDER BY created_at, id;
+  `, userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export presets: %v", err)})
+		return
+	}
+	defer presetRows.Close()
+	for presetRows.Next() {
+		var it ExportPreset
+		if err := presetRows.Scan(&it.ID, &it.UserID, &it.Name, &it.Pinned, &it.CreatedAt); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "export presets scan"})
+			return
+		}
+		out.Presets = append(out.Presets, it)
+	}
+
+	presetItemRows, err := a.DB.Query(ctx, `
+    SELECT pi.id, pi.preset_id::text, pi.kind, pi.ref_id::text, pi.servings, pi.created_at
+    FROM preset_items pi
+    JOIN presets p ON p.id = pi.preset_id
+    WHERE p.user_id = $1
+    ORDER BY pi.created_at, pi.id;
+  `, userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export preset_items: %v", err)})
+		return
+	}
+	defer presetItemRows.Close()
+	for presetItemRows.Next() {
+		var it ExportPresetItem
+		if err := presetItemRows.Scan(&it.ID, &it.PresetID, &it.Kind, &it.RefID, &it.Servings, &it.CreatedAt); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "export preset_items scan"})
+			return
+		}
+		out.PresetItems = append(out.PresetItems, it)
+	}
+
+	logRows, err := a.DB.Query(ctx, `
+    SELECT id, user_id::text, occurred_at, kind, ref_id::text, servings, meal, COALESCE(note,''), created_at,
+           calories_per_serving, protein_g_per_serving, carbs_g_per_serving, fat_g_per_serving, fiber_g_per_serving,
+           nutrients_per_serving
+    FROM log_entries
+    WHERE user_id = $1
+    ORDER BY occurred_at, id;
+  `, userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export log_entries: %v", err)})
+		return
+	}
+	defer logRows.Close()
+	for logRows.Next() {
+		var it ExportLogEntry
+		if err := logRows.Scan(&it.ID, &it.UserID, &it.OccurredAt, &it.Kind, &it.RefID, &it.Servings, &it.Meal, &it.Note, &it.CreatedAt,
+			&it.CaloriesPerServing, &it.ProteinPerServing, &it.CarbsPerServing, &it.FatPerServing, &it.FiberPerServing,
+			&it.NutrientsPerServing); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "export log_entries scan"})
+			return
+		}
+		out.LogEntries = append(out.LogEntries, it)
+	}
+
+	weightRows, err := a.DB.Query(ctx, `
+    SELECT id, user_id::text, measured_at, weight_kg, source, COALESCE(note,''), created_at
+    FROM body_weights
+    WHERE user_id = $1
+    ORDER BY measured_at, id;
+  `, userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export body_weights: %v", err)})
+		return
+	}
+	defer weightRows.Close()
+	for weightRows.Next() {
+		var it ExportBodyWeight
+		if err := weightRows.Scan(&it.ID, &it.UserID, &it.MeasuredAt, &it.WeightKg, &it.Source, &it.Note, &it.CreatedAt); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "export body_weights scan"})
+			return
+		}
+		out.BodyWeights = append(out.BodyWeights, it)
+	}
+
+	measurementRows, err := a.DB.Query(ctx, `
+    SELECT id, user_id::text, measured_at, sex, height_cm::float8, body_fat_pct::float8, body_fat_method,
+           lean_mass_kg::float8, waist_cm::float8, hips_cm::float8, chest_cm::float8, arm_cm::float8,
+           thigh_cm::float8, neck_cm::float8, source, COALESCE(note,''), created_at
+    FROM body_measurements
+    WHERE user_id = $1
+    ORDER BY measured_at, id;
+  `, userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export body_measurements: %v", err)})
+		return
+	}
+	defer measurementRows.Close()
+	for measurementRows.Next() {
+		var it ExportBodyMeasurement
+		if err := measurementRows.Scan(&it.ID, &it.UserID, &it.MeasuredAt, &it.Sex, &it.HeightCm, &it.BodyFatPct, &it.BodyFatMethod,
+			&it.LeanMassKg, &it.WaistCm, &it.HipsCm, &it.ChestCm, &it.ArmCm, &it.ThighCm, &it.NeckCm, &it.Source, &it.Note,
+			&it.CreatedAt); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "export body_measurements scan"})
+			return
+		}
+		out.BodyMeasurements = append(out.BodyMeasurements, it)
+	}
+
+	photoRows, err := a.DB.Query(ctx, `
+    SELECT id, user_id::text, taken_on, pose, note, content_type, created_at
+    FROM progress_photos
+    WHERE user_id = $1
+    ORDER BY taken_on, pose, created_at;
+  `, userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export progress_photos: %v", err)})
+		return
+	}
+	defer photoRows.Close()
+	for photoRows.Next() {
+		var it ExportProgressPhoto
+		var takenOn time.Time
+		if err := photoRows.Scan(&it.ID, &it.UserID, &takenOn, &it.Pose, &it.Note, &it.ContentType, &it.CreatedAt); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "export progress_photos scan"})
+			return
+		}
+		it.TakenOn = takenOn.Format("2006-01-02")
+		out.ProgressPhotos = append(out.ProgressPhotos, it)
+	}
+
+	activityRows, err := a.DB.Query(ctx, `
+    SELECT user_id::text, date, steps, active_calories_kcal_est, COALESCE(water_glasses, 0), source, created_at
+    FROM daily_activity
+    WHERE user_id = $1
+    ORDER BY date;
+  `, userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export daily_activity: %v", err)})
+		return
+	}
+	defer activityRows.Close()
+	for activityRows.Next() {
+		var it ExportDailyActivity
+		var dateVal time.Time
+		if err := activityRows.Scan(&it.UserID, &dateVal, &it.Steps, &it.ActiveKcalEst, &it.WaterGlasses, &it.Source, &it.CreatedAt); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "export daily_activity scan"})
+			return
+		}
+		it.Date = dateVal.Format("2006-01-02")
+		out.DailyActivity = append(out.DailyActivity, it)
+	}
+
+	sourceRows, err := a.DB.Query(ctx, `
+    SELECT date, source, steps, active_calories_kcal_est::float8, updated_at
+    FROM daily_activity_sources
+    WHERE user_id = $1
+    ORDER BY date, source;
+  `, userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export daily_activity_sources: %v", err)})
+		return
+	}
+	defer sourceRows.Close()
+	activityIndex := map[string]int{}
+	for i, it := range out.DailyActivity {
+		activityIndex[it.Date] = i
+	}
+	for sourceRows.Next() {
+		var it ExportActivitySource
+		var dateVal time.Time
+		if err := sourceRows.Scan(&dateVal, &it.Source, &it.Steps, &it.ActiveKcalEst, &it.UpdatedAt); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "export daily_activity_sources scan"})
+			return
+		}
+		if i, ok := activityIndex[dateVal.Format("2006-01-02")]; ok {
+			out.DailyActivity[i].Sources = append(out.DailyActivity[i].Sources, it)
+		}
+	}
+
+	workoutRows, err := a.DB.Query(ctx, `
+    SELECT id, started_at, activity, duration_min::float8, distance_km::float8, intensity, avg_heart_rate,
+           max_heart_rate, met::float8, weight_kg::float8, calories_kcal::float8, calories_source, note, created_at
+    FROM workouts
+    WHERE user_id = $1
+    ORDER BY started_at, id;
+  `, userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("export workouts: %v", err)})
+		return
+	}
+	defer workoutRows.Close()
+	for workoutRows.Next() {
+		var it ExportWorkout
+		if err := workoutRows.Scan(&it.ID, &it.StartedAt, &it.Activity, &it.DurationMin, &it.DistanceKm, &it.Intensity,
+			&it.AvgHeartRate, &it.MaxHeartRate, &it.MET, &it.WeightKg, &it.CaloriesKcal, &it.CaloriesSource, &it.Note,
+			&it.CreatedAt); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "export workouts scan"})
+			return
+		}
+		out.Workouts = append(out.Workouts, it)
+	}
+
+	log.Printf("[api-debug] req_id=%s export done food_items=%d recipes=%d recipe_ingredients=%d recipe_portions=%d presets=%d preset_items=%d log_entries=%d body_weights=%d body_measurements=%d daily_activity=%d",
+		reqID, len(out.FoodItems), len(out.Recipes), len(out.RecipeIngredients), len(out.RecipePortions), len(out.Presets), len(out.PresetItems), len(out.LogEntries), len(out.BodyWeights), len(out.BodyMeasurements), len(out.DailyActivity))
+	if r.URL.Query().Get("format") == "zip" {
+		a.writeExportZip(w, r, out)
+		return
+	}
+	writeJSON(w, 200, out)
+}
+
+// exportZipBundle is the bundle's name inside a ZIP export; progress photo
+// originals sit next to it under progress-photos/.
+const exportZipBundle = "intake-export.json"
+
+// maxImportZipBytes caps an uploaded ZIP export.
+const maxImportZipBytes = 2 << 30
+
+var photoExtensions = map[string]string{"image/jpeg": ".jpg", "image/png": ".png", "image/gif": ".gif", "image/webp": ".webp"}
+
+// writeExportZip streams every progress photo original, then the bundle,
+// as a ZIP. Photos are copied from the store one at a time; those whose files
+// are missing are left out of the bundle, which is why it is written last.
+func (a *App) writeExportZip(w http.ResponseWriter, r *http.Request, out ExportBundle) {
+	ctx := r.Context()
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="intake-export-%s.zip"`, a.now().Format("2006-01-02")))
+	zw := zip.NewWriter(w)
+	photos := out.ProgressPhotos[:0]
+	for _, it := range out.ProgressPhotos {
+		rc, err := a.Photos.Open(ctx, progressPhotoKey(it.UserID, it.ID, "original"))
+		if err != nil {
+			log.Printf("export progress photo %s: %v", it.ID, err)
+			continue
+		}
+		it.File = "progress-photos/" + it.ID + photoExtensions[it.ContentType]
+		f, err := zw.Create(it.File)
+		if err == nil {
+			_, err = io.Copy(f, rc)
+		}
+		rc.Close()
+		if err != nil {
+			// The response is already partly written; stop rather than
+			// close the archive over a truncated entry.
+			log.Printf("export zip: %s: %v", it.File, err)
+			return
+		}
+		photos = append(photos, it)
+	}
+	out.ProgressPhotos = photos
+
+	f, err := zw.Create(exportZipBundle)
+	if err != nil {
+		log.Printf("export zip: %v", err)
+		return
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		log.Printf("export zip: %s: %v", exportZipBundle, err)
+		return
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("export zip: %v", err)
+	}
+}
+
+// readExportZip reads a ZIP export from body, spooling it to a temp file.
+// The returned files are keyed by their name in the archive; cleanup must be
+// called once they have been read.
+func readExportZip(body io.Reader) (bundle ExportBundle, files map[string]*zip.File, cleanup func(), err error) {
+	tmp, err := os.CreateTemp("", "intake-import-*.zip")
+	if err != nil {
+		return bundle, nil, nil, err
+	}
+	cleanup = func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	size, err := io.Copy(tmp, body)
+	if err == nil {
+		var zr *zip.Reader
+		if zr, err = zip.NewReader(tmp, size); err == nil {
+			files = map[string]*zip.File{}
+			for _, f := range zr.File {
+				files[f.Name] = f
+			}
+			err = errors.New("missing " + exportZipBundle)
+			if f := files[exportZipBundle]; f != nil {
+				var rc io.ReadCloser
+				if rc, err = f.Open(); err == nil {
+					err = json.NewDecoder(rc).Decode(&bundle)
+					rc.Close()
+				}
+			}
+		}
+	}
+	if err != nil {
+		cleanup()
+		return bundle, nil, nil, err
+	}
+	return bundle, files, cleanup, nil
+}
+
+func (a *App) HandleImportData(w http.ResponseWriter, r *http.Request) {
+	reqID := middleware.GetReqID(r.Context())
+	queryUserID := r.URL.Query().Get("user_id")
+	if queryUserID == "" {
+		queryUserID = "00000000-0000-0000-0000-000000000001"
+	}
+
+	// A ZIP export (format=zip) carries progress photo files as well.
+	var req ExportBundle
+	var photoFiles map[string]*zip.File
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/zip") {
+		bundle, files, closeZip, err := readExportZip(http.MaxBytesReader(w, r.Body, maxImportZipBytes))
+		if err != nil {
+			log.Printf("[api-debug] req_id=%s import zip error: %v", reqID, err)
+			writeJSON(w, 400, map[string]any{"error": fmt.Sprintf("invalid zip: %v", err)})
+			return
+		}
+		defer closeZip()
+		req, photoFiles = bundle, files
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("[api-debug] req_id=%s import decode error: %v", reqID, err)
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+
+	ctx := r.Context()
+	tx, err := a.DB.Begin(ctx)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx begin"})
+		return
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	rowsImported := 0
+	now := time.Now().UTC()
+	effectiveUserID := queryUserID
+	if r.URL.Query().Get("user_id") == "" && req.UserID != "" {
+		effectiveUserID = req.UserID
+	}
+	log.Printf("[api-debug] req_id=%s import start query_user_id=%s payload_user_id=%s effective_user_id=%s food_items=%d recipes=%d recipe_ingredients=%d recipe_portions=%d presets=%d preset_items=%d log_entries=%d body_weights=%d body_measurements=%d daily_activity=%d",
+		reqID, queryUserID, req.UserID, effectiveUserID,
+		len(req.FoodItems), len(req.Recipes), len(req.RecipeIngredients), len(req.RecipePortions),
+		len(req.Presets), len(req.PresetItems), len(req.LogEntries), len(req.BodyWeights), len(req.BodyMeasurements), len(req.DailyActivity))
+
+	// Ensure the target user exists so FK inserts don't fail on a fresh DB.
+	if _, err := tx.Exec(ctx, `
+      INSERT INTO users (id, display_name)
+      VALUES ($1, 'Imported User')
+      ON CONFLICT (id) DO NOTHING;
+    `, effectiveUserID); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("ensure user: %v", err)})
+		return
+	}
+
+	for _, d := range req.NutrientDefs {
+		if !nutrientKeyRe.MatchString(d.Key) || d.Name == "" || d.Unit == "" {
+			continue
+		}
+		if _, err := tx.Exec(ctx, `
+      INSERT INTO nutrients (key, name, unit, usda_nbr, sort_order)
+      VALUES ($1,$2,$3,NULLIF($4,''),$5)
+      ON CONFLICT (key) DO NOTHING;
+    `, d.Key, d.Name, d.Unit, d.USDANbr, d.SortOrder); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import nutrients: %v", err)})
+			return
+		}
+	}
+
+	var inferRecipeIDs []string
+	for _, it := range req.FoodItems {
+		createdAt := it.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+		var foodUserID any
+		if it.UserID != "" {
+			foodUserID = effectiveUserID
+		}
+		if it.IsRecipe == nil {
+			inferRecipeIDs = append(inferRecipeIDs, it.ID)
+		}
+		_, err := tx.Exec(ctx, `
+      INSERT INTO food_items (
+        id, user_id, name, brand, serving_label, source,
+        calories_per_serving, protein_g_per_serving, carbs_g_per_serving, fat_g_per_serving, fiber_g_per_serving, created_at,
+        is_recipe
+      ) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,COALESCE($13::boolean, false))
+      ON CONFLICT (id) DO UPDATE SET
+        is_recipe = CASE WHEN $13::boolean IS NULL THEN food_items.is_recipe ELSE EXCLUDED.is_recipe END,
+        user_id = EXCLUDED.user_id,
+        name = EXCLUDED.name,
+        brand = EXCLUDED.brand,
+        serving_label = EXCLUDED.serving_label,
+        source = EXCLUDED.source,
+        calories_per_serving = EXCLUDED.calories_per_serving,
+        protein_g_per_serving = EXCLUDED.protein_g_per_serving,
+        carbs_g_per_serving = EXCLUDED.carbs_g_per_serving,
+        fat_g_per_serving = EXCLUDED.fat_g_per_serving,
+        fiber_g_per_serving = EXCLUDED.fiber_g_per_serving;
+    `, it.ID, foodUserID, it.Name, it.Brand, it.ServingLabel, it.Source,
+			it.CaloriesPerServing, it.ProteinPerServing, it.CarbsPerServing, it.FatPerServing, it.FiberPerServing, createdAt,
+			it.IsRecipe)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import food_items: %v", err)})
+			return
+		}
+		if it.Nutrients != nil {
+			if err := saveFoodNutrients(ctx, tx, it.ID, it.Nutrients); err != nil {
+				writeJSON(w, nutrientErrorStatus(err), map[string]any{"error": fmt.Sprintf("import food_item_nutrients: %v", err)})
+				return
+			}
+		}
+		rowsImported++
+	}
+
+	for _, it := range req.Recipes {
+		createdAt := it.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+		_, err := tx.Exec(ctx, `
+      INSERT INTO recipes (id, user_id, name, instructions, yield_count, created_at)
+      VALUES ($1,$2,$3,$4,$5,$6)
+      ON CONFLICT (id) DO UPDATE SET
+        user_id = EXCLUDED.user_id,
+        name = EXCLUDED.name,
+        instructions = EXCLUDED.instructions,
+        yield_count = EXCLUDED.yield_count;
+    `, it.ID, effectiveUserID, it.Name, it.Instructions, it.YieldCount, createdAt)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import recipes: %v", err)})
+			return
+		}
+		if it.Tags != nil {
+			if err := replaceRecipeTags(ctx, tx, it.ID, normalizeTags(it.Tags)); err != nil {
+				writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import recipe tags: %v", err)})
+				return
+			}
+		}
+		rowsImported++
+	}
+
+	for _, it := range req.RecipeIngredients {
+		createdAt := it.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+		_, err := tx.Exec(ctx, `
+      INSERT INTO recipe_ingredients (id, recipe_id, food_item_id, amount_g, created_at)
+      VALUES ($1,$2,$3,$4,$5)
+      ON CONFLICT (id) DO UPDATE SET
+        recipe_id = EXCLUDED.recipe_id,
+        food_item_id = EXCLUDED.food_item_id,
+        amount_g = EXCLUDED.amount_g;
+    `, it.ID, it.RecipeID, it.FoodItemID, it.AmountG, createdAt)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import recipe_ingredients: %v", err)})
+			return
+		}
+		rowsImported++
+	}
+
+	for _, it := range req.RecipePortions {
+		createdAt := it.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+		_, err := tx.Exec(ctx, `
+      INSERT INTO recipe_portions (id, recipe_id, name, portion_count, created_at)
+      VALUES ($1,$2,$3,$4,$5)
+      ON CONFLICT (id) DO UPDATE SET
+        recipe_id = EXCLUDED.recipe_id,
+        name = EXCLUDED.name,
+        portion_count = EXCLUDED.portion_count;
+    `, it.ID, it.RecipeID, it.Name, it.PortionCount, createdAt)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import recipe_portions: %v", err)})
+			return
+		}
+		rowsImported++
+	}
+	// Older bundles carry a recipe page for every food item. Keep the ones
+	// with content as recipes and drop the empty mirrors.
+	if len(inferRecipeIDs) > 0 {
+		if _, err := tx.Exec(ctx, `
+      UPDATE food_items fi
+      SET is_recipe = true
+      FROM recipes r
+      WHERE r.id = fi.id AND fi.id = ANY($1::uuid[]) AND NOT fi.is_recipe
+        AND (
+          COALESCE(btrim(r.instructions), '') <> ''
+          OR r.yield_count <> 1
+          OR EXISTS (SELECT 1 FROM recipe_ingredients ri WHERE ri.recipe_id = r.id)
+          OR EXISTS (SELECT 1 FROM recipe_portions rp WHERE rp.recipe_id = r.id)
+          OR EXISTS (SELECT 1 FROM recipe_shopping_items rsi WHERE rsi.recipe_id = r.id)
+          OR EXISTS (SELECT 1 FROM recipe_photos ph WHERE ph.recipe_id = r.id)
+          OR EXISTS (SELECT 1 FROM recipe_images ri WHERE ri.recipe_id = r.id)
+          OR EXISTS (SELECT 1 FROM recipe_tags t WHERE t.recipe_id = r.id)
+        );
+    `, inferRecipeIDs); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("flag recipes: %v", err)})
+			return
+		}
+		if _, err := tx.Exec(ctx, `
+      DELETE FROM recipes r
+      USING food_items fi
+      WHERE fi.id = r.id AND fi.id = ANY($1::uuid[]) AND NOT fi.is_recipe;
+    `, inferRecipeIDs); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("drop empty recipes: %v", err)})
+			return
+		}
+	}
+
+	for _, it := range req.Presets {
+		createdAt := it.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+		_, err := tx.Exec(ctx, `
+      INSERT INTO presets (id, user_id, name, pinned, created_at)
+      VALUES ($1,$2,$3,$4,$5)
+      ON CONFLICT (id) DO UPDATE SET
+        user_id = EXCLUDED.user_id,
+        name = EXCLUDED.name,
+        pinned = EXCLUDED.pinned;
+    `, it.ID, effectiveUserID, it.Name, it.Pinned, createdAt)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import presets: %v", err)})
+			return
+		}
+		rowsImported++
+	}
+
+	for _, it := range req.PresetItems {
+		createdAt := it.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+		_, err := tx.Exec(ctx, `
+      INSERT INTO preset_items (id, preset_id, kind, ref_id, servings, created_at)
+      VALUES ($1,$2,$3,$4,$5,$6)
+      ON CONFLICT (id) DO UPDATE SET
+        preset_id = EXCLUDED.preset_id,
+        kind = EXCLUDED.kind,
+        ref_id = EXCLUDED.ref_id,
+        servings = EXCLUDED.servings;
+    `, it.ID, it.PresetID, it.Kind, it.RefID, it.Servings, createdAt)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import preset_items: %v", err)})
+			return
+		}
+		rowsImported++
+	}
+
+	for _, it := range req.LogEntries {
+		createdAt := it.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+		occurredAt := it.OccurredAt
+		if occurredAt.IsZero() {
+			occurredAt = now
+		}
+		var nutrients any
+		if len(it.NutrientsPerServing) > 0 {
+			nutrients = it.NutrientsPerServing
+		}
+		_, err := tx.Exec(ctx, `
+      INSERT INTO log_entries (id, user_id, occurred_at, kind, ref_id, servings, meal, note, created_at,
+                               calories_per_serving, protein_g_per_serving, carbs_g_per_serving, fat_g_per_serving, fiber_g_per_serving,
+                               nutrients_per_serving)
+      VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15)
+      ON CONFLICT (id) DO UPDATE SET
+        user_id = EXCLUDED.user_id,
+        occurred_at = EXCLUDED.occurred_at,
+        kind = EXCLUDED.kind,
+        ref_id = EXCLUDED.ref_id,
+        servings = EXCLUDED.servings,
+        meal = EXCLUDED.meal,
+        note = EXCLUDED.note,
+        calories_per_serving = EXCLUDED.calories_per_serving,
+        protein_g_per_serving = EXCLUDED.protein_g_per_serving,
+        carbs_g_per_serving = EXCLUDED.carbs_g_per_serving,
+        fat_g_per_serving = EXCLUDED.fat_g_per_serving,
+        fiber_g_per_serving = EXCLUDED.fiber_g_per_serving,
+        nutrients_per_serving = EXCLUDED.nutrients_per_serving;
+    `, it.ID, effectiveUserID, occurredAt, it.Kind, it.RefID, it.Servings, it.Meal, it.Note, createdAt,
+			it.CaloriesPerServing, it.ProteinPerServing, it.CarbsPerServing, it.FatPerServing, it.FiberPerServing,
+			nutrients)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import log_entries: %v", err)})
+			return
+		}
+		rowsImported++
+	}
+	// Bundles from before macro snapshots: take them from the imported foods.
+	if _, err := tx.Exec(ctx, `
+      UPDATE log_entries le SET`+logSnapshotSet+`
+      FROM food_items fi
+      WHERE fi.id = le.ref_id AND le.kind = 'food' AND le.user_id = $1 AND le.calories_per_serving IS NULL;
+    `, effectiveUserID); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("snapshot log_entries: %v", err)})
+		return
+	}
+
+	for _, it := range req.BodyWeights {
+		createdAt := it.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+		measuredAt := it.MeasuredAt
+		if measuredAt.IsZero() {
+			measuredAt = now
+		}
+		_, err := tx.Exec(ctx, `
+      INSERT INTO body_weights (id, user_id, measured_at, weight_kg, source, note, created_at)
+      VALUES ($1,$2,$3,$4,$5,$6,$7)
+      ON CONFLICT (id) DO UPDATE SET
+        user_id = EXCLUDED.user_id,
+        measured_at = EXCLUDED.measured_at,
+        weight_kg = EXCLUDED.weight_kg,
+        source = EXCLUDED.source,
+        note = EXCLUDED.note;
+    `, it.ID, effectiveUserID, measuredAt, it.WeightKg, it.Source, it.Note, createdAt)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import body_weights: %v", err)})
+			return
+		}
+		rowsImported++
+	}
+
+	for _, it := range req.BodyMeasurements {
+		createdAt := it.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+		measuredAt := it.MeasuredAt
+		if measuredAt.IsZero() {
+			measuredAt = now
+		}
+		source := it.Source
+		if source == "" {
+			source = "manual"
+		}
+		_, err := tx.Exec(ctx, `
+      INSERT INTO body_measurements (id, user_id, measured_at, sex, height_cm, body_fat_pct, body_fat_method, lean_mass_kg,
+                                     waist_cm, hips_cm, chest_cm, arm_cm, thigh_cm, neck_cm, source, note, created_at)
+      VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,NULLIF($16, ''),$17)
+      ON CONFLICT (id) DO UPDATE SET
+        user_id = EXCLUDED.user_id,
+        measured_at = EXCLUDED.measured_at,
+        sex = EXCLUDED.sex,
+        height_cm = EXCLUDED.height_cm,
+        body_fat_pct = EXCLUDED.body_fat_pct,
+        body_fat_method = EXCLUDED.body_fat_method,
+        lean_mass_kg = EXCLUDED.lean_mass_kg,
+        waist_cm = EXCLUDED.waist_cm,
+        hips_cm = EXCLUDED.hips_cm,
+        chest_cm = EXCLUDED.chest_cm,
+        arm_cm = EXCLUDED.arm_cm,
+        thigh_cm = EXCLUDED.thigh_cm,
+        neck_cm = EXCLUDED.neck_cm,
+        source = EXCLUDED.source,
+        note = EXCLUDED.note;
+    `, it.ID, effectiveUserID, measuredAt, it.Sex, it.HeightCm, it.BodyFatPct, it.BodyFatMethod, it.LeanMassKg,
+			it.WaistCm, it.HipsCm, it.ChestCm, it.ArmCm, it.ThighCm, it.NeckCm, source, it.Note, createdAt)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import body_measurements: %v", err)})
+			return
+		}
+		rowsImported++
+	}
+
+	for _, it := range req.DailyActivity {
+		createdAt := it.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+		if _, err := time.Parse("2006-01-02", it.Date); err != nil {
+			writeJSON(w, 400, map[string]any{"error": fmt.Sprintf("invalid activity date: %s", it.Date)})
+			return
+		}
+		source := it.Source
+		if source == "" {
+			source = "manual"
+		}
+		_, err := tx.Exec(ctx, `
+      INSERT INTO daily_activity (user_id, date, steps, active_calories_kcal_est, water_glasses, source, created_at)
+      VALUES ($1,$2,$3,$4,$5,$6,$7)
+      ON CONFLICT (user_id, date) DO UPDATE SET
+        water_glasses = EXCLUDED.water_glasses;
+    `, effectiveUserID, it.Date, it.Steps, it.ActiveKcalEst, it.WaterGlasses, source, createdAt)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import daily_activity: %v", err)})
+			return
+		}
+		sources := it.Sources
+		if len(sources) == 0 && (it.Steps != 0 || it.ActiveKcalEst != 0) {
+			steps, kcal := it.Steps, it.ActiveKcalEst
+			sources = []ExportActivitySource{{Source: source, Steps: &steps, ActiveKcalEst: &kcal, UpdatedAt: createdAt}}
+		}
+		for _, src := range sources {
+			updatedAt := src.UpdatedAt
+			if updatedAt.IsZero() {
+				updatedAt = now
+			}
+			_, err := tx.Exec(ctx, `
+        INSERT INTO daily_activity_sources (user_id, date, source, steps, active_calories_kcal_est, updated_at)
+        VALUES ($1,$2,$3,$4,$5,$6)
+        ON CONFLICT (user_id, date, source) DO UPDATE SET
+          steps = EXCLUDED.steps,
+          active_calories_kcal_est = EXCLUDED.active_calories_kcal_est,
+          updated_at = EXCLUDED.updated_at;
+      `, effectiveUserID, it.Date, src.Source, src.Steps, src.ActiveKcalEst, updatedAt)
+			if err != nil {
+				writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import daily_activity_sources: %v", err)})
+				return
+			}
+		}
+		if err := resolveDailyActivity(ctx, tx, effectiveUserID, it.Date); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import daily_activity: %v", err)})
+			return
+		}
+		rowsImported++
+	}
+
+	// Workouts keep their stored calories; each touched day is rolled up
+	// again afterwards.
+	workoutDays := map[string]bool{}
+	for _, it := range req.Workouts {
+		createdAt := it.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+		if it.Intensity == "" {
+			it.Intensity = "moderate"
+		}
+		if it.CaloriesSource == "" {
+			it.CaloriesSource = "manual"
+		}
+		var day time.Time
+		err := tx.QueryRow(ctx, `
+      INSERT INTO workouts (id, user_id, started_at, activity, duration_min, distance_km, intensity, avg_heart_rate,
+                            max_heart_rate, met, weight_kg, calories_kcal, calories_source, note, created_at)
+      VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15)
+      ON CONFLICT (id) DO UPDATE SET
+        user_id = EXCLUDED.user_id,
+        started_at = EXCLUDED.started_at,
+        activity = EXCLUDED.activity,
+        duration_min = EXCLUDED.duration_min,
+        distance_km = EXCLUDED.distance_km,
+        intensity = EXCLUDED.intensity,
+        avg_heart_rate = EXCLUDED.avg_heart_rate,
+        max_heart_rate = EXCLUDED.max_heart_rate,
+        met = EXCLUDED.met,
+        weight_kg = EXCLUDED.weight_kg,
+        calories_kcal = EXCLUDED.calories_kcal,
+        calories_source = EXCLUDED.calories_source,
+        note = EXCLUDED.note
+      RETURNING (started_at AT TIME ZONE $16)::date;
+    `, it.ID, effectiveUserID, it.StartedAt, it.Activity, it.DurationMin, it.DistanceKm, it.Intensity, it.AvgHeartRate,
+			it.MaxHeartRate, it.MET, it.WeightKg, it.CaloriesKcal, it.CaloriesSource, it.Note, createdAt, a.Loc.String()).Scan(&day)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import workouts: %v", err)})
+			return
+		}
+		workoutDays[day.Format("2006-01-02")] = true
+		rowsImported++
+	}
+	for day := range workoutDays {
+		if err := a.rollupWorkouts(ctx, tx, effectiveUserID, day); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import workouts: %v", err)})
+			return
+		}
+	}
+
+	// Photo files are written before the commit; if the import fails from
+	// here on, remove new ones again and put back the files of any photo that
+	// was overwritten. Photos already stored unchanged are skipped.
+	storedPhotos := map[string]bool{}
+	replacedPhotos := map[string]map[string][]byte{}
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		for prefix := range storedPhotos {
+			_ = a.Photos.Delete(ctx, prefix)
+		}
+		for prefix, files := range replacedPhotos {
+			_ = a.Photos.Delete(ctx, prefix)
+			for key, b := range files {
+				if err := a.Photos.Put(ctx, key, b); err != nil {
+					log.Printf("[api] restore %s after failed import: %v", key, err)
+				}
+			}
+		}
+	}()
+	for _, it := range req.ProgressPhotos {
+		f := photoFiles[it.File]
+		if it.File == "" || f == nil {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": fmt.Sprintf("import progress photo %s: %v", it.ID, err)})
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(rc, maxPhotoBytes+1))
+		rc.Close()
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": fmt.Sprintf("import progress photo %s: %v", it.ID, err)})
+			return
+		}
+		var existing string
+		var owned bool
+		err = tx.QueryRow(ctx, `SELECT user_id = $2, sha256 FROM progress_photos WHERE id::text = $1;`,
+			it.ID, effectiveUserID).Scan(&owned, &existing)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import progress photo %s: %v", it.ID, err)})
+			return
+		}
+		id := it.ID
+		if err == nil && !owned {
+			// Another user's photo has this ID: import it as a new photo.
+			id, existing = "", ""
+		}
+		if sum := sha256.Sum256(data); existing == hex.EncodeToString(sum[:]) {
+			continue
+		}
+		if existing != "" {
+			prefix := fmt.Sprintf("progress/%s/%s", effectiveUserID, id)
+			if _, ok := replacedPhotos[prefix]; !ok && !storedPhotos[prefix] {
+				files, err := a.readProgressPhotoFiles(ctx, effectiveUserID, id)
+				if err != nil {
+					writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("import progress photo %s: %v", it.ID, err)})
+					return
+				}
+				replacedPhotos[prefix] = files
+			}
+		}
+		p, err := a.storeProgressPhoto(ctx, tx, effectiveUserID,
+			ProgressPhoto{ID: id, TakenOn: it.TakenOn, Pose: it.Pose, Note: it.Note}, data)
+		if err != nil {
+			writeJSON(w, photoErrorStatus(err), map[string]any{"error": fmt.Sprintf("import progress photo %s: %v", it.ID, err)})
+			return
+		}
+		if existing == "" {
+			storedPhotos[fmt.Sprintf("progress/%s/%s", effectiveUserID, p.ID)] = true
+		}
+		rowsImported++
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("[api-debug] req_id=%s import tx commit error: %v", reqID, err)
+		writeJSON(w, 500, map[string]any{"error": "tx commit"})
+		return
+	}
+	committed = true
+	log.Printf("[api-debug] req_id=%s import success imported_rows=%d", reqID, rowsImported)
+	writeJSON(w, 200, map[string]any{"ok": true, "imported_rows": rowsImported})
+}
+
+// ── Markdown Export ───────────────────────────────────────────────────────────
+
+func (a *App) HandleExportMarkdown(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	fromStr := r.URL.Query().Get("from")
+	toStr := r.URL.Query().Get("to")
+	if fromStr == "" || toStr == "" {
+		writeJSON(w, 400, map[string]any{"error": "from and to required (YYYY-MM-DD)"})
+		return
+	}
+	from, err := time.ParseInLocation("2006-01-02", fromStr, a.Loc)
+	if err != nil {
+		writeJSON(w, 400, map[string]any{"error": "bad from date"})
+		return
+	}
+	to, err := time.ParseInLocation("2006-01-02", toStr, a.Loc)
+	if err != nil {
+		writeJSON(w, 400, map[string]any{"error": "bad to date"})
+		return
+	}
+	if to.Before(from) {
+		writeJSON(w, 400, map[string]any{"error": "to must be >= from"})
+		return
+	}
+
+	ctx := r.Context()
+
+	// Fetch all log entries in range in one query, ordered by day + meal + time
+	type mdEntry struct {
+		Date     string
+		Meal     string
+		FoodName string
+		Servings float64
+		Kcal     float64
+		ProteinG float64
+		CarbsG   float64
+		FatG     float64
+		FiberG   float64
+	}
+	rangeEnd := to.Add(24 * time.Hour)
+	logRows, err := a.DB.Query(ctx, `
+		SELECT DATE(le.occurred_at AT TIME ZONE $4) AS day,
+		       le.meal, fi.name, le.servings,
+		       le.servings * le.calories_per_serving,
+		       le.servings * le.protein_g_per_serving,
+		       le.servings * le.carbs_g_per_serving,
+		       le.servings * le.fat_g_per_serving,
+		       le.servings * le.fiber_g_per_serving
+		FROM log_entries le
+		JOIN food_items fi ON fi.id = le.ref_id
+		WHERE le.user_id = $1 AND le.kind = 'food'
+		  AND le.occurred_at >= $2 AND le.occurred_at < $3
+		ORDER BY day, le.meal, le.occurred_at
+	`, userID, from, rangeEnd, a.Loc.String())
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query log: %v", err)})
+		return
+	}
+	defer logRows.Close()
+
+	entriesByDay := map[string][]mdEntry{}
+	for logRows.Next() {
+		var e mdEntry
+		var day time.Time
+		if err := logRows.Scan(&day, &e.Meal, &e.FoodName, &e.Servings,
+			&e.Kcal, &e.ProteinG, &e.CarbsG, &e.FatG, &e.FiberG); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "scan log"})
+			return
+		}
+		e.Date = day.Format("2006-01-02")
+		entriesByDay[e.Date] = append(entriesByDay[e.Date], e)
+	}
+	logRows.Close()
+
+	// Fetch body weights in range
+	type mdWeight struct {
+		Date     string
+		WeightKg float64
+	}
+	weightByDay := map[string]mdWeight{}
+	wRows, err := a.DB.Query(ctx, `
+		SELECT DATE(measured_at AT TIME ZONE $4), AVG(weight_kg)
+		FROM body_weights
+		WHERE user_id = $1 AND measured_at >= $2 AND measured_at < $3
+		GROUP BY 1 ORDER BY 1
+	`, userID, from, rangeEnd, a.Loc.String())
+	if err == nil {
+		defer wRows.Close()
+		for wRows.Next() {
+			var d time.Time
+			var kg float64
+			if wRows.Scan(&d, &kg) == nil {
+				weightByDay[d.Format("2006-01-02")] = mdWeight{Date: d.Format("2006-01-02"), WeightKg: kg}
+			}
+		}
+		wRows.Close()
+	}
+
+	// Fetch activity in range
+	type mdActivity struct {
+		Steps      int
+		ActiveKcal float64
+	}
+	activityByDay := map[string]mdActivity{}
+	aRows, err := a.DB.Query(ctx, `
+		SELECT date, steps, active_calories_kcal_est
+		FROM daily_activity
+		WHERE user_id = $1 AND date >= $2 AND date <= $3
+		ORDER BY date
+	`, userID, fromStr, toStr)
+	if err == nil {
+		defer aRows.Close()
+		for aRows.Next() {
+			var d time.Time
+			var act mdActivity
+			if aRows.Scan(&d, &act.Steps, &act.ActiveKcal) == nil {
+				activityByDay[d.Format("2006-01-02")] = act
+			}
+		}
+		aRows.Close()
+	}
+
+	// Micronutrient totals, listed in definition order
+	nutrientDefs, err := a.loadNutrientDefs(ctx)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query nutrients: %v", err)})
+		return
+	}
+	nutrientsByDay, err := a.dailyNutrientTotals(ctx, userID, from, rangeEnd)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query nutrient totals: %v", err)})
+		return
+	}
+
+	// Build zip in memory
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for cur := from; !cur.After(to); cur = cur.Add(24 * time.Hour) {
+		dateStr := cur.Format("2006-01-02")
+		entries := entriesByDay[dateStr]
+		weight := weightByDay[dateStr]
+		activity := activityByDay[dateStr]
+
+		var sb strings.Builder
+		sb.WriteString("# " + dateStr + "\n\n")
+
+		// Summary totals
+		var totalKcal, totalProtein, totalCarbs, totalFat, totalFiber float64
+		for _, e := range entries {
+			totalKcal += e.Kcal
+			totalProtein += e.ProteinG
+			totalCarbs += e.CarbsG
+			totalFat += e.FatG
+			totalFiber += e.FiberG
+		}
+
+		sb.WriteString("## Summary\n\n")
+		sb.WriteString(fmt.Sprintf("| | |\n|---|---|\n"))
+		sb.WriteString(fmt.Sprintf("| Calories | %.0f kcal |\n", totalKcal))
+		sb.WriteString(fmt.Sprintf("| Protein | %.1f g |\n", totalProtein))
+		sb.WriteString(fmt.Sprintf("| Carbs | %.1f g |\n", totalCarbs))
+		sb.WriteString(fmt.Sprintf("| Fat | %.1f g |\n", totalFat))
+		sb.WriteString(fmt.Sprintf("| Fiber | %.1f g |\n", totalFiber))
+		if weight.WeightKg > 0 {
+			sb.WriteString(fmt.Sprintf("| Weight | %.2f kg |\n", weight.WeightKg))
+		}
+		if activity.Steps > 0 {
+			sb.WriteString(fmt.Sprintf("| Steps | %d |\n", activity.Steps))
+		}
+		if activity.ActiveKcal > 0 {
+			sb.WriteString(fmt.Sprintf("| Active kcal | %.0f |\n", activity.ActiveKcal))
+		}
+		sb.WriteString("\n")
+
+		if dayNutrients := nutrientsByDay[dateStr]; len(dayNutrients) > 0 {
+			sb.WriteString("## Micronutrients\n\n")
+			sb.WriteString("| | |\n|---|---|\n")
+			for _, d := range nutrientDefs {
+				if v, ok := dayNutrients[d.Key]; ok {
+					sb.WriteString(fmt.Sprintf("| %s | %.1f %s |\n", d.Name, v, d.Unit))
+				}
+			}
+			sb.WriteString("\n")
+		}
+
+		// Food log grouped by meal
+		if len(entries) > 0 {
+			sb.WriteString("## Food Log\n\n")
+			currentMeal := ""
+			var mealKcal, mealProtein float64
+			mealEntries := []mdEntry{}
+
+			flushMeal := func() {
+				if currentMeal == "" {
+					return
+				}
+				sb.WriteString("### " + strings.Title(strings.ReplaceAll(currentMeal, "_", " ")) + "\n\n")
+				sb.WriteString("| Food | Servings | kcal | Protein | Carbs | Fat |\n")
+				sb.WriteString("|---|---|---|---|---|---|\n")
+				for _, me := range mealEntries {
+					sb.WriteString(fmt.Sprintf("| %s | %.2g | %.0f | %.1fg | %.1fg | %.1fg |\n",
+						me.FoodName, me.Servings, me.Kcal, me.ProteinG, me.CarbsG, me.FatG))
+				}
+				sb.WriteString(fmt.Sprintf("\n**Meal total:** %.0f kcal · %.1fg protein\n\n", mealKcal, mealProtein))
+			}
+
+			for _, e := range entries {
+				if e.Meal != currentMeal {
+					flushMeal()
+					currentMeal = e.Meal
+					mealKcal = 0
+					mealProtein = 0
+					mealEntries = nil
+				}
+				mealKcal += e.Kcal
+				mealProtein += e.ProteinG
+				mealEntries = append(mealEntries, e)
+			}
+			flushMeal()
+		} else {
+			sb.WriteString("_No food logged._\n\n")
+		}
+
+		f, err := zw.Create(dateStr + ".md")
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": "zip create"})
+			return
+		}
+		if _, err := f.Write([]byte(sb.String())); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "zip write"})
+			return
+		}
+	}
+
 	if err := zw.Close(); err != nil {
 		writeJSON(w, 500, map[string]any{"error": "zip close"})
 		return
 	}
 
-	filename := fmt.Sprintf("intake-md-%s-to-%s.zip", fromStr, toStr)
-	w.Header().Set("Content-Type", "application/zip")
-	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
-	w.WriteHeader(200)
-	_, _ = w.Write(buf.Bytes())
+	filename := fmt.Sprintf("intake-md-%s-to-%s.zip", fromStr, toStr)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.WriteHeader(200)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// ── Daily Reports ─────────────────────────────────────────────────────────────
+
+// maxReportDays bounds the date ranges the report and insight endpoints accept.
+const maxReportDays = 3660
+
+// parseDateRange reads the required inclusive from/to (YYYY-MM-DD) query
+// parameters and returns local midnights for from and for the day after to.
+func (a *App) parseDateRange(r *http.Request) (from, end time.Time, err error) {
+	fromStr, toStr := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	if fromStr == "" || toStr == "" {
+		return from, end, errors.New("from and to required (YYYY-MM-DD)")
+	}
+	if from, err = time.ParseInLocation("2006-01-02", fromStr, a.Loc); err != nil {
+		return from, end, errors.New("bad from date")
+	}
+	to, err := time.ParseInLocation("2006-01-02", toStr, a.Loc)
+	if err != nil {
+		return from, end, errors.New("bad to date")
+	}
+	if to.Before(from) {
+		return from, end, errors.New("to must be >= from")
+	}
+	end = to.AddDate(0, 0, 1)
+	if end.Sub(from) > maxReportDays*24*time.Hour {
+		return from, end, fmt.Errorf("range is limited to %d days", maxReportDays)
+	}
+	return from, end, nil
+}
+
+// goalTolerance is how far a day's total may be from its goal, as a fraction
+// of the goal, and still count as on target.
+const goalTolerance = 0.10
+
+type GoalProgress struct {
+	Value   float64 `json:"value"`
+	Goal    float64 `json:"goal"`
+	Percent float64 `json:"percent"`
+	// Status is under, on_target or over; no_goal when the goal is unset.
+	Status string `json:"status"`
+}
+
+func goalProgress(value, goal float64) GoalProgress {
+	p := GoalProgress{Value: value, Goal: goal, Status: "no_goal"}
+	if goal <= 0 {
+		return p
+	}
+	p.Percent = math.Round(value/goal*1000) / 10
+	switch {
+	case value < goal*(1-goalTolerance):
+		p.Status = "under"
+	case value > goal*(1+goalTolerance):
+		p.Status = "over"
+	default:
+		p.Status = "on_target"
+	}
+	return p
+}
+
+type DailyGoalComparison struct {
+	Calories     GoalProgress `json:"calories"`
+	ProteinG     GoalProgress `json:"protein_g"`
+	CarbsG       GoalProgress `json:"carbs_g"`
+	FatG         GoalProgress `json:"fat_g"`
+	FiberG       GoalProgress `json:"fiber_g"`
+	WaterGlasses GoalProgress `json:"water_glasses"`
+}
+
+type DailyReportDay struct {
+	Date          string              `json:"date"`
+	Summary       MacroTotals         `json:"summary"`
+	Steps         int                 `json:"steps"`
+	ActiveKcalEst float64             `json:"active_calories_est"`
+	WaterGlasses  int                 `json:"water_glasses"`
+	Goals         DailyGoalComparison `json:"goals"`
+	FoodLog       []LogEntry          `json:"food_log"`
+}
+
+func (d *DailyReportDay) compare(g NutritionGoals) {
+	d.Goals = DailyGoalComparison{
+		Calories:     goalProgress(d.Summary.Calories, g.Calories),
+		ProteinG:     goalProgress(d.Summary.ProteinG, g.ProteinG),
+		CarbsG:       goalProgress(d.Summary.CarbsG, g.CarbsG),
+		FatG:         goalProgress(d.Summary.FatG, g.FatG),
+		FiberG:       goalProgress(d.Summary.FiberG, g.FiberG),
+		WaterGlasses: goalProgress(float64(d.WaterGlasses), float64(g.WaterGlasses)),
+	}
+}
+
+var dailyReportCSVHeader = []string{
+	"date", "entry_count", "calories", "protein_g", "carbs_g", "fat_g", "fiber_g",
+	"steps", "active_calories_est", "water_glasses",
+	"calories_goal", "calories_status", "protein_g_goal", "protein_g_status",
+	"carbs_g_goal", "carbs_g_status", "fat_g_goal", "fat_g_status",
+	"fiber_g_goal", "fiber_g_status", "water_glasses_goal", "water_glasses_status",
+}
+
+func (d DailyReportDay) csvRecord() []string {
+	f := func(v float64) string { return strconv.FormatFloat(math.Round(v*10)/10, 'f', -1, 64) }
+	rec := []string{
+		d.Date, strconv.Itoa(d.Summary.EntryCount),
+		f(d.Summary.Calories), f(d.Summary.ProteinG), f(d.Summary.CarbsG), f(d.Summary.FatG), f(d.Summary.FiberG),
+		strconv.Itoa(d.Steps), f(d.ActiveKcalEst), strconv.Itoa(d.WaterGlasses),
+	}
+	for _, g := range []GoalProgress{d.Goals.Calories, d.Goals.ProteinG, d.Goals.CarbsG, d.Goals.FatG, d.Goals.FiberG, d.Goals.WaterGlasses} {
+		rec = append(rec, f(g.Goal), g.Status)
+	}
+	return rec
+}
+
+// reportFormat picks json, ndjson or csv from ?format=, falling back to the
+// Accept header.
+func reportFormat(r *http.Request) string {
+	switch f := strings.ToLower(r.URL.Query().Get("format")); f {
+	case "json", "ndjson", "csv":
+		return f
+	}
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "application/x-ndjson"):
+		return "ndjson"
+	case strings.Contains(accept, "text/csv"):
+		return "csv"
+	}
+	return "json"
+}
+
+// HandleDailyReport returns one entry per day in [from, to]: food totals and
+// log, activity, water, and how each compares with the user's goals. Days are
+// written as they are built, so long ranges stream. ?format=ndjson gives one
+// day per line; ?format=csv one row per day without the food log.
+func (a *App) HandleDailyReport(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	from, end, err := a.parseDateRange(r)
+	if err != nil {
+		writeJSON(w, 400, map[string]any{"error": err.Error()})
+		return
+	}
+	format := reportFormat(r)
+	ctx := r.Context()
+
+	goals, err := a.loadGoals(ctx, userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("load goals: %v", err)})
+		return
+	}
+	type activity struct {
+		steps   int
+		kcal    float64
+		glasses int
+	}
+	activityByDay := map[string]activity{}
+	actRows, err := a.DB.Query(ctx, `
+    SELECT date, COALESCE(steps,0), COALESCE(active_calories_kcal_est,0), COALESCE(water_glasses,0)
+    FROM daily_activity
+    WHERE user_id = $1 AND date >= $2::date AND date < $3::date;
+  `, userID, from.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query activity: %v", err)})
+		return
+	}
+	for actRows.Next() {
+		var day time.Time
+		var act activity
+		if err := actRows.Scan(&day, &act.steps, &act.kcal, &act.glasses); err != nil {
+			actRows.Close()
+			writeJSON(w, 500, map[string]any{"error": "scan activity"})
+			return
+		}
+		activityByDay[day.Format("2006-01-02")] = act
+	}
+	actRows.Close()
+	if err := actRows.Err(); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query activity: %v", err)})
+		return
+	}
+
+	rows, err := a.DB.Query(ctx, `
+    SELECT le.id, le.meal, le.ref_id, fi.name, fi.serving_label, le.servings,
+           le.servings * le.calories_per_serving,
+           le.servings * le.protein_g_per_serving,
+           le.servings * le.carbs_g_per_serving,
+           le.servings * le.fat_g_per_serving,
+           le.servings * le.fiber_g_per_serving,
+           le.occurred_at, le.nutrients_per_serving
+    FROM log_entries le
+    JOIN food_items fi ON fi.id = le.ref_id
+    WHERE le.user_id = $1 AND le.kind = 'food' AND le.occurred_at >= $2 AND le.occurred_at < $3
+    ORDER BY le.occurred_at;
+  `, userID, from, end)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query log: %v", err)})
+		return
+	}
+	defer rows.Close()
+
+	rc := http.NewResponseController(w)
+	var cw *csv.Writer
+	days := 0
+	switch format {
+	case "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="intake-report-%s-to-%s.csv"`,
+			from.Format("2006-01-02"), end.AddDate(0, 0, -1).Format("2006-01-02")))
+		cw = csv.NewWriter(w)
+		_ = cw.Write(dailyReportCSVHeader)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		head, _ := json.Marshal(map[string]any{
+			"from": from.Format("2006-01-02"), "to": end.AddDate(0, 0, -1).Format("2006-01-02"),
+			"generated_at": time.Now().UTC(), "goals": goals, "goal_tolerance": goalTolerance,
+		})
+		// Open the object without its closing brace so days can follow.
+		_, _ = w.Write(head[:len(head)-1])
+		_, _ = io.WriteString(w, `,"days":[`)
+	}
+	emit := func(d DailyReportDay) {
+		act := activityByDay[d.Date]
+		d.Steps, d.ActiveKcalEst, d.WaterGlasses = act.steps, act.kcal, act.glasses
+		d.compare(goals)
+		switch format {
+		case "csv":
+			_ = cw.Write(d.csvRecord())
+		case "ndjson":
+			_ = json.NewEncoder(w).Encode(d)
+		default:
+			if days > 0 {
+				_, _ = io.WriteString(w, ",")
+			}
+			b, _ := json.Marshal(d)
+			_, _ = w.Write(b)
+		}
+		days++
+		if days%30 == 0 {
+			if cw != nil {
+				cw.Flush()
+			}
+			_ = rc.Flush()
+		}
+	}
+
+	cur := from
+	day := DailyReportDay{Date: cur.Format("2006-01-02"), FoodLog: []LogEntry{}}
+	for rows.Next() {
+		var e LogEntry
+		var ts time.Time
+		if err := rows.Scan(&e.ID, &e.Meal, &e.FoodItemID, &e.FoodName, &e.ServingLabel, &e.Servings,
+			&e.Calories, &e.ProteinG, &e.CarbsG, &e.FatG, &e.FiberG, &ts, &e.Nutrients); err != nil {
+			// Headers are already sent; cut the stream short so it fails to parse.
+			log.Printf("daily report scan: %v", err)
+			return
+		}
+		e.OccurredAt = ts.Format(time.RFC3339)
+		for key, perServing := range e.Nutrients {
+			e.Nutrients[key] = perServing * e.Servings
+		}
+		key := ts.In(a.Loc).Format("2006-01-02")
+		for day.Date < key {
+			emit(day)
+			cur = cur.AddDate(0, 0, 1)
+			day = DailyReportDay{Date: cur.Format("2006-01-02"), FoodLog: []LogEntry{}}
+		}
+		day.FoodLog = append(day.FoodLog, e)
+		day.Summary.add(MacroTotals{EntryCount: 1, Calories: e.Calories, ProteinG: e.ProteinG, CarbsG: e.CarbsG, FatG: e.FatG, FiberG: e.FiberG})
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("daily report query: %v", err)
+		return
+	}
+	for cur.Before(end) {
+		emit(day)
+		cur = cur.AddDate(0, 0, 1)
+		day = DailyReportDay{Date: cur.Format("2006-01-02"), FoodLog: []LogEntry{}}
+	}
+	switch format {
+	case "csv":
+		cw.Flush()
+	case "json":
+		_, _ = io.WriteString(w, "]}\n")
+	}
+}
+
+// ── Insights ──────────────────────────────────────────────────────────────────
+
+// insightMacros are the daily_totals columns summarised by /insights/summary,
+// in the order their statistics are selected.
+var insightMacros = []string{"calories", "protein_g", "carbs_g", "fat_g", "fiber_g"}
+
+type MacroStat struct {
+	Avg float64 `json:"avg"`
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+	// DaysOnTarget counts logged days within goalTolerance of the goal.
+	DaysOnTarget int `json:"days_on_target"`
+}
+
+// EnergySplit is the share of macro energy (4 kcal/g protein and carbs,
+// 9 kcal/g fat) from each macro, in percent.
+type EnergySplit struct {
+	ProteinPct float64 `json:"protein_pct"`
+	CarbsPct   float64 `json:"carbs_pct"`
+	FatPct     float64 `json:"fat_pct"`
+}
+
+// InsightStats summarises the days from From to To. Completeness is the
+// percentage of those days with at least one entry.
+type InsightStats struct {
+	From         string      `json:"from"`
+	To           string      `json:"to"`
+	Days         int         `json:"days"`
+	DaysLogged   int         `json:"days_logged"`
+	Completeness float64     `json:"completeness_pct"`
+	Calories     MacroStat   `json:"calories"`
+	ProteinG     MacroStat   `json:"protein_g"`
+	CarbsG       MacroStat   `json:"carbs_g"`
+	FatG         MacroStat   `json:"fat_g"`
+	FiberG       MacroStat   `json:"fiber_g"`
+	EnergySplit  EnergySplit `json:"energy_split"`
+}
+
+type InsightSummary struct {
+	From          string         `json:"from"`
+	To            string         `json:"to"`
+	Group         string         `json:"group"`
+	Goals         NutritionGoals `json:"goals"`
+	GoalTolerance float64        `json:"goal_tolerance"`
+	Overall       InsightStats   `json:"overall"`
+	Weekday       InsightStats   `json:"weekday"`
+	Weekend       InsightStats   `json:"weekend"`
+	Periods       []InsightStats `json:"periods"`
+}
+
+// HandleInsightsSummary summarises food logging over [from, to]: per-macro
+// average/min/max, energy split, days within goal tolerance, and logging
+// completeness, overall, for weekdays vs weekends (Sat/Sun), and per
+// group=day|week|month period. Statistics cover logged days only, so a day
+// without entries lowers completeness rather than the averages.
+func (a *App) HandleInsightsSummary(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	from, end, err := a.parseDateRange(r)
+	if err != nil {
+		writeJSON(w, 400, map[string]any{"error": err.Error()})
+		return
+	}
+	group := r.URL.Query().Get("group")
+	if group == "" {
+		group = "week"
+	}
+	if group != "day" && group != "week" && group != "month" {
+		writeJSON(w, 400, map[string]any{"error": "group must be day, week or month"})
+		return
+	}
+	ctx := r.Context()
+	goals, err := a.loadGoals(ctx, userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("load goals: %v", err)})
+		return
+	}
+
+	// Goals are $8-$12 in insightMacros order; the tolerance is $13.
+	var stats []string
+	for i, m := range insightMacros {
+		goal := fmt.Sprintf("$%d::float8", 8+i)
+		stats = append(stats, fmt.Sprintf(`
+           COALESCE(AVG(%[1]s) FILTER (WHERE logged), 0), COALESCE(MIN(%[1]s) FILTER (WHERE logged), 0),
+           COALESCE(MAX(%[1]s) FILTER (WHERE logged), 0),
+           COUNT(*) FILTER (WHERE logged AND %[2]s > 0 AND %[1]s BETWEEN %[2]s * (1 - $13::float8) AND %[2]s * (1 + $13::float8))`, m, goal))
+	}
+	rows, err := a.DB.Query(ctx, `
+    WITH days AS (
+      SELECT d::date AS day FROM generate_series($2::date, $3::date, interval '1 day') d
+    ), totals AS (
+      SELECT DATE(le.occurred_at AT TIME ZONE $4) AS day,
+             SUM(le.servings * le.calories_per_serving) AS calories,
+             SUM(le.servings * le.protein_g_per_serving) AS protein_g,
+             SUM(le.servings * le.carbs_g_per_serving) AS carbs_g,
+             SUM(le.servings * le.fat_g_per_serving) AS fat_g,
+             SUM(le.servings * le.fiber_g_per_serving) AS fiber_g
+      FROM log_entries le
+      JOIN food_items fi ON fi.id = le.ref_id
+      WHERE le.user_id = $1 AND le.kind = 'food' AND le.occurred_at >= $5 AND le.occurred_at < $6
+      GROUP BY 1
+    ), daily_totals AS (
+      SELECT d.day, date_trunc($7::text, d.day::timestamp)::date AS bucket, EXTRACT(ISODOW FROM d.day) >= 6 AS weekend,
+             t.day IS NOT NULL AS logged,
+             COALESCE(t.calories, 0) AS calories, COALESCE(t.protein_g, 0) AS protein_g,
+             COALESCE(t.carbs_g, 0) AS carbs_g, COALESCE(t.fat_g, 0) AS fat_g, COALESCE(t.fiber_g, 0) AS fiber_g
+      FROM days d
+      LEFT JOIN totals t ON t.day = d.day
+    )
+    SELECT GROUPING(bucket), GROUPING(weekend), COALESCE(weekend, false),
+           MIN(day), MAX(day), COUNT(*), COUNT(*) FILTER (WHERE logged),
+           COALESCE(SUM(protein_g) * 4 / NULLIF(SUM(protein_g * 4 + carbs_g * 4 + fat_g * 9), 0) * 100, 0),
+           COALESCE(SUM(carbs_g) * 4 / NULLIF(SUM(protein_g * 4 + carbs_g * 4 + fat_g * 9), 0) * 100, 0),
+           COALESCE(SUM(fat_g) * 9 / NULLIF(SUM(protein_g * 4 + carbs_g * 4 + fat_g * 9), 0) * 100, 0),`+
+		strings.Join(stats, ",")+`
+    FROM daily_totals
+    GROUP BY GROUPING SETS ((bucket), (weekend), ())
+    ORDER BY GROUPING(bucket), GROUPING(weekend), MIN(day);
+  `, userID, from.Format("2006-01-02"), end.AddDate(0, 0, -1).Format("2006-01-02"), a.Loc.String(), from, end, group,
+		goals.Calories, goals.ProteinG, goals.CarbsG, goals.FatG, goals.FiberG, goalTolerance)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("insights query: %v", err)})
+		return
+	}
+	defer rows.Close()
+
+	out := InsightSummary{
+		From: from.Format("2006-01-02"), To: end.AddDate(0, 0, -1).Format("2006-01-02"), Group: group,
+		Goals: goals, GoalTolerance: goalTolerance, Periods: []InsightStats{},
+	}
+	round := func(v float64) float64 { return math.Round(v*10) / 10 }
+	for rows.Next() {
+		var byBucket, byWeekend int
+		var weekend bool
+		var first, last time.Time
+		var s InsightStats
+		macros := []*MacroStat{&s.Calories, &s.ProteinG, &s.CarbsG, &s.FatG, &s.FiberG}
+		dest := []any{&byBucket, &byWeekend, &weekend, &first, &last, &s.Days, &s.DaysLogged,
+			&s.EnergySplit.ProteinPct, &s.EnergySplit.CarbsPct, &s.EnergySplit.FatPct}
+		for _, m := range macros {
+			dest = append(dest, &m.Avg, &m.Min, &m.Max, &m.DaysOnTarget)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("insights scan: %v", err)})
+			return
+		}
+		s.From, s.To = first.Format("2006-01-02"), last.Format("2006-01-02")
+		if s.Days > 0 {
+			s.Completeness = round(float64(s.DaysLogged) / float64(s.Days) * 100)
+		}
+		for _, m := range macros {
+			m.Avg, m.Min, m.Max = round(m.Avg), round(m.Min), round(m.Max)
+		}
+		s.EnergySplit = EnergySplit{round(s.EnergySplit.ProteinPct), round(s.EnergySplit.CarbsPct), round(s.EnergySplit.FatPct)}
+		// GROUPING() is 1 for the columns a row is not grouped by.
+		switch {
+		case byBucket == 0:
+			out.Periods = append(out.Periods, s)
+		case byWeekend == 0 && weekend:
+			out.Weekend = s
+		case byWeekend == 0:
+			out.Weekday = s
+		default:
+			out.Overall = s
+		}
+	}
+	if err := rows.Err(); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("insights query: %v", err)})
+		return
+	}
+	writeJSON(w, 200, out)
+}
+
+// mealTimingEntries selects the user's food entries in [$2, $3) with their
+// local timestamp ($4 is the time zone); the meal-timing queries build on it.
+const mealTimingEntries = `
+    WITH entries AS (
+      SELECT le.occurred_at AT TIME ZONE $4 AS local_at, le.meal,
+             le.servings * le.calories_per_serving AS calories,
+             le.servings * le.protein_g_per_serving AS protein_g
+      FROM log_entries le
+      JOIN food_items fi ON fi.id = le.ref_id
+      WHERE le.user_id = $1 AND le.kind = 'food' AND le.occurred_at >= $2 AND le.occurred_at < $3
+    )`
+
+type MealShare struct {
+	Meal        string  `json:"meal"`
+	Entries     int     `json:"entries"`
+	Calories    float64 `json:"calories"`
+	ProteinG    float64 `json:"protein_g"`
+	CaloriesPct float64 `json:"calories_pct"`
+	ProteinPct  float64 `json:"protein_pct"`
+}
+
+type HourShare struct {
+	Hour        int     `json:"hour"`
+	Entries     int     `json:"entries"`
+	Calories    float64 `json:"calories"`
+	ProteinG    float64 `json:"protein_g"`
+	CaloriesPct float64 `json:"calories_pct"`
+	ProteinPct  float64 `json:"protein_pct"`
+}
+
+// EatingWindow describes when food was logged on the logged days from From
+// to To. Days run from the report's DayStart, so a snack after midnight
+// still ends the previous day. Times are local HH:MM; late-night means from
+// LateAfter until DayStart.
+type EatingWindow struct {
+	From                 string  `json:"from"`
+	To                   string  `json:"to"`
+	DaysLogged           int     `json:"days_logged"`
+	AvgFirstMeal         string  `json:"avg_first_meal"`
+	AvgLastMeal          string  `json:"avg_last_meal"`
+	AvgWindowHours       float64 `json:"avg_window_hours"`
+	LateNightDays        int     `json:"late_night_days"`
+	LateNightPct         float64 `json:"late_night_pct"`
+	LateNightCaloriesPct float64 `json:"late_night_calories_pct"`
+	ProteinBeforeNoonPct float64 `json:"protein_before_noon_pct"`
+}
+
+type MealTimingReport struct {
+	From      string         `json:"from"`
+	To        string         `json:"to"`
+	Group     string         `json:"group"`
+	DayStart  string         `json:"day_start"`
+	LateAfter string         `json:"late_after"`
+	ByMeal    []MealShare    `json:"by_meal"`
+	ByHour    []HourShare    `json:"by_hour"`
+	Overall   EatingWindow   `json:"overall"`
+	Trend     []EatingWindow `json:"trend"`
+}
+
+// clockFromMinutes formats minutes after midnight as HH:MM.
+func clockFromMinutes(m float64) string {
+	total := int(math.Round(m)) % (24 * 60)
+	return fmt.Sprintf("%02d:%02d", total/60, total%60)
+}
+
+func sharePct(part, total float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return math.Round(part/total*1000) / 10
+}
+
+// HandleMealTiming analyses when the user eats over [from, to]: calories and
+// protein by meal slot and by local hour, the average first and last entry
+// of the day, late-night eating (?late_after=HH:MM, default 21:00), and the
+// share of protein logged before noon. Days start at ?day_start=HH:MM
+// (default 04:00, before noon), so late-night entries after midnight count
+// towards the evening before. trend repeats the eating-window figures per
+// group=week|month.
+func (a *App) HandleMealTiming(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	from, end, err := a.parseDateRange(r)
+	if err != nil {
+		writeJSON(w, 400, map[string]any{"error": err.Error()})
+		return
+	}
+	group := r.URL.Query().Get("group")
+	if group == "" {
+		group = "week"
+	}
+	if group != "week" && group != "month" {
+		writeJSON(w, 400, map[string]any{"error": "group must be week or month"})
+		return
+	}
+	lateAfter := r.URL.Query().Get("late_after")
+	if lateAfter == "" {
+		lateAfter = "21:00"
+	}
+	if _, err := time.Parse("15:04", lateAfter); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "late_after must be HH:MM"})
+		return
+	}
+	dayStart := r.URL.Query().Get("day_start")
+	if dayStart == "" {
+		dayStart = "04:00"
+	}
+	ds, err := time.Parse("15:04", dayStart)
+	if err != nil || ds.Hour() >= 12 {
+		writeJSON(w, 400, map[string]any{"error": "day_start must be HH:MM before 12:00"})
+		return
+	}
+	ctx := r.Context()
+	tz := a.Loc.String()
+	out := MealTimingReport{
+		From: from.Format("2006-01-02"), To: end.AddDate(0, 0, -1).Format("2006-01-02"),
+		Group: group, DayStart: dayStart, LateAfter: lateAfter, ByMeal: []MealShare{}, Trend: []EatingWindow{},
+	}
+	// Every query covers the same shifted days: from's day start up to the
+	// day start after to.
+	from = time.Date(from.Year(), from.Month(), from.Day(), ds.Hour(), ds.Minute(), 0, 0, a.Loc)
+	end = time.Date(end.Year(), end.Month(), end.Day(), ds.Hour(), ds.Minute(), 0, 0, a.Loc)
+	dayStartMin := float64(ds.Hour()*60 + ds.Minute())
+
+	rows, err := a.DB.Query(ctx, mealTimingEntries+`
+    SELECT meal, COUNT(*), COALESCE(SUM(calories), 0), COALESCE(SUM(protein_g), 0)
+    FROM entries
+    GROUP BY meal;
+  `, userID, from, end, tz)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("meal query: %v", err)})
+		return
+	}
+	var totalCal, totalProtein float64
+	for rows.Next() {
+		var m MealShare
+		if err := rows.Scan(&m.Meal, &m.Entries, &m.Calories, &m.ProteinG); err != nil {
+			rows.Close()
+			writeJSON(w, 500, map[string]any{"error": "scan meals"})
+			return
+		}
+		totalCal += m.Calories
+		totalProtein += m.ProteinG
+		out.ByMeal = append(out.ByMeal, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("meal query: %v", err)})
+		return
+	}
+	sort.Slice(out.ByMeal, func(i, j int) bool { return mealLess(out.ByMeal[i].Meal, out.ByMeal[j].Meal) })
+	for i := range out.ByMeal {
+		m := &out.ByMeal[i]
+		m.CaloriesPct, m.ProteinPct = sharePct(m.Calories, totalCal), sharePct(m.ProteinG, totalProtein)
+	}
+
+	out.ByHour = make([]HourShare, 24)
+	for h := range out.ByHour {
+		out.ByHour[h].Hour = h
+	}
+	rows, err = a.DB.Query(ctx, mealTimingEntries+`
+    SELECT EXTRACT(HOUR FROM local_at)::int, COUNT(*), COALESCE(SUM(calories), 0), COALESCE(SUM(protein_g), 0)
+    FROM entries
+    GROUP BY 1;
+  `, userID, from, end, tz)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("hour query: %v", err)})
+		return
+	}
+	for rows.Next() {
+		var h HourShare
+		if err := rows.Scan(&h.Hour, &h.Entries, &h.Calories, &h.ProteinG); err != nil {
+			rows.Close()
+			writeJSON(w, 500, map[string]any{"error": "scan hours"})
+			return
+		}
+		h.CaloriesPct, h.ProteinPct = sharePct(h.Calories, totalCal), sharePct(h.ProteinG, totalProtein)
+		out.ByHour[h.Hour] = h
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("hour query: %v", err)})
+		return
+	}
+
+	// day_at is local time shifted back by day_start ($7), so its date is
+	// the eating day and its clock runs from the day start. Late-night is
+	// [late_after, day_start), which wraps past midnight; morning is
+	// [day_start, 12:00).
+	rows, err = a.DB.Query(ctx, mealTimingEntries+`, days AS (
+      SELECT day_at::date AS day,
+             date_trunc($6::text, day_at::date::timestamp)::date AS bucket,
+             MIN(day_at::time) AS first_at, MAX(day_at::time) AS last_at,
+             bool_or(day_at::time >= $5::time - $7::interval) AS late,
+             SUM(calories) AS calories,
+             SUM(calories) FILTER (WHERE day_at::time >= $5::time - $7::interval) AS late_calories,
+             SUM(protein_g) AS protein_g,
+             SUM(protein_g) FILTER (WHERE day_at::time < '12:00'::time - $7::interval) AS morning_protein_g
+      FROM (SELECT e.*, e.local_at - $7::interval AS day_at FROM entries e) e
+      GROUP BY 1, 2
+    )
+    SELECT GROUPING(bucket), MIN(day), MAX(day), COUNT(*),
+           COALESCE(AVG(EXTRACT(EPOCH FROM first_at)) / 60, 0)::float8,
+           COALESCE(AVG(EXTRACT(EPOCH FROM last_at)) / 60, 0)::float8,
+           COALESCE(AVG(EXTRACT(EPOCH FROM last_at - first_at)) / 3600, 0)::float8,
+           COUNT(*) FILTER (WHERE late),
+           COALESCE(SUM(late_calories), 0)::float8, COALESCE(SUM(calories), 0)::float8,
+           COALESCE(SUM(morning_protein_g), 0)::float8, COALESCE(SUM(protein_g), 0)::float8
+    FROM days
+    GROUP BY GROUPING SETS ((bucket), ())
+    ORDER BY GROUPING(bucket), MIN(day);
+  `, userID, from, end, tz, lateAfter, group, dayStart)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("window query: %v", err)})
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var overall int
+		var first, last *time.Time
+		var ew EatingWindow
+		var firstMin, lastMin, lateCal, cal, morningProtein, protein float64
+		if err := rows.Scan(&overall, &first, &last, &ew.DaysLogged, &firstMin, &lastMin, &ew.AvgWindowHours,
+			&ew.LateNightDays, &lateCal, &cal, &morningProtein, &protein); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("scan window: %v", err)})
+			return
+		}
+		// Trend periods span their logged days; the overall row spans the
+		// requested range, even when nothing was logged.
+		ew.From, ew.To = out.From, out.To
+		if overall == 0 && first != nil {
+			ew.From, ew.To = first.Format("2006-01-02"), last.Format("2006-01-02")
+		}
+		if ew.DaysLogged > 0 {
+			ew.AvgFirstMeal, ew.AvgLastMeal = clockFromMinutes(firstMin+dayStartMin), clockFromMinutes(lastMin+dayStartMin)
+		}
+		ew.AvgWindowHours = math.Round(ew.AvgWindowHours*10) / 10
+		ew.LateNightPct = sharePct(float64(ew.LateNightDays), float64(ew.DaysLogged))
+		ew.LateNightCaloriesPct = sharePct(lateCal, cal)
+		ew.ProteinBeforeNoonPct = sharePct(morningProtein, protein)
+		if overall == 1 {
+			out.Overall = ew
+		} else {
+			out.Trend = append(out.Trend, ew)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("window query: %v", err)})
+		return
+	}
+	writeJSON(w, 200, out)
+}
+
+// FoodContribution is one food item's (or recipe's) share of what was eaten
+// over a date range. The *_pct fields are its share of each range total.
+type FoodContribution struct {
+	FoodItemID  string  `json:"food_item_id"`
+	Name        string  `json:"name"`
+	Brand       string  `json:"brand"`
+	IsRecipe    bool    `json:"is_recipe"`
+	TimesLogged int     `json:"times_logged"`
+	Servings    float64 `json:"servings"`
+	Calories    float64 `json:"calories"`
+	ProteinG    float64 `json:"protein_g"`
+	CarbsG      float64 `json:"carbs_g"`
+	FatG        float64 `json:"fat_g"`
+	FiberG      float64 `json:"fiber_g"`
+	TimesPct    float64 `json:"times_logged_pct"`
+	CaloriesPct float64 `json:"calories_pct"`
+	ProteinPct  float64 `json:"protein_pct"`
+	CarbsPct    float64 `json:"carbs_pct"`
+	FatPct      float64 `json:"fat_pct"`
+	FiberPct    float64 `json:"fiber_pct"`
+}
+
+type FoodContributionReport struct {
+	From   string             `json:"from"`
+	To     string             `json:"to"`
+	Sort   string             `json:"sort"`
+	Totals MacroTotals        `json:"totals"`
+	Items  []FoodContribution `json:"items"`
+}
+
+// foodContributionSorts maps ?sort= to the value items are ranked by.
+var foodContributionSorts = map[string]func(FoodContribution) float64{
+	"calories":     func(f FoodContribution) float64 { return f.Calories },
+	"protein_g":    func(f FoodContribution) float64 { return f.ProteinG },
+	"carbs_g":      func(f FoodContribution) float64 { return f.CarbsG },
+	"fat_g":        func(f FoodContribution) float64 { return f.FatG },
+	"fiber_g":      func(f FoodContribution) float64 { return f.FiberG },
+	"times_logged": func(f FoodContribution) float64 { return float64(f.TimesLogged) },
+}
+
+// HandleFoodContributions ranks the food items and recipes logged over
+// [from, to] by ?sort=calories|protein_g|carbs_g|fat_g|fiber_g|times_logged
+// (default calories), with each one's share of the range totals.
+// kind=food|recipe narrows the list; totals always cover everything logged,
+// so shares stay comparable. limit defaults to 50.
+func (a *App) HandleFoodContributions(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	from, end, err := a.parseDateRange(r)
+	if err != nil {
+		writeJSON(w, 400, map[string]any{"error": err.Error()})
+		return
+	}
+	sortBy := r.URL.Query().Get("sort")
+	if sortBy == "" {
+		sortBy = "calories"
+	}
+	key, ok := foodContributionSorts[sortBy]
+	if !ok {
+		writeJSON(w, 400, map[string]any{"error": "sort must be calories, protein_g, carbs_g, fat_g, fiber_g or times_logged"})
+		return
+	}
+	kind := r.URL.Query().Get("kind")
+	if kind != "" && kind != "food" && kind != "recipe" {
+		writeJSON(w, 400, map[string]any{"error": "kind must be food or recipe"})
+		return
+	}
+	limit := queryInt(r, "limit", 50)
+	if limit <= 0 {
+		limit = 50
+	}
+
+	rows, err := a.DB.Query(r.Context(), `
+    SELECT fi.id, fi.name, COALESCE(fi.brand, ''), fi.is_recipe, COUNT(*), COALESCE(SUM(le.servings), 0),
+           COALESCE(SUM(le.servings * le.calories_per_serving), 0),
+           COALESCE(SUM(le.servings * le.protein_g_per_serving), 0),
+           COALESCE(SUM(le.servings * le.carbs_g_per_serving), 0),
+           COALESCE(SUM(le.servings * le.fat_g_per_serving), 0),
+           COALESCE(SUM(le.servings * le.fiber_g_per_serving), 0)
+    FROM log_entries le
+    JOIN food_items fi ON fi.id = le.ref_id
+    WHERE le.user_id = $1 AND le.kind = 'food' AND le.occurred_at >= $2 AND le.occurred_at < $3
+    GROUP BY fi.id, fi.name, fi.brand, fi.is_recipe;
+  `, userID, from, end)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
+		return
+	}
+	defer rows.Close()
+	out := FoodContributionReport{
+		From: from.Format("2006-01-02"), To: end.AddDate(0, 0, -1).Format("2006-01-02"),
+		Sort: sortBy, Items: []FoodContribution{},
+	}
+	for rows.Next() {
+		var f FoodContribution
+		if err := rows.Scan(&f.FoodItemID, &f.Name, &f.Brand, &f.IsRecipe, &f.TimesLogged, &f.Servings,
+			&f.Calories, &f.ProteinG, &f.CarbsG, &f.FatG, &f.FiberG); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("scan: %v", err)})
+			return
+		}
+		out.Totals.add(MacroTotals{EntryCount: f.TimesLogged, Calories: f.Calories, ProteinG: f.ProteinG,
+			CarbsG: f.CarbsG, FatG: f.FatG, FiberG: f.FiberG})
+		if kind == "" || f.IsRecipe == (kind == "recipe") {
+			out.Items = append(out.Items, f)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
+		return
+	}
+
+	sort.SliceStable(out.Items, func(i, j int) bool {
+		ki, kj := key(out.Items[i]), key(out.Items[j])
+		if ki != kj {
+			return ki > kj
+		}
+		return out.Items[i].Name < out.Items[j].Name
+	})
+	if len(out.Items) > limit {
+		out.Items = out.Items[:limit]
+	}
+	t := out.Totals
+	for i := range out.Items {
+		f := &out.Items[i]
+		f.TimesPct = sharePct(float64(f.TimesLogged), float64(t.EntryCount))
+		f.CaloriesPct, f.ProteinPct = sharePct(f.Calories, t.Calories), sharePct(f.ProteinG, t.ProteinG)
+		f.CarbsPct, f.FatPct, f.FiberPct = sharePct(f.CarbsG, t.CarbsG), sharePct(f.FatG, t.FatG), sharePct(f.FiberG, t.FiberG)
+	}
+	writeJSON(w, 200, out)
+}
+
+// ── Streaks ───────────────────────────────────────────────────────────────────
+
+// DayStatus is one day's totals and which daily goals it met. Logged means
+// at least one food entry; the calorie flag needs a logged day so that an
+// empty day is not "under target". WeightKg is the day's last reading.
+type DayStatus struct {
+	Date          string   `json:"date"`
+	EntryCount    int      `json:"entry_count"`
+	Calories      float64  `json:"calories"`
+	ProteinG      float64  `json:"protein_g"`
+	CarbsG        float64  `json:"carbs_g"`
+	FatG          float64  `json:"fat_g"`
+	FiberG        float64  `json:"fiber_g"`
+	Steps         int      `json:"steps"`
+	WaterGlasses  int      `json:"water_glasses"`
+	WeightKg      *float64 `json:"weight_kg"`
+	Logged        bool     `json:"logged"`
+	ProteinMet    bool     `json:"protein_met"`
+	UnderCalories bool     `json:"under_calories"`
+	FiberMet      bool     `json:"fiber_met"`
+	WaterMet      bool     `json:"water_met"`
+}
+
+func (d *DayStatus) evaluate(g NutritionGoals) {
+	d.Logged = d.EntryCount > 0
+	d.ProteinMet = d.Logged && g.ProteinG > 0 && d.ProteinG >= g.ProteinG
+	d.UnderCalories = d.Logged && g.Calories > 0 && d.Calories <= g.Calories
+	d.FiberMet = d.Logged && g.FiberG > 0 && d.FiberG >= g.FiberG
+	d.WaterMet = g.WaterGlasses > 0 && d.WaterGlasses >= g.WaterGlasses
+}
+
+// dayStatuses returns, in date order, every local day in [from, end) with
+// food entries, steps, water or a weight reading. A zero from means since
+// the beginning. Food totals come from dailyMacroTotals so the digest and
+// the streak and history endpoints agree on what a day contains.
+func (a *App) dayStatuses(ctx context.Context, userID string, from, end time.Time, goals NutritionGoals) ([]DayStatus, error) {
+	food, err := a.dailyMacroTotals(ctx, userID, from, end)
+	if err != nil {
+		return nil, err
+	}
+	byDay := map[string]*DayStatus{}
+	for day, t := range food {
+		byDay[day] = &DayStatus{Date: day, EntryCount: t.EntryCount, Calories: t.Calories, ProteinG: t.ProteinG,
+			CarbsG: t.CarbsG, FatG: t.FatG, FiberG: t.FiberG}
+	}
+	rows, err := a.DB.Query(ctx, `
+    WITH activity AS (
+      SELECT date AS day, steps, water_glasses
+      FROM daily_activity
+      WHERE user_id = $1 AND (steps > 0 OR water_glasses > 0) AND date >= $5::date AND date < $6::date
+    ), weights AS (
+      SELECT DISTINCT ON (DATE(measured_at AT TIME ZONE $4)) DATE(measured_at AT TIME ZONE $4) AS day, weight_kg
+      FROM body_weights
+      WHERE user_id = $1 AND measured_at >= $2 AND measured_at < $3
+      ORDER BY 1, measured_at DESC
+    )
+    SELECT COALESCE(ac.day, wt.day), COALESCE(ac.steps, 0), COALESCE(ac.water_glasses, 0), wt.weight_kg::float8
+    FROM activity ac
+    FULL JOIN weights wt ON wt.day = ac.day;
+  `, userID, from, end, a.Loc.String(), from.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var day time.Time
+		var steps, water int
+		var weight *float64
+		if err := rows.Scan(&day, &steps, &water, &weight); err != nil {
+			return nil, err
+		}
+		key := day.Format("2006-01-02")
+		d, ok := byDay[key]
+		if !ok {
+			d = &DayStatus{Date: key}
+			byDay[key] = d
+		}
+		d.Steps, d.WaterGlasses, d.WeightKg = steps, water, weight
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	out := make([]DayStatus, 0, len(byDay))
+	for _, d := range byDay {
+		d.evaluate(goals)
+		out = append(out, *d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Date < out[j].Date })
+	return out, nil
+}
+
+// StatusBucket rolls DayStatus rows up into one week, month or year,
+// clipped to the requested range. Totals sum every day in the bucket; the
+// *_days fields count days that met each goal.
+type StatusBucket struct {
+	From              string      `json:"from"`
+	To                string      `json:"to"`
+	Days              int         `json:"days"`
+	DaysLogged        int         `json:"days_logged"`
+	Totals            MacroTotals `json:"totals"`
+	Steps             int         `json:"steps"`
+	WaterGlasses      int         `json:"water_glasses"`
+	AvgWeightKg       *float64    `json:"avg_weight_kg"`
+	ProteinMetDays    int         `json:"protein_met_days"`
+	UnderCaloriesDays int         `json:"under_calories_days"`
+	FiberMetDays      int         `json:"fiber_met_days"`
+	WaterMetDays      int         `json:"water_met_days"`
+}
+
+// bucketStart returns the first day of the week (Monday), month or year
+// containing day.
+func bucketStart(day time.Time, group string) time.Time {
+	switch group {
+	case "week":
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case "month":
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+	default:
+		return time.Date(day.Year(), 1, 1, 0, 0, 0, 0, day.Location())
+	}
+}
+
+// groupDayStatuses buckets days (sorted) covering [from, end) by group.
+// Every bucket overlapping the range is returned, including empty ones.
+func groupDayStatuses(days []DayStatus, from, end time.Time, group string) []StatusBucket {
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	last := end.AddDate(0, 0, -1)
+	last = time.Date(last.Year(), last.Month(), last.Day(), 0, 0, 0, 0, time.UTC)
+	out := []StatusBucket{}
+	index := map[string]int{}
+	for start := bucketStart(from, group); !start.After(last); {
+		var next time.Time
+		switch group {
+		case "week":
+			next = start.AddDate(0, 0, 7)
+		case "month":
+			next = start.AddDate(0, 1, 0)
+		default:
+			next = start.AddDate(1, 0, 0)
+		}
+		b0, b1 := start, next.AddDate(0, 0, -1)
+		if b0.Before(from) {
+			b0 = from
+		}
+		if b1.After(last) {
+			b1 = last
+		}
+		index[start.Format("2006-01-02")] = len(out)
+		out = append(out, StatusBucket{
+			From: b0.Format("2006-01-02"), To: b1.Format("2006-01-02"),
+			Days: int(b1.Sub(b0).Hours()/24) + 1,
+		})
+		start = next
+	}
+	weights := make([]float64, len(out))
+	readings := make([]int, len(out))
+	for _, d := range days {
+		day, err := time.Parse("2006-01-02", d.Date)
+		// Edge buckets are clipped, so days outside the range must not count.
+		if err != nil || day.Before(from) || day.After(last) {
+			continue
+		}
+		i, ok := index[bucketStart(day, group).Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+		b := &out[i]
+		b.Totals.add(MacroTotals{EntryCount: d.EntryCount, Calories: d.Calories, ProteinG: d.ProteinG,
+			CarbsG: d.CarbsG, FatG: d.FatG, FiberG: d.FiberG})
+		b.Steps += d.Steps
+		b.WaterGlasses += d.WaterGlasses
+		if d.WeightKg != nil {
+			weights[i] += *d.WeightKg
+			readings[i]++
+		}
+		for _, c := range []struct {
+			met bool
+			n   *int
+		}{
+			{d.Logged, &b.DaysLogged}, {d.ProteinMet, &b.ProteinMetDays}, {d.UnderCalories, &b.UnderCaloriesDays},
+			{d.FiberMet, &b.FiberMetDays}, {d.WaterMet, &b.WaterMetDays},
+		} {
+			if c.met {
+				*c.n++
+			}
+		}
+	}
+	for i := range out {
+		if readings[i] > 0 {
+			avg := math.Round(weights[i]/float64(readings[i])*100) / 100
+			out[i].AvgWeightKg = &avg
+		}
+	}
+	return out
+}
+
+type Streak struct {
+	Current int `json:"current"`
+	Longest int `json:"longest"`
+	// LongestFrom/LongestTo bound the most recent longest run.
+	LongestFrom string `json:"longest_from,omitempty"`
+	LongestTo   string `json:"longest_to,omitempty"`
+}
+
+// countStreak measures runs of consecutive days meeting met in days (sorted,
+// possibly with gaps). The current run ends on asOf, or on the day before
+// when asOf does not qualify yet, so an unfinished today does not break it.
+func countStreak(days []DayStatus, asOf time.Time, met func(DayStatus) bool) Streak {
+	var s Streak
+	hit := map[string]bool{}
+	run, runStart := 0, ""
+	var prev time.Time
+	for _, d := range days {
+		if !met(d) {
+			run = 0
+			continue
+		}
+		day, err := time.Parse("2006-01-02", d.Date)
+		if err != nil {
+			continue
+		}
+		hit[d.Date] = true
+		if run > 0 && day.Equal(prev.AddDate(0, 0, 1)) {
+			run++
+		} else {
+			run, runStart = 1, d.Date
+		}
+		prev = day
+		if run >= s.Longest {
+			s.Longest, s.LongestFrom, s.LongestTo = run, runStart, d.Date
+		}
+	}
+	cur := time.Date(asOf.Year(), asOf.Month(), asOf.Day(), 0, 0, 0, 0, time.UTC)
+	if !hit[cur.Format("2006-01-02")] {
+		cur = cur.AddDate(0, 0, -1)
+	}
+	for hit[cur.Format("2006-01-02")] {
+		s.Current++
+		cur = cur.AddDate(0, 0, -1)
+	}
+	return s
+}
+
+type StreaksResponse struct {
+	AsOf          string         `json:"as_of"`
+	Goals         NutritionGoals `json:"goals"`
+	Logging       Streak         `json:"logging"`
+	Protein       Streak         `json:"protein_goal"`
+	UnderCalories Streak         `json:"under_calories"`
+	Water         Streak         `json:"water_goal"`
+}
+
+// HandleStreaks reports current and longest-ever streaks of logging, meeting
+// the protein goal, staying at or under the calorie goal, and meeting the
+// water goal, as of ?date= (default today). Goals are the current ones.
+func (a *App) HandleStreaks(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	dateStr := r.URL.Query().Get("date")
+	if dateStr == "" {
+		dateStr = a.now().Format("2006-01-02")
+	}
+	asOf, err := time.ParseInLocation("2006-01-02", dateStr, a.Loc)
+	if err != nil {
+		writeJSON(w, 400, map[string]any{"error": "bad date"})
+		return
+	}
+	ctx := r.Context()
+	goals, err := a.loadGoals(ctx, userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("load goals: %v", err)})
+		return
+	}
+	days, err := a.dayStatuses(ctx, userID, time.Time{}, asOf.AddDate(0, 0, 1), goals)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("day statuses: %v", err)})
+		return
+	}
+	writeJSON(w, 200, StreaksResponse{
+		AsOf:          dateStr,
+		Goals:         goals,
+		Logging:       countStreak(days, asOf, func(d DayStatus) bool { return d.Logged }),
+		Protein:       countStreak(days, asOf, func(d DayStatus) bool { return d.ProteinMet }),
+		UnderCalories: countStreak(days, asOf, func(d DayStatus) bool { return d.UnderCalories }),
+		Water:         countStreak(days, asOf, func(d DayStatus) bool { return d.WaterMet }),
+	})
+}
+
+// ── Shopping Items ────────────────────────────────────────────────────────────
+
+type ShoppingItem struct {
+	ID        string  `json:"id"`
+	RecipeID  string  `json:"recipe_id"`
+	Name      string  `json:"name"`
+	Amount    float64 `json:"amount"`
+	Unit      string  `json:"unit"`
+	SortOrder int     `json:"sort_order"`
+}
+
+func (a *App) HandleGetShoppingItems(w http.ResponseWriter, r *http.Request) {
+	recipeID := chi.URLParam(r, "id")
+	rows, err := a.DB.Query(r.Context(), `
+		SELECT id, recipe_id, name, amount, unit, sort_order
+		FROM recipe_shopping_items
+		WHERE recipe_id = $1
+		ORDER BY sort_order, created_at
+	`, recipeID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
+		return
+	}
+	defer rows.Close()
+	items := []ShoppingItem{}
+	for rows.Next() {
+		var it ShoppingItem
+		if err := rows.Scan(&it.ID, &it.RecipeID, &it.Name, &it.Amount, &it.Unit, &it.SortOrder); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "scan"})
+			return
+		}
+		items = append(items, it)
+	}
+	writeJSON(w, 200, items)
+}
+
+func (a *App) HandleReplaceShoppingItems(w http.ResponseWriter, r *http.Request) {
+	recipeID := chi.URLParam(r, "id")
+	var body struct {
+		Items []struct {
+			Name      string  `json:"name"`
+			Amount    float64 `json:"amount"`
+			Unit      string  `json:"unit"`
+			SortOrder int     `json:"sort_order"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	ctx := r.Context()
+	tx, err := a.DB.Begin(ctx)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx begin"})
+		return
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	if len(body.Items) > 0 {
+		found, err := promoteToRecipe(ctx, tx, recipeID, DefaultUserID)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("promote recipe: %v", err)})
+			return
+		}
+		if !found {
+			writeJSON(w, 404, map[string]any{"error": "recipe not found"})
+			return
+		}
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM recipe_shopping_items WHERE recipe_id = $1`, recipeID); err != nil {
+		writeJSON(w, 500, map[string]any{"error": "delete"})
+		return
+	}
+	for i, it := range body.Items {
+		if strings.TrimSpace(it.Name) == "" {
+			continue
+		}
+		order := it.SortOrder
+		if order == 0 {
+			order = i
+		}
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO recipe_shopping_items (recipe_id, name, amount, unit, sort_order)
+			VALUES ($1, $2, $3, $4, $5)
+		`, recipeID, strings.TrimSpace(it.Name), it.Amount, it.Unit, order); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("insert: %v", err)})
+			return
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeJSON(w, 500, map[string]any{"error": "commit"})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+// HandleShoppingList returns all shopping items for the given recipe IDs.
+// Query param: recipe_ids=uuid1,uuid2,...
+func (a *App) HandleShoppingList(w http.ResponseWriter, r *http.Request) {
+	idsParam := r.URL.Query().Get("recipe_ids")
+	if idsParam == "" {
+		writeJSON(w, 400, map[string]any{"error": "recipe_ids required"})
+		return
+	}
+	ids := strings.Split(idsParam, ",")
+	// Build a safe IN clause using positional params
+	placeholders := make([]string, len(ids))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = strings.TrimSpace(id)
+	}
+	query := fmt.Sprintf(`
+		SELECT rsi.name, rsi.amount, rsi.unit, r.name AS recipe_name
+		FROM recipe_shopping_items rsi
+		JOIN recipes r ON r.id = rsi.recipe_id
+		WHERE rsi.recipe_id IN (%s)
+		ORDER BY rsi.name, rsi.unit
+	`, strings.Join(placeholders, ","))
+
+	rows, err := a.DB.Query(r.Context(), query, args...)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
+		return
+	}
+	defer rows.Close()
+
+	type ListItem struct {
+		Name       string  `json:"name"`
+		Amount     float64 `json:"amount"`
+		Unit       string  `json:"unit"`
+		RecipeName string  `json:"recipe_name"`
+	}
+	items := []ListItem{}
+	for rows.Next() {
+		var it ListItem
+		if err := rows.Scan(&it.Name, &it.Amount, &it.Unit, &it.RecipeName); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "scan"})
+			return
+		}
+		items = append(items, it)
+	}
+	writeJSON(w, 200, items)
+}
+
+// ── Recipe Photos ─────────────────────────────────────────────────────────────
+
+// PhotoStore keeps photo bytes outside Postgres. Keys are slash-separated
+// paths; an S3-compatible store can satisfy the same interface.
+type PhotoStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Open streams key; the caller closes the reader.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes key and everything stored under it as a prefix.
+	Delete(ctx context.Context, key string) error
+}
+
+var (
+	errPhotoNotFound   = errors.New("photo not found")
+	errInvalidPhotoKey = errors.New("invalid photo key")
+)
+
+// dirPhotoStore keeps photos under a local directory, a volume in Docker.
+type dirPhotoStore struct {
+	root string
+}
+
+func newDirPhotoStore(root string) (*dirPhotoStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &dirPhotoStore{root: root}, nil
+}
+
+// path maps a slash-separated key below root. Empty, absolute and ".."
+// keys are refused so no key can reach outside the directory or name root
+// itself.
+func (s *dirPhotoStore) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || filepath.IsAbs(key) {
+		return "", fmt.Errorf("%w %q", errInvalidPhotoKey, key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", fmt.Errorf("%w %q", errInvalidPhotoKey, key)
+		}
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+func (s *dirPhotoStore) Put(_ context.Context, key string, data []byte) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// Get and Open report a key that cannot exist as not found.
+func (s *dirPhotoStore) Get(_ context.Context, key string) ([]byte, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, errPhotoNotFound
+	}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errPhotoNotFound
+	}
+	return data, err
+}
+
+func (s *dirPhotoStore) Open(_ context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, errPhotoNotFound
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errPhotoNotFound
+	}
+	return f, err
+}
+
+func (s *dirPhotoStore) Delete(_ context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(p)
+}
+
+const (
+	// maxPhotoBytes caps a single uploaded photo.
+	maxPhotoBytes = 20 << 20
+	// maxPhotoPixels rejects images that would take too much memory to decode.
+	maxPhotoPixels = 50_000_000
+)
+
+// photoVariants are the resized JPEGs kept next to each original, by the
+// longest edge in pixels.
+var photoVariants = []struct {
+	Name    string
+	MaxEdge int
+}{
+	{"thumb", 320},
+	{"medium", 1280},
+}
+
+var (
+	errUnsupportedPhoto = errors.New("photo must be a JPEG, PNG, GIF or WebP image")
+	errPhotoTooLarge    = errors.New("photo too large")
+	errPhotoIDTaken     = errors.New("photo id belongs to another user")
+)
+
+type RecipePhoto struct {
+	ID          string    `json:"id"`
+	RecipeID    string    `json:"recipe_id"`
+	ContentType string    `json:"content_type"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	SizeBytes   int       `json:"size_bytes"`
+	SortOrder   int       `json:"sort_order"`
+	CreatedAt   time.Time `json:"created_at"`
+	// URLs are relative to the API root.
+	URL       string `json:"url"`
+	MediumURL string `json:"medium_url"`
+	ThumbURL  string `json:"thumb_url"`
+}
+
+func (p *RecipePhoto) setURLs() {
+	p.URL = recipePhotoURL(p.RecipeID, p.ID, "original")
+	p.MediumURL = recipePhotoURL(p.RecipeID, p.ID, "medium")
+	p.ThumbURL = recipePhotoURL(p.RecipeID, p.ID, "thumb")
+}
+
+func recipePhotoURL(recipeID, photoID, size string) string {
+	u := fmt.Sprintf("/recipes/%s/photos/%s", recipeID, photoID)
+	if size != "original" {
+		u += "?size=" + size
+	}
+	return u
+}
+
+func recipePhotoKey(recipeID, photoID, variant string) string {
+	return fmt.Sprintf("recipes/%s/%s/%s", recipeID, photoID, variant)
+}
+
+// renderPhotoVariants decodes an upload, applies its EXIF orientation and
+// returns the original's content type and size plus one JPEG per variant.
+func renderPhotoVariants(data []byte) (contentType string, width, height int, variants map[string][]byte, err error) {
+	contentType = http.DetectContentType(data)
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+	default:
+		return "", 0, 0, nil, errUnsupportedPhoto
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", 0, 0, nil, fmt.Errorf("%w: %v", errUnsupportedPhoto, err)
+	}
+	if cfg.Width*cfg.Height > maxPhotoPixels {
+		return "", 0, 0, nil, fmt.Errorf("%w: %dx%d is over %d megapixels", errPhotoTooLarge, cfg.Width, cfg.Height, maxPhotoPixels/1_000_000)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", 0, 0, nil, fmt.Errorf("%w: %v", errUnsupportedPhoto, err)
+	}
+	if contentType == "image/jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+	b := img.Bounds()
+	width, height = b.Dx(), b.Dy()
+	variants = map[string][]byte{}
+	for _, v := range photoVariants {
+		w, h := width, height
+		if longest := max(w, h); longest > v.MaxEdge {
+			w = max(1, w*v.MaxEdge/longest)
+			h = max(1, h*v.MaxEdge/longest)
+		}
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		// JPEG has no alpha: flatten transparent PNG/GIF/WebP onto white.
+		xdraw.Draw(dst, dst.Bounds(), image.White, image.Point{}, xdraw.Src)
+		xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, xdraw.Over, nil)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 82}); err != nil {
+			return "", 0, 0, nil, err
+		}
+		variants[v.Name] = buf.Bytes()
+	}
+	return contentType, width, height, variants, nil
+}
+
+// jpegOrientation reads the EXIF orientation tag (1-8) from a JPEG, or 1.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		size := int(data[i+2])<<8 | int(data[i+3])
+		if marker == 0xDA || size < 2 || i+2+size > len(data) { // start of scan: no more metadata
+			return 1
+		}
+		seg := data[i+4 : i+2+size]
+		if marker == 0xE1 && len(seg) > 14 && string(seg[:6]) == "Exif\x00\x00" {
+			return exifOrientation(seg[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	n := int(order.Uint16(tiff[ifd : ifd+2]))
+	for e := 0; e < n; e++ {
+		off := ifd + 2 + e*12
+		if off+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[off:off+2]) == 0x0112 {
+			if v := int(order.Uint16(tiff[off+8 : off+10])); v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// applyOrientation rotates/flips img so it displays upright for an EXIF
+// orientation value.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	transposed := orientation >= 5
+	dw, dh := w, h
+	if transposed {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// saveRecipePhoto stores data as a new photo of recipeID, after any existing
+// ones. The recipe row must already exist.
+func (a *App) saveRecipePhoto(ctx context.Context, recipeID string, data []byte) (RecipePhoto, error) {
+	if len(data) > maxPhotoBytes {
+		return RecipePhoto{}, fmt.Errorf("%w: the limit is %d MB", errPhotoTooLarge, maxPhotoBytes>>20)
+	}
+	contentType, width, height, variants, err := renderPhotoVariants(data)
+	if err != nil {
+		return RecipePhoto{}, err
+	}
+	sum := sha256.Sum256(data)
+	p := RecipePhoto{RecipeID: recipeID, ContentType: contentType, Width: width, Height: height, SizeBytes: len(data)}
+	tx, err := a.DB.Begin(ctx)
+	if err != nil {
+		return RecipePhoto{}, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	err = tx.QueryRow(ctx, `
+    INSERT INTO recipe_images (recipe_id, content_type, width, height, size_bytes, sha256, sort_order)
+    SELECT $1, $2, $3, $4, $5, $6, COALESCE(MAX(sort_order) + 1, 0)
+    FROM recipe_images WHERE recipe_id = $1
+    RETURNING id, sort_order, created_at;
+  `, recipeID, contentType, width, height, len(data), hex.EncodeToString(sum[:])).Scan(&p.ID, &p.SortOrder, &p.CreatedAt)
+	if err != nil {
+		return RecipePhoto{}, err
+	}
+	files := map[string][]byte{"original": data}
+	for name, v := range variants {
+		files[name] = v
+	}
+	for name, b := range files {
+		if err := a.Photos.Put(ctx, recipePhotoKey(recipeID, p.ID, name), b); err != nil {
+			_ = a.Photos.Delete(ctx, fmt.Sprintf("recipes/%s/%s", recipeID, p.ID))
+			return RecipePhoto{}, fmt.Errorf("store photo: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		_ = a.Photos.Delete(ctx, fmt.Sprintf("recipes/%s/%s", recipeID, p.ID))
+		return RecipePhoto{}, err
+	}
+	p.setURLs()
+	return p, nil
+}
+
+// deleteRecipePhotos removes photoID of recipeID, or every photo of the
+// recipe when photoID is empty. It reports how many were removed.
+func (a *App) deleteRecipePhotos(ctx context.Context, recipeID, photoID string) (int, error) {
+	rows, err := a.DB.Query(ctx, `
+    DELETE FROM recipe_images
+    WHERE recipe_id = $1 AND ($2 = '' OR id::text = $2)
+    RETURNING id;
+  `, recipeID, photoID)
+	return a.removeRecipePhotoFiles(ctx, recipeID, rows, err)
+}
+
+// deleteRecipePhotosExcept removes every photo of recipeID but keepID.
+func (a *App) deleteRecipePhotosExcept(ctx context.Context, recipeID, keepID string) (int, error) {
+	rows, err := a.DB.Query(ctx, `
+    DELETE FROM recipe_images
+    WHERE recipe_id = $1 AND id::text <> $2
+    RETURNING id;
+  `, recipeID, keepID)
+	return a.removeRecipePhotoFiles(ctx, recipeID, rows, err)
+}
+
+// removeRecipePhotoFiles deletes the stored files of the photo IDs returned
+// by a DELETE ... RETURNING id query.
+func (a *App) removeRecipePhotoFiles(ctx context.Context, recipeID string, rows pgx.Rows, err error) (int, error) {
+	if err != nil {
+		return 0, err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err := a.Photos.Delete(ctx, fmt.Sprintf("recipes/%s/%s", recipeID, id)); err != nil {
+			log.Printf("delete photo files %s: %v", id, err)
+		}
+	}
+	return len(ids), nil
+}
+
+func (a *App) listRecipePhotos(ctx context.Context, recipeID string) ([]RecipePhoto, error) {
+	rows, err := a.DB.Query(ctx, `
+    SELECT id, recipe_id, content_type, width, height, size_bytes, sort_order, created_at
+    FROM recipe_images
+    WHERE recipe_id = $1
+    ORDER BY sort_order, created_at;
+  `, recipeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []RecipePhoto{}
+	for rows.Next() {
+		var p RecipePhoto
+		if err := rows.Scan(&p.ID, &p.RecipeID, &p.ContentType, &p.Width, &p.Height, &p.SizeBytes, &p.SortOrder, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		p.setURLs()
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// ensureRecipeForPhotos promotes a plain food item to a recipe so it can
+// hold photos, reporting false when there is no such item.
+func (a *App) ensureRecipeForPhotos(ctx context.Context, id string) (bool, error) {
+	tx, err := a.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	found, err := promoteToRecipe(ctx, tx, id, DefaultUserID)
+	if err != nil || !found {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+func photoErrorStatus(err error) int {
+	if errors.Is(err, errUnsupportedPhoto) || errors.Is(err, errPhotoTooLarge) {
+		return 400
+	}
+	if errors.Is(err, errPhotoIDTaken) {
+		return 409
+	}
+	return 500
+}
+
+func (a *App) HandleListRecipePhotos(w http.ResponseWriter, r *http.Request) {
+	photos, err := a.listRecipePhotos(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("list photos: %v", err)})
+		return
+	}
+	writeJSON(w, 200, photos)
+}
+
+// HandleUploadRecipePhotos accepts a multipart form with one or more files in
+// "photo" or "photos" and adds them after the recipe's existing photos.
+func (a *App) HandleUploadRecipePhotos(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	r.Body = http.MaxBytesReader(w, r.Body, 5*maxPhotoBytes)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeJSON(w, 400, map[string]any{"error": fmt.Sprintf("invalid multipart form: %v", err)})
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	files := append(r.MultipartForm.File["photo"], r.MultipartForm.File["photos"]...)
+	if len(files) == 0 {
+		writeJSON(w, 400, map[string]any{"error": "no photo file (use field \"photo\")"})
+		return
+	}
+	ctx := r.Context()
+	found, err := a.ensureRecipeForPhotos(ctx, id)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("promote recipe: %v", err)})
+		return
+	}
+	if !found {
+		writeJSON(w, 404, map[string]any{"error": "recipe not found"})
+		return
+	}
+	saved := []RecipePhoto{}
+	for _, fh := range files {
+		f, err := fh.Open()
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": fmt.Sprintf("read %s: %v", fh.Filename, err)})
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(f, maxPhotoBytes+1))
+		f.Close()
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": fmt.Sprintf("read %s: %v", fh.Filename, err)})
+			return
+		}
+		p, err := a.saveRecipePhoto(ctx, id, data)
+		if err != nil {
+			writeJSON(w, photoErrorStatus(err), map[string]any{"error": fmt.Sprintf("%s: %v", fh.Filename, err), "saved": saved})
+			return
+		}
+		saved = append(saved, p)
+	}
+	writeJSON(w, 201, saved)
+}
+
+// HandleServeRecipePhoto streams a photo. ?size=thumb|medium picks a resized
+// JPEG; the default is the original upload. Photos never change once stored,
+// so responses carry an ETag and a long immutable cache lifetime.
+func (a *App) HandleServeRecipePhoto(w http.ResponseWriter, r *http.Request) {
+	recipeID, photoID := chi.URLParam(r, "id"), chi.URLParam(r, "photo_id")
+	size := r.URL.Query().Get("size")
+	if size == "" {
+		size = "original"
+	}
+	if size != "original" && size != "thumb" && size != "medium" {
+		writeJSON(w, 400, map[string]any{"error": "size must be thumb, medium or original"})
+		return
+	}
+	var contentType, sum string
+	var createdAt time.Time
+	err := a.DB.QueryRow(r.Context(), `
+    SELECT content_type, sha256, created_at FROM recipe_images
+    WHERE id::text = $1 AND recipe_id::text = $2;
+  `, photoID, recipeID).Scan(&contentType, &sum, &createdAt)
+	if err != nil {
+		writeJSON(w, 404, map[string]any{"error": "photo not found"})
+		return
+	}
+	if size != "original" {
+		contentType = "image/jpeg"
+	}
+	w.Header().Set("ETag", fmt.Sprintf(`"%s-%s"`, sum[:16], size))
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("Content-Type", contentType)
+	if match := r.Header.Get("If-None-Match"); match != "" && strings.Contains(match, w.Header().Get("ETag")) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	data, err := a.Photos.Get(r.Context(), recipePhotoKey(recipeID, photoID, size))
+	if err != nil {
+		w.Header().Del("Cache-Control")
+		writeJSON(w, 404, map[string]any{"error": err.Error()})
+		return
+	}
+	http.ServeContent(w, r, "", createdAt, bytes.NewReader(data))
+}
+
+func (a *App) HandleDeleteRecipePhotoFile(w http.ResponseWriter, r *http.Request) {
+	n, err := a.deleteRecipePhotos(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "photo_id"))
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete photo: %v", err)})
+		return
+	}
+	if n == 0 {
+		writeJSON(w, 404, map[string]any{"error": "photo not found"})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+// HandleReorderRecipePhotos sets the photo order from {"ids": [...]}; the
+// first becomes the cover. Photos not listed keep their place after them.
+func (a *App) HandleReorderRecipePhotos(w http.ResponseWriter, r *http.Request) {
+	recipeID := chi.URLParam(r, "id")
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.IDs) == 0 {
+		writeJSON(w, 400, map[string]any{"error": "ids required"})
+		return
+	}
+	_, err := a.DB.Exec(r.Context(), `
+    UPDATE recipe_images ri
+    SET sort_order = CASE WHEN o.pos IS NULL THEN $3 + ri.sort_order ELSE o.pos END
+    FROM recipe_images cur
+    LEFT JOIN unnest($2::text[]) WITH ORDINALITY AS o(id, pos) ON o.id = cur.id::text
+    WHERE cur.id = ri.id AND ri.recipe_id = $1;
+  `, recipeID, req.IDs, len(req.IDs))
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("reorder photos: %v", err)})
+		return
+	}
+	photos, err := a.listRecipePhotos(r.Context(), recipeID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("list photos: %v", err)})
+		return
+	}
+	writeJSON(w, 200, photos)
+}
+
+// HandleGetRecipePhoto is the single-photo API from before photo files:
+// {"photo": url} of the cover's medium size, relative to the API root.
+func (a *App) HandleGetRecipePhoto(w http.ResponseWriter, r *http.Request) {
+	photos, err := a.listRecipePhotos(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("list photos: %v", err)})
+		return
+	}
+	if len(photos) == 0 {
+		writeJSON(w, 404, map[string]any{"error": "no photo"})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"photo": photos[0].MediumURL, "thumb": photos[0].ThumbURL})
+}
+
+// HandlePutRecipePhoto replaces all of a recipe's photos with one given as a
+// base64 data: URL, as the single-photo API did.
+func (a *App) HandlePutRecipePhoto(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req struct {
+		Photo string `json:"photo"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*maxPhotoBytes)).Decode(&req); err != nil || req.Photo == "" {
+		writeJSON(w, 400, map[string]any{"error": "invalid request"})
+		return
+	}
+	data, err := decodeDataURL(req.Photo)
+	if err != nil {
+		writeJSON(w, 400, map[string]any{"error": err.Error()})
+		return
+	}
+	ctx := r.Context()
+	found, err := a.ensureRecipeForPhotos(ctx, id)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("promote recipe: %v", err)})
+		return
+	}
+	if !found {
+		writeJSON(w, 404, map[string]any{"error": "recipe not found"})
+		return
+	}
+	// Save first so a bad upload leaves the existing photos alone.
+	p, err := a.saveRecipePhoto(ctx, id, data)
+	if err != nil {
+		writeJSON(w, photoErrorStatus(err), map[string]any{"error": fmt.Sprintf("save photo: %v", err)})
+		return
+	}
+	if _, err := a.deleteRecipePhotosExcept(ctx, id, p.ID); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete photos: %v", err)})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true, "photo": p})
+}
+
+func (a *App) HandleDeleteRecipePhoto(w http.ResponseWriter, r *http.Request) {
+	if _, err := a.deleteRecipePhotos(r.Context(), chi.URLParam(r, "id"), ""); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete photo: %v", err)})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+// decodeDataURL returns the bytes of a base64 "data:image/...;base64,..." URL.
+func decodeDataURL(s string) ([]byte, error) {
+	meta, payload, ok := strings.Cut(s, ",")
+	if !ok || !strings.HasPrefix(meta, "data:") || !strings.HasSuffix(meta, ";base64") {
+		return nil, errors.New("photo must be a base64 data: URL")
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("decode photo: %w", err)
+	}
+	return data, nil
+}
+
+// MigrateLegacyPhotos moves base64 photos left in recipe_photos into the
+// photo store. Rows that fail to convert stay put and are retried on the next
+// start.
+func (a *App) MigrateLegacyPhotos(ctx context.Context) error {
+	rows, err := a.DB.Query(ctx, `SELECT recipe_id::text, photo_data FROM recipe_photos ORDER BY updated_at`)
+	if err != nil {
+		return err
+	}
+	type legacyPhoto struct{ recipeID, data string }
+	legacy, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (legacyPhoto, error) {
+		var p legacyPhoto
+		err := row.Scan(&p.recipeID, &p.data)
+		return p, err
+	})
+	if err != nil {
+		return err
+	}
+	for _, lp := range legacy {
+		data, err := decodeDataURL(lp.data)
+		if err == nil {
+			_, err = a.saveRecipePhoto(ctx, lp.recipeID, data)
+		}
+		if err != nil {
+			log.Printf("migrate photo for recipe %s: %v", lp.recipeID, err)
+			continue
+		}
+		if _, err := a.DB.Exec(ctx, `DELETE FROM recipe_photos WHERE recipe_id = $1`, lp.recipeID); err != nil {
+			return err
+		}
+	}
+	if len(legacy) > 0 {
+		log.Printf("migrated %d legacy recipe photos", len(legacy))
+	}
+	return nil
+}
+
+// ── Progress Photos ───────────────────────────────────────────────────────────
+
+// progressPoses are the accepted pose labels, in display order.
+var progressPoses = []string{"front", "side", "back"}
+
+type ProgressPhoto struct {
+	ID          string    `json:"id"`
+	TakenOn     string    `json:"taken_on"`
+	Pose        string    `json:"pose"`
+	Note        string    `json:"note"`
+	ContentType string    `json:"content_type"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	SizeBytes   int       `json:"size_bytes"`
+	CreatedAt   time.Time `json:"created_at"`
+	// URLs are relative to the API root.
+	URL       string `json:"url"`
+	MediumURL string `json:"medium_url"`
+	ThumbURL  string `json:"thumb_url"`
+}
+
+func (p *ProgressPhoto) setURLs() {
+	p.URL = "/body/photos/" + p.ID
+	p.MediumURL = p.URL + "?size=medium"
+	p.ThumbURL = p.URL + "?size=thumb"
+}
+
+func progressPhotoKey(userID, photoID, variant string) string {
+	return fmt.Sprintf("progress/%s/%s/%s", userID, photoID, variant)
+}
+
+const progressPhotoColumns = `id, taken_on, pose, note, content_type, width, height, size_bytes, created_at`
+
+func scanProgressPhoto(row pgx.Row) (ProgressPhoto, error) {
+	var p ProgressPhoto
+	var takenOn time.Time
+	err := row.Scan(&p.ID, &takenOn, &p.Pose, &p.Note, &p.ContentType, &p.Width, &p.Height, &p.SizeBytes, &p.CreatedAt)
+	p.TakenOn = takenOn.Format("2006-01-02")
+	p.setURLs()
+	return p, err
+}
+
+func validPose(pose string) bool {
+	switch pose {
+	case "front", "side", "back":
+		return true
+	}
+	return false
+}
+
+// storeProgressPhoto renders data's variants, writes p's row in tx and puts
+// the files in the photo store. A non-empty p.ID is kept (and overwritten if
+// the user already has it), so imports restore the same photo; an ID owned by
+// another user fails with errPhotoIDTaken. If tx is later rolled back the
+// caller must delete new files and restore overwritten ones, see
+// readProgressPhotoFiles.
+func (a *App) storeProgressPhoto(ctx context.Context, tx pgx.Tx, userID string, p ProgressPhoto, data []byte) (ProgressPhoto, error) {
+	if len(data) > maxPhotoBytes {
+		return p, fmt.Errorf("%w: the limit is %d MB", errPhotoTooLarge, maxPhotoBytes>>20)
+	}
+	contentType, width, height, variants, err := renderPhotoVariants(data)
+	if err != nil {
+		return p, err
+	}
+	sum := sha256.Sum256(data)
+	out, err := scanProgressPhoto(tx.QueryRow(ctx, `
+    INSERT INTO progress_photos (id, user_id, taken_on, pose, note, content_type, width, height, size_bytes, sha256)
+    VALUES (COALESCE(NULLIF($1, '')::uuid, uuid_generate_v4()), $2, $3::date, $4, $5, $6, $7, $8, $9, $10)
+    ON CONFLICT (id) DO UPDATE SET
+      taken_on = EXCLUDED.taken_on,
+      pose = EXCLUDED.pose,
+      note = EXCLUDED.note,
+      content_type = EXCLUDED.content_type,
+      width = EXCLUDED.width,
+      height = EXCLUDED.height,
+      size_bytes = EXCLUDED.size_bytes,
+      sha256 = EXCLUDED.sha256
+    WHERE progress_photos.user_id = EXCLUDED.user_id
+    RETURNING `+progressPhotoColumns+`;
+  `, p.ID, userID, p.TakenOn, p.Pose, p.Note, contentType, width, height, len(data), hex.EncodeToString(sum[:])))
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The conflict update is limited to the owner's rows.
+		return p, errPhotoIDTaken
+	}
+	if err != nil {
+		return p, err
+	}
+	files := map[string][]byte{"original": data}
+	for name, v := range variants {
+		files[name] = v
+	}
+	for name, b := range files {
+		if err := a.Photos.Put(ctx, progressPhotoKey(userID, out.ID, name), b); err != nil {
+			_ = a.Photos.Delete(ctx, fmt.Sprintf("progress/%s/%s", userID, out.ID))
+			return p, fmt.Errorf("store photo: %w", err)
+		}
+	}
+	return out, nil
+}
+
+// readProgressPhotoFiles returns the stored original and variants of a photo
+// by key, so they can be put back if an overwrite is rolled back.
+func (a *App) readProgressPhotoFiles(ctx context.Context, userID, photoID string) (map[string][]byte, error) {
+	names := []string{"original"}
+	for _, v := range photoVariants {
+		names = append(names, v.Name)
+	}
+	files := map[string][]byte{}
+	for _, name := range names {
+		key := progressPhotoKey(userID, photoID, name)
+		b, err := a.Photos.Get(ctx, key)
+		if errors.Is(err, errPhotoNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files[key] = b
+	}
+	return files, nil
+}
+
+// HandleUploadProgressPhoto accepts a multipart form with the image in
+// "photo", plus taken_on (YYYY-MM-DD, default today), pose
+// (front|side|back) and an optional note.
+func (a *App) HandleUploadProgressPhoto(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxPhotoBytes+1<<20)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeJSON(w, 400, map[string]any{"error": fmt.Sprintf("invalid multipart form: %v", err)})
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	userID := r.FormValue("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	p := ProgressPhoto{TakenOn: r.FormValue("taken_on"), Pose: r.FormValue("pose"), Note: strings.TrimSpace(r.FormValue("note"))}
+	if p.TakenOn == "" {
+		p.TakenOn = a.now().Format("2006-01-02")
+	}
+	if _, err := time.Parse("2006-01-02", p.TakenOn); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "taken_on must be YYYY-MM-DD"})
+		return
+	}
+	if !validPose(p.Pose) {
+		writeJSON(w, 400, map[string]any{"error": "pose must be front, side or back"})
+		return
+	}
+	f, fh, err := r.FormFile("photo")
+	if err != nil {
+		writeJSON(w, 400, map[string]any{"error": "no photo file (use field \"photo\")"})
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(f, maxPhotoBytes+1))
+	f.Close()
+	if err != nil {
+		writeJSON(w, 400, map[string]any{"error": fmt.Sprintf("read %s: %v", fh.Filename, err)})
+		return
+	}
+
+	ctx := r.Context()
+	tx, err := a.DB.Begin(ctx)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx begin"})
+		return
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	p, err = a.storeProgressPhoto(ctx, tx, userID, p, data)
+	if err != nil {
+		writeJSON(w, photoErrorStatus(err), map[string]any{"error": fmt.Sprintf("save photo: %v", err)})
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		_ = a.Photos.Delete(ctx, fmt.Sprintf("progress/%s/%s", userID, p.ID))
+		writeJSON(w, 500, map[string]any{"error": "tx commit"})
+		return
+	}
+	writeJSON(w, 201, p)
+}
+
+// HandleListProgressPhotos lists photos oldest first, optionally limited to
+// ?from=&to= and ?pose=.
+func (a *App) HandleListProgressPhotos(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	where := []string{"user_id = $1"}
+	args := []any{userID}
+	if r.URL.Query().Get("from") != "" || r.URL.Query().Get("to") != "" {
+		from, end, err := a.parseDateRange(r)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": err.Error()})
+			return
+		}
+		args = append(args, from.Format("2006-01-02"), end.Format("2006-01-02"))
+		where = append(where, fmt.Sprintf("taken_on >= $%d::date", len(args)-1), fmt.Sprintf("taken_on < $%d::date", len(args)))
+	}
+	if pose := r.URL.Query().Get("pose"); pose != "" {
+		if !validPose(pose) {
+			writeJSON(w, 400, map[string]any{"error": "pose must be front, side or back"})
+			return
+		}
+		args = append(args, pose)
+		where = append(where, fmt.Sprintf("pose = $%d", len(args)))
+	}
+	rows, err := a.DB.Query(r.Context(), `
+    SELECT `+progressPhotoColumns+`
+    FROM progress_photos
+    WHERE `+strings.Join(where, " AND ")+`
+    ORDER BY taken_on, pose, created_at;
+  `, args...)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
+		return
+	}
+	defer rows.Close()
+	out := []ProgressPhoto{}
+	for rows.Next() {
+		p, err := scanProgressPhoto(rows)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("scan: %v", err)})
+			return
+		}
+		out = append(out, p)
+	}
+	if err := rows.Err(); err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
+		return
+	}
+	writeJSON(w, 200, out)
+}
+
+// HandleServeProgressPhoto streams a photo like HandleServeRecipePhoto, but
+// only to its owner and with private caching.
+func (a *App) HandleServeProgressPhoto(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	photoID := chi.URLParam(r, "id")
+	size := r.URL.Query().Get("size")
+	if size == "" {
+		size = "original"
+	}
+	if size != "original" && size != "thumb" && size != "medium" {
+		writeJSON(w, 400, map[string]any{"error": "size must be thumb, medium or original"})
+		return
+	}
+	var contentType, sum string
+	var createdAt time.Time
+	err := a.DB.QueryRow(r.Context(), `
+    SELECT content_type, sha256, created_at FROM progress_photos
+    WHERE id::text = $1 AND user_id = $2;
+  `, photoID, userID).Scan(&contentType, &sum, &createdAt)
+	if err != nil {
+		writeJSON(w, 404, map[string]any{"error": "photo not found"})
+		return
+	}
+	if size != "original" {
+		contentType = "image/jpeg"
+	}
+	// The sha256 changes if an import replaces the file under the same ID.
+	w.Header().Set("ETag", fmt.Sprintf(`"%s-%s"`, sum[:16], size))
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("Content-Type", contentType)
+	if match := r.Header.Get("If-None-Match"); match != "" && strings.Contains(match, w.Header().Get("ETag")) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	data, err := a.Photos.Get(r.Context(), progressPhotoKey(userID, photoID, size))
+	if err != nil {
+		w.Header().Del("Cache-Control")
+		writeJSON(w, 404, map[string]any{"error": err.Error()})
+		return
+	}
+	http.ServeContent(w, r, "", createdAt, bytes.NewReader(data))
+}
+
+func (a *App) HandleDeleteProgressPhoto(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	photoID := chi.URLParam(r, "id")
+	ct, err := a.DB.Exec(r.Context(), `DELETE FROM progress_photos WHERE id::text = $1 AND user_id = $2;`, photoID, userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete: %v", err)})
+		return
+	}
+	if ct.RowsAffected() == 0 {
+		writeJSON(w, 404, map[string]any{"error": "photo not found"})
+		return
+	}
+	if err := a.Photos.Delete(r.Context(), fmt.Sprintf("progress/%s/%s", userID, photoID)); err != nil {
+		log.Printf("delete progress photo files %s: %v", photoID, err)
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+// ComparisonSide is one date of a comparison with the body metrics
+// current on it: the last weigh-in and body fat reading up to that day.
+type ComparisonSide struct {
+	Date       string   `json:"date"`
+	WeightKg   *float64 `json:"weight_kg"`
+	BodyFatPct *float64 `json:"body_fat_pct"`
+}
+
+// ComparisonPair holds the photo of one pose nearest to each date; either
+// side is null when that pose has never been photographed.
+type ComparisonPair struct {
+	Pose   string         `json:"pose"`
+	Before *ProgressPhoto `json:"before"`
+	After  *ProgressPhoto `json:"after"`
+}
+
+type ProgressComparison struct {
+	Before      ComparisonSide   `json:"before"`
+	After       ComparisonSide   `json:"after"`
+	DaysBetween int              `json:"days_between"`
+	Pairs       []ComparisonPair `json:"pairs"`
+}
+
+// comparisonSide loads the photos nearest to date by pose and the body
+// metrics as of that date.
+func (a *App) comparisonSide(ctx context.Context, userID string, date time.Time) (ComparisonSide, map[string]*ProgressPhoto, error) {
+	side := ComparisonSide{Date: date.Format("2006-01-02")}
+	err := a.DB.QueryRow(ctx, `
+    SELECT (SELECT weight_kg::float8 FROM body_weights
+            WHERE user_id = $1 AND measured_at < $2 ORDER BY measured_at DESC LIMIT 1),
+           (SELECT body_fat_pct::float8 FROM body_measurements
+            WHERE user_id = $1 AND measured_at < $2 AND body_fat_pct IS NOT NULL ORDER BY measured_at DESC LIMIT 1);
+  `, userID, date.AddDate(0, 0, 1)).Scan(&side.WeightKg, &side.BodyFatPct)
+	if err != nil {
+		return side, nil, err
+	}
+	rows, err := a.DB.Query(ctx, `
+    SELECT DISTINCT ON (pose) `+progressPhotoColumns+`
+    FROM progress_photos
+    WHERE user_id = $1
+    ORDER BY pose, abs(taken_on - $2::date), taken_on DESC, created_at DESC;
+  `, userID, side.Date)
+	if err != nil {
+		return side, nil, err
+	}
+	defer rows.Close()
+	photos := map[string]*ProgressPhoto{}
+	for rows.Next() {
+		p, err := scanProgressPhoto(rows)
+		if err != nil {
+			return side, nil, err
+		}
+		photos[p.Pose] = &p
+	}
+	return side, photos, rows.Err()
+}
+
+// HandleCompareProgressPhotos pairs up, for each pose, the photos nearest to
+// ?before= and ?after= (YYYY-MM-DD), with weight and body fat on each date.
+func (a *App) HandleCompareProgressPhotos(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	before, err1 := time.ParseInLocation("2006-01-02", r.URL.Query().Get("before"), a.Loc)
+	after, err2 := time.ParseInLocation("2006-01-02", r.URL.Query().Get("after"), a.Loc)
+	if err1 != nil || err2 != nil {
+		writeJSON(w, 400, map[string]any{"error": "before and after must be YYYY-MM-DD"})
+		return
+	}
+	ctx := r.Context()
+	out := ProgressComparison{Pairs: []ComparisonPair{}}
+	var beforePhotos, afterPhotos map[string]*ProgressPhoto
+	var err error
+	if out.Before, beforePhotos, err = a.comparisonSide(ctx, userID, before); err == nil {
+		out.After, afterPhotos, err = a.comparisonSide(ctx, userID, after)
+	}
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
+		return
+	}
+	out.DaysBetween = int(math.Round(after.Sub(before).Hours() / 24))
+	for _, pose := range progressPoses {
+		if beforePhotos[pose] == nil && afterPhotos[pose] == nil {
+			continue
+		}
+		out.Pairs = append(out.Pairs, ComparisonPair{Pose: pose, Before: beforePhotos[pose], After: afterPhotos[pose]})
+	}
+	writeJSON(w, 200, out)
+}
+
+// ── Pantry ────────────────────────────────────────────────────────────────────
+
+type PantryItem struct {
+	FoodItemID string  `json:"food_item_id"`
+	FoodName   string  `json:"food_name"`
+	Brand      string  `json:"brand"`
+	ServingLabel string `json:"serving_label"`
+	CaloriesPerServing float64 `json:"calories_per_serving"`
+	ProteinGPerServing float64 `json:"protein_g_per_serving"`
+	CarbsGPerServing   float64 `json:"carbs_g_per_serving"`
+	FatGPerServing     float64 `json:"fat_g_per_serving"`
+	Quantity   float64 `json:"quantity"`
+	UpdatedAt  string  `json:"updated_at"`
+}
+
+func (a *App) HandleListPantry(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	rows, err := a.DB.Query(r.Context(), `
+		SELECT fi.id, fi.name, COALESCE(fi.brand,''), COALESCE(fi.serving_label,'1 serving'),
+		       fi.calories_per_serving, fi.protein_g_per_serving, fi.carbs_g_per_serving, fi.fat_g_per_serving,
+		       p.quantity, p.updated_at
+		FROM pantry_items p
+		JOIN food_items fi ON fi.id = p.food_item_id
+		WHERE p.user_id = $1
+		ORDER BY fi.name
+	`, userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("list pantry: %v", err)})
+		return
+	}
+	defer rows.Close()
+	items := []PantryItem{}
+	for rows.Next() {
+		var it PantryItem
+		var updatedAt interface{}
+		if err := rows.Scan(&it.FoodItemID, &it.FoodName, &it.Brand, &it.ServingLabel,
+			&it.CaloriesPerServing, &it.ProteinGPerServing, &it.CarbsGPerServing, &it.FatGPerServing,
+			&it.Quantity, &updatedAt); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "scan pantry"})
+			return
+		}
+		if t, ok := updatedAt.(interface{ Format(string) string }); ok {
+			it.UpdatedAt = t.Format(time.RFC3339)
+		}
+		items = append(items, it)
+	}
+	writeJSON(w, 200, items)
+}
+
+func (a *App) HandleUpsertPantry(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	foodItemID := chi.URLParam(r, "food_item_id")
+	var req struct {
+		Quantity float64 `json:"quantity"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	_, err := a.DB.Exec(r.Context(), `
+		INSERT INTO pantry_items (user_id, food_item_id, quantity, updated_at)
+		VALUES ($1, $2, $3, now())
+		ON CONFLICT (user_id, food_item_id)
+		DO UPDATE SET quantity = EXCLUDED.quantity, updated_at = now()
+	`, userID, foodItemID, req.Quantity)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("upsert pantry: %v", err)})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+func (a *App) HandleDeletePantry(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	foodItemID := chi.URLParam(r, "food_item_id")
+	_, err := a.DB.Exec(r.Context(), `
+		DELETE FROM pantry_items WHERE user_id = $1 AND food_item_id = $2
+	`, userID, foodItemID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete pantry: %v", err)})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+func (a *App) HandleDeductPantry(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	var req struct {
+		FoodItemID string  `json:"food_item_id"`
+		Servings   float64 `json:"servings"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.FoodItemID == "" || req.Servings <= 0 {
+		writeJSON(w, 400, map[string]any{"error": "invalid request"})
+		return
+	}
+	_, err := a.DB.Exec(r.Context(), `
+		UPDATE pantry_items
+		SET quantity = GREATEST(0, quantity - $3), updated_at = now()
+		WHERE user_id = $1 AND food_item_id = $2
+	`, userID, req.FoodItemID, req.Servings)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("deduct pantry: %v", err)})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+// ── Ingredient Categories ─────────────────────────────────────────────────────
+
+type IngredientCategory struct {
+	IngredientName string `json:"ingredient_name"`
+	CategorySlug   string `json:"category_slug"`
+}
+
+func (a *App) HandleListIngredientCategories(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	rows, err := a.DB.Query(r.Context(), `
+		SELECT ingredient_name, category_slug
+		FROM ingredient_categories
+		WHERE user_id = $1
+		ORDER BY ingredient_name
+	`, userID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("list ingredient categories: %v", err)})
+		return
+	}
+	defer rows.Close()
+	items := []IngredientCategory{}
+	for rows.Next() {
+		var it IngredientCategory
+		if err := rows.Scan(&it.IngredientName, &it.CategorySlug); err != nil {
+			writeJSON(w, 500, map[string]any{"error": "scan"})
+			return
+		}
+		items = append(items, it)
+	}
+	writeJSON(w, 200, items)
+}
+
+func (a *App) HandleReplaceIngredientCategories(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	var body struct {
+		Items []IngredientCategory `json:"items"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	ctx := r.Context()
+	tx, err := a.DB.Begin(ctx)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": "tx begin"})
+		return
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	if _, err := tx.Exec(ctx, `DELETE FROM ingredient_categories WHERE user_id = $1`, userID); err != nil {
+		writeJSON(w, 500, map[string]any{"error": "delete"})
+		return
+	}
+	for _, it := range body.Items {
+		name := strings.TrimSpace(strings.ToLower(it.IngredientName))
+		if name == "" || strings.TrimSpace(it.CategorySlug) == "" {
+			continue
+		}
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO ingredient_categories (user_id, ingredient_name, category_slug)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, ingredient_name) DO UPDATE SET category_slug = EXCLUDED.category_slug
+		`, userID, name, strings.TrimSpace(it.CategorySlug)); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("insert: %v", err)})
+			return
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		writeJSON(w, 500, map[string]any{"error": "commit"})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+func (a *App) HandleSetIngredientCategoryBody(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	var body struct {
+		IngredientName string `json:"ingredient_name"`
+		CategorySlug   string `json:"category_slug"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	name := strings.TrimSpace(strings.ToLower(body.IngredientName))
+	if name == "" || strings.TrimSpace(body.CategorySlug) == "" {
+		writeJSON(w, 400, map[string]any{"error": "ingredient_name and category_slug are required"})
+		return
+	}
+	_, err := a.DB.Exec(r.Context(), `
+		INSERT INTO ingredient_categories (user_id, ingredient_name, category_slug)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, ingredient_name) DO UPDATE SET category_slug = EXCLUDED.category_slug
+	`, userID, name, strings.TrimSpace(body.CategorySlug))
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("upsert: %v", err)})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
 }
 
-// ── Shopping Items ────────────────────────────────────────────────────────────
+func (a *App) HandleSetIngredientCategory(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	rawName, _ := url.PathUnescape(chi.URLParam(r, "name"))
+	name := strings.TrimSpace(strings.ToLower(rawName))
+	if name == "" {
+		writeJSON(w, 400, map[string]any{"error": "name is required"})
+		return
+	}
+	var body struct {
+		CategorySlug string `json:"category_slug"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.CategorySlug) == "" {
+		writeJSON(w, 400, map[string]any{"error": "category_slug is required"})
+		return
+	}
+	_, err := a.DB.Exec(r.Context(), `
+		INSERT INTO ingredient_categories (user_id, ingredient_name, category_slug)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, ingredient_name) DO UPDATE SET category_slug = EXCLUDED.category_slug
+	`, userID, name, strings.TrimSpace(body.CategorySlug))
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("upsert: %v", err)})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
 
-type ShoppingItem struct {
-	ID        string  `json:"id"`
-	RecipeID  string  `json:"recipe_id"`
-	Name      string  `json:"name"`
-	Amount    float64 `json:"amount"`
-	Unit      string  `json:"unit"`
-	SortOrder int     `json:"sort_order"`
+func (a *App) HandleDeleteIngredientCategory(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	rawName, _ := url.PathUnescape(chi.URLParam(r, "name"))
+	name := strings.TrimSpace(strings.ToLower(rawName))
+	if name == "" {
+		writeJSON(w, 400, map[string]any{"error": "name is required"})
+		return
+	}
+	_, err := a.DB.Exec(r.Context(), `
+		DELETE FROM ingredient_categories WHERE user_id = $1 AND ingredient_name = $2
+	`, userID, name)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete: %v", err)})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
 }
 
-func (a *App) HandleGetShoppingItems(w http.ResponseWriter, r *http.Request) {
-	recipeID := chi.URLParam(r, "id")
+// ── Nudges ───────────────────────────────────────────────────────────────────
+
+type Nudge struct {
+	ID         string `json:"id"`
+	UserID     string `json:"user_id"`
+	FoodItemID string `json:"food_item_id"`
+	FoodName   string `json:"food_name"`
+	RemindAt   string `json:"remind_at"`
+	WebhookURL string `json:"webhook_url"`
+	Enabled    bool   `json:"enabled"`
+	LoggedToday bool  `json:"logged_today"`
+}
+
+func (a *App) HandleListNudges(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	now := a.now()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, a.Loc)
+	dayEnd := dayStart.Add(24 * time.Hour)
+
 	rows, err := a.DB.Query(r.Context(), `
-		SELECT id, recipe_id, name, amount, unit, sort_order
-		FROM recipe_shopping_items
-		WHERE recipe_id = $1
-		ORDER BY sort_order, created_at
-	`, recipeID)
+		SELECT n.id, n.user_id, n.food_item_id, fi.name,
+		       to_char(n.remind_at, 'HH24:MI'), n.webhook_url, n.enabled,
+		       (SELECT COUNT(*) FROM log_entries le
+		        WHERE le.user_id = n.user_id AND le.ref_id = n.food_item_id
+		          AND le.kind = 'food' AND le.occurred_at >= $2 AND le.occurred_at < $3) AS logged
+		FROM nudges n
+		JOIN food_items fi ON fi.id = n.food_item_id
+		WHERE n.user_id = $1
+		ORDER BY n.remind_at
+	`, userID, dayStart, dayEnd)
 	if err != nil {
 		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
 		return
 	}
 	defer rows.Close()
-	items := []ShoppingItem{}
+
+	nudges := []Nudge{}
 	for rows.Next() {
-		var it ShoppingItem
-		if err := rows.Scan(&it.ID, &it.RecipeID, &it.Name, &it.Amount, &it.Unit, &it.SortOrder); err != nil {
+		var n Nudge
+		var logCount int
+		if err := rows.Scan(&n.ID, &n.UserID, &n.FoodItemID, &n.FoodName,
+			&n.RemindAt, &n.WebhookURL, &n.Enabled, &logCount); err != nil {
 			writeJSON(w, 500, map[string]any{"error": "scan"})
 			return
 		}
-		items = append(items, it)
+		n.LoggedToday = logCount > 0
+		nudges = append(nudges, n)
 	}
-	writeJSON(w, 200, items)
+	writeJSON(w, 200, nudges)
 }
 
-func (a *App) HandleReplaceShoppingItems(w http.ResponseWriter, r *http.Request) {
-	recipeID := chi.URLParam(r, "id")
-	var body struct {
-		Items []struct {
-			Name      string  `json:"name"`
-			Amount    float64 `json:"amount"`
-			Unit      string  `json:"unit"`
-			SortOrder int     `json:"sort_order"`
-		} `json:"items"`
+func (a *App) HandleCreateNudge(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID     string `json:"user_id"`
+		FoodItemID string `json:"food_item_id"`
+		RemindAt   string `json:"remind_at"`
+		WebhookURL string `json:"webhook_url"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, 400, map[string]any{"error": "invalid json"})
 		return
 	}
-	ctx := r.Context()
-	tx, err := a.DB.Begin(ctx)
+	if req.UserID == "" {
+		req.UserID = DefaultUserID
+	}
+	if req.FoodItemID == "" || req.RemindAt == "" || req.WebhookURL == "" {
+		writeJSON(w, 400, map[string]any{"error": "food_item_id, remind_at, and webhook_url are required"})
+		return
+	}
+
+	var id string
+	err := a.DB.QueryRow(r.Context(), `
+		INSERT INTO nudges (user_id, food_item_id, remind_at, webhook_url)
+		VALUES ($1, $2, $3::time, $4)
+		ON CONFLICT (user_id, food_item_id) DO UPDATE
+		  SET remind_at = EXCLUDED.remind_at, webhook_url = EXCLUDED.webhook_url, enabled = true
+		RETURNING id
+	`, req.UserID, req.FoodItemID, req.RemindAt, req.WebhookURL).Scan(&id)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("insert: %v", err)})
+		return
+	}
+	writeJSON(w, 201, map[string]any{"ok": true, "id": id})
+}
+
+func (a *App) HandleUpdateNudge(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req struct {
+		RemindAt   *string `json:"remind_at"`
+		WebhookURL *string `json:"webhook_url"`
+		Enabled    *bool   `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+
+	if req.RemindAt != nil {
+		a.DB.Exec(r.Context(), `UPDATE nudges SET remind_at = $2::time WHERE id = $1`, id, *req.RemindAt)
+	}
+	if req.WebhookURL != nil {
+		a.DB.Exec(r.Context(), `UPDATE nudges SET webhook_url = $2 WHERE id = $1`, id, *req.WebhookURL)
+	}
+	if req.Enabled != nil {
+		a.DB.Exec(r.Context(), `UPDATE nudges SET enabled = $2 WHERE id = $1`, id, *req.Enabled)
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+func (a *App) HandleDeleteNudge(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	ct, err := a.DB.Exec(r.Context(), `DELETE FROM nudges WHERE id = $1`, id)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": "tx begin"})
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete: %v", err)})
 		return
 	}
-	defer func() { _ = tx.Rollback(ctx) }()
-	if _, err := tx.Exec(ctx, `DELETE FROM recipe_shopping_items WHERE recipe_id = $1`, recipeID); err != nil {
-		writeJSON(w, 500, map[string]any{"error": "delete"})
+	if ct.RowsAffected() == 0 {
+		writeJSON(w, 404, map[string]any{"error": "not found"})
 		return
 	}
-	for i, it := range body.Items {
-		if strings.TrimSpace(it.Name) == "" {
-			continue
-		}
-		order := it.SortOrder
-		if order == 0 {
-			order = i
-		}
-		if _, err := tx.Exec(ctx, `
-			INSERT INTO recipe_shopping_items (recipe_id, name, amount, unit, sort_order)
-			VALUES ($1, $2, $3, $4, $5)
-		`, recipeID, strings.TrimSpace(it.Name), it.Amount, it.Unit, order); err != nil {
-			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("insert: %v", err)})
-			return
-		}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+func (a *App) HandleTestNudge(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var foodName, webhookURL string
+	err := a.DB.QueryRow(r.Context(), `
+		SELECT fi.name, n.webhook_url
+		FROM nudges n JOIN food_items fi ON fi.id = n.food_item_id
+		WHERE n.id = $1
+	`, id).Scan(&foodName, &webhookURL)
+	if err != nil {
+		writeJSON(w, 404, map[string]any{"error": "nudge not found"})
+		return
 	}
-	if err := tx.Commit(ctx); err != nil {
-		writeJSON(w, 500, map[string]any{"error": "commit"})
+	if err := fireDiscordWebhook(webhookURL, foodName); err != nil {
+		writeJSON(w, 502, map[string]any{"error": fmt.Sprintf("webhook failed: %v", err)})
 		return
 	}
-	writeJSON(w, 200, map[string]any{"ok": true})
+	writeJSON(w, 200, map[string]any{"ok": true, "message": "webhook fired"})
 }
 
-// HandleShoppingList returns all shopping items for the given recipe IDs.
-// Query param: recipe_ids=uuid1,uuid2,...
-func (a *App) HandleShoppingList(w http.ResponseWriter, r *http.Request) {
-	idsParam := r.URL.Query().Get("recipe_ids")
-	if idsParam == "" {
-		writeJSON(w, 400, map[string]any{"error": "recipe_ids required"})
-		return
+func fireDiscordWebhook(webhookURL, foodName string) error {
+	return postDiscordWebhook(webhookURL, fmt.Sprintf("🔔 **Nudge:** You haven't logged **%s** yet today!", foodName))
+}
+
+// discordContentLimit is the maximum message length Discord accepts for webhook content.
+const discordContentLimit = 2000
+
+func postDiscordWebhook(webhookURL, content string) error {
+	if r := []rune(content); len(r) > discordContentLimit {
+		content = string(r[:discordContentLimit-1]) + "…"
 	}
-	ids := strings.Split(idsParam, ",")
-	// Build a safe IN clause using positional params
-	placeholders := make([]string, len(ids))
-	args := make([]any, len(ids))
-	for i, id := range ids {
-		placeholders[i] = fmt.Sprintf("$%d", i+1)
-		args[i] = strings.TrimSpace(id)
+	body, _ := json.Marshal(map[string]string{"content": content})
+	resp, err := http.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
 	}
-	query := fmt.Sprintf(`
-		SELECT rsi.name, rsi.amount, rsi.unit, r.name AS recipe_name
-		FROM recipe_shopping_items rsi
-		JOIN recipes r ON r.id = rsi.recipe_id
-		WHERE rsi.recipe_id IN (%s)
-		ORDER BY rsi.name, rsi.unit
-	`, strings.Join(placeholders, ","))
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("discord returned %d", resp.StatusCode)
+	}
+	return nil
+}
 
-	rows, err := a.DB.Query(r.Context(), query, args...)
+func (a *App) checkNudges() {
+	now := a.now()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, a.Loc)
+	dayEnd := dayStart.Add(24 * time.Hour)
+	currentTime := now.Format("15:04")
+	prevMinute := now.Add(-1 * time.Minute).Format("15:04")
+
+	rows, err := a.DB.Query(context.Background(), `
+		SELECT n.id, n.user_id, n.food_item_id, fi.name, n.webhook_url
+		FROM nudges n
+		JOIN food_items fi ON fi.id = n.food_item_id
+		WHERE n.enabled = true
+		  AND to_char(n.remind_at, 'HH24:MI') > $1
+		  AND to_char(n.remind_at, 'HH24:MI') <= $2
+	`, prevMinute, currentTime)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
+		log.Printf("[nudge] query error: %v", err)
 		return
 	}
 	defer rows.Close()
 
-	type ListItem struct {
-		Name       string  `json:"name"`
-		Amount     float64 `json:"amount"`
-		Unit       string  `json:"unit"`
-		RecipeName string  `json:"recipe_name"`
+	type pending struct {
+		id, userID, foodItemID, foodName, webhookURL string
 	}
-	items := []ListItem{}
+	var checks []pending
 	for rows.Next() {
-		var it ListItem
-		if err := rows.Scan(&it.Name, &it.Amount, &it.Unit, &it.RecipeName); err != nil {
-			writeJSON(w, 500, map[string]any{"error": "scan"})
-			return
+		var p pending
+		if err := rows.Scan(&p.id, &p.userID, &p.foodItemID, &p.foodName, &p.webhookURL); err != nil {
+			log.Printf("[nudge] scan error: %v", err)
+			continue
+		}
+		checks = append(checks, p)
+	}
+
+	for _, p := range checks {
+		var count int
+		err := a.DB.QueryRow(context.Background(), `
+			SELECT COUNT(*) FROM log_entries
+			WHERE user_id = $1 AND ref_id = $2 AND kind = 'food'
+			  AND occurred_at >= $3 AND occurred_at < $4
+		`, p.userID, p.foodItemID, dayStart, dayEnd).Scan(&count)
+		if err != nil {
+			log.Printf("[nudge] log check error for %s: %v", p.foodName, err)
+			continue
+		}
+		if count == 0 {
+			log.Printf("[nudge] firing webhook for %s (not logged today)", p.foodName)
+			if err := fireDiscordWebhook(p.webhookURL, p.foodName); err != nil {
+				log.Printf("[nudge] webhook error for %s: %v", p.foodName, err)
+			}
+		} else {
+			log.Printf("[nudge] %s already logged today (%d entries), skipping", p.foodName, count)
 		}
-		items = append(items, it)
 	}
-	writeJSON(w, 200, items)
 }
 
-func (a *App) HandleGetRecipePhoto(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	var data string
-	err := a.DB.QueryRow(r.Context(),
-		`SELECT photo_data FROM recipe_photos WHERE recipe_id = $1`, id,
-	).Scan(&data)
+// ── Goals ────────────────────────────────────────────────────────────────────
+
+type NutritionGoals struct {
+	Calories     float64 `json:"calories"`
+	ProteinG     float64 `json:"protein_g"`
+	CarbsG       float64 `json:"carbs_g"`
+	FatG         float64 `json:"fat_g"`
+	FiberG       float64 `json:"fiber_g"`
+	WaterGlasses int     `json:"water_glasses"`
+}
+
+// DefaultNutritionGoals mirrors DEFAULT_NUTRITION_GOALS in web/app/lib/settings.ts.
+var DefaultNutritionGoals = NutritionGoals{Calories: 2200, ProteinG: 180, CarbsG: 220, FatG: 70, FiberG: 30, WaterGlasses: 8}
+
+func (a *App) loadGoals(ctx context.Context, userID string) (NutritionGoals, error) {
+	g := DefaultNutritionGoals
+	err := a.DB.QueryRow(ctx, `
+		SELECT calories, protein_g, carbs_g, fat_g, fiber_g, water_glasses
+		FROM nutrition_goals WHERE user_id = $1
+	`, userID).Scan(&g.Calories, &g.ProteinG, &g.CarbsG, &g.FatG, &g.FiberG, &g.WaterGlasses)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DefaultNutritionGoals, nil
+	}
+	return g, err
+}
+
+func (a *App) HandleGetGoals(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	g, err := a.loadGoals(r.Context(), userID)
 	if err != nil {
-		writeJSON(w, 404, map[string]any{"error": "no photo"})
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("load goals: %v", err)})
 		return
 	}
-	writeJSON(w, 200, map[string]any{"photo": data})
+	writeJSON(w, 200, g)
 }
 
-func (a *App) HandlePutRecipePhoto(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
+func (a *App) HandleUpdateGoals(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		userID = DefaultUserID
+	}
 	var req struct {
-		Photo string `json:"photo"`
+		Calories     *float64 `json:"calories"`
+		ProteinG     *float64 `json:"protein_g"`
+		CarbsG       *float64 `json:"carbs_g"`
+		FatG         *float64 `json:"fat_g"`
+		FiberG       *float64 `json:"fiber_g"`
+		WaterGlasses *int     `json:"water_glasses"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Photo == "" {
-		writeJSON(w, 400, map[string]any{"error": "invalid request"})
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
 		return
 	}
-	_, err := a.DB.Exec(r.Context(), `
-		INSERT INTO recipe_photos (recipe_id, photo_data, updated_at)
-		VALUES ($1, $2, now())
-		ON CONFLICT (recipe_id) DO UPDATE SET photo_data = EXCLUDED.photo_data, updated_at = now()
-	`, id, req.Photo)
+	ctx := r.Context()
+	g, err := a.loadGoals(ctx, userID)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("save photo: %v", err)})
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("load goals: %v", err)})
 		return
 	}
-	writeJSON(w, 200, map[string]any{"ok": true})
-}
-
-func (a *App) HandleDeleteRecipePhoto(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	_, err := a.DB.Exec(r.Context(), `DELETE FROM recipe_photos WHERE recipe_id = $1`, id)
+	if req.Calories != nil {
+		g.Calories = *req.Calories
+	}
+	if req.ProteinG != nil {
+		g.ProteinG = *req.ProteinG
+	}
+	if req.CarbsG != nil {
+		g.CarbsG = *req.CarbsG
+	}
+	if req.FatG != nil {
+		g.FatG = *req.FatG
+	}
+	if req.FiberG != nil {
+		g.FiberG = *req.FiberG
+	}
+	if req.WaterGlasses != nil {
+		g.WaterGlasses = *req.WaterGlasses
+	}
+	if g.Calories < 0 || g.ProteinG < 0 || g.CarbsG < 0 || g.FatG < 0 || g.FiberG < 0 || g.WaterGlasses < 0 {
+		writeJSON(w, 400, map[string]any{"error": "goals must be >= 0"})
+		return
+	}
+	_, err = a.DB.Exec(ctx, `
+		INSERT INTO nutrition_goals (user_id, calories, protein_g, carbs_g, fat_g, fiber_g, water_glasses, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, now())
+		ON CONFLICT (user_id) DO UPDATE SET
+		  calories = EXCLUDED.calories,
+		  protein_g = EXCLUDED.protein_g,
+		  carbs_g = EXCLUDED.carbs_g,
+		  fat_g = EXCLUDED.fat_g,
+		  fiber_g = EXCLUDED.fiber_g,
+		  water_glasses = EXCLUDED.water_glasses,
+		  updated_at = now()
+	`, userID, g.Calories, g.ProteinG, g.CarbsG, g.FatG, g.FiberG, g.WaterGlasses)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete photo: %v", err)})
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("upsert goals: %v", err)})
 		return
 	}
-	writeJSON(w, 200, map[string]any{"ok": true})
+	writeJSON(w, 200, g)
 }
 
-// ── Pantry ────────────────────────────────────────────────────────────────────
+// ── Digests ──────────────────────────────────────────────────────────────────
 
-type PantryItem struct {
-	FoodItemID string  `json:"food_item_id"`
-	FoodName   string  `json:"food_name"`
-	Brand      string  `json:"brand"`
-	ServingLabel string `json:"serving_label"`
-	CaloriesPerServing float64 `json:"calories_per_serving"`
-	ProteinGPerServing float64 `json:"protein_g_per_serving"`
-	CarbsGPerServing   float64 `json:"carbs_g_per_serving"`
-	FatGPerServing     float64 `json:"fat_g_per_serving"`
-	Quantity   float64 `json:"quantity"`
-	UpdatedAt  string  `json:"updated_at"`
+type MacroTotals struct {
+	EntryCount int     `json:"entry_count"`
+	Calories   float64 `json:"calories"`
+	ProteinG   float64 `json:"protein_g"`
+	CarbsG     float64 `json:"carbs_g"`
+	FatG       float64 `json:"fat_g"`
+	FiberG     float64 `json:"fiber_g"`
 }
 
-func (a *App) HandleListPantry(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		userID = DefaultUserID
+func (t *MacroTotals) add(o MacroTotals) {
+	t.EntryCount += o.EntryCount
+	t.Calories += o.Calories
+	t.ProteinG += o.ProteinG
+	t.CarbsG += o.CarbsG
+	t.FatG += o.FatG
+	t.FiberG += o.FiberG
+}
+
+func (t MacroTotals) scale(f float64) MacroTotals {
+	return MacroTotals{
+		EntryCount: t.EntryCount,
+		Calories:   t.Calories * f, ProteinG: t.ProteinG * f, CarbsG: t.CarbsG * f, FatG: t.FatG * f, FiberG: t.FiberG * f,
 	}
-	rows, err := a.DB.Query(r.Context(), `
-		SELECT fi.id, fi.name, COALESCE(fi.brand,''), COALESCE(fi.serving_label,'1 serving'),
-		       fi.calories_per_serving, fi.protein_g_per_serving, fi.carbs_g_per_serving, fi.fat_g_per_serving,
-		       p.quantity, p.updated_at
-		FROM pantry_items p
-		JOIN food_items fi ON fi.id = p.food_item_id
-		WHERE p.user_id = $1
-		ORDER BY fi.name
-	`, userID)
+}
+
+// dailyMacroTotals returns food totals keyed by local date (YYYY-MM-DD) for
+// every day in [from, to) that has at least one log entry.
+func (a *App) dailyMacroTotals(ctx context.Context, userID string, from, to time.Time) (map[string]MacroTotals, error) {
+	rows, err := a.DB.Query(ctx, `
+		SELECT DATE(le.occurred_at AT TIME ZONE $4) AS day,
+		       COUNT(*),
+		       COALESCE(SUM(le.servings * le.calories_per_serving), 0),
+		       COALESCE(SUM(le.servings * le.protein_g_per_serving), 0),
+		       COALESCE(SUM(le.servings * le.carbs_g_per_serving), 0),
+		       COALESCE(SUM(le.servings * le.fat_g_per_serving), 0),
+		       COALESCE(SUM(le.servings * le.fiber_g_per_serving), 0)
+		FROM log_entries le
+		JOIN food_items fi ON fi.id = le.ref_id
+		WHERE le.user_id = $1 AND le.kind = 'food' AND le.occurred_at >= $2 AND le.occurred_at < $3
+		GROUP BY day
+	`, userID, from, to, a.Loc.String())
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("list pantry: %v", err)})
-		return
+		return nil, err
 	}
 	defer rows.Close()
-	items := []PantryItem{}
+	out := map[string]MacroTotals{}
 	for rows.Next() {
-		var it PantryItem
-		var updatedAt interface{}
-		if err := rows.Scan(&it.FoodItemID, &it.FoodName, &it.Brand, &it.ServingLabel,
-			&it.CaloriesPerServing, &it.ProteinGPerServing, &it.CarbsGPerServing, &it.FatGPerServing,
-			&it.Quantity, &updatedAt); err != nil {
-			writeJSON(w, 500, map[string]any{"error": "scan pantry"})
-			return
-		}
-		if t, ok := updatedAt.(interface{ Format(string) string }); ok {
-			it.UpdatedAt = t.Format(time.RFC3339)
+		var day time.Time
+		var t MacroTotals
+		if err := rows.Scan(&day, &t.EntryCount, &t.Calories, &t.ProteinG, &t.CarbsG, &t.FatG, &t.FiberG); err != nil {
+			return nil, err
 		}
-		items = append(items, it)
+		out[day.Format("2006-01-02")] = t
 	}
-	writeJSON(w, 200, items)
+	return out, rows.Err()
 }
 
-func (a *App) HandleUpsertPantry(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		userID = DefaultUserID
+type DigestWeight struct {
+	StartKg  float64 `json:"start_kg"`
+	EndKg    float64 `json:"end_kg"`
+	ChangeKg float64 `json:"change_kg"`
+	Readings int     `json:"readings"`
+}
+
+type DigestFood struct {
+	FoodItemID  string  `json:"food_item_id"`
+	Name        string  `json:"name"`
+	TimesLogged int     `json:"times_logged"`
+	Calories    float64 `json:"calories"`
+	ProteinG    float64 `json:"protein_g"`
+}
+
+type DigestReport struct {
+	Period        string         `json:"period"`
+	From          string         `json:"from"`
+	To            string         `json:"to"`
+	Days          int            `json:"days"`
+	DaysLogged    int            `json:"days_logged"`
+	Totals        MacroTotals    `json:"totals"`
+	DailyAverage  MacroTotals    `json:"daily_average"`
+	Goals         NutritionGoals `json:"goals"`
+	Weight        *DigestWeight  `json:"weight,omitempty"`
+	TopFoods      []DigestFood   `json:"top_foods"`
+	LoggingStreak int            `json:"logging_streak"`
+	ProteinStreak int            `json:"protein_streak"`
+	Content       string         `json:"content"`
+}
+
+// composeDigest builds the daily or weekly digest for the period ending on
+// endDay (a local midnight). Averages are per calendar day in the period.
+func (a *App) composeDigest(ctx context.Context, userID, period string, endDay time.Time) (DigestReport, error) {
+	days := 1
+	if period == "weekly" {
+		days = 7
 	}
-	foodItemID := chi.URLParam(r, "food_item_id")
-	var req struct {
-		Quantity float64 `json:"quantity"`
+	from := endDay.AddDate(0, 0, -(days - 1))
+	to := endDay.AddDate(0, 0, 1)
+	out := DigestReport{
+		Period: period,
+		From:   from.Format("2006-01-02"),
+		To:     endDay.Format("2006-01-02"),
+		Days:   days,
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, 400, map[string]any{"error": "invalid json"})
-		return
+
+	goals, err := a.loadGoals(ctx, userID)
+	if err != nil {
+		return out, fmt.Errorf("load goals: %w", err)
 	}
-	_, err := a.DB.Exec(r.Context(), `
-		INSERT INTO pantry_items (user_id, food_item_id, quantity, updated_at)
-		VALUES ($1, $2, $3, now())
-		ON CONFLICT (user_id, food_item_id)
-		DO UPDATE SET quantity = EXCLUDED.quantity, updated_at = now()
-	`, userID, foodItemID, req.Quantity)
+	out.Goals = goals
+
+	// Streaks look at the whole history, the same way /streaks does.
+	statuses, err := a.dayStatuses(ctx, userID, time.Time{}, to, goals)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("upsert pantry: %v", err)})
-		return
+		return out, fmt.Errorf("day statuses: %w", err)
+	}
+	fromKey := from.Format("2006-01-02")
+	for _, d := range statuses {
+		if d.Logged && d.Date >= fromKey {
+			out.Totals.add(MacroTotals{EntryCount: d.EntryCount, Calories: d.Calories, ProteinG: d.ProteinG,
+				CarbsG: d.CarbsG, FatG: d.FatG, FiberG: d.FiberG})
+			out.DaysLogged++
+		}
 	}
-	writeJSON(w, 200, map[string]any{"ok": true})
-}
+	out.DailyAverage = out.Totals.scale(1 / float64(days))
+	out.LoggingStreak = countStreak(statuses, endDay, func(d DayStatus) bool { return d.Logged }).Current
+	out.ProteinStreak = countStreak(statuses, endDay, func(d DayStatus) bool { return d.ProteinMet }).Current
 
-func (a *App) HandleDeletePantry(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		userID = DefaultUserID
+	// Weight trend covers at least the trailing week so daily digests still show direction.
+	weightFrom := from
+	if days < 7 {
+		weightFrom = endDay.AddDate(0, 0, -6)
 	}
-	foodItemID := chi.URLParam(r, "food_item_id")
-	_, err := a.DB.Exec(r.Context(), `
-		DELETE FROM pantry_items WHERE user_id = $1 AND food_item_id = $2
-	`, userID, foodItemID)
+	var wt DigestWeight
+	err = a.DB.QueryRow(ctx, `
+		SELECT COUNT(*),
+		       COALESCE((array_agg(weight_kg ORDER BY measured_at ASC))[1], 0),
+		       COALESCE((array_agg(weight_kg ORDER BY measured_at DESC))[1], 0)
+		FROM body_weights
+		WHERE user_id = $1 AND measured_at >= $2 AND measured_at < $3
+	`, userID, weightFrom, to).Scan(&wt.Readings, &wt.StartKg, &wt.EndKg)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete pantry: %v", err)})
-		return
+		return out, fmt.Errorf("weight trend: %w", err)
+	}
+	if wt.Readings > 0 {
+		wt.ChangeKg = wt.EndKg - wt.StartKg
+		out.Weight = &wt
 	}
-	writeJSON(w, 200, map[string]any{"ok": true})
-}
 
-func (a *App) HandleDeductPantry(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		userID = DefaultUserID
+	rows, err := a.DB.Query(ctx, `
+		SELECT fi.id, fi.name, COUNT(*),
+		       COALESCE(SUM(le.servings * le.calories_per_serving), 0),
+		       COALESCE(SUM(le.servings * le.protein_g_per_serving), 0)
+		FROM log_entries le
+		JOIN food_items fi ON fi.id = le.ref_id
+		WHERE le.user_id = $1 AND le.kind = 'food' AND le.occurred_at >= $2 AND le.occurred_at < $3
+		GROUP BY fi.id, fi.name
+		ORDER BY 4 DESC, fi.name
+		LIMIT 5
+	`, userID, from, to)
+	if err != nil {
+		return out, fmt.Errorf("top foods: %w", err)
 	}
-	var req struct {
-		FoodItemID string  `json:"food_item_id"`
-		Servings   float64 `json:"servings"`
+	defer rows.Close()
+	out.TopFoods = []DigestFood{}
+	for rows.Next() {
+		var f DigestFood
+		if err := rows.Scan(&f.FoodItemID, &f.Name, &f.TimesLogged, &f.Calories, &f.ProteinG); err != nil {
+			return out, fmt.Errorf("top foods scan: %w", err)
+		}
+		out.TopFoods = append(out.TopFoods, f)
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.FoodItemID == "" || req.Servings <= 0 {
-		writeJSON(w, 400, map[string]any{"error": "invalid request"})
-		return
+	rows.Close()
+
+	out.Content = renderDigest(out)
+	return out, nil
+}
+
+func goalLine(label string, value, goal float64, unit string) string {
+	if goal <= 0 {
+		return fmt.Sprintf("%s: %.0f%s\n", label, value, unit)
 	}
-	_, err := a.DB.Exec(r.Context(), `
-		UPDATE pantry_items
-		SET quantity = GREATEST(0, quantity - $3), updated_at = now()
-		WHERE user_id = $1 AND food_item_id = $2
-	`, userID, req.FoodItemID, req.Servings)
-	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("deduct pantry: %v", err)})
-		return
+	return fmt.Sprintf("%s: %.0f / %.0f%s (%.0f%%)\n", label, value, goal, unit, value/goal*100)
+}
+
+// renderDigest formats a digest as Discord-flavoured Markdown.
+func renderDigest(d DigestReport) string {
+	var sb strings.Builder
+	if d.Period == "weekly" {
+		sb.WriteString(fmt.Sprintf("📊 **Weekly digest — %s to %s**\n", d.From, d.To))
+		sb.WriteString(fmt.Sprintf("Logged %d of %d days. Daily averages:\n", d.DaysLogged, d.Days))
+	} else {
+		sb.WriteString(fmt.Sprintf("📊 **Daily digest — %s**\n", d.To))
+	}
+	avg := d.DailyAverage
+	sb.WriteString(goalLine("Calories", avg.Calories, d.Goals.Calories, " kcal"))
+	sb.WriteString(goalLine("Protein", avg.ProteinG, d.Goals.ProteinG, "g"))
+	sb.WriteString(goalLine("Carbs", avg.CarbsG, d.Goals.CarbsG, "g"))
+	sb.WriteString(goalLine("Fat", avg.FatG, d.Goals.FatG, "g"))
+	sb.WriteString(goalLine("Fiber", avg.FiberG, d.Goals.FiberG, "g"))
+	if d.Weight != nil {
+		sb.WriteString(fmt.Sprintf("Weight: %.1f kg (%+.1f kg over %d readings)\n", d.Weight.EndKg, d.Weight.ChangeKg, d.Weight.Readings))
+	}
+	if len(d.TopFoods) > 0 {
+		sb.WriteString("\n**Top foods**\n")
+		for _, f := range d.TopFoods {
+			sb.WriteString(fmt.Sprintf("• %s — %.0f kcal, %.0fg protein (×%d)\n", f.Name, f.Calories, f.ProteinG, f.TimesLogged))
+		}
+	} else {
+		sb.WriteString("\n_No food logged._\n")
 	}
-	writeJSON(w, 200, map[string]any{"ok": true})
+	sb.WriteString(fmt.Sprintf("\n🔥 Logging streak: %d day(s) · 💪 Protein goal streak: %d day(s)\n", d.LoggingStreak, d.ProteinStreak))
+	return sb.String()
 }
 
-// ── Ingredient Categories ─────────────────────────────────────────────────────
+// digestEndDay returns the last full day a digest sent at now should cover:
+// yesterday for both daily and weekly digests.
+func (a *App) digestEndDay(now time.Time) time.Time {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, a.Loc)
+	return today.AddDate(0, 0, -1)
+}
 
-type IngredientCategory struct {
-	IngredientName string `json:"ingredient_name"`
-	CategorySlug   string `json:"category_slug"`
+type Digest struct {
+	ID         string  `json:"id"`
+	UserID     string  `json:"user_id"`
+	Period     string  `json:"period"`
+	SendAt     string  `json:"send_at"`
+	Weekday    int     `json:"weekday"`
+	WebhookURL string  `json:"webhook_url"`
+	Enabled    bool    `json:"enabled"`
+	LastSentAt *string `json:"last_sent_at"`
 }
 
-func (a *App) HandleListIngredientCategories(w http.ResponseWriter, r *http.Request) {
+func validDigestPeriod(p string) bool {
+	return p == "daily" || p == "weekly"
+}
+
+func (a *App) HandleListDigests(w http.ResponseWriter, r *http.Request) {
 	userID := r.URL.Query().Get("user_id")
 	if userID == "" {
 		userID = DefaultUserID
 	}
 	rows, err := a.DB.Query(r.Context(), `
-		SELECT ingredient_name, category_slug
-		FROM ingredient_categories
+		SELECT id, user_id, period, to_char(send_at, 'HH24:MI'), weekday, webhook_url, enabled, last_sent_at
+		FROM digests
 		WHERE user_id = $1
-		ORDER BY ingredient_name
+		ORDER BY period, send_at
 	`, userID)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("list ingredient categories: %v", err)})
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
 		return
 	}
 	defer rows.Close()
-	items := []IngredientCategory{}
+	out := []Digest{}
 	for rows.Next() {
-		var it IngredientCategory
-		if err := rows.Scan(&it.IngredientName, &it.CategorySlug); err != nil {
+		var d Digest
+		var lastSent *time.Time
+		if err := rows.Scan(&d.ID, &d.UserID, &d.Period, &d.SendAt, &d.Weekday, &d.WebhookURL, &d.Enabled, &lastSent); err != nil {
 			writeJSON(w, 500, map[string]any{"error": "scan"})
 			return
 		}
-		items = append(items, it)
+		if lastSent != nil {
+			s := lastSent.In(a.Loc).Format(time.RFC3339)
+			d.LastSentAt = &s
+		}
+		out = append(out, d)
 	}
-	writeJSON(w, 200, items)
+	writeJSON(w, 200, out)
 }
 
-func (a *App) HandleReplaceIngredientCategories(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		userID = DefaultUserID
-	}
-	var body struct {
-		Items []IngredientCategory `json:"items"`
+func (a *App) HandleCreateDigest(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID     string `json:"user_id"`
+		Period     string `json:"period"`
+		SendAt     string `json:"send_at"`
+		Weekday    int    `json:"weekday"`
+		WebhookURL string `json:"webhook_url"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, 400, map[string]any{"error": "invalid json"})
 		return
 	}
-	ctx := r.Context()
-	tx, err := a.DB.Begin(ctx)
-	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": "tx begin"})
+	if req.UserID == "" {
+		req.UserID = DefaultUserID
+	}
+	if req.Period == "" {
+		req.Period = "daily"
+	}
+	if !validDigestPeriod(req.Period) {
+		writeJSON(w, 400, map[string]any{"error": "period must be daily or weekly"})
 		return
 	}
-	defer func() { _ = tx.Rollback(ctx) }()
-	if _, err := tx.Exec(ctx, `DELETE FROM ingredient_categories WHERE user_id = $1`, userID); err != nil {
-		writeJSON(w, 500, map[string]any{"error": "delete"})
+	if req.Weekday < 0 || req.Weekday > 6 {
+		writeJSON(w, 400, map[string]any{"error": "weekday must be 0 (Sunday) to 6 (Saturday)"})
 		return
 	}
-	for _, it := range body.Items {
-		name := strings.TrimSpace(strings.ToLower(it.IngredientName))
-		if name == "" || strings.TrimSpace(it.CategorySlug) == "" {
-			continue
-		}
-		if _, err := tx.Exec(ctx, `
-			INSERT INTO ingredient_categories (user_id, ingredient_name, category_slug)
-			VALUES ($1, $2, $3)
-			ON CONFLICT (user_id, ingredient_name) DO UPDATE SET category_slug = EXCLUDED.category_slug
-		`, userID, name, strings.TrimSpace(it.CategorySlug)); err != nil {
-			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("insert: %v", err)})
-			return
-		}
+	if req.SendAt == "" || req.WebhookURL == "" {
+		writeJSON(w, 400, map[string]any{"error": "send_at and webhook_url are required"})
+		return
 	}
-	if err := tx.Commit(ctx); err != nil {
-		writeJSON(w, 500, map[string]any{"error": "commit"})
+
+	var id string
+	err := a.DB.QueryRow(r.Context(), `
+		INSERT INTO digests (user_id, period, send_at, weekday, webhook_url)
+		VALUES ($1, $2, $3::time, $4, $5)
+		ON CONFLICT (user_id, period) DO UPDATE
+		  SET send_at = EXCLUDED.send_at, weekday = EXCLUDED.weekday, webhook_url = EXCLUDED.webhook_url, enabled = true
+		RETURNING id
+	`, req.UserID, req.Period, req.SendAt, req.Weekday, req.WebhookURL).Scan(&id)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("insert: %v", err)})
 		return
 	}
-	writeJSON(w, 200, map[string]any{"ok": true})
+	writeJSON(w, 201, map[string]any{"ok": true, "id": id})
 }
 
-func (a *App) HandleSetIngredientCategoryBody(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		userID = DefaultUserID
-	}
-	var body struct {
-		IngredientName string `json:"ingredient_name"`
-		CategorySlug   string `json:"category_slug"`
+func (a *App) HandleUpdateDigest(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req struct {
+		SendAt     *string `json:"send_at"`
+		Weekday    *int    `json:"weekday"`
+		WebhookURL *string `json:"webhook_url"`
+		Enabled    *bool   `json:"enabled"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, 400, map[string]any{"error": "invalid json"})
 		return
 	}
-	name := strings.TrimSpace(strings.ToLower(body.IngredientName))
-	if name == "" || strings.TrimSpace(body.CategorySlug) == "" {
-		writeJSON(w, 400, map[string]any{"error": "ingredient_name and category_slug are required"})
+	if req.Weekday != nil && (*req.Weekday < 0 || *req.Weekday > 6) {
+		writeJSON(w, 400, map[string]any{"error": "weekday must be 0 (Sunday) to 6 (Saturday)"})
 		return
 	}
-	_, err := a.DB.Exec(r.Context(), `
-		INSERT INTO ingredient_categories (user_id, ingredient_name, category_slug)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (user_id, ingredient_name) DO UPDATE SET category_slug = EXCLUDED.category_slug
-	`, userID, name, strings.TrimSpace(body.CategorySlug))
+	ct, err := a.DB.Exec(r.Context(), `
+		UPDATE digests SET
+		  send_at = COALESCE($2::time, send_at),
+		  weekday = COALESCE($3, weekday),
+		  webhook_url = COALESCE($4, webhook_url),
+		  enabled = COALESCE($5, enabled)
+		WHERE id = $1
+	`, id, req.SendAt, req.Weekday, req.WebhookURL, req.Enabled)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("upsert: %v", err)})
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("update: %v", err)})
+		return
+	}
+	if ct.RowsAffected() == 0 {
+		writeJSON(w, 404, map[string]any{"error": "not found"})
 		return
 	}
 	writeJSON(w, 200, map[string]any{"ok": true})
 }
 
-func (a *App) HandleSetIngredientCategory(w http.ResponseWriter, r *http.Request) {
+func (a *App) HandleDeleteDigest(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	ct, err := a.DB.Exec(r.Context(), `DELETE FROM digests WHERE id = $1`, id)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete: %v", err)})
+		return
+	}
+	if ct.RowsAffected() == 0 {
+		writeJSON(w, 404, map[string]any{"error": "not found"})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+// HandlePreviewDigest renders a digest without sending it.
+// Query params: user_id, period (daily|weekly), date (YYYY-MM-DD, last day covered; defaults to yesterday)
+func (a *App) HandlePreviewDigest(w http.ResponseWriter, r *http.Request) {
 	userID := r.URL.Query().Get("user_id")
 	if userID == "" {
 		userID = DefaultUserID
 	}
-	rawName, _ := url.PathUnescape(chi.URLParam(r, "name"))
-	name := strings.TrimSpace(strings.ToLower(rawName))
-	if name == "" {
-		writeJSON(w, 400, map[string]any{"error": "name is required"})
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "daily"
+	}
+	if !validDigestPeriod(period) {
+		writeJSON(w, 400, map[string]any{"error": "period must be daily or weekly"})
 		return
 	}
-	var body struct {
-		CategorySlug string `json:"category_slug"`
+	endDay := a.digestEndDay(a.now())
+	if dateStr := r.URL.Query().Get("date"); dateStr != "" {
+		d, err := time.ParseInLocation("2006-01-02", dateStr, a.Loc)
+		if err != nil {
+			writeJSON(w, 400, map[string]any{"error": "bad date"})
+			return
+		}
+		endDay = d
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.CategorySlug) == "" {
-		writeJSON(w, 400, map[string]any{"error": "category_slug is required"})
+	report, err := a.composeDigest(r.Context(), userID, period, endDay)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("compose digest: %v", err)})
 		return
 	}
-	_, err := a.DB.Exec(r.Context(), `
-		INSERT INTO ingredient_categories (user_id, ingredient_name, category_slug)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (user_id, ingredient_name) DO UPDATE SET category_slug = EXCLUDED.category_slug
-	`, userID, name, strings.TrimSpace(body.CategorySlug))
+	writeJSON(w, 200, report)
+}
+
+func (a *App) HandleTestDigest(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var userID, period, webhookURL string
+	err := a.DB.QueryRow(r.Context(), `
+		SELECT user_id, period, webhook_url FROM digests WHERE id = $1
+	`, id).Scan(&userID, &period, &webhookURL)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("upsert: %v", err)})
+		writeJSON(w, 404, map[string]any{"error": "digest not found"})
 		return
 	}
-	writeJSON(w, 200, map[string]any{"ok": true})
+	report, err := a.composeDigest(r.Context(), userID, period, a.digestEndDay(a.now()))
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("compose digest: %v", err)})
+		return
+	}
+	if err := postDiscordWebhook(webhookURL, report.Content); err != nil {
+		writeJSON(w, 502, map[string]any{"error": fmt.Sprintf("webhook failed: %v", err)})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true, "message": "webhook fired"})
 }
 
-func (a *App) HandleDeleteIngredientCategory(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		userID = DefaultUserID
+func (a *App) checkDigests() {
+	now := a.now()
+	currentTime := now.Format("15:04")
+	prevMinute := now.Add(-1 * time.Minute).Format("15:04")
+	ctx := context.Background()
+
+	rows, err := a.DB.Query(ctx, `
+		SELECT id, user_id, period, webhook_url
+		FROM digests
+		WHERE enabled = true
+		  AND to_char(send_at, 'HH24:MI') > $1
+		  AND to_char(send_at, 'HH24:MI') <= $2
+		  AND (period = 'daily' OR weekday = $3)
+	`, prevMinute, currentTime, int(now.Weekday()))
+	if err != nil {
+		log.Printf("[digest] query error: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	type pending struct {
+		id, userID, period, webhookURL string
+	}
+	var due []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.userID, &p.period, &p.webhookURL); err != nil {
+			log.Printf("[digest] scan error: %v", err)
+			continue
+		}
+		due = append(due, p)
+	}
+	rows.Close()
+
+	endDay := a.digestEndDay(now)
+	for _, p := range due {
+		report, err := a.composeDigest(ctx, p.userID, p.period, endDay)
+		if err != nil {
+			log.Printf("[digest] compose error for %s: %v", p.id, err)
+			continue
+		}
+		log.Printf("[digest] sending %s digest %s", p.period, p.id)
+		if err := postDiscordWebhook(p.webhookURL, report.Content); err != nil {
+			log.Printf("[digest] webhook error for %s: %v", p.id, err)
+			continue
+		}
+		if _, err := a.DB.Exec(ctx, `UPDATE digests SET last_sent_at = now() WHERE id = $1`, p.id); err != nil {
+			log.Printf("[digest] mark sent error for %s: %v", p.id, err)
+		}
+	}
+}
+
+// ── Command-line Tasks ────────────────────────────────────────────────────────
+
+// runCommand handles `api <command> ...` invocations, which run a one-off
+// task against the database instead of starting the server.
+func (a *App) runCommand(ctx context.Context, args []string) error {
+	switch args[0] {
+	case "import-products":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: api import-products <products.jsonl[.gz] | products.csv[.gz]>")
+		}
+		n, skipped, err := a.importProductCatalog(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		log.Printf("[import-products] upserted %d products, skipped %d", n, skipped)
+		return nil
+	case "import-usda":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: api import-usda <FoodData_Central_*.json[.gz] | extracted CSV directory>")
+		}
+		n, skipped, err := a.importUSDA(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		log.Printf("[import-usda] upserted %d foods, skipped %d", n, skipped)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q (available: import-products, import-usda)", args[0])
+	}
+}
+
+// batchUpserter queues upserts for the import commands and sends them in
+// batches, logging progress as it goes.
+type batchUpserter struct {
+	a     *App
+	label string
+	batch *pgx.Batch
+	n     int
+}
+
+const importBatchSize = 500
+
+func newBatchUpserter(a *App, label string) *batchUpserter {
+	return &batchUpserter{a: a, label: label, batch: &pgx.Batch{}}
+}
+
+func (b *batchUpserter) queue(ctx context.Context, sql string, args ...any) error {
+	b.batch.Queue(sql, args...)
+	b.n++
+	if b.batch.Len() >= importBatchSize {
+		return b.flush(ctx)
+	}
+	return nil
+}
+
+func (b *batchUpserter) flush(ctx context.Context) error {
+	if b.batch.Len() == 0 {
+		return nil
+	}
+	err := b.a.DB.SendBatch(ctx, b.batch).Close()
+	b.batch = &pgx.Batch{}
+	if err != nil {
+		return fmt.Errorf("%s: upsert: %w", b.label, err)
+	}
+	log.Printf("[%s] %d rows…", b.label, b.n)
+	return nil
+}
+
+// openImportFile opens a dump file, transparently gunzipping *.gz.
+func openImportFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
 	}
-	rawName, _ := url.PathUnescape(chi.URLParam(r, "name"))
-	name := strings.TrimSpace(strings.ToLower(rawName))
-	if name == "" {
-		writeJSON(w, 400, map[string]any{"error": "name is required"})
-		return
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
 	}
-	_, err := a.DB.Exec(r.Context(), `
-		DELETE FROM ingredient_categories WHERE user_id = $1 AND ingredient_name = $2
-	`, userID, name)
+	gz, err := gzip.NewReader(f)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete: %v", err)})
-		return
+		f.Close()
+		return nil, err
 	}
-	writeJSON(w, 200, map[string]any{"ok": true})
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, f}, nil
 }
 
-// ── Nudges ───────────────────────────────────────────────────────────────────
+// numberValue coerces the loosely typed numbers found in product dumps
+// (JSON numbers or numeric strings) to float64.
+func numberValue(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
 
-type Nudge struct {
-	ID         string `json:"id"`
-	UserID     string `json:"user_id"`
-	FoodItemID string `json:"food_item_id"`
-	FoodName   string `json:"food_name"`
-	RemindAt   string `json:"remind_at"`
-	WebhookURL string `json:"webhook_url"`
-	Enabled    bool   `json:"enabled"`
-	LoggedToday bool  `json:"logged_today"`
+// openFoodFactsProduct maps an Open Food Facts record onto a catalog row.
+// Per-serving values are used when the dump has a gram serving size;
+// otherwise the row is expressed per 100 g.
+func openFoodFactsProduct(code, name, brands, servingSize string, servingQty float64, nutrient func(key string) (float64, bool)) (CatalogProduct, bool) {
+	code, err := normalizeBarcode(code)
+	name = strings.TrimSpace(name)
+	if err != nil || name == "" {
+		return CatalogProduct{}, false
+	}
+	kcal100, ok := nutrient("energy-kcal_100g")
+	if !ok {
+		return CatalogProduct{}, false
+	}
+	p := CatalogProduct{Code: code, Name: name, Source: "openfoodfacts", ServingLabel: "100 g"}
+	if b, _, _ := strings.Cut(brands, ","); b != "" {
+		p.Brand = strings.TrimSpace(b)
+	}
+	scale := 1.0
+	if servingQty > 0 && strings.TrimSpace(servingSize) != "" {
+		p.ServingLabel = strings.TrimSpace(servingSize)
+		scale = servingQty / 100
+	}
+	per := func(key string) float64 {
+		v, _ := nutrient(key + "_100g")
+		return math.Round(v*scale*10) / 10
+	}
+	p.CaloriesPerServing = math.Round(kcal100 * scale)
+	p.ProteinPerServing = per("proteins")
+	p.CarbsPerServing = per("carbohydrates")
+	p.FatPerServing = per("fat")
+	p.FiberPerServing = per("fiber")
+	return p, true
 }
 
-func (a *App) HandleListNudges(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		userID = DefaultUserID
+// importProductCatalog loads an Open Food Facts dump (JSONL or tab-separated
+// CSV, optionally gzipped) into product_catalog, upserting on barcode.
+func (a *App) importProductCatalog(ctx context.Context, path string) (int, int, error) {
+	f, err := openImportFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	up := newBatchUpserter(a, "import-products")
+	emit := func(p CatalogProduct) error {
+		return up.queue(ctx, `
+      INSERT INTO product_catalog (code, name, brand, serving_label, calories_per_serving, protein_g_per_serving, carbs_g_per_serving, fat_g_per_serving, fiber_g_per_serving, source)
+      VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+      ON CONFLICT (code) DO UPDATE SET
+        name = EXCLUDED.name, brand = EXCLUDED.brand, serving_label = EXCLUDED.serving_label,
+        calories_per_serving = EXCLUDED.calories_per_serving, protein_g_per_serving = EXCLUDED.protein_g_per_serving,
+        carbs_g_per_serving = EXCLUDED.carbs_g_per_serving, fat_g_per_serving = EXCLUDED.fat_g_per_serving,
+        fiber_g_per_serving = EXCLUDED.fiber_g_per_serving, source = EXCLUDED.source, imported_at = now();
+    `, p.Code, p.Name, p.Brand, p.ServingLabel, p.CaloriesPerServing, p.ProteinPerServing, p.CarbsPerServing, p.FatPerServing, p.FiberPerServing, p.Source)
+	}
+
+	var skipped int
+	base := strings.TrimSuffix(path, ".gz")
+	if strings.HasSuffix(base, ".csv") || strings.HasSuffix(base, ".tsv") {
+		skipped, err = readOpenFoodFactsCSV(f, emit)
+	} else {
+		skipped, err = readOpenFoodFactsJSONL(f, emit)
 	}
-	now := a.now()
-	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, a.Loc)
-	dayEnd := dayStart.Add(24 * time.Hour)
-
-	rows, err := a.DB.Query(r.Context(), `
-		SELECT n.id, n.user_id, n.food_item_id, fi.name,
-		       to_char(n.remind_at, 'HH24:MI'), n.webhook_url, n.enabled,
-		       (SELECT COUNT(*) FROM log_entries le
-		        WHERE le.user_id = n.user_id AND le.ref_id = n.food_item_id
-		          AND le.kind = 'food' AND le.occurred_at >= $2 AND le.occurred_at < $3) AS logged
-		FROM nudges n
-		JOIN food_items fi ON fi.id = n.food_item_id
-		WHERE n.user_id = $1
-		ORDER BY n.remind_at
-	`, userID, dayStart, dayEnd)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("query: %v", err)})
-		return
+		return up.n, skipped, err
 	}
-	defer rows.Close()
+	return up.n, skipped, up.flush(ctx)
+}
 
-	nudges := []Nudge{}
-	for rows.Next() {
-		var n Nudge
-		var logCount int
-		if err := rows.Scan(&n.ID, &n.UserID, &n.FoodItemID, &n.FoodName,
-			&n.RemindAt, &n.WebhookURL, &n.Enabled, &logCount); err != nil {
-			writeJSON(w, 500, map[string]any{"error": "scan"})
-			return
+func readOpenFoodFactsJSONL(r io.Reader, emit func(CatalogProduct) error) (int, error) {
+	skipped := 0
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 1<<20), 64<<20)
+	for sc.Scan() {
+		var rec struct {
+			Code            string         `json:"code"`
+			ProductName     string         `json:"product_name"`
+			Brands          string         `json:"brands"`
+			ServingSize     string         `json:"serving_size"`
+			ServingQuantity any            `json:"serving_quantity"`
+			Nutriments      map[string]any `json:"nutriments"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			skipped++
+			continue
+		}
+		qty, _ := numberValue(rec.ServingQuantity)
+		p, ok := openFoodFactsProduct(rec.Code, rec.ProductName, rec.Brands, rec.ServingSize, qty, func(key string) (float64, bool) {
+			return numberValue(rec.Nutriments[key])
+		})
+		if !ok {
+			skipped++
+			continue
+		}
+		if err := emit(p); err != nil {
+			return skipped, err
 		}
-		n.LoggedToday = logCount > 0
-		nudges = append(nudges, n)
 	}
-	writeJSON(w, 200, nudges)
+	return skipped, sc.Err()
 }
 
-func (a *App) HandleCreateNudge(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		UserID     string `json:"user_id"`
-		FoodItemID string `json:"food_item_id"`
-		RemindAt   string `json:"remind_at"`
-		WebhookURL string `json:"webhook_url"`
+func readOpenFoodFactsCSV(r io.Reader, emit func(CatalogProduct) error) (int, error) {
+	skipped := 0
+	cr := csv.NewReader(r)
+	cr.Comma = '\t'
+	cr.LazyQuotes = true
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return 0, fmt.Errorf("read header: %w", err)
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, 400, map[string]any{"error": "invalid json"})
-		return
+	col := map[string]int{}
+	for i, h := range header {
+		col[h] = i
 	}
-	if req.UserID == "" {
-		req.UserID = DefaultUserID
+	field := func(rec []string, key string) string {
+		if i, ok := col[key]; ok && i < len(rec) {
+			return rec[i]
+		}
+		return ""
 	}
-	if req.FoodItemID == "" || req.RemindAt == "" || req.WebhookURL == "" {
-		writeJSON(w, 400, map[string]any{"error": "food_item_id, remind_at, and webhook_url are required"})
-		return
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return skipped, nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			skipped++
+			continue
+		}
+		if err != nil {
+			return skipped, err
+		}
+		qty, _ := numberValue(field(rec, "serving_quantity"))
+		p, ok := openFoodFactsProduct(field(rec, "code"), field(rec, "product_name"), field(rec, "brands"), field(rec, "serving_size"), qty, func(key string) (float64, bool) {
+			return numberValue(field(rec, key))
+		})
+		if !ok {
+			skipped++
+			continue
+		}
+		if err := emit(p); err != nil {
+			return skipped, err
+		}
 	}
+}
 
-	var id string
-	err := a.DB.QueryRow(r.Context(), `
-		INSERT INTO nudges (user_id, food_item_id, remind_at, webhook_url)
-		VALUES ($1, $2, $3::time, $4)
-		ON CONFLICT (user_id, food_item_id) DO UPDATE
-		  SET remind_at = EXCLUDED.remind_at, webhook_url = EXCLUDED.webhook_url, enabled = true
-		RETURNING id
-	`, req.UserID, req.FoodItemID, req.RemindAt, req.WebhookURL).Scan(&id)
-	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("insert: %v", err)})
-		return
-	}
-	writeJSON(w, 201, map[string]any{"ok": true, "id": id})
+// USDA FoodData Central nutrient numbers for the columns we keep. Values in
+// FDC downloads are per 100 g.
+const (
+	usdaEnergyKcal    = "208"
+	usdaEnergyAtwater = "957" // Foundation foods report Atwater energy instead of 208
+	usdaEnergyKJ      = "268"
+	usdaProtein       = "203"
+	usdaCarbs         = "205"
+	usdaFat           = "204"
+	usdaFiber         = "291"
+)
+
+// usdaDataTypes are the FDC data types that describe edible foods; the
+// Foundation download also ships sample and acquisition records we skip.
+var usdaDataTypes = map[string]bool{
+	"foundation_food": true, "sr_legacy_food": true, "survey_fndds_food": true, "branded_food": true,
 }
 
-func (a *App) HandleUpdateNudge(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	var req struct {
-		RemindAt   *string `json:"remind_at"`
-		WebhookURL *string `json:"webhook_url"`
-		Enabled    *bool   `json:"enabled"`
+// usdaFood is the subset of an FDC record the importer needs, whichever
+// download format it came from.
+type usdaFood struct {
+	FdcID       string
+	Description string
+	Brand       string
+	ServingSize float64
+	ServingUnit string
+	Household   string
+	Nutrients   map[string]float64 // by nutrient number, per 100 g
+}
+
+// foodItem converts an FDC record into catalog macros, plus any nutrients in
+// micro (FDC number → nutrient key). Branded foods with a gram (or ml)
+// serving size keep it; everything else is expressed per 100 g.
+func (u usdaFood) foodItem(micro map[string]string) (FoodItem, bool) {
+	name := strings.TrimSpace(u.Description)
+	if u.FdcID == "" || name == "" {
+		return FoodItem{}, false
+	}
+	kcal, ok := u.Nutrients[usdaEnergyKcal]
+	if !ok {
+		kcal, ok = u.Nutrients[usdaEnergyAtwater]
+	}
+	if !ok {
+		var kj float64
+		if kj, ok = u.Nutrients[usdaEnergyKJ]; ok {
+			kcal = kj / 4.184
+		}
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, 400, map[string]any{"error": "invalid json"})
-		return
+	if !ok {
+		return FoodItem{}, false
+	}
+	it := FoodItem{Name: name, Brand: strings.TrimSpace(u.Brand), ServingLabel: "100 g"}
+	scale := 1.0
+	switch strings.ToLower(u.ServingUnit) {
+	case "g", "grm", "ml", "mlt":
+		if u.ServingSize > 0 {
+			unit := "g"
+			if strings.HasPrefix(strings.ToLower(u.ServingUnit), "m") {
+				unit = "ml"
+			}
+			it.ServingLabel = trimFloat(u.ServingSize) + " " + unit
+			if h := strings.TrimSpace(u.Household); h != "" {
+				it.ServingLabel += " (" + strings.ToLower(h) + ")"
+			}
+			scale = u.ServingSize / 100
+		}
+	}
+	per := func(nbr string) float64 { return math.Round(u.Nutrients[nbr]*scale*10) / 10 }
+	it.CaloriesPerServing = math.Round(kcal * scale)
+	it.ProteinPerServing = per(usdaProtein)
+	it.CarbsPerServing = per(usdaCarbs)
+	it.FatPerServing = per(usdaFat)
+	it.FiberPerServing = per(usdaFiber)
+	for nbr, key := range micro {
+		// Zero amounts are dropped as saveFoodNutrients drops them, so the
+		// import's stale-nutrient cleanup removes any older zero rows too.
+		if v := math.Round(u.Nutrients[nbr]*scale*100) / 100; v > 0 {
+			if it.Nutrients == nil {
+				it.Nutrients = map[string]float64{}
+			}
+			it.Nutrients[key] = v
+		}
 	}
+	return it, true
+}
 
-	if req.RemindAt != nil {
-		a.DB.Exec(r.Context(), `UPDATE nudges SET remind_at = $2::time WHERE id = $1`, id, *req.RemindAt)
+// trimFloat formats a number without trailing zeros ("30", "28.35").
+func trimFloat(f float64) string {
+	return strconv.FormatFloat(math.Round(f*100)/100, 'f', -1, 64)
+}
+
+// importUSDA loads a FoodData Central download into the shared catalog:
+// food_items with user_id NULL and source 'usda', keyed on the FDC ID so
+// re-running the import updates rows in place and drops nutrients the food
+// no longer has. path is either a JSON download (optionally gzipped) or an
+// extracted CSV directory.
+func (a *App) importUSDA(ctx context.Context, path string) (int, int, error) {
+	defs, err := a.loadNutrientDefs(ctx)
+	if err != nil {
+		return 0, 0, err
 	}
-	if req.WebhookURL != nil {
-		a.DB.Exec(r.Context(), `UPDATE nudges SET webhook_url = $2 WHERE id = $1`, id, *req.WebhookURL)
+	micro := map[string]string{}
+	for _, d := range defs {
+		if d.USDANbr != "" {
+			micro[d.USDANbr] = d.Key
+		}
 	}
-	if req.Enabled != nil {
-		a.DB.Exec(r.Context(), `UPDATE nudges SET enabled = $2 WHERE id = $1`, id, *req.Enabled)
+
+	up := newBatchUpserter(a, "import-usda")
+	skipped := 0
+	emit := func(u usdaFood) error {
+		it, ok := u.foodItem(micro)
+		if !ok {
+			skipped++
+			return nil
+		}
+		keys := make([]string, 0, len(it.Nutrients))
+		amounts := make([]float64, 0, len(it.Nutrients))
+		for k, v := range it.Nutrients {
+			keys = append(keys, k)
+			amounts = append(amounts, v)
+		}
+		return up.queue(ctx, `
+      WITH fi AS (
+        INSERT INTO food_items (user_id, name, brand, serving_label, calories_per_serving, protein_g_per_serving, carbs_g_per_serving, fat_g_per_serving, fiber_g_per_serving, source, external_id)
+        VALUES (NULL,$1,NULLIF($2,''),$3,$4,$5,$6,$7,$8,'usda',$9)
+        ON CONFLICT (source, external_id) WHERE external_id IS NOT NULL DO UPDATE SET
+          name = EXCLUDED.name, brand = EXCLUDED.brand, serving_label = EXCLUDED.serving_label,
+          calories_per_serving = EXCLUDED.calories_per_serving, protein_g_per_serving = EXCLUDED.protein_g_per_serving,
+          carbs_g_per_serving = EXCLUDED.carbs_g_per_serving, fat_g_per_serving = EXCLUDED.fat_g_per_serving,
+          fiber_g_per_serving = EXCLUDED.fiber_g_per_serving
+        RETURNING id
+      ), stale AS (
+        -- Nutrients FoodData Central no longer reports for this food.
+        DELETE FROM food_item_nutrients n
+        USING fi
+        WHERE n.food_item_id = fi.id AND n.nutrient_key <> ALL($10::text[])
+      )
+      INSERT INTO food_item_nutrients (food_item_id, nutrient_key, amount_per_serving)
+      SELECT fi.id, n.key, n.amount
+      FROM fi, unnest($10::text[], $11::numeric[]) AS n(key, amount)
+      ON CONFLICT (food_item_id, nutrient_key) DO UPDATE SET amount_per_serving = EXCLUDED.amount_per_serving;
+    `, it.Name, it.Brand, it.ServingLabel, it.CaloriesPerServing, it.ProteinPerServing, it.CarbsPerServing, it.FatPerServing, it.FiberPerServing, u.FdcID,
+			keys, amounts)
+	}
+
+	wanted := map[string]bool{usdaEnergyKcal: true, usdaEnergyAtwater: true, usdaEnergyKJ: true, usdaProtein: true, usdaCarbs: true, usdaFat: true, usdaFiber: true}
+	for nbr := range micro {
+		wanted[nbr] = true
+	}
+	if info, statErr := os.Stat(path); statErr == nil && info.IsDir() {
+		err = readUSDACSV(path, wanted, emit)
+	} else {
+		err = readUSDAJSON(path, emit)
 	}
-	writeJSON(w, 200, map[string]any{"ok": true})
+	if err != nil {
+		return up.n, skipped, err
+	}
+	return up.n, skipped, up.flush(ctx)
 }
 
-func (a *App) HandleDeleteNudge(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	ct, err := a.DB.Exec(r.Context(), `DELETE FROM nudges WHERE id = $1`, id)
+// readUSDAJSON streams an FDC JSON download, which is a single object whose
+// one key ("FoundationFoods", "SRLegacyFoods", "BrandedFoods", …) holds the
+// array of foods.
+func readUSDAJSON(path string, emit func(usdaFood) error) error {
+	f, err := openImportFile(path)
 	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("delete: %v", err)})
-		return
+		return err
 	}
-	if ct.RowsAffected() == 0 {
-		writeJSON(w, 404, map[string]any{"error": "not found"})
-		return
+	defer f.Close()
+	dec := json.NewDecoder(bufio.NewReader(f))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return fmt.Errorf("%s: expected a FoodData Central JSON object", path)
 	}
-	writeJSON(w, 200, map[string]any{"ok": true})
+	for dec.More() {
+		if _, err := dec.Token(); err != nil { // array key
+			return err
+		}
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			return fmt.Errorf("%s: expected an array of foods", path)
+		}
+		for dec.More() {
+			var rec struct {
+				FdcID         json.Number `json:"fdcId"`
+				Description   string      `json:"description"`
+				BrandOwner    string      `json:"brandOwner"`
+				BrandName     string      `json:"brandName"`
+				ServingSize   float64     `json:"servingSize"`
+				ServingUnit   string      `json:"servingSizeUnit"`
+				Household     string      `json:"householdServingFullText"`
+				FoodNutrients []struct {
+					Nutrient struct {
+						Number string `json:"number"`
+					} `json:"nutrient"`
+					Amount *float64 `json:"amount"`
+				} `json:"foodNutrients"`
+			}
+			if err := dec.Decode(&rec); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			u := usdaFood{
+				FdcID: rec.FdcID.String(), Description: rec.Description, Brand: rec.BrandName,
+				ServingSize: rec.ServingSize, ServingUnit: rec.ServingUnit, Household: rec.Household,
+				Nutrients: map[string]float64{},
+			}
+			if u.Brand == "" {
+				u.Brand = rec.BrandOwner
+			}
+			for _, fn := range rec.FoodNutrients {
+				if fn.Amount != nil {
+					u.Nutrients[fn.Nutrient.Number] = *fn.Amount
+				}
+			}
+			if err := emit(u); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil { // closing ]
+			return err
+		}
+	}
+	return nil
 }
 
-func (a *App) HandleTestNudge(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	var foodName, webhookURL string
-	err := a.DB.QueryRow(r.Context(), `
-		SELECT fi.name, n.webhook_url
-		FROM nudges n JOIN food_items fi ON fi.id = n.food_item_id
-		WHERE n.id = $1
-	`, id).Scan(&foodName, &webhookURL)
+// readUSDACSV reads an extracted FDC CSV download: food.csv and
+// food_nutrient.csv joined via nutrient.csv (keeping only the wanted nutrient
+// numbers), plus branded_food.csv when present for brand and serving size.
+func readUSDACSV(dir string, wanted map[string]bool, emit func(usdaFood) error) error {
+	nutrientNbr := map[string]string{}
+	err := eachCSVRow(filepath.Join(dir, "nutrient.csv"), func(row func(string) string) error {
+		if nbr := strings.TrimSuffix(row("nutrient_nbr"), ".0"); wanted[nbr] {
+			nutrientNbr[row("id")] = nbr
+		}
+		return nil
+	})
 	if err != nil {
-		writeJSON(w, 404, map[string]any{"error": "nudge not found"})
-		return
+		return err
 	}
-	if err := fireDiscordWebhook(webhookURL, foodName); err != nil {
-		writeJSON(w, 502, map[string]any{"error": fmt.Sprintf("webhook failed: %v", err)})
-		return
+
+	foods := map[string]*usdaFood{}
+	var order []string
+	err = eachCSVRow(filepath.Join(dir, "food.csv"), func(row func(string) string) error {
+		if !usdaDataTypes[row("data_type")] {
+			return nil
+		}
+		id := row("fdc_id")
+		foods[id] = &usdaFood{FdcID: id, Description: row("description"), Nutrients: map[string]float64{}}
+		order = append(order, id)
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	writeJSON(w, 200, map[string]any{"ok": true, "message": "webhook fired"})
-}
 
-func fireDiscordWebhook(webhookURL, foodName string) error {
-	body, _ := json.Marshal(map[string]string{
-		"content": fmt.Sprintf("🔔 **Nudge:** You haven't logged **%s** yet today!", foodName),
+	branded := filepath.Join(dir, "branded_food.csv")
+	if _, statErr := os.Stat(branded); statErr == nil {
+		err = eachCSVRow(branded, func(row func(string) string) error {
+			if u := foods[row("fdc_id")]; u != nil {
+				u.Brand = row("brand_name")
+				if u.Brand == "" {
+					u.Brand = row("brand_owner")
+				}
+				u.ServingSize, _ = strconv.ParseFloat(row("serving_size"), 64)
+				u.ServingUnit = row("serving_size_unit")
+				u.Household = row("household_serving_fulltext")
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = eachCSVRow(filepath.Join(dir, "food_nutrient.csv"), func(row func(string) string) error {
+		nbr, ok := nutrientNbr[row("nutrient_id")]
+		if !ok {
+			return nil
+		}
+		if u := foods[row("fdc_id")]; u != nil {
+			if v, err := strconv.ParseFloat(row("amount"), 64); err == nil {
+				u.Nutrients[nbr] = v
+			}
+		}
+		return nil
 	})
-	resp, err := http.Post(webhookURL, "application/json", bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode >= 400 {
-		return fmt.Errorf("discord returned %d", resp.StatusCode)
+
+	for _, id := range order {
+		if err := emit(*foods[id]); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func (a *App) checkNudges() {
-	now := a.now()
-	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, a.Loc)
-	dayEnd := dayStart.Add(24 * time.Hour)
-	currentTime := now.Format("15:04")
-	prevMinute := now.Add(-1 * time.Minute).Format("15:04")
-
-	rows, err := a.DB.Query(context.Background(), `
-		SELECT n.id, n.user_id, n.food_item_id, fi.name, n.webhook_url
-		FROM nudges n
-		JOIN food_items fi ON fi.id = n.food_item_id
-		WHERE n.enabled = true
-		  AND to_char(n.remind_at, 'HH24:MI') > $1
-		  AND to_char(n.remind_at, 'HH24:MI') <= $2
-	`, prevMinute, currentTime)
+// eachCSVRow calls fn for every data row of a comma-separated file with a
+// header, passing a column lookup by header name.
+func eachCSVRow(path string, fn func(row func(col string) string) error) error {
+	f, err := openImportFile(path)
 	if err != nil {
-		log.Printf("[nudge] query error: %v", err)
-		return
+		return err
 	}
-	defer rows.Close()
-
-	type pending struct {
-		id, userID, foodItemID, foodName, webhookURL string
+	defer f.Close()
+	br := bufio.NewReader(f)
+	if bom, _ := br.Peek(3); bytes.Equal(bom, []byte("\ufeff")) {
+		_, _ = br.Discard(3)
 	}
-	var checks []pending
-	for rows.Next() {
-		var p pending
-		if err := rows.Scan(&p.id, &p.userID, &p.foodItemID, &p.foodName, &p.webhookURL); err != nil {
-			log.Printf("[nudge] scan error: %v", err)
-			continue
+	cr := csv.NewReader(br)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("%s: read header: %w", path, err)
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		col[h] = i
+	}
+	var rec []string
+	row := func(key string) string {
+		if i, ok := col[key]; ok && i < len(rec) {
+			return rec[i]
 		}
-		checks = append(checks, p)
+		return ""
 	}
-
-	for _, p := range checks {
-		var count int
-		err := a.DB.QueryRow(context.Background(), `
-			SELECT COUNT(*) FROM log_entries
-			WHERE user_id = $1 AND ref_id = $2 AND kind = 'food'
-			  AND occurred_at >= $3 AND occurred_at < $4
-		`, p.userID, p.foodItemID, dayStart, dayEnd).Scan(&count)
+	for {
+		rec, err = cr.Read()
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
-			log.Printf("[nudge] log check error for %s: %v", p.foodName, err)
-			continue
+			return fmt.Errorf("%s: %w", path, err)
 		}
-		if count == 0 {
-			log.Printf("[nudge] firing webhook for %s (not logged today)", p.foodName)
-			if err := fireDiscordWebhook(p.webhookURL, p.foodName); err != nil {
-				log.Printf("[nudge] webhook error for %s: %v", p.foodName, err)
-			}
-		} else {
-			log.Printf("[nudge] %s already logged today (%d entries), skipping", p.foodName, count)
+		if err := fn(row); err != nil {
+			return err
 		}
 	}
 }
@@ -0,0 +1,829 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func scrapeFixture(t *testing.T, name, pageURL string) ImportedRecipe {
+	t.Helper()
+	page, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := scrapeRecipe(string(page), base)
+	if err != nil {
+		t.Fatalf("scrapeRecipe(%s): %v", name, err)
+	}
+	return rec
+}
+
+func TestScrapeRecipeJSONLDGraph(t *testing.T) {
+	rec := scrapeFixture(t, "recipe_jsonld_graph.html", "https://kitchen.example/recipes/curry")
+
+	if rec.Name != "Weeknight Chicken Curry" || rec.YieldCount != 4 || rec.ServingLabel != "1 bowl" {
+		t.Errorf("name/yield/serving = %q/%d/%q", rec.Name, rec.YieldCount, rec.ServingLabel)
+	}
+	if rec.ImageURL != "https://kitchen.example/images/curry-1200.jpg" {
+		t.Errorf("image_url = %q", rec.ImageURL)
+	}
+	wantIngredients := []ImportedIngredient{
+		{Line: "500 g chicken thighs, diced", Name: "chicken thighs", Amount: 500, Unit: "g", Note: "diced"},
+		{Line: "1 cup coconut milk", Name: "coconut milk", Amount: 1, Unit: "cup"},
+		{Line: "2 tbsp curry paste", Name: "curry paste", Amount: 2, Unit: "tbsp"},
+	}
+	if !reflect.DeepEqual(rec.Ingredients, wantIngredients) {
+		t.Errorf("ingredients = %+v", rec.Ingredients)
+	}
+	// 1,880 kJ is 449 kcal; sodium is converted from g to the nutrient's mg.
+	if !rec.HasNutrition || rec.CaloriesPerServing != 449 || rec.ProteinPerServing != 32 ||
+		rec.CarbsPerServing != 12 || rec.FatPerServing != 28.5 || rec.FiberPerServing != 3 {
+		t.Errorf("nutrition = %+v", rec)
+	}
+	if rec.Nutrients["sodium"] != 800 {
+		t.Errorf("nutrients = %v", rec.Nutrients)
+	}
+	if want := []string{"dinner", "indian", "curry", "quick"}; !reflect.DeepEqual(rec.Tags, want) {
+		t.Errorf("tags = %v, want %v", rec.Tags, want)
+	}
+	for _, want := range []string{
+		"A quick coconut curry.",
+		"**Prep:** 15 min · **Cook:** 1 h 5 min",
+		"### Cook\n\n1. Fry the paste.\n2. Add chicken and coconut milk; simmer 20 minutes.",
+		"Source: https://kitchen.example/recipes/curry",
+	} {
+		if !strings.Contains(rec.Instructions, want) {
+			t.Errorf("instructions missing %q:\n%s", want, rec.Instructions)
+		}
+	}
+}
+
+func TestScrapeRecipeMicrodata(t *testing.T) {
+	rec := scrapeFixture(t, "recipe_microdata.html", "https://kitchen.example/recipes/pancakes")
+
+	if rec.Name != "Grandma's Pancakes" || rec.YieldCount != 6 || rec.ServingLabel != "1 serving" {
+		t.Errorf("name/yield/serving = %q/%d/%q", rec.Name, rec.YieldCount, rec.ServingLabel)
+	}
+	if rec.ImageURL != "https://kitchen.example/recipes/pancakes.jpg" {
+		t.Errorf("image_url = %q", rec.ImageURL)
+	}
+	var names []string
+	for _, it := range rec.Ingredients {
+		names = append(names, it.Name)
+	}
+	if want := []string{"flour", "eggs", "buttermilk"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ingredient names = %v, want %v", names, want)
+	}
+	if rec.Ingredients[2].Amount != 1.5 || rec.Ingredients[2].Unit != "cup" {
+		t.Errorf("buttermilk = %+v", rec.Ingredients[2])
+	}
+	if !rec.HasNutrition || rec.CaloriesPerServing != 250 || rec.ProteinPerServing != 8 {
+		t.Errorf("nutrition = %+v", rec)
+	}
+	if want := []string{"breakfast"}; !reflect.DeepEqual(rec.Tags, want) {
+		t.Errorf("tags = %v, want %v", rec.Tags, want)
+	}
+	if !strings.Contains(rec.Instructions, "1. Whisk the dry ingredients.\n2. Stir in eggs and buttermilk.") {
+		t.Errorf("instructions = %q", rec.Instructions)
+	}
+}
+
+func TestScrapeRecipeNone(t *testing.T) {
+	_, err := scrapeRecipe(`<html><body><p>No recipe here.</p></body></html>`, nil)
+	if !errors.Is(err, errNoRecipe) {
+		t.Errorf("err = %v, want errNoRecipe", err)
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.215.14":        true,
+		"2606:2800:21f::1":     true,
+		"127.0.0.1":            false,
+		"10.1.2.3":             false,
+		"172.18.0.2":           false,
+		"192.168.1.10":         false,
+		"169.254.169.254":      false,
+		"100.100.1.1":          false,
+		"0.0.0.0":              false,
+		"::1":                  false,
+		"fd00::1":              false,
+		"fe80::1":              false,
+		"::ffff:127.0.0.1":     false,
+		"::ffff:93.184.215.14": true,
+		"64:ff9b::a00:1":       false,
+	} {
+		if got := isPublicAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("isPublicAddr(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestRecipeImportClientRefusesLoopback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached the loopback server")
+	}))
+	defer srv.Close()
+	_, _, err := fetchLimited(context.Background(), srv.URL, "text/html")
+	if !errors.Is(err, errNonPublicAddress) {
+		t.Errorf("err = %v, want errNonPublicAddress", err)
+	}
+}
+
+func TestIsHTMLContent(t *testing.T) {
+	for _, tc := range []struct {
+		contentType, body string
+		want              bool
+	}{
+		{"text/html; charset=utf-8", "", true},
+		{"application/xhtml+xml", "", true},
+		{"application/json", `{"name":"x"}`, false},
+		{"image/png", "", false},
+		{"", "<!DOCTYPE html><html></html>", true},
+		{"", "plain text", false},
+	} {
+		if got := isHTMLContent(tc.contentType, []byte(tc.body)); got != tc.want {
+			t.Errorf("isHTMLContent(%q, %q) = %v, want %v", tc.contentType, tc.body, got, tc.want)
+		}
+	}
+}
+
+func TestMealLess(t *testing.T) {
+	meals := []string{"snack_10", "other", "dinner", "snack_2", "breakfast", "snack_1", "lunch"}
+	sort.Slice(meals, func(i, j int) bool { return mealLess(meals[i], meals[j]) })
+	want := []string{"breakfast", "lunch", "dinner", "snack_1", "snack_2", "snack_10", "other"}
+	if !reflect.DeepEqual(meals, want) {
+		t.Errorf("sorted = %v, want %v", meals, want)
+	}
+}
+
+func TestExportZipStreamsPhotosAndSkipsMissing(t *testing.T) {
+	store, err := newDirPhotoStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	photo := []byte("\xff\xd8\xff fake jpeg bytes")
+	if err := store.Put(ctx, progressPhotoKey(DefaultUserID, "p1", "original"), photo); err != nil {
+		t.Fatal(err)
+	}
+	a := &App{Photos: store}
+	bundle := ExportBundle{ProgressPhotos: []ExportProgressPhoto{
+		{ID: "p1", UserID: DefaultUserID, ContentType: "image/jpeg"},
+		{ID: "gone", UserID: DefaultUserID, ContentType: "image/png"},
+	}}
+	rec := httptest.NewRecorder()
+	a.writeExportZip(rec, httptest.NewRequest(http.MethodGet, "/data/export?format=zip", nil), bundle)
+
+	got, files, cleanup, err := readExportZip(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	if len(got.ProgressPhotos) != 1 || got.ProgressPhotos[0].File != "progress-photos/p1.jpg" {
+		t.Fatalf("progress photos = %+v, want only p1", got.ProgressPhotos)
+	}
+	f := files["progress-photos/p1.jpg"]
+	if f == nil {
+		t.Fatal("photo entry missing from archive")
+	}
+	rc, err := f.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if data, _ := io.ReadAll(rc); !bytes.Equal(data, photo) {
+		t.Errorf("photo bytes = %q, want %q", data, photo)
+	}
+}
+
+func TestCountStreak(t *testing.T) {
+	logged := func(d DayStatus) bool { return d.Logged }
+	day := func(date string, met bool) DayStatus { return DayStatus{Date: date, Logged: met} }
+	days := []DayStatus{
+		day("2026-03-01", true), day("2026-03-02", true), day("2026-03-03", true), day("2026-03-04", true),
+		// 03-05 has no row at all: a gap breaks the run.
+		day("2026-03-06", true), day("2026-03-07", false), day("2026-03-08", true),
+		day("2026-03-09", true), day("2026-03-10", true),
+	}
+	cases := []struct {
+		name string
+		asOf string
+		want Streak
+	}{
+		{"ends today", "2026-03-10", Streak{Current: 3, Longest: 4, LongestFrom: "2026-03-01", LongestTo: "2026-03-04"}},
+		{"unfinished today", "2026-03-11", Streak{Current: 3, Longest: 4, LongestFrom: "2026-03-01", LongestTo: "2026-03-04"}},
+		{"broken yesterday", "2026-03-12", Streak{Current: 0, Longest: 4, LongestFrom: "2026-03-01", LongestTo: "2026-03-04"}},
+		{"missed day not yet over", "2026-03-07", Streak{Current: 1, Longest: 4, LongestFrom: "2026-03-01", LongestTo: "2026-03-04"}},
+	}
+	for _, c := range cases {
+		asOf, _ := time.Parse("2006-01-02", c.asOf)
+		if got := countStreak(days, asOf, logged); got != c.want {
+			t.Errorf("%s: countStreak = %+v, want %+v", c.name, got, c.want)
+		}
+	}
+
+	// The most recent of two equally long runs is reported as the longest.
+	tied := []DayStatus{day("2026-03-01", true), day("2026-03-02", true), day("2026-03-04", true), day("2026-03-05", true)}
+	asOf, _ := time.Parse("2006-01-02", "2026-03-05")
+	want := Streak{Current: 2, Longest: 2, LongestFrom: "2026-03-04", LongestTo: "2026-03-05"}
+	if got := countStreak(tied, asOf, logged); got != want {
+		t.Errorf("tied runs: countStreak = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseIngredientLine(t *testing.T) {
+	cases := []struct {
+		line string
+		want ParsedIngredient
+	}{
+		{"1 1/2 cups diced yellow onion (about 1 large)", ParsedIngredient{Amount: 1.5, Unit: "cup", Name: "yellow onion", Note: "diced, about 1 large"}},
+		{"½ tsp salt", ParsedIngredient{Amount: 0.5, Unit: "tsp", Name: "salt"}},
+		{"1½ cups milk", ParsedIngredient{Amount: 1.5, Unit: "cup", Name: "milk"}},
+		{"2-3 cloves garlic, minced", ParsedIngredient{Amount: 2, AmountMax: 3, Unit: "clove", Name: "garlic", Note: "minced"}},
+		{"1 to 2 tbsp olive oil", ParsedIngredient{Amount: 1, AmountMax: 2, Unit: "tbsp", Name: "olive oil"}},
+		{"2 large cloves garlic", ParsedIngredient{Amount: 2, Unit: "clove", Name: "garlic", Note: "large"}},
+		{"3 large eggs", ParsedIngredient{Amount: 3, Name: "eggs", Note: "large"}},
+		{"200g spaghetti", ParsedIngredient{Amount: 200, Unit: "g", Name: "spaghetti"}},
+		{"8 oz. cream cheese, softened", ParsedIngredient{Amount: 8, Unit: "oz", Name: "cream cheese", Note: "softened"}},
+		{"salt and pepper, to taste", ParsedIngredient{Name: "salt and pepper", Note: "to taste"}},
+		{"black pepper to taste", ParsedIngredient{Name: "black pepper", Note: "to taste"}},
+		{"- 1 cup flour, plus more for dusting", ParsedIngredient{Amount: 1, Unit: "cup", Name: "flour", Note: "plus more for dusting"}},
+		{"1 1/2 cups", ParsedIngredient{Amount: 1.5, Unit: "cup"}},
+	}
+	for _, c := range cases {
+		got := parseIngredientLine(c.line)
+		c.want.Line = c.line
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseIngredientLine(%q) = %+v, want %+v", c.line, got, c.want)
+		}
+	}
+}
+
+func TestGramsFor(t *testing.T) {
+	cases := []struct {
+		q           ParsedQuantity
+		label       string
+		want        float64
+		wantWarning bool
+	}{
+		{ParsedQuantity{Amount: 200, Unit: "g"}, "1 cup (240 g)", 200, false},
+		{ParsedQuantity{Amount: 8, Unit: "oz"}, "100 g", 226.8, false},
+		{ParsedQuantity{Amount: 1.5, Unit: "cup"}, "1 cup (185 g)", 277.5, false},
+		{ParsedQuantity{Amount: 2, Unit: "tbsp"}, "1 serving", 29.6, true},
+		{ParsedQuantity{Amount: 2, Unit: "clove"}, "1 serving", 0, true},
+		{ParsedQuantity{}, "100 g", 0, true},
+	}
+	for _, c := range cases {
+		got, warning := gramsFor(c.q, c.label)
+		if got != c.want || (warning != "") != c.wantWarning {
+			t.Errorf("gramsFor(%+v, %q) = %v, %q; want %v, warning %v", c.q, c.label, got, warning, c.want, c.wantWarning)
+		}
+	}
+}
+
+func TestParseFoodPhrase(t *testing.T) {
+	cases := []struct {
+		text string
+		name string
+		q    ParsedQuantity
+	}{
+		{"6oz chicken breast", "chicken breast", ParsedQuantity{Amount: 6, Unit: "oz"}},
+		{"chicken breast 6oz", "chicken breast", ParsedQuantity{Amount: 6, Unit: "oz"}},
+		{"2 eggs", "eggs", ParsedQuantity{Amount: 2}},
+		{"a cup of rice", "rice", ParsedQuantity{Amount: 1, Unit: "cup"}},
+		{"1 1/2 cups oats", "oats", ParsedQuantity{Amount: 1.5, Unit: "cup"}},
+		{"½ avocado", "avocado", ParsedQuantity{Amount: 0.5}},
+		{"half a bagel", "bagel", ParsedQuantity{Amount: 0.5}},
+		{"a couple of slices of toast", "toast", ParsedQuantity{Amount: 2, Unit: "slice"}},
+		{"rice 150 g", "rice", ParsedQuantity{Amount: 150, Unit: "g"}},
+		{"eggs x2", "eggs", ParsedQuantity{Amount: 2, Unit: "serving"}},
+		{"some coffee", "coffee", ParsedQuantity{}},
+	}
+	for _, c := range cases {
+		name, q := parseFoodPhrase(c.text)
+		if name != c.name || q != c.q {
+			t.Errorf("parseFoodPhrase(%q) = %q, %+v; want %q, %+v", c.text, name, q, c.name, c.q)
+		}
+	}
+}
+
+func TestParseLeadingAmount(t *testing.T) {
+	cases := []struct {
+		text string
+		q    ParsedQuantity
+		n    int
+	}{
+		{"2 eggs", ParsedQuantity{Amount: 2}, 1},
+		{"1 1/2 cups rice", ParsedQuantity{Amount: 1.5, Unit: "cup"}, 3},
+		{"250ml milk", ParsedQuantity{Amount: 250, Unit: "ml"}, 1},
+		{"a dozen eggs", ParsedQuantity{Amount: 12}, 2},
+		{"two slices of bread", ParsedQuantity{Amount: 2, Unit: "slice"}, 3},
+		{"toast", ParsedQuantity{}, 0},
+	}
+	for _, c := range cases {
+		q, n := parseLeadingAmount(strings.Fields(c.text))
+		if q != c.q || n != c.n {
+			t.Errorf("parseLeadingAmount(%q) = %+v, %d; want %+v, %d", c.text, q, n, c.q, c.n)
+		}
+	}
+}
+
+func TestServingsFor(t *testing.T) {
+	cases := []struct {
+		q           ParsedQuantity
+		label       string
+		want        float64
+		wantWarning bool
+	}{
+		{ParsedQuantity{}, "100 g", 1, false},
+		{ParsedQuantity{Amount: 2}, "1 egg", 2, false},
+		{ParsedQuantity{Amount: 150, Unit: "g"}, "100 g", 1.5, false},
+		{ParsedQuantity{Amount: 6, Unit: "oz"}, "100 g", 1.7, false},
+		{ParsedQuantity{Amount: 2, Unit: "cup"}, "1 cup (185 g)", 2, false},
+		{ParsedQuantity{Amount: 370, Unit: "g"}, "1 cup (185 g)", 2, false},
+		{ParsedQuantity{Amount: 4, Unit: "slice"}, "2 slices", 2, false},
+		{ParsedQuantity{Amount: 1, Unit: "cup"}, "100 g", 1, true},
+	}
+	for _, c := range cases {
+		got, warning := servingsFor(c.q, c.label)
+		if got != c.want || (warning != "") != c.wantWarning {
+			t.Errorf("servingsFor(%+v, %q) = %v, %q; want %v, warning %v", c.q, c.label, got, warning, c.want, c.wantWarning)
+		}
+	}
+}
+
+func TestFoodMatchScore(t *testing.T) {
+	if s := foodMatchScore("chicken breast", "Chicken Breast", ""); s != 1 {
+		t.Errorf("exact match score = %v, want 1", s)
+	}
+	if s := foodMatchScore("eggs", "Egg", ""); s < autoMatchScore {
+		t.Errorf("plural match score = %v, want >= %v", s, autoMatchScore)
+	}
+	if s := foodMatchScore("banana", "Chicken breast", ""); s >= minFoodMatchScore {
+		t.Errorf("unrelated match score = %v, want < %v", s, minFoodMatchScore)
+	}
+
+	foods := []FoodItem{
+		{ID: "partial", Name: "Chicken breast, grilled with herbs", ServingLabel: "100 g"},
+		{ID: "exact", Name: "Chicken breast", ServingLabel: "100 g"},
+		{ID: "other", Name: "Brown rice", ServingLabel: "1 cup (195 g)"},
+	}
+	matches := rankFoodMatches("chicken breast", ParsedQuantity{Amount: 6, Unit: "oz"}, foods, 3)
+	if len(matches) != 2 || matches[0].FoodItemID != "exact" || matches[1].FoodItemID != "partial" {
+		t.Fatalf("rankFoodMatches = %+v, want exact then partial", matches)
+	}
+	if matches[0].Score <= matches[1].Score {
+		t.Errorf("exact score %v not above partial score %v", matches[0].Score, matches[1].Score)
+	}
+}
+
+func TestSplitFoodList(t *testing.T) {
+	foods := []FoodItem{{Name: "Mac and cheese"}, {Name: "Egg"}, {Name: "Toast"}}
+	cases := []struct {
+		text string
+		want []string
+	}{
+		{"2 eggs and toast", []string{"2 eggs", "toast"}},
+		{"2 eggs, 1 slice toast; coffee", []string{"2 eggs", "1 slice toast", "coffee"}},
+		{"a bowl of mac and cheese", []string{"a bowl of mac and cheese"}},
+		{"oats with milk then a banana", []string{"oats", "milk", "a banana"}},
+	}
+	for _, c := range cases {
+		if got := splitFoodList(c.text, foods); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("splitFoodList(%q) = %q, want %q", c.text, got, c.want)
+		}
+	}
+}
+
+func TestUSDAFoodItemDropsZeroNutrients(t *testing.T) {
+	u := usdaFood{
+		FdcID: "1", Description: "Spinach, raw",
+		Nutrients: map[string]float64{usdaEnergyKcal: 23, usdaProtein: 2.9, "301": 99, "318": 0, "401": 0.001},
+	}
+	it, ok := u.foodItem(map[string]string{"301": "calcium_mg", "318": "vitamin_a_iu", "401": "vitamin_c_mg", "303": "iron_mg"})
+	if !ok {
+		t.Fatal("foodItem rejected a food with energy")
+	}
+	if want := map[string]float64{"calcium_mg": 99}; !reflect.DeepEqual(it.Nutrients, want) {
+		t.Errorf("nutrients = %v, want %v", it.Nutrients, want)
+	}
+}
+
+func TestNavyBodyFat(t *testing.T) {
+	cases := []struct {
+		sex                       string
+		height, neck, waist, hips float64
+		want                      float64
+		wantErr                   bool
+	}{
+		{"male", 178, 38, 85, 0, 16.4, false},
+		{"female", 165, 33, 75, 100, 29.4, false},
+		{"male", 178, 40, 40, 0, 0, true},
+		{"male", 178, 42, 38, 0, 0, true},
+		{"female", 165, 33, 75, 0, 0, true},
+		{"male", 0, 38, 85, 0, 0, true},
+		{"other", 178, 38, 85, 0, 0, true},
+	}
+	for _, c := range cases {
+		got, err := navyBodyFat(c.sex, c.height, c.neck, c.waist, c.hips)
+		if got != c.want || (err != nil) != c.wantErr {
+			t.Errorf("navyBodyFat(%s, %v, %v, %v, %v) = %v, %v; want %v, error %v",
+				c.sex, c.height, c.neck, c.waist, c.hips, got, err, c.want, c.wantErr)
+		}
+	}
+}
+
+func TestExportRecipeTagsJSON(t *testing.T) {
+	b, err := json.Marshal(ExportRecipe{ID: "r1", Tags: []string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b, []byte(`"tags":[]`)) {
+		t.Errorf("export without tags = %s, want \"tags\":[]", b)
+	}
+
+	var cleared, legacy ExportRecipe
+	if err := json.Unmarshal([]byte(`{"id":"r1","tags":[]}`), &cleared); err != nil {
+		t.Fatal(err)
+	}
+	if cleared.Tags == nil {
+		t.Error("tags [] decoded as nil; import would keep the old tags")
+	}
+	if err := json.Unmarshal([]byte(`{"id":"r1"}`), &legacy); err != nil {
+		t.Fatal(err)
+	}
+	if legacy.Tags != nil {
+		t.Errorf("bundle without tags decoded as %v, want nil", legacy.Tags)
+	}
+}
+
+// halvesJPEG encodes a 64x32 JPEG whose left half is red and right half blue,
+// with an EXIF orientation tag when orientation is non-zero.
+func halvesJPEG(t *testing.T, orientation int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 64; x++ {
+			c := color.RGBA{255, 0, 0, 255}
+			if x >= 32 {
+				c = color.RGBA{0, 0, 255, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if orientation == 0 {
+		return data
+	}
+	// Big-endian TIFF header, one IFD entry: tag 0x0112, type SHORT, count 1.
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1, 0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, byte(orientation), 0, 0, 0, 0, 0, 0}
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := append([]byte{0xFF, 0xE1, byte((len(seg) + 2) >> 8), byte(len(seg) + 2)}, seg...)
+	return append(append([]byte{0xFF, 0xD8}, app1...), data[2:]...)
+}
+
+func decodeVariant(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func isRed(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r > 0xC000 && g < 0x4000 && b < 0x4000
+}
+
+func isBlue(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return b > 0xC000 && r < 0x4000 && g < 0x4000
+}
+
+func TestRenderPhotoVariantsAppliesOrientation(t *testing.T) {
+	cases := []struct {
+		orientation   int
+		width, height int
+		// firstRed: the left (or top, when portrait) half of the upright
+		// image is red and the other half blue.
+		firstRed bool
+	}{
+		{1, 64, 32, true},
+		{3, 64, 32, false},
+		{6, 32, 64, true},
+		{8, 32, 64, false},
+	}
+	for _, c := range cases {
+		_, w, h, variants, err := renderPhotoVariants(halvesJPEG(t, c.orientation))
+		if err != nil {
+			t.Fatalf("orientation %d: %v", c.orientation, err)
+		}
+		if w != c.width || h != c.height {
+			t.Errorf("orientation %d: size %dx%d, want %dx%d", c.orientation, w, h, c.width, c.height)
+			continue
+		}
+		img := decodeVariant(t, variants["medium"])
+		var first, second color.Color
+		if w > h {
+			first, second = img.At(w/4, h/2), img.At(3*w/4, h/2)
+		} else {
+			first, second = img.At(w/2, h/4), img.At(w/2, 3*h/4)
+		}
+		if c.firstRed && (!isRed(first) || !isBlue(second)) || !c.firstRed && (!isBlue(first) || !isRed(second)) {
+			t.Errorf("orientation %d: halves are %v and %v, want red first = %v", c.orientation, first, second, c.firstRed)
+		}
+	}
+}
+
+func TestRenderPhotoVariantsKeepAspectRatio(t *testing.T) {
+	cases := []struct {
+		width, height int
+		thumb, medium image.Point
+	}{
+		{2000, 1000, image.Pt(320, 160), image.Pt(1280, 640)},
+		{1000, 3000, image.Pt(106, 320), image.Pt(426, 1280)},
+		{200, 100, image.Pt(200, 100), image.Pt(200, 100)},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, c.width, c.height))); err != nil {
+			t.Fatal(err)
+		}
+		_, w, h, variants, err := renderPhotoVariants(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w != c.width || h != c.height {
+			t.Errorf("%dx%d: original size reported as %dx%d", c.width, c.height, w, h)
+		}
+		for name, want := range map[string]image.Point{"thumb": c.thumb, "medium": c.medium} {
+			if got := decodeVariant(t, variants[name]).Bounds().Size(); got != want {
+				t.Errorf("%dx%d: %s is %v, want %v", c.width, c.height, name, got, want)
+			}
+		}
+	}
+}
+
+func TestRenderPhotoVariantsFlattensAlphaOntoWhite(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 40))
+	for x := 20; x < 40; x++ {
+		for y := 0; y < 40; y++ {
+			img.Set(x, y, color.NRGBA{255, 0, 0, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	contentType, _, _, variants, err := renderPhotoVariants(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "image/png" {
+		t.Errorf("content type = %q", contentType)
+	}
+	out := decodeVariant(t, variants["thumb"])
+	if r, g, b, _ := out.At(5, 20).RGBA(); r < 0xF000 || g < 0xF000 || b < 0xF000 {
+		t.Errorf("transparent area = %v, want white", out.At(5, 20))
+	}
+	if !isRed(out.At(35, 20)) {
+		t.Errorf("opaque area = %v, want red", out.At(35, 20))
+	}
+}
+
+func TestDirPhotoStorePath(t *testing.T) {
+	root := t.TempDir()
+	s := &dirPhotoStore{root: root}
+	got, err := s.path("recipes/r1/p1/thumb")
+	if err != nil || got != filepath.Join(root, "recipes", "r1", "p1", "thumb") {
+		t.Errorf("path(valid key) = %q, %v", got, err)
+	}
+	for _, key := range []string{"", "..", "../secret", "recipes/../../secret", "recipes/./p1", "recipes//p1", "/etc/passwd"} {
+		if got, err := s.path(key); !errors.Is(err, errInvalidPhotoKey) {
+			t.Errorf("path(%q) = %q, %v; want errInvalidPhotoKey", key, got, err)
+		}
+	}
+
+	secret := filepath.Join(filepath.Dir(root), filepath.Base(root)+"-secret")
+	if err := os.WriteFile(secret, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(secret)
+	key := "../" + filepath.Base(secret)
+	if _, err := s.Get(context.Background(), key); !errors.Is(err, errPhotoNotFound) {
+		t.Errorf("Get(%q) error = %v, want errPhotoNotFound", key, err)
+	}
+	if err := s.Delete(context.Background(), key); !errors.Is(err, errInvalidPhotoKey) {
+		t.Errorf("Delete(%q) error = %v, want errInvalidPhotoKey", key, err)
+	}
+	if _, err := os.Stat(secret); err != nil {
+		t.Errorf("file outside root was touched: %v", err)
+	}
+}
+
+func TestWorkoutMET(t *testing.T) {
+	km := func(v float64) *float64 { return &v }
+	cases := []struct {
+		name      string
+		activity  string
+		intensity string
+		minutes   float64
+		distance  *float64
+		want      float64
+	}{
+		{"ACSM running", "running", "light", 30, km(5), 10.5},
+		{"ACSM walking", "walking", "vigorous", 60, km(5), 3.4},
+		{"walking too fast for ACSM", "walking", "vigorous", 20, km(5), 5.0},
+		{"running too slow for ACSM", "running", "light", 60, km(5), 7.0},
+		{"no distance", "running", "vigorous", 30, nil, 11.5},
+		{"zero duration", "running", "moderate", 0, km(5), 9.8},
+		{"cycling ignores distance", "cycling", "vigorous", 60, km(30), 10.0},
+		{"unknown intensity", "swimming", "extreme", 30, nil, 7.0},
+		{"unknown activity", "parkour", "light", 30, nil, 3.0},
+		{"unknown activity and intensity", "parkour", "", 30, nil, 4.5},
+	}
+	for _, c := range cases {
+		if got := workoutMET(c.activity, c.intensity, c.minutes, c.distance); got != c.want {
+			t.Errorf("%s: workoutMET = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestBucketStart(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := func(s string, loc *time.Location) time.Time {
+		d, err := time.ParseInLocation("2006-01-02", s, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	cases := []struct {
+		day   string
+		loc   *time.Location
+		group string
+		want  string
+	}{
+		{"2026-03-04", time.UTC, "week", "2026-03-02"}, // Wednesday
+		{"2026-03-08", time.UTC, "week", "2026-03-02"}, // Sunday ends the week
+		{"2026-03-09", time.UTC, "week", "2026-03-09"}, // Monday starts one
+		{"2026-03-04", time.UTC, "month", "2026-03-01"},
+		{"2026-03-04", time.UTC, "year", "2026-01-01"},
+		{"2026-03-10", ny, "week", "2026-03-09"}, // the Monday after clocks went forward
+		{"2026-03-08", ny, "week", "2026-03-02"}, // the day clocks went forward
+		{"2026-11-03", ny, "week", "2026-11-02"}, // just after clocks went back
+	}
+	for _, c := range cases {
+		got := bucketStart(day(c.day, c.loc), c.group)
+		if got.Format("2006-01-02") != c.want || got.Hour() != 0 {
+			t.Errorf("bucketStart(%s in %s, %s) = %v, want %s at midnight", c.day, c.loc, c.group, got, c.want)
+		}
+	}
+}
+
+func TestGroupDayStatuses(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := func(from, to string) (time.Time, time.Time) {
+		f, _ := time.ParseInLocation("2006-01-02", from, ny)
+		l, _ := time.ParseInLocation("2006-01-02", to, ny)
+		return f, l.AddDate(0, 0, 1)
+	}
+	type span struct {
+		From, To   string
+		Days       int
+		DaysLogged int
+	}
+	spans := func(bs []StatusBucket) []span {
+		out := []span{}
+		for _, b := range bs {
+			out = append(out, span{b.From, b.To, b.Days, b.DaysLogged})
+		}
+		return out
+	}
+	kg := 80.0
+	days := []DayStatus{
+		{Date: "2026-03-05", EntryCount: 2, Calories: 1800, Logged: true, ProteinMet: true},
+		{Date: "2026-03-08", EntryCount: 1, Calories: 900, Logged: true, UnderCalories: true},
+		{Date: "2026-03-17", EntryCount: 3, Calories: 2100, Logged: true, WeightKg: &kg},
+	}
+
+	// 2026-03-08 is when New York moves its clocks forward.
+	from, end := rng("2026-03-04", "2026-03-17")
+	weeks := groupDayStatuses(days, from, end, "week")
+	want := []span{
+		{"2026-03-04", "2026-03-08", 5, 2},
+		{"2026-03-09", "2026-03-15", 7, 0}, // nothing logged, still reported
+		{"2026-03-16", "2026-03-17", 2, 1},
+	}
+	if got := spans(weeks); !reflect.DeepEqual(got, want) {
+		t.Fatalf("weeks = %+v, want %+v", got, want)
+	}
+	if w := weeks[0]; w.Totals.Calories != 2700 || w.Totals.EntryCount != 3 || w.ProteinMetDays != 1 || w.UnderCaloriesDays != 1 {
+		t.Errorf("first week = %+v", w)
+	}
+	if w := weeks[2]; w.AvgWeightKg == nil || *w.AvgWeightKg != 80 {
+		t.Errorf("last week weight = %v, want 80", w.AvgWeightKg)
+	}
+	if weeks[1].AvgWeightKg != nil {
+		t.Errorf("empty week weight = %v, want nil", *weeks[1].AvgWeightKg)
+	}
+
+	from, end = rng("2026-01-20", "2026-03-10")
+	want = []span{
+		{"2026-01-20", "2026-01-31", 12, 0},
+		{"2026-02-01", "2026-02-28", 28, 0},
+		{"2026-03-01", "2026-03-10", 10, 2},
+	}
+	if got := spans(groupDayStatuses(days, from, end, "month")); !reflect.DeepEqual(got, want) {
+		t.Errorf("months = %+v, want %+v", got, want)
+	}
+
+	from, end = rng("2025-12-30", "2026-03-05")
+	want = []span{
+		{"2025-12-30", "2025-12-31", 2, 0},
+		{"2026-01-01", "2026-03-05", 64, 1},
+	}
+	if got := spans(groupDayStatuses(days, from, end, "year")); !reflect.DeepEqual(got, want) {
+		t.Errorf("years = %+v, want %+v", got, want)
+	}
+}
+
+func TestGS1CheckDigit(t *testing.T) {
+	for payload, want := range map[string]byte{
+		"9638507":      '4', // EAN-8
+		"03600029145":  '2', // UPC-A
+		"400638133393": '1', // EAN-13
+		"000000000000": '0',
+	} {
+		if got := gs1CheckDigit(payload); got != want {
+			t.Errorf("gs1CheckDigit(%q) = %c, want %c", payload, got, want)
+		}
+	}
+}
+
+func TestNormalizeBarcode(t *testing.T) {
+	cases := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{"96385074", "96385074", false},
+		{"96385075", "", true},
+		{"036000291452", "0036000291452", false}, // UPC-A widened to EAN-13
+		{"036000291453", "", true},
+		{"4006381333931", "4006381333931", false},
+		{"4006381333932", "", true},
+		{" 4 006381 333931 ", "4006381333931", false},
+		{"0-36000-29145-2", "0036000291452", false},
+		{"4006381a33931", "", true},
+		{"1234567", "", true},
+		{"", "", true},
+	}
+	for _, c := range cases {
+		got, err := normalizeBarcode(c.raw)
+		if got != c.want || (err != nil) != c.wantErr {
+			t.Errorf("normalizeBarcode(%q) = %q, %v; want %q, error %v", c.raw, got, err, c.want, c.wantErr)
+		}
+	}
+	// Either scan of a UPC-A product resolves to the same code.
+	a, _ := normalizeBarcode("036000291452")
+	b, _ := normalizeBarcode("0036000291452")
+	if a != b {
+		t.Errorf("UPC-A %q and EAN-13 %q differ", a, b)
+	}
+}
@@ -0,0 +1,646 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const DefaultUserID = "00000000-0000-0000-0000-000000000001"
+
+const LbsPerKg = 2.20462
+
+func main() {
+	console := flag.Bool("console", false, "read commands from stdin instead of connecting to Discord")
+	flag.Parse()
+
+	apiURL := os.Getenv("INTAKE_API_URL")
+	if apiURL == "" {
+		apiURL = "http://localhost:8080"
+	}
+	userID := os.Getenv("INTAKE_USER_ID")
+	if userID == "" {
+		userID = DefaultUserID
+	}
+	unit := os.Getenv("INTAKE_WEIGHT_UNIT")
+	if unit != "kg" {
+		unit = "lbs"
+	}
+	loc := time.Local
+	if tz := os.Getenv("APP_TIMEZONE"); tz != "" {
+		loaded, err := time.LoadLocation(tz)
+		if err != nil {
+			log.Printf("invalid APP_TIMEZONE=%q, falling back to local: %v", tz, err)
+		} else {
+			loc = loaded
+		}
+	}
+
+	bot := &Bot{
+		API:        &Client{BaseURL: strings.TrimRight(apiURL, "/"), UserID: userID, HTTP: &http.Client{Timeout: 10 * time.Second}},
+		Loc:        loc,
+		WeightUnit: unit,
+		undo:       map[string][][]string{},
+	}
+
+	var gw Gateway
+	if *console {
+		gw = &ConsoleGateway{In: os.Stdin, Out: os.Stdout}
+	} else {
+		token := os.Getenv("DISCORD_BOT_TOKEN")
+		if token == "" {
+			log.Fatal("DISCORD_BOT_TOKEN is required (or run with -console)")
+		}
+		gw = &DiscordGateway{Token: token, GuildID: os.Getenv("DISCORD_GUILD_ID")}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Printf("bot starting api=%s user_id=%s", bot.API.BaseURL, userID)
+	if err := gw.Run(ctx, Commands, bot.Handle); err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatal(err)
+	}
+}
+
+// ── Commands ─────────────────────────────────────────────────────────────────
+
+type OptionKind int
+
+const (
+	OptionString OptionKind = iota
+	OptionNumber
+)
+
+type OptionSpec struct {
+	Name        string
+	Description string
+	Kind        OptionKind
+	Required    bool
+	Choices     []string
+}
+
+type CommandSpec struct {
+	Name        string
+	Description string
+	Options     []OptionSpec
+}
+
+// Command is a single slash-command invocation, independent of the gateway it arrived on.
+type Command struct {
+	Name    string
+	Options map[string]string
+	// Author identifies who ran the command so /undo only reverts their own entries.
+	Author string
+}
+
+var mealChoices = []string{"breakfast", "lunch", "dinner", "snack"}
+
+var Commands = []CommandSpec{
+	{
+		Name:        "log",
+		Description: "Log a food, e.g. chicken breast 6oz",
+		Options: []OptionSpec{
+			{Name: "food", Description: "Food name with optional amount (2 eggs, rice 150g)", Kind: OptionString, Required: true},
+			{Name: "meal", Description: "Meal slot (defaults to time of day)", Kind: OptionString, Choices: mealChoices},
+		},
+	},
+	{
+		Name:        "today",
+		Description: "Show today's totals against your goals",
+	},
+	{
+		Name:        "weight",
+		Description: "Log body weight",
+		Options: []OptionSpec{
+			{Name: "value", Description: "Weight", Kind: OptionNumber, Required: true},
+			{Name: "unit", Description: "Unit (defaults to INTAKE_WEIGHT_UNIT)", Kind: OptionString, Choices: []string{"lbs", "kg"}},
+		},
+	},
+	{
+		Name:        "undo",
+		Description: "Remove the last food you logged",
+	},
+}
+
+// HandlerFunc turns a command into the reply text shown to the user.
+type HandlerFunc func(ctx context.Context, cmd Command) string
+
+// Gateway delivers slash commands to a handler and posts its replies.
+type Gateway interface {
+	Run(ctx context.Context, cmds []CommandSpec, handle HandlerFunc) error
+}
+
+// ── Discord gateway ──────────────────────────────────────────────────────────
+
+type DiscordGateway struct {
+	Token   string
+	GuildID string // empty registers commands globally
+}
+
+func (g *DiscordGateway) Run(ctx context.Context, cmds []CommandSpec, handle HandlerFunc) error {
+	s, err := discordgo.New("Bot " + g.Token)
+	if err != nil {
+		return fmt.Errorf("discord session: %w", err)
+	}
+	s.Identify.Intents = discordgo.IntentsGuilds
+	s.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		if i.Type != discordgo.InteractionApplicationCommand {
+			return
+		}
+		data := i.ApplicationCommandData()
+		cmd := Command{Name: data.Name, Options: map[string]string{}}
+		for _, opt := range data.Options {
+			cmd.Options[opt.Name] = fmt.Sprint(opt.Value)
+		}
+		if i.Member != nil && i.Member.User != nil {
+			cmd.Author = i.Member.User.ID
+		} else if i.User != nil {
+			cmd.Author = i.User.ID
+		}
+		// Defer first: Discord drops interactions not acknowledged within 3 seconds.
+		if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		}); err != nil {
+			log.Printf("[bot] defer /%s: %v", cmd.Name, err)
+			return
+		}
+		reply := handle(ctx, cmd)
+		if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &reply}); err != nil {
+			log.Printf("[bot] reply /%s: %v", cmd.Name, err)
+		}
+	})
+	if err := s.Open(); err != nil {
+		return fmt.Errorf("discord open: %w", err)
+	}
+	defer s.Close()
+
+	appCmds := make([]*discordgo.ApplicationCommand, 0, len(cmds))
+	for _, c := range cmds {
+		ac := &discordgo.ApplicationCommand{Name: c.Name, Description: c.Description}
+		for _, o := range c.Options {
+			opt := &discordgo.ApplicationCommandOption{
+				Name: o.Name, Description: o.Description, Required: o.Required,
+				Type: discordgo.ApplicationCommandOptionString,
+			}
+			if o.Kind == OptionNumber {
+				opt.Type = discordgo.ApplicationCommandOptionNumber
+			}
+			for _, ch := range o.Choices {
+				opt.Choices = append(opt.Choices, &discordgo.ApplicationCommandOptionChoice{Name: ch, Value: ch})
+			}
+			ac.Options = append(ac.Options, opt)
+		}
+		appCmds = append(appCmds, ac)
+	}
+	if _, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, g.GuildID, appCmds); err != nil {
+		return fmt.Errorf("register commands: %w", err)
+	}
+	log.Printf("[bot] connected as %s, %d commands registered", s.State.User.Username, len(appCmds))
+
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// ── Console gateway ──────────────────────────────────────────────────────────
+
+// ConsoleGateway reads commands such as "/log food:2 eggs meal:breakfast" from
+// In and writes replies to Out. Text before the first "name:" goes to the
+// command's first option, so "/log 2 eggs" works too. It lets the bot be
+// exercised offline against a local API.
+type ConsoleGateway struct {
+	In  io.Reader
+	Out io.Writer
+}
+
+func (g *ConsoleGateway) Run(ctx context.Context, cmds []CommandSpec, handle HandlerFunc) error {
+	specs := map[string]CommandSpec{}
+	for _, c := range cmds {
+		specs[c.Name] = c
+	}
+	sc := bufio.NewScanner(g.In)
+	for sc.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		cmd, err := parseConsoleCommand(line, specs)
+		if err != nil {
+			fmt.Fprintf(g.Out, "⚠️ %v\n", err)
+			continue
+		}
+		cmd.Author = "console"
+		fmt.Fprintln(g.Out, handle(ctx, cmd))
+	}
+	return sc.Err()
+}
+
+func parseConsoleCommand(line string, specs map[string]CommandSpec) (Command, error) {
+	if !strings.HasPrefix(line, "/") {
+		return Command{}, errors.New("commands start with /")
+	}
+	fields := strings.Fields(line[1:])
+	if len(fields) == 0 {
+		return Command{}, errors.New("missing command name")
+	}
+	spec, ok := specs[fields[0]]
+	if !ok {
+		return Command{}, fmt.Errorf("unknown command /%s", fields[0])
+	}
+	cmd := Command{Name: spec.Name, Options: map[string]string{}}
+	current := ""
+	if len(spec.Options) > 0 {
+		current = spec.Options[0].Name
+	}
+	for _, f := range fields[1:] {
+		if name, val, found := strings.Cut(f, ":"); found {
+			if spec.hasOption(name) {
+				current = name
+				f = val
+			}
+		}
+		if current == "" || f == "" {
+			continue
+		}
+		cmd.Options[current] = strings.TrimSpace(cmd.Options[current] + " " + f)
+	}
+	for _, o := range spec.Options {
+		if o.Required && cmd.Options[o.Name] == "" {
+			return Command{}, fmt.Errorf("/%s needs %s", spec.Name, o.Name)
+		}
+	}
+	return cmd, nil
+}
+
+func (c CommandSpec) hasOption(name string) bool {
+	for _, o := range c.Options {
+		if o.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ── Intake API client ────────────────────────────────────────────────────────
+
+type Client struct {
+	BaseURL string
+	UserID  string
+	HTTP    *http.Client
+}
+
+type ParsedMatch struct {
+	FoodItemID   string  `json:"food_item_id"`
+	Name         string  `json:"name"`
+	ServingLabel string  `json:"serving_label"`
+	Calories     float64 `json:"calories"`
+	ProteinG     float64 `json:"protein_g"`
+	Warning      string  `json:"warning"`
+}
+
+type ParsedItem struct {
+	Text       string        `json:"text"`
+	Name       string        `json:"name"`
+	Meal       string        `json:"meal"`
+	FoodItemID string        `json:"food_item_id"`
+	Servings   float64       `json:"servings"`
+	Matches    []ParsedMatch `json:"matches"`
+}
+
+type ParseResult struct {
+	Meal       string       `json:"meal"`
+	OccurredAt string       `json:"occurred_at"`
+	Items      []ParsedItem `json:"items"`
+}
+
+type LogEntry struct {
+	ID         string  `json:"id"`
+	FoodName   string  `json:"food_name"`
+	Servings   float64 `json:"servings"`
+	Calories   float64 `json:"calories"`
+	OccurredAt string  `json:"occurred_at"`
+	Note       string  `json:"note"`
+}
+
+type Dashboard struct {
+	CaloriesIn    float64 `json:"calories_in"`
+	ProteinG      float64 `json:"protein_g"`
+	CarbsG        float64 `json:"carbs_g"`
+	FatG          float64 `json:"fat_g"`
+	FiberG        float64 `json:"fiber_g"`
+	Steps         int     `json:"steps"`
+	ActiveKcalEst float64 `json:"active_calories_est"`
+}
+
+type Goals struct {
+	Calories float64 `json:"calories"`
+	ProteinG float64 `json:"protein_g"`
+	CarbsG   float64 `json:"carbs_g"`
+	FatG     float64 `json:"fat_g"`
+	FiberG   float64 `json:"fiber_g"`
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var rdr io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rdr = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, rdr)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(raw, &apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("%s %s: %s", method, path, apiErr.Error)
+		}
+		return fmt.Errorf("%s %s: status %d", method, path, resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, out)
+}
+
+func (c *Client) userQuery(extra url.Values) string {
+	q := url.Values{"user_id": {c.UserID}}
+	for k, v := range extra {
+		q[k] = v
+	}
+	return "?" + q.Encode()
+}
+
+// ParseLog asks the API to turn free text into candidate log entries.
+func (c *Client) ParseLog(ctx context.Context, text, meal string) (ParseResult, error) {
+	var out ParseResult
+	err := c.do(ctx, http.MethodPost, "/log/parse", map[string]any{"user_id": c.UserID, "text": text, "meal": meal}, &out)
+	return out, err
+}
+
+// ConfirmLog commits parsed items with note and returns the new log entry IDs.
+func (c *Client) ConfirmLog(ctx context.Context, occurredAt, note string, items []ParsedItem) ([]string, error) {
+	body := []map[string]any{}
+	for _, it := range items {
+		body = append(body, map[string]any{"food_item_id": it.FoodItemID, "servings": it.Servings, "meal": it.Meal, "note": note})
+	}
+	var out struct {
+		IDs []string `json:"ids"`
+	}
+	err := c.do(ctx, http.MethodPost, "/log/parse/confirm", map[string]any{
+		"user_id": c.UserID, "occurred_at": occurredAt, "items": body,
+	}, &out)
+	return out.IDs, err
+}
+
+func (c *Client) LogToday(ctx context.Context, date string) ([]LogEntry, error) {
+	var out []LogEntry
+	err := c.do(ctx, http.MethodGet, "/log/today"+c.userQuery(url.Values{"date": {date}}), nil, &out)
+	return out, err
+}
+
+func (c *Client) DeleteLogEntry(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/log/"+url.PathEscape(id), nil, nil)
+}
+
+func (c *Client) Dashboard(ctx context.Context, date string) (Dashboard, error) {
+	var out Dashboard
+	err := c.do(ctx, http.MethodGet, "/dashboard/today"+c.userQuery(url.Values{"date": {date}}), nil, &out)
+	return out, err
+}
+
+func (c *Client) Goals(ctx context.Context) (Goals, error) {
+	var out Goals
+	err := c.do(ctx, http.MethodGet, "/goals"+c.userQuery(nil), nil, &out)
+	return out, err
+}
+
+func (c *Client) LogWeight(ctx context.Context, kg float64) error {
+	return c.do(ctx, http.MethodPost, "/body/weight", map[string]any{"user_id": c.UserID, "weight_kg": kg, "note": "discord"}, nil)
+}
+
+// ── Bot ──────────────────────────────────────────────────────────────────────
+
+type Bot struct {
+	API        *Client
+	Loc        *time.Location
+	WeightUnit string
+
+	mu   sync.Mutex
+	undo map[string][][]string // author -> IDs logged per /log command, most recent last
+}
+
+func (b *Bot) now() time.Time {
+	return time.Now().In(b.Loc)
+}
+
+func (b *Bot) Handle(ctx context.Context, cmd Command) string {
+	var reply string
+	var err error
+	switch cmd.Name {
+	case "log":
+		reply, err = b.handleLog(ctx, cmd)
+	case "today":
+		reply, err = b.handleToday(ctx)
+	case "weight":
+		reply, err = b.handleWeight(ctx, cmd)
+	case "undo":
+		reply, err = b.handleUndo(ctx, cmd)
+	default:
+		err = fmt.Errorf("unknown command /%s", cmd.Name)
+	}
+	if err != nil {
+		log.Printf("[bot] /%s failed: %v", cmd.Name, err)
+		return "⚠️ " + err.Error()
+	}
+	return reply
+}
+
+func (b *Bot) handleLog(ctx context.Context, cmd Command) (string, error) {
+	text := strings.TrimSpace(cmd.Options["food"])
+	if text == "" {
+		return "", errors.New("tell me what to log, e.g. /log chicken breast 6oz")
+	}
+	meal := cmd.Options["meal"]
+	if meal == "snack" {
+		meal = "snack_1"
+	}
+	parsed, err := b.API.ParseLog(ctx, text, meal)
+	if err != nil {
+		return "", err
+	}
+	var matched []ParsedItem
+	var missing []string
+	for _, it := range parsed.Items {
+		if it.FoodItemID == "" {
+			missing = append(missing, it.Name)
+			continue
+		}
+		matched = append(matched, it)
+	}
+	if len(matched) == 0 {
+		return fmt.Sprintf("❓ No food matching **%s**. Add it in Intake first.", text), nil
+	}
+	ids, err := b.API.ConfirmLog(ctx, parsed.OccurredAt, authorNote(cmd.Author), matched)
+	if err != nil {
+		return "", err
+	}
+	b.mu.Lock()
+	b.undo[cmd.Author] = append(b.undo[cmd.Author], ids)
+	b.mu.Unlock()
+
+	var sb strings.Builder
+	for _, it := range matched {
+		m := it.Matches[0]
+		sb.WriteString(fmt.Sprintf("✅ Logged **%s** ×%s (%s) to %s — %.0f kcal, %.0fg protein\n",
+			m.Name, trimFloat(it.Servings), m.ServingLabel, strings.ReplaceAll(it.Meal, "_", " "), m.Calories, m.ProteinG))
+		if m.Warning != "" {
+			sb.WriteString("   ⚠️ " + m.Warning + "\n")
+		}
+	}
+	for _, name := range missing {
+		sb.WriteString(fmt.Sprintf("❓ Skipped **%s** (no matching food)\n", name))
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+func (b *Bot) handleToday(ctx context.Context) (string, error) {
+	date := b.now().Format("2006-01-02")
+	d, err := b.API.Dashboard(ctx, date)
+	if err != nil {
+		return "", err
+	}
+	g, err := b.API.Goals(ctx)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📅 **Today (%s)**\n", date))
+	sb.WriteString(progressLine("Calories", d.CaloriesIn, g.Calories, " kcal"))
+	sb.WriteString(progressLine("Protein", d.ProteinG, g.ProteinG, "g"))
+	sb.WriteString(progressLine("Carbs", d.CarbsG, g.CarbsG, "g"))
+	sb.WriteString(progressLine("Fat", d.FatG, g.FatG, "g"))
+	sb.WriteString(progressLine("Fiber", d.FiberG, g.FiberG, "g"))
+	if d.Steps > 0 || d.ActiveKcalEst > 0 {
+		sb.WriteString(fmt.Sprintf("Steps: %d · Active: %.0f kcal\n", d.Steps, d.ActiveKcalEst))
+	}
+	return sb.String(), nil
+}
+
+func progressLine(label string, value, goal float64, unit string) string {
+	if goal <= 0 {
+		return fmt.Sprintf("%s: %.0f%s\n", label, value, unit)
+	}
+	return fmt.Sprintf("%s: %.0f / %.0f%s (%.0f left)\n", label, value, goal, unit, math.Max(0, goal-value))
+}
+
+func (b *Bot) handleWeight(ctx context.Context, cmd Command) (string, error) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(cmd.Options["value"]), 64)
+	if err != nil || v <= 0 {
+		return "", errors.New("weight must be a positive number")
+	}
+	unit := cmd.Options["unit"]
+	if unit == "" {
+		unit = b.WeightUnit
+	}
+	kg := v
+	if unit == "lbs" {
+		kg = v / LbsPerKg
+	}
+	if err := b.API.LogWeight(ctx, kg); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("⚖️ Logged %.1f %s", v, unit), nil
+}
+
+// authorNote tags the entries a /log creates, so /undo can find an author's
+// entries again after the bot restarts.
+func authorNote(author string) string {
+	return "discord:" + author
+}
+
+func (b *Bot) handleUndo(ctx context.Context, cmd Command) (string, error) {
+	b.mu.Lock()
+	stack := b.undo[cmd.Author]
+	var ids []string
+	if n := len(stack); n > 0 {
+		ids = stack[n-1]
+		b.undo[cmd.Author] = stack[:n-1]
+	}
+	b.mu.Unlock()
+
+	label := "your last /log"
+	if len(ids) > 1 {
+		label = fmt.Sprintf("your last /log (%d entries)", len(ids))
+	}
+	if len(ids) == 0 {
+		// Nothing on the stack, e.g. after a restart: fall back to the latest
+		// entry this author logged through the bot today. Entries from the
+		// web UI or other people are never touched.
+		entries, err := b.API.LogToday(ctx, b.now().Format("2006-01-02"))
+		if err != nil {
+			return "", err
+		}
+		var last *LogEntry
+		for i, e := range entries {
+			if e.Note == authorNote(cmd.Author) && (last == nil || e.OccurredAt >= last.OccurredAt) {
+				last = &entries[i]
+			}
+		}
+		if last == nil {
+			return "Nothing you logged today to undo.", nil
+		}
+		ids, label = []string{last.ID}, "**"+last.FoodName+"**"
+	}
+	for i, id := range ids {
+		if err := b.API.DeleteLogEntry(ctx, id); err != nil {
+			// Put back what is left so /undo can be retried.
+			b.mu.Lock()
+			b.undo[cmd.Author] = append(b.undo[cmd.Author], ids[i:])
+			b.mu.Unlock()
+			return "", err
+		}
+	}
+	return fmt.Sprintf("↩️ Removed %s.", label), nil
+}
+
+func trimFloat(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
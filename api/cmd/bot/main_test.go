@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeGateway replays a fixed list of commands and records the replies, standing
+// in for Discord so the bot can be exercised without a network connection.
+type fakeGateway struct {
+	cmds    []Command
+	replies []string
+}
+
+func (g *fakeGateway) Run(ctx context.Context, _ []CommandSpec, handle HandlerFunc) error {
+	for _, c := range g.cmds {
+		g.replies = append(g.replies, handle(ctx, c))
+	}
+	return nil
+}
+
+// fakeAPI implements the handful of Intake endpoints the bot calls.
+type fakeAPI struct {
+	mu         sync.Mutex
+	nextID     int
+	entries    []LogEntry
+	deleted    []string
+	weightKg   float64
+	failWith   int // when non-zero every request returns this status
+	failDelete int // when non-zero DELETE requests return this status
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reply := func(code int, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(v)
+	}
+	if f.failWith != 0 {
+		reply(f.failWith, map[string]any{"error": "database unavailable"})
+		return
+	}
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/log/parse":
+		var in struct {
+			Text string `json:"text"`
+			Meal string `json:"meal"`
+		}
+		json.NewDecoder(r.Body).Decode(&in)
+		meal := in.Meal
+		if meal == "" {
+			meal = "lunch"
+		}
+		item := ParsedItem{Text: in.Text, Name: in.Text, Meal: meal, Servings: 1}
+		if strings.Contains(in.Text, "chicken") {
+			item.FoodItemID = "food-chicken"
+			item.Matches = []ParsedMatch{{FoodItemID: "food-chicken", Name: "Chicken breast", ServingLabel: "100 g", Calories: 165, ProteinG: 31}}
+		}
+		reply(http.StatusOK, ParseResult{Meal: meal, OccurredAt: "2026-01-02T12:00:00Z", Items: []ParsedItem{item}})
+	case r.Method == http.MethodPost && r.URL.Path == "/log/parse/confirm":
+		var in struct {
+			Items []struct {
+				FoodItemID string `json:"food_item_id"`
+				Note       string `json:"note"`
+			} `json:"items"`
+		}
+		json.NewDecoder(r.Body).Decode(&in)
+		var ids []string
+		for _, it := range in.Items {
+			f.nextID++
+			id := fmt.Sprintf("entry-%d", f.nextID)
+			ids = append(ids, id)
+			f.entries = append(f.entries, LogEntry{ID: id, FoodName: it.FoodItemID, Servings: 1, OccurredAt: time.Now().UTC().Format(time.RFC3339Nano), Note: it.Note})
+		}
+		reply(http.StatusCreated, map[string]any{"ids": ids})
+	case r.Method == http.MethodGet && r.URL.Path == "/log/today":
+		reply(http.StatusOK, f.entries)
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/log/"):
+		if f.failDelete != 0 {
+			reply(f.failDelete, map[string]any{"error": "delete failed"})
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/log/")
+		f.deleted = append(f.deleted, id)
+		for i, e := range f.entries {
+			if e.ID == id {
+				f.entries = append(f.entries[:i], f.entries[i+1:]...)
+				break
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && r.URL.Path == "/dashboard/today":
+		reply(http.StatusOK, Dashboard{CaloriesIn: 1200, ProteinG: 90, CarbsG: 110, FatG: 40, FiberG: 18, Steps: 8000, ActiveKcalEst: 320})
+	case r.Method == http.MethodGet && r.URL.Path == "/goals":
+		reply(http.StatusOK, Goals{Calories: 2000, ProteinG: 150, CarbsG: 200, FatG: 70, FiberG: 30})
+	case r.Method == http.MethodPost && r.URL.Path == "/body/weight":
+		var in struct {
+			WeightKg float64 `json:"weight_kg"`
+		}
+		json.NewDecoder(r.Body).Decode(&in)
+		f.weightKg = in.WeightKg
+		reply(http.StatusCreated, map[string]any{"ok": true})
+	default:
+		reply(http.StatusNotFound, map[string]any{"error": "not found"})
+	}
+}
+
+func newTestBot(t *testing.T) (*Bot, *fakeAPI) {
+	t.Helper()
+	api := &fakeAPI{}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	bot := &Bot{
+		API:        &Client{BaseURL: srv.URL, UserID: DefaultUserID, HTTP: srv.Client()},
+		Loc:        time.UTC,
+		WeightUnit: "lbs",
+		undo:       map[string][][]string{},
+	}
+	return bot, api
+}
+
+func runCommands(t *testing.T, bot *Bot, cmds ...Command) []string {
+	t.Helper()
+	gw := &fakeGateway{cmds: cmds}
+	if err := gw.Run(context.Background(), Commands, bot.Handle); err != nil {
+		t.Fatal(err)
+	}
+	return gw.replies
+}
+
+func TestLogParsesThenConfirms(t *testing.T) {
+	bot, api := newTestBot(t)
+	replies := runCommands(t, bot,
+		Command{Name: "log", Author: "u1", Options: map[string]string{"food": "chicken breast", "meal": "dinner"}},
+		Command{Name: "log", Author: "u1", Options: map[string]string{"food": "unicorn steak"}},
+	)
+	if !strings.Contains(replies[0], "Logged **Chicken breast**") || !strings.Contains(replies[0], "to dinner") {
+		t.Errorf("log reply = %q", replies[0])
+	}
+	if !strings.Contains(replies[1], "No food matching **unicorn steak**") {
+		t.Errorf("unmatched reply = %q", replies[1])
+	}
+	if len(api.entries) != 1 || api.entries[0].FoodName != "food-chicken" {
+		t.Errorf("entries = %+v, want one chicken entry", api.entries)
+	}
+}
+
+func TestToday(t *testing.T) {
+	bot, _ := newTestBot(t)
+	reply := runCommands(t, bot, Command{Name: "today"})[0]
+	for _, want := range []string{"Calories: 1200 / 2000 kcal (800 left)", "Protein: 90 / 150g (60 left)", "Steps: 8000 · Active: 320 kcal"} {
+		if !strings.Contains(reply, want) {
+			t.Errorf("today reply missing %q:\n%s", want, reply)
+		}
+	}
+}
+
+func TestWeightConvertsPounds(t *testing.T) {
+	bot, api := newTestBot(t)
+	replies := runCommands(t, bot,
+		Command{Name: "weight", Options: map[string]string{"value": "180"}},
+	)
+	if want := 180 / LbsPerKg; math.Abs(api.weightKg-want) > 1e-9 {
+		t.Errorf("weight_kg = %v, want %v", api.weightKg, want)
+	}
+	if replies[0] != "⚖️ Logged 180.0 lbs" {
+		t.Errorf("weight reply = %q", replies[0])
+	}
+
+	replies = runCommands(t, bot, Command{Name: "weight", Options: map[string]string{"value": "80", "unit": "kg"}})
+	if api.weightKg != 80 {
+		t.Errorf("weight_kg = %v, want 80", api.weightKg)
+	}
+	if replies[0] != "⚖️ Logged 80.0 kg" {
+		t.Errorf("weight reply = %q", replies[0])
+	}
+}
+
+func TestUndo(t *testing.T) {
+	bot, api := newTestBot(t)
+	replies := runCommands(t, bot,
+		Command{Name: "log", Author: "u1", Options: map[string]string{"food": "chicken breast"}},
+		Command{Name: "undo", Author: "u1"},
+		Command{Name: "undo", Author: "u1"},
+	)
+	if replies[1] != "↩️ Removed your last /log." {
+		t.Errorf("undo reply = %q", replies[1])
+	}
+	if len(api.deleted) != 1 || api.deleted[0] != "entry-1" {
+		t.Errorf("deleted = %v, want [entry-1]", api.deleted)
+	}
+	// The bot's own stack is empty now, so /undo falls back to today's log, which is also empty.
+	if replies[2] != "Nothing you logged today to undo." {
+		t.Errorf("second undo reply = %q", replies[2])
+	}
+}
+
+func TestUndoFallsBackToAuthorsLatestEntry(t *testing.T) {
+	bot, api := newTestBot(t)
+	api.entries = []LogEntry{
+		{ID: "old", FoodName: "Oats", OccurredAt: "2026-01-02T08:00:00Z", Note: authorNote("u1")},
+		{ID: "mine", FoodName: "Banana", OccurredAt: "2026-01-02T10:00:00Z", Note: authorNote("u1")},
+		{ID: "theirs", FoodName: "Toast", OccurredAt: "2026-01-02T11:00:00Z", Note: authorNote("u2")},
+		{ID: "web", FoodName: "Soup", OccurredAt: "2026-01-02T12:00:00Z"},
+	}
+	// A fresh bot has no undo stack, as after a restart.
+	reply := runCommands(t, bot, Command{Name: "undo", Author: "u1"})[0]
+	if reply != "↩️ Removed **Banana**." {
+		t.Errorf("undo reply = %q", reply)
+	}
+	if len(api.deleted) != 1 || api.deleted[0] != "mine" {
+		t.Errorf("deleted = %v, want [mine]", api.deleted)
+	}
+
+	reply = runCommands(t, bot, Command{Name: "undo", Author: "u3"})[0]
+	if reply != "Nothing you logged today to undo." {
+		t.Errorf("undo reply for author with no entries = %q", reply)
+	}
+	if len(api.deleted) != 1 {
+		t.Errorf("deleted = %v, want only [mine]", api.deleted)
+	}
+}
+
+func TestUndoCanBeRetriedAfterFailure(t *testing.T) {
+	bot, api := newTestBot(t)
+	runCommands(t, bot, Command{Name: "log", Author: "u1", Options: map[string]string{"food": "chicken breast"}})
+
+	api.failDelete = http.StatusInternalServerError
+	reply := runCommands(t, bot, Command{Name: "undo", Author: "u1"})[0]
+	if !strings.HasPrefix(reply, "⚠️ ") {
+		t.Fatalf("undo reply = %q, want error", reply)
+	}
+
+	api.failDelete = 0
+	reply = runCommands(t, bot, Command{Name: "undo", Author: "u1"})[0]
+	if reply != "↩️ Removed your last /log." {
+		t.Errorf("retried undo reply = %q", reply)
+	}
+	if len(api.deleted) != 1 || api.deleted[0] != "entry-1" {
+		t.Errorf("deleted = %v, want [entry-1]", api.deleted)
+	}
+}
+
+func TestAPIErrorReply(t *testing.T) {
+	bot, api := newTestBot(t)
+	api.failWith = http.StatusInternalServerError
+	for _, cmd := range []Command{
+		{Name: "log", Options: map[string]string{"food": "chicken breast"}},
+		{Name: "today"},
+		{Name: "weight", Options: map[string]string{"value": "180"}},
+	} {
+		reply := runCommands(t, bot, cmd)[0]
+		if !strings.HasPrefix(reply, "⚠️ ") || !strings.Contains(reply, "database unavailable") {
+			t.Errorf("/%s reply = %q, want API error", cmd.Name, reply)
+		}
+	}
+}
+
+func TestParseConsoleCommand(t *testing.T) {
+	specs := map[string]CommandSpec{}
+	for _, c := range Commands {
+		specs[c.Name] = c
+	}
+	cmd, err := parseConsoleCommand("/log 2 eggs meal:breakfast", specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.Options["food"] != "2 eggs" || cmd.Options["meal"] != "breakfast" {
+		t.Errorf("options = %v", cmd.Options)
+	}
+	if _, err := parseConsoleCommand("/weight", specs); err == nil {
+		t.Error("expected missing value error")
+	}
+}
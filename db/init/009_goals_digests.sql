@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS nutrition_goals (
+  user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  calories NUMERIC NOT NULL DEFAULT 2200,
+  protein_g NUMERIC NOT NULL DEFAULT 180,
+  carbs_g NUMERIC NOT NULL DEFAULT 220,
+  fat_g NUMERIC NOT NULL DEFAULT 70,
+  fiber_g NUMERIC NOT NULL DEFAULT 30,
+  water_glasses INT NOT NULL DEFAULT 8,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS digests (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  period TEXT NOT NULL DEFAULT 'daily',   -- daily | weekly
+  send_at TIME NOT NULL,
+  weekday INT NOT NULL DEFAULT 1,         -- weekly only; 0 = Sunday
+  webhook_url TEXT NOT NULL,
+  enabled BOOLEAN NOT NULL DEFAULT true,
+  last_sent_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE(user_id, period)
+);
@@ -0,0 +1,9 @@
+-- Fuzzy food search: trigram index over name + brand, and a usage index so
+-- ranking by the user's logging frequency/recency stays cheap.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS food_items_search_trgm_idx
+  ON food_items USING gin ((lower(name || ' ' || COALESCE(brand, ''))) gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS log_entries_user_ref_idx
+  ON log_entries (user_id, kind, ref_id, occurred_at DESC);
@@ -0,0 +1,25 @@
+-- Barcodes (UPC/EAN) map many-to-one onto food items. Codes are stored
+-- normalised: UPC-A is widened to EAN-13 with a leading zero.
+CREATE TABLE IF NOT EXISTS food_barcodes (
+  code TEXT PRIMARY KEY,
+  food_item_id UUID NOT NULL REFERENCES food_items(id) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS food_barcodes_food_item_idx ON food_barcodes (food_item_id);
+
+-- Locally loaded product database (e.g. an Open Food Facts dump imported with
+-- `api import-products`), used to create food items for unknown codes offline.
+CREATE TABLE IF NOT EXISTS product_catalog (
+  code TEXT PRIMARY KEY,
+  name TEXT NOT NULL,
+  brand TEXT,
+  serving_label TEXT NOT NULL DEFAULT '100 g',
+  calories_per_serving NUMERIC NOT NULL DEFAULT 0,
+  protein_g_per_serving NUMERIC NOT NULL DEFAULT 0,
+  carbs_g_per_serving NUMERIC NOT NULL DEFAULT 0,
+  fat_g_per_serving NUMERIC NOT NULL DEFAULT 0,
+  fiber_g_per_serving NUMERIC NOT NULL DEFAULT 0,
+  source TEXT NOT NULL DEFAULT 'openfoodfacts',
+  imported_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,6 @@
+-- Reference catalog imports (e.g. USDA FoodData Central) key rows on the
+-- upstream ID so re-running an import updates in place.
+ALTER TABLE food_items ADD COLUMN IF NOT EXISTS external_id TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS food_items_source_external_idx
+  ON food_items (source, external_id) WHERE external_id IS NOT NULL;
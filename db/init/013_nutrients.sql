@@ -0,0 +1,28 @@
+-- Micronutrients beyond the five macro columns. Definitions are data, so new
+-- nutrients can be added without a schema change; values are per serving.
+CREATE TABLE IF NOT EXISTS nutrients (
+  key TEXT PRIMARY KEY,            -- e.g. 'sodium'
+  name TEXT NOT NULL,
+  unit TEXT NOT NULL,              -- g | mg | mcg
+  usda_nbr TEXT,                   -- FoodData Central nutrient number, for imports
+  sort_order INT NOT NULL DEFAULT 100
+);
+
+INSERT INTO nutrients (key, name, unit, usda_nbr, sort_order) VALUES
+  ('sodium',        'Sodium',        'mg',  '307', 10),
+  ('sugar',         'Sugar',         'g',   '269', 20),
+  ('added_sugar',   'Added sugar',   'g',   '539', 30),
+  ('saturated_fat', 'Saturated fat', 'g',   '606', 40),
+  ('cholesterol',   'Cholesterol',   'mg',  '601', 50),
+  ('potassium',     'Potassium',     'mg',  '306', 60),
+  ('calcium',       'Calcium',       'mg',  '301', 70),
+  ('iron',          'Iron',          'mg',  '303', 80),
+  ('vitamin_d',     'Vitamin D',     'mcg', '328', 90)
+ON CONFLICT (key) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS food_item_nutrients (
+  food_item_id UUID NOT NULL REFERENCES food_items(id) ON DELETE CASCADE,
+  nutrient_key TEXT NOT NULL REFERENCES nutrients(key) ON DELETE CASCADE,
+  amount_per_serving NUMERIC NOT NULL,
+  PRIMARY KEY (food_item_id, nutrient_key)
+);
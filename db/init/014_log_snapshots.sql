@@ -0,0 +1,23 @@
+-- Log entries snapshot the food's per-serving macros (and nutrients) at log
+-- time, so editing a food item no longer rewrites past totals. History is only
+-- re-derived through POST /log/recalculate.
+ALTER TABLE log_entries ADD COLUMN IF NOT EXISTS calories_per_serving NUMERIC;
+ALTER TABLE log_entries ADD COLUMN IF NOT EXISTS protein_g_per_serving NUMERIC;
+ALTER TABLE log_entries ADD COLUMN IF NOT EXISTS carbs_g_per_serving NUMERIC;
+ALTER TABLE log_entries ADD COLUMN IF NOT EXISTS fat_g_per_serving NUMERIC;
+ALTER TABLE log_entries ADD COLUMN IF NOT EXISTS fiber_g_per_serving NUMERIC;
+ALTER TABLE log_entries ADD COLUMN IF NOT EXISTS nutrients_per_serving JSONB;
+
+-- Backfill existing rows from the foods as they are today.
+UPDATE log_entries le SET
+  calories_per_serving = fi.calories_per_serving,
+  protein_g_per_serving = fi.protein_g_per_serving,
+  carbs_g_per_serving = fi.carbs_g_per_serving,
+  fat_g_per_serving = fi.fat_g_per_serving,
+  fiber_g_per_serving = fi.fiber_g_per_serving,
+  nutrients_per_serving = (
+    SELECT jsonb_object_agg(fin.nutrient_key, fin.amount_per_serving)
+    FROM food_item_nutrients fin WHERE fin.food_item_id = fi.id
+  )
+FROM food_items fi
+WHERE fi.id = le.ref_id AND le.kind = 'food' AND le.calories_per_serving IS NULL;
@@ -0,0 +1,5 @@
+-- Archived food items are hidden from lists, search and parsing but keep
+-- their history. merged_into records the canonical item a duplicate was
+-- folded into by POST /food-items/{id}/merge.
+ALTER TABLE food_items ADD COLUMN IF NOT EXISTS archived_at TIMESTAMPTZ;
+ALTER TABLE food_items ADD COLUMN IF NOT EXISTS merged_into UUID REFERENCES food_items(id) ON DELETE SET NULL;
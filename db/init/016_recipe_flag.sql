@@ -0,0 +1,26 @@
+-- Recipes used to be mirrored onto every food item (same ID), so plain
+-- ingredients showed up as recipes. is_recipe marks the food items that
+-- really are recipes; only those keep a row in recipes.
+ALTER TABLE food_items ADD COLUMN IF NOT EXISTS is_recipe BOOLEAN NOT NULL DEFAULT false;
+
+-- A recipe page that carries any user data is a real recipe.
+UPDATE food_items fi
+SET is_recipe = true
+FROM recipes r
+WHERE r.id = fi.id
+  AND NOT fi.is_recipe
+  AND (
+    COALESCE(btrim(r.instructions), '') <> ''
+    OR r.yield_count <> 1
+    OR EXISTS (SELECT 1 FROM recipe_ingredients ri WHERE ri.recipe_id = r.id)
+    OR EXISTS (SELECT 1 FROM recipe_portions rp WHERE rp.recipe_id = r.id)
+    OR EXISTS (SELECT 1 FROM recipe_shopping_items rsi WHERE rsi.recipe_id = r.id)
+    OR EXISTS (SELECT 1 FROM recipe_photos ph WHERE ph.recipe_id = r.id)
+  );
+
+-- Everything left is an auto-created empty page; nothing references it.
+DELETE FROM recipes r
+USING food_items fi
+WHERE fi.id = r.id AND NOT fi.is_recipe;
+
+CREATE INDEX IF NOT EXISTS food_items_is_recipe_idx ON food_items (user_id) WHERE is_recipe;
@@ -0,0 +1,19 @@
+-- Recipe photos live in the photo store (PHOTO_DIR) as an original plus
+-- resized JPEG variants; this table holds their metadata. A recipe can have
+-- several photos; the lowest sort_order is the cover.
+CREATE TABLE IF NOT EXISTS recipe_images (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  recipe_id UUID NOT NULL REFERENCES recipes(id) ON DELETE CASCADE,
+  content_type TEXT NOT NULL,       -- of the original upload
+  width INT NOT NULL,
+  height INT NOT NULL,
+  size_bytes INT NOT NULL,
+  sha256 TEXT NOT NULL,             -- of the original; basis of the ETag
+  sort_order INT NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS recipe_images_recipe_idx ON recipe_images (recipe_id, sort_order, created_at);
+
+-- recipe_photos (base64 data URLs) is read once at API startup, moved into
+-- the photo store, and emptied. The table stays for older bundles/tools.
@@ -0,0 +1,35 @@
+-- Free-form recipe tags ("high-protein", "freezer-friendly"), stored
+-- normalised: lower-case with words joined by hyphens.
+CREATE TABLE IF NOT EXISTS recipe_tags (
+  recipe_id UUID NOT NULL REFERENCES recipes(id) ON DELETE CASCADE,
+  tag TEXT NOT NULL,
+  PRIMARY KEY (recipe_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS recipe_tags_tag_idx ON recipe_tags (tag);
+
+-- User-curated recipe collections ("Meal prep", "Date night"). A recipe can
+-- be in any number of them.
+CREATE TABLE IF NOT EXISTS recipe_collections (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS recipe_collections_user_name_idx ON recipe_collections (user_id, lower(name));
+
+CREATE TABLE IF NOT EXISTS recipe_collection_items (
+  collection_id UUID NOT NULL REFERENCES recipe_collections(id) ON DELETE CASCADE,
+  recipe_id UUID NOT NULL REFERENCES recipes(id) ON DELETE CASCADE,
+  added_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (collection_id, recipe_id)
+);
+
+CREATE INDEX IF NOT EXISTS recipe_collection_items_recipe_idx ON recipe_collection_items (recipe_id);
+
+-- Text search over recipe instructions; names are covered by
+-- food_items_search_trgm_idx.
+CREATE INDEX IF NOT EXISTS recipes_instructions_trgm_idx
+  ON recipes USING gin ((lower(COALESCE(instructions, ''))) gin_trgm_ops);
@@ -0,0 +1,29 @@
+-- Body composition and tape measurements, alongside body_weights. Every
+-- metric is optional; a row holds whatever was measured at that moment.
+-- sex and height_cm are kept per row because the navy body fat estimate
+-- needs them and there is no user profile to hold them.
+CREATE TABLE IF NOT EXISTS body_measurements (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  measured_at TIMESTAMPTZ NOT NULL,
+  sex TEXT CHECK (sex IN ('male', 'female')),
+  height_cm NUMERIC,
+  body_fat_pct NUMERIC,
+  -- 'measured' when body_fat_pct was supplied (scale, DEXA, calipers),
+  -- 'navy' when it was estimated from neck/waist/hips and height.
+  body_fat_method TEXT CHECK (body_fat_method IN ('measured', 'navy')),
+  lean_mass_kg NUMERIC,
+  waist_cm NUMERIC,
+  hips_cm NUMERIC,
+  chest_cm NUMERIC,
+  arm_cm NUMERIC,
+  thigh_cm NUMERIC,
+  neck_cm NUMERIC,
+  source TEXT NOT NULL DEFAULT 'manual',
+  note TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS body_measurements_user_measured_idx ON body_measurements (user_id, measured_at);
+-- /body/trend reads both tables by user and time range.
+CREATE INDEX IF NOT EXISTS body_weights_user_measured_idx ON body_weights (user_id, measured_at);
@@ -0,0 +1,17 @@
+-- Progress photos, one row per upload. Like recipe_images, the files live
+-- in the photo store (PHOTO_DIR) under progress/<user_id>/<id>/.
+CREATE TABLE IF NOT EXISTS progress_photos (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  taken_on DATE NOT NULL,
+  pose TEXT NOT NULL CHECK (pose IN ('front', 'side', 'back')),
+  content_type TEXT NOT NULL,
+  width INT NOT NULL,
+  height INT NOT NULL,
+  size_bytes INT NOT NULL,
+  sha256 TEXT NOT NULL,
+  note TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS progress_photos_user_taken_idx ON progress_photos (user_id, taken_on, pose);
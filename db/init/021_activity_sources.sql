@@ -0,0 +1,19 @@
+-- Steps and active calories per reporting source (manual, watch, phone, ...).
+-- daily_activity keeps the resolved figures for the day: per field, the
+-- highest-priority source that reported it (manual, then watch, then phone,
+-- then anything else). Water stays on daily_activity; it is manual only.
+CREATE TABLE IF NOT EXISTS daily_activity_sources (
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  date DATE NOT NULL,
+  source TEXT NOT NULL,
+  steps INT,
+  active_calories_kcal_est NUMERIC,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (user_id, date, source)
+);
+
+INSERT INTO daily_activity_sources (user_id, date, source, steps, active_calories_kcal_est, updated_at)
+SELECT user_id, date, source, steps, active_calories_kcal_est, created_at
+FROM daily_activity
+WHERE steps <> 0 OR active_calories_kcal_est <> 0
+ON CONFLICT DO NOTHING;
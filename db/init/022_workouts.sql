@@ -0,0 +1,24 @@
+-- Exercise log. calories_kcal is either typed in (calories_source 'manual')
+-- or estimated as MET x weight_kg x hours ('met'); weight_kg records the
+-- weigh-in the estimate used. Each day's total is rolled up into
+-- daily_activity_sources under the 'workouts' source, which is added to a
+-- manual active-calorie figure but not to a device's, which already has it.
+CREATE TABLE IF NOT EXISTS workouts (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  started_at TIMESTAMPTZ NOT NULL,
+  activity TEXT NOT NULL,
+  duration_min NUMERIC NOT NULL CHECK (duration_min > 0),
+  distance_km NUMERIC,
+  intensity TEXT NOT NULL DEFAULT 'moderate' CHECK (intensity IN ('light', 'moderate', 'vigorous')),
+  avg_heart_rate INT,
+  max_heart_rate INT,
+  met NUMERIC,
+  weight_kg NUMERIC,
+  calories_kcal NUMERIC NOT NULL,
+  calories_source TEXT NOT NULL DEFAULT 'met' CHECK (calories_source IN ('met', 'manual')),
+  note TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS workouts_user_started_idx ON workouts (user_id, started_at);
@@ -7,7 +7,24 @@ import { todayISOInAppTZ } from "../lib/date";
 const USER_ID = "00000000-0000-0000-0000-000000000001";
 const API = "/api";
 
-type DayTotal = { date: string; calories: number };
+type DayStatus = {
+  date: string;
+  entry_count: number;
+  calories: number;
+  logged: boolean;
+  protein_met: boolean;
+  under_calories: boolean;
+  water_met: boolean;
+};
+type Streak = { current: number; longest: number };
+type Streaks = { logging: Streak; protein_goal: Streak; under_calories: Streak; water_goal: Streak };
+
+// Goal flags shown as dots under each day, in display order.
+const STATUS_DOTS: { key: "protein_met" | "under_calories" | "water_met"; label: string; color: string }[] = [
+  { key: "protein_met", label: "Protein goal", color: "var(--accent)" },
+  { key: "under_calories", label: "Under calories", color: "var(--accent2)" },
+  { key: "water_met", label: "Water goal", color: "var(--accent3)" },
+];
 
 function daysInMonth(year: number, month: number) {
   return new Date(year, month + 1, 0).getDate();
@@ -27,17 +44,25 @@ export default function CalendarPage() {
   const now = new Date();
   const [year, setYear] = useState(now.getFullYear());
   const [month, setMonth] = useState(now.getMonth());
-  const [totals, setTotals] = useState<Record<string, number>>({});
+  const [days, setDays] = useState<Record<string, DayStatus>>({});
+  const [streaks, setStreaks] = useState<Streaks | null>(null);
+
+  useEffect(() => {
+    fetch(`${API}/streaks?user_id=${USER_ID}`)
+      .then(r => r.ok ? r.json() : null)
+      .then(setStreaks)
+      .catch(() => {});
+  }, []);
 
   useEffect(() => {
     const from = toDateStr(year, month, 1);
     const to = toDateStr(year, month, daysInMonth(year, month));
     fetch(`${API}/log/range?user_id=${USER_ID}&from=${from}&to=${to}`)
       .then(r => r.ok ? r.json() : [])
-      .then((data: DayTotal[]) => {
-        const map: Record<string, number> = {};
-        data.forEach(d => { map[d.date] = d.calories; });
-        setTotals(map);
+      .then((data: DayStatus[]) => {
+        const map: Record<string, DayStatus> = {};
+        data.forEach(d => { map[d.date] = d; });
+        setDays(map);
       })
       .catch(() => {});
   }, [year, month]);
@@ -66,6 +91,23 @@ export default function CalendarPage() {
         <button className="btn btn-ghost" onClick={nextMonth} style={{ padding: "6px 14px" }}>›</button>
       </div>
 
+      {streaks && (
+        <div style={{ display: "grid", gridTemplateColumns: "repeat(4, 1fr)", gap: 12, marginBottom: 16 }}>
+          {([
+            ["Logging", streaks.logging],
+            ["Protein goal", streaks.protein_goal],
+            ["Under calories", streaks.under_calories],
+            ["Water goal", streaks.water_goal],
+          ] as [string, Streak][]).map(([label, s]) => (
+            <div key={label} className="card" style={{ padding: "12px 16px" }}>
+              <div style={{ fontSize: 12, color: "var(--muted)", fontWeight: 600 }}>{label}</div>
+              <div style={{ fontSize: 22, fontWeight: 800 }}>{s.current} <span style={{ fontSize: 12, fontWeight: 500, color: "var(--muted)" }}>days</span></div>
+              <div style={{ fontSize: 11, color: "var(--muted)" }}>Best: {s.longest}</div>
+            </div>
+          ))}
+        </div>
+      )}
+
       <div className="card" style={{ padding: 0, overflow: "hidden" }}>
         {/* Day headers */}
         <div style={{
@@ -90,7 +132,7 @@ export default function CalendarPage() {
           {Array.from({ length: totalDays }).map((_, i) => {
             const day = i + 1;
             const dateStr = toDateStr(year, month, day);
-            const kcal = totals[dateStr];
+            const status = days[dateStr];
             const isToday = dateStr === todayStr;
             const col = (startPad + i) % 7;
 
@@ -120,16 +162,32 @@ export default function CalendarPage() {
                   borderRadius: "50%",
                   background: isToday ? "rgba(108,99,255,0.15)" : undefined,
                 }}>{day}</span>
-                {kcal !== undefined && (
+                {status?.logged && (
                   <span style={{ fontSize: 11, color: "var(--muted)", fontWeight: 600 }}>
-                    {Math.round(kcal)} kcal
+                    {Math.round(status.calories)} kcal
                   </span>
                 )}
+                {status && (
+                  <div style={{ display: "flex", gap: 4 }}>
+                    {STATUS_DOTS.filter(d => status[d.key]).map(d => (
+                      <span key={d.key} title={d.label} style={{ width: 7, height: 7, borderRadius: "50%", background: d.color }} />
+                    ))}
+                  </div>
+                )}
               </div>
             );
           })}
         </div>
       </div>
+
+      <div style={{ display: "flex", gap: 16, marginTop: 12, fontSize: 12, color: "var(--muted)" }}>
+        {STATUS_DOTS.map(d => (
+          <span key={d.key} style={{ display: "flex", alignItems: "center", gap: 6 }}>
+            <span style={{ width: 7, height: 7, borderRadius: "50%", background: d.color }} />
+            {d.label}
+          </span>
+        ))}
+      </div>
     </div>
   );
 }
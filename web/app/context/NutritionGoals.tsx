@@ -3,6 +3,9 @@
 import { createContext, useContext, useEffect, useState } from "react";
 import { DEFAULT_NUTRITION_GOALS, NUTRITION_GOALS_KEY } from "../lib/settings";
 
+const USER_ID = "00000000-0000-0000-0000-000000000001";
+const API = "/api";
+
 export type NutritionGoals = {
   calories: number;
   protein: number;
@@ -34,11 +37,38 @@ export function NutritionGoalsProvider({ children }: { children: React.ReactNode
     } catch {
       // ignore malformed stored data
     }
+    // Server copy wins so scheduled digests and the UI agree on goals
+    fetch(`${API}/goals?user_id=${USER_ID}`)
+      .then(r => r.ok ? r.json() : null)
+      .then(data => {
+        if (!data) return;
+        const next = {
+          calories: Number(data.calories) || DEFAULT_NUTRITION_GOALS.calories,
+          protein: Number(data.protein_g) || DEFAULT_NUTRITION_GOALS.protein,
+          carbs: Number(data.carbs_g) || DEFAULT_NUTRITION_GOALS.carbs,
+          fat: Number(data.fat_g) || DEFAULT_NUTRITION_GOALS.fat,
+          fiber: Number(data.fiber_g) || DEFAULT_NUTRITION_GOALS.fiber,
+        };
+        setGoalsState(next);
+        localStorage.setItem(NUTRITION_GOALS_KEY, JSON.stringify(next));
+      })
+      .catch(() => {});
   }, []);
 
   function setGoals(next: NutritionGoals) {
     setGoalsState(next);
     localStorage.setItem(NUTRITION_GOALS_KEY, JSON.stringify(next));
+    fetch(`${API}/goals?user_id=${USER_ID}`, {
+      method: "PUT",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({
+        calories: next.calories,
+        protein_g: next.protein,
+        carbs_g: next.carbs,
+        fat_g: next.fat,
+        fiber_g: next.fiber,
+      }),
+    }).catch(() => {});
   }
 
   return (
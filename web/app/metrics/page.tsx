@@ -7,6 +7,8 @@ import { todayISOInAppTZ } from "../lib/date";
 const USER_ID = "00000000-0000-0000-0000-000000000001";
 const API = "/api";
 
+const ACTIVITIES = ["walking", "running", "cycling", "swimming", "rowing", "hiking", "elliptical", "strength", "hiit", "yoga", "dancing", "sports", "other"];
+
 export default function MetricsPage() {
   const { unit } = useWeightUnit();
   const [weight, setWeight] = useState("");
@@ -14,6 +16,37 @@ export default function MetricsPage() {
   const [kcal, setKcal] = useState("");
   const [saving, setSaving] = useState(false);
   const [status, setStatus] = useState<{ msg: string; ok: boolean } | null>(null);
+  const [activity, setActivity] = useState("walking");
+  const [duration, setDuration] = useState("");
+  const [distance, setDistance] = useState("");
+  const [intensity, setIntensity] = useState("moderate");
+  const [heartRate, setHeartRate] = useState("");
+  const [workoutStatus, setWorkoutStatus] = useState<{ msg: string; ok: boolean } | null>(null);
+
+  async function logWorkout() {
+    setWorkoutStatus(null);
+    const res = await fetch(`${API}/workouts`, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({
+        user_id: USER_ID,
+        activity,
+        intensity,
+        duration_min: Number(duration),
+        ...(distance ? { distance_km: Number(distance) } : {}),
+        ...(heartRate ? { avg_heart_rate: Number(heartRate) } : {}),
+      }),
+    });
+    const body = await res.json().catch(() => null);
+    if (!res.ok) {
+      setWorkoutStatus({ msg: body?.error || "Failed to log workout.", ok: false });
+      return;
+    }
+    setWorkoutStatus({ msg: `Logged: about ${Math.round(body.calories_kcal)} kcal.`, ok: true });
+    setDuration("");
+    setDistance("");
+    setHeartRate("");
+  }
 
   async function save() {
     setSaving(true);
@@ -36,11 +69,14 @@ export default function MetricsPage() {
       const res = await fetch(`${API}/activity/daily`, {
         method: "POST",
         headers: { "Content-Type": "application/json" },
+        // Only the fields filled in are sent, so saving steps keeps the
+        // day's active calories and vice versa.
         body: JSON.stringify({
           user_id: USER_ID,
           date: today,
-          steps: Number(steps) || 0,
-          active_calories_est: Number(kcal) || 0,
+          source: "manual",
+          ...(steps ? { steps: Number(steps) } : {}),
+          ...(kcal ? { active_calories_est: Number(kcal) } : {}),
         }),
       });
       if (!res.ok) errors.push("activity");
@@ -117,6 +153,31 @@ export default function MetricsPage() {
           )}
         </div>
       </div>
+
+      <div className="card" style={{ maxWidth: 480, marginTop: 16 }}>
+        <div style={{ display: "grid", gap: 16 }}>
+          <div style={{ fontWeight: 700 }}>Log a workout</div>
+          <div style={{ display: "flex", gap: 8 }}>
+            <select value={activity} onChange={e => setActivity(e.target.value)} style={{ flex: 1 }}>
+              {ACTIVITIES.map(a => <option key={a} value={a}>{a}</option>)}
+            </select>
+            <select value={intensity} onChange={e => setIntensity(e.target.value)} style={{ flex: 1 }}>
+              <option value="light">light</option>
+              <option value="moderate">moderate</option>
+              <option value="vigorous">vigorous</option>
+            </select>
+          </div>
+          <Field label="Duration (min)" value={duration} setValue={setDuration} placeholder="e.g. 45" />
+          <Field label="Distance (km)" hint="Optional; refines walking and running estimates" value={distance} setValue={setDistance} placeholder="e.g. 5" />
+          <Field label="Average heart rate" hint="Optional" value={heartRate} setValue={setHeartRate} placeholder="e.g. 135" integer />
+          <button className="btn btn-primary" onClick={logWorkout} disabled={!duration}>
+            Log workout
+          </button>
+          {workoutStatus && (
+            <div className={`pill ${workoutStatus.ok ? "pill-ok" : "pill-err"}`}>{workoutStatus.msg}</div>
+          )}
+        </div>
+      </div>
     </div>
   );
 }
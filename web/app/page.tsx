@@ -21,6 +21,10 @@ type DashboardData = {
   fiber_g: number;
   steps: number;
   active_calories_est: number;
+  active_source: string;
+  workouts: number;
+  workout_calories: number;
+  net_calories: number;
 };
 
 type LogEntry = {
@@ -205,10 +209,10 @@ function LedgerInner() {
     setNewItemError(null);
     try {
       const base = API.replace(/\/+$/, "");
-      const res = await fetch(`${base}/recipes`, {
+      const res = await fetch(`${base}/food-items`, {
         method: "POST",
         headers: { "Content-Type": "application/json" },
-        body: JSON.stringify({ user_id: USER_ID, name, instructions: "", yield_count: 1 }),
+        body: JSON.stringify({ user_id: USER_ID, name }),
       });
       const body = await res.json().catch(() => ({}));
       if (res.ok && body.id) {
@@ -222,7 +226,7 @@ function LedgerInner() {
     setCreatingItem(false);
   }
 
-  const net = data ? data.calories_in - data.active_calories_est : 0;
+  const net = data ? data.net_calories : 0;
   const remaining = data ? goals.calories - data.calories_in : 0;
 
   return (
@@ -271,7 +275,11 @@ function LedgerInner() {
               value={Math.round(data.active_calories_est)}
               unit="kcal"
               accent="var(--accent3)"
-              sub="Estimated"
+              sub={data.workouts === 0
+                ? "Estimated"
+                : data.active_source && data.active_source !== "manual"
+                  ? `${data.workouts} workout${data.workouts === 1 ? "" : "s"} · counted by ${data.active_source}`
+                  : `Incl. ${data.workouts} workout${data.workouts === 1 ? "" : "s"} · ${Math.round(data.workout_calories)} kcal`}
             />
             <StatCard
               label="Net Calories"
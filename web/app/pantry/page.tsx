@@ -135,8 +135,8 @@ export default function PantryPage() {
     const t = setTimeout(async () => {
       setSearching(true);
       try {
-        const res = await fetch(`${API}/food-items?user_id=${USER_ID}&q=${encodeURIComponent(search.trim())}`);
-        if (res.ok) setSearchResults(await res.json());
+        const res = await fetch(`${API}/food-items/search?user_id=${USER_ID}&limit=20&q=${encodeURIComponent(search.trim())}`);
+        if (res.ok) setSearchResults((await res.json()).items ?? []);
       } finally {
         setSearching(false);
       }
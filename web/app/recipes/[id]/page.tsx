@@ -61,6 +61,7 @@ type RecipeDetail = {
   instructions: string;
   yield_count: number;
   ingredients: null;
+  tags?: string[];
 };
 
 type FoodItemDetail = {
@@ -85,6 +86,14 @@ function makeRowID() {
 // DraftItem carries a client-only `category` slug that is NOT sent to the API
 type DraftItem = ShoppingItem & { row_id: string; category: string };
 
+// URLs are relative to the API root; size variants are resized JPEGs.
+type RecipePhotoFile = {
+  id: string;
+  url: string;
+  medium_url: string;
+  thumb_url: string;
+};
+
 // ---------------------------------------------------------------------------
 // Component
 // ---------------------------------------------------------------------------
@@ -94,11 +103,18 @@ export default function RecipeDetailPage() {
   const router = useRouter();
   const [recipe, setRecipe] = useState<RecipeDetail | null>(null);
   const [food, setFood] = useState<FoodItemDetail | null>(null);
+  // Plain food items have no recipe page until something recipe-like is saved.
+  const [hasRecipe, setHasRecipe] = useState(false);
   const [shoppingDraft, setShoppingDraft] = useState<DraftItem[]>([]);
   const [status, setStatus] = useState<string>("");
   const [isSaving, setIsSaving] = useState(false);
-  const [photo, setPhoto] = useState<string>("");
+  const [recalcHistory, setRecalcHistory] = useState(false);
+  const [photos, setPhotos] = useState<RecipePhotoFile[]>([]);
+  const [photoIndex, setPhotoIndex] = useState(0);
   const [previewMd, setPreviewMd] = useState(false);
+  const [pasteOpen, setPasteOpen] = useState(false);
+  const [pasteText, setPasteText] = useState("");
+  const [tagsText, setTagsText] = useState("");
   const catsRef = useRef<Record<string, string>>({});
 
   async function loadAll() {
@@ -110,7 +126,16 @@ export default function RecipeDetailPage() {
       fetchCategories(),
     ]);
     catsRef.current = cats;
-    if (recipeRes.ok) setRecipe(await recipeRes.json());
+    if (recipeRes.ok) {
+      const data: RecipeDetail = await recipeRes.json();
+      setRecipe(data);
+      setTagsText((data.tags ?? []).join(", "));
+      setHasRecipe(true);
+    } else {
+      setRecipe({ id: recipeID, name: "", instructions: "", yield_count: 1, ingredients: null });
+      setTagsText("");
+      setHasRecipe(false);
+    }
     if (linkedFoodRes.ok) setFood(await linkedFoodRes.json());
     if (shoppingRes.ok) {
       const items: ShoppingItem[] = await shoppingRes.json();
@@ -126,12 +151,13 @@ export default function RecipeDetailPage() {
 
   useEffect(() => { loadAll(); }, [recipeID]);
 
-  useEffect(() => {
+  async function loadPhotos() {
     if (!recipeID) return;
-    fetch(`${API}/recipes/${recipeID}/photo`)
-      .then(r => r.ok ? r.json() : null)
-      .then(data => { if (data?.photo) setPhoto(data.photo); });
-  }, [recipeID]);
+    const res = await fetch(`${API}/recipes/${recipeID}/photos`, { cache: "no-store" });
+    if (res.ok) setPhotos(await res.json());
+  }
+
+  useEffect(() => { loadPhotos(); }, [recipeID]);
 
   useEffect(() => {
     function onKey(e: KeyboardEvent) {
@@ -162,22 +188,30 @@ export default function RecipeDetailPage() {
         sort_order: i,
       }));
 
-    const [foodRes, recipeRes, shoppingRes] = await Promise.all([
-      fetch(`${API}/food-items/${recipeID}`, {
-        method: "PUT",
-        headers: { "Content-Type": "application/json" },
-        body: JSON.stringify({
-          name: food.name,
-          brand: food.brand,
-          serving_label: food.serving_label,
-          calories_per_serving: food.calories_per_serving,
-          protein_g_per_serving: food.protein_g_per_serving,
-          carbs_g_per_serving: food.carbs_g_per_serving,
-          fat_g_per_serving: food.fat_g_per_serving,
-          fiber_g_per_serving: food.fiber_g_per_serving,
-        }),
+    const foodRes = await fetch(`${API}/food-items/${recipeID}`, {
+      method: "PUT",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({
+        name: food.name,
+        brand: food.brand,
+        serving_label: food.serving_label,
+        calories_per_serving: food.calories_per_serving,
+        protein_g_per_serving: food.protein_g_per_serving,
+        carbs_g_per_serving: food.carbs_g_per_serving,
+        fat_g_per_serving: food.fat_g_per_serving,
+        fiber_g_per_serving: food.fiber_g_per_serving,
+        recalculate_history: recalcHistory,
       }),
-      fetch(`${API}/recipes/${recipeID}`, {
+    });
+    // Only write a recipe page when there is something to put on it; saving
+    // one turns a plain food item into a recipe.
+    const tags = tagsText.split(",").map(t => t.trim()).filter(Boolean);
+    const wantsRecipe = hasRecipe || recipe.instructions.trim() !== "" || recipe.yield_count !== 1 || shoppingPayload.length > 0 || tags.length > 0;
+    let recipeRes: Response | null = null;
+    let shoppingRes: Response | null = null;
+    let tagsRes: Response | null = null;
+    if (wantsRecipe) {
+      recipeRes = await fetch(`${API}/recipes/${recipeID}`, {
         method: "PUT",
         headers: { "Content-Type": "application/json" },
         body: JSON.stringify({
@@ -186,40 +220,70 @@ export default function RecipeDetailPage() {
           instructions: recipe.instructions,
           yield_count: recipe.yield_count,
         }),
-      }),
-      fetch(`${API}/recipes/${recipeID}/shopping-items`, {
+      });
+      shoppingRes = await fetch(`${API}/recipes/${recipeID}/shopping-items`, {
         method: "PUT",
         headers: { "Content-Type": "application/json" },
         body: JSON.stringify({ items: shoppingPayload }),
-      }),
-    ]);
+      });
+      tagsRes = await fetch(`${API}/recipes/${recipeID}/tags`, {
+        method: "PUT",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ user_id: USER_ID, tags }),
+      });
+    }
 
-    if (foodRes.ok && recipeRes.ok && shoppingRes.ok) {
+    const recipeOK = !recipeRes || recipeRes.ok;
+    const shoppingOK = !shoppingRes || shoppingRes.ok;
+    const tagsOK = !tagsRes || tagsRes.ok;
+    if (foodRes.ok && recipeOK && shoppingOK && tagsOK) {
       setStatus("Saved.");
+      setRecalcHistory(false);
       setIsSaving(false);
       await loadAll();
       return;
     }
     const errors = [];
     if (!foodRes.ok) errors.push("Food save failed");
-    if (!recipeRes.ok) errors.push("Recipe save failed");
-    if (!shoppingRes.ok) errors.push("Ingredients save failed");
+    if (!recipeOK) errors.push("Recipe save failed");
+    if (!shoppingOK) errors.push("Ingredients save failed");
+    if (!tagsOK) errors.push("Tags save failed");
     setStatus(errors.join(" | "));
     setIsSaving(false);
   }
 
-  function onPhotoFile(file: File) {
-    const reader = new FileReader();
-    reader.onload = () => {
-      const result = typeof reader.result === "string" ? reader.result : "";
-      setPhoto(result);
-      fetch(`${API}/recipes/${recipeID}/photo`, {
-        method: "PUT",
-        headers: { "Content-Type": "application/json" },
-        body: JSON.stringify({ photo: result }),
-      });
-    };
-    reader.readAsDataURL(file);
+  async function onPhotoFiles(files: FileList) {
+    const form = new FormData();
+    Array.from(files).forEach(f => form.append("photos", f));
+    setStatus("Uploading photo...");
+    const res = await fetch(`${API}/recipes/${recipeID}/photos`, { method: "POST", body: form });
+    if (!res.ok) {
+      const data = await res.json().catch(() => null);
+      setStatus(data?.error ? `Photo upload failed: ${data.error}` : "Photo upload failed");
+    } else {
+      setStatus("");
+      setHasRecipe(true);
+    }
+    await loadPhotos();
+  }
+
+  async function deletePhoto(id: string) {
+    await fetch(`${API}/recipes/${recipeID}/photos/${id}`, { method: "DELETE" });
+    setPhotoIndex(0);
+    await loadPhotos();
+  }
+
+  async function makeCover(id: string) {
+    const ids = [id, ...photos.map(p => p.id).filter(p => p !== id)];
+    const res = await fetch(`${API}/recipes/${recipeID}/photos/order`, {
+      method: "PUT",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ ids }),
+    });
+    if (res.ok) {
+      setPhotos(await res.json());
+      setPhotoIndex(0);
+    }
   }
 
   function addRow() {
@@ -229,6 +293,38 @@ export default function RecipeDetailPage() {
     ]);
   }
 
+  // Split pasted ingredient lines into name / amount / unit rows server-side.
+  async function addPastedRows() {
+    if (!pasteText.trim()) return;
+    const res = await fetch(`${API}/recipes/parse-ingredients`, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ text: pasteText }),
+    });
+    if (!res.ok) {
+      setStatus("Could not parse ingredients");
+      return;
+    }
+    const body: { items: { line: string; name: string; amount: number; unit: string; warning?: string }[] } = await res.json();
+    // Lines the server could not read a name from stay out of the list.
+    const items = body.items.filter(it => !it.warning);
+    const skipped = body.items.filter(it => it.warning).map(it => it.line);
+    setShoppingDraft(prev => [
+      ...prev,
+      ...items.map((it, i) => ({
+        row_id: makeRowID(),
+        name: it.name,
+        amount: it.amount || 1,
+        unit: it.unit,
+        sort_order: prev.length + i,
+        category: catsRef.current[normName(it.name)] ?? "",
+      })),
+    ]);
+    setPasteText("");
+    setPasteOpen(false);
+    if (skipped.length > 0) setStatus(`Skipped lines with no ingredient name: ${skipped.join("; ")}`);
+  }
+
   function removeRow(rowID: string) {
     setShoppingDraft(prev => prev.filter(it => it.row_id !== rowID));
   }
@@ -246,6 +342,8 @@ export default function RecipeDetailPage() {
     }));
   }
 
+  const shownPhoto = photos[photoIndex] ?? photos[0];
+
   // Display rows sorted by category order, then by original sort_order within group
   const sortedDraft = useMemo(() => {
     return [...shoppingDraft].sort((a, b) => {
@@ -303,20 +401,54 @@ export default function RecipeDetailPage() {
         <div style={{ display: "grid", gridTemplateColumns: "180px 1fr", gap: 20 }}>
           {/* Photo column */}
           <div>
-            <div style={{
-              width: 180, height: 180,
-              borderRadius: "var(--radius-sm)",
-              border: "1px solid var(--border)",
-              background: photo ? `url(${photo}) center/cover no-repeat` : "var(--surface2)",
-              display: "flex", alignItems: "center", justifyContent: "center",
-              color: "var(--muted)", fontSize: 12,
-            }}>
-              {!photo && "No photo"}
-            </div>
+            <a
+              href={shownPhoto ? `${API}${shownPhoto.url}` : undefined}
+              target="_blank"
+              rel="noreferrer"
+              style={{
+                width: 180, height: 180,
+                borderRadius: "var(--radius-sm)",
+                border: "1px solid var(--border)",
+                background: shownPhoto ? `url(${API}${shownPhoto.medium_url}) center/cover no-repeat` : "var(--surface2)",
+                display: "flex", alignItems: "center", justifyContent: "center",
+                color: "var(--muted)", fontSize: 12,
+              }}
+            >
+              {!shownPhoto && "No photo"}
+            </a>
+            {photos.length > 1 && (
+              <div style={{ display: "flex", flexWrap: "wrap", gap: 4, marginTop: 6 }}>
+                {photos.map((p, i) => (
+                  <button
+                    key={p.id}
+                    onClick={() => setPhotoIndex(i)}
+                    aria-label={`Photo ${i + 1}`}
+                    style={{
+                      width: 40, height: 40, padding: 0,
+                      borderRadius: "var(--radius-sm)",
+                      border: i === photoIndex ? "2px solid var(--accent)" : "1px solid var(--border)",
+                      background: `url(${API}${p.thumb_url}) center/cover no-repeat`,
+                    }}
+                  />
+                ))}
+              </div>
+            )}
+            {shownPhoto && (
+              <div style={{ display: "flex", gap: 4, marginTop: 6 }}>
+                {photoIndex > 0 && (
+                  <button className="btn btn-ghost" style={{ flex: 1, fontSize: 11 }} onClick={() => makeCover(shownPhoto.id)}>
+                    Make Cover
+                  </button>
+                )}
+                <button className="btn btn-ghost" style={{ flex: 1, fontSize: 11 }} onClick={() => deletePhoto(shownPhoto.id)}>
+                  Remove
+                </button>
+              </div>
+            )}
             <label className="btn btn-ghost" style={{ marginTop: 8, width: "100%", fontSize: 12 }}>
-              Upload Photo
-              <input type="file" accept="image/*" style={{ display: "none" }}
-                onChange={e => { const file = e.target.files?.[0]; if (file) onPhotoFile(file); }} />
+              Add Photos
+              <input type="file" accept="image/*" multiple style={{ display: "none" }}
+                onChange={e => { if (e.target.files?.length) onPhotoFiles(e.target.files); e.target.value = ""; }} />
             </label>
           </div>
 
@@ -343,6 +475,14 @@ export default function RecipeDetailPage() {
                 style={{ maxWidth: 120 }}
               />
             </div>
+            <div>
+              <label className="field-label">Tags</label>
+              <input
+                value={tagsText}
+                onChange={e => setTagsText(e.target.value)}
+                placeholder="high-protein, freezer-friendly, breakfast"
+              />
+            </div>
             <div className="modal-grid">
               <div>
                 <label className="field-label">Calories</label>
@@ -504,8 +644,26 @@ export default function RecipeDetailPage() {
                   </div>
                 ))}
 
-                <div style={{ marginTop: 4 }}>
+                {pasteOpen && (
+                  <div style={{ display: "grid", gap: 6, marginTop: 4 }}>
+                    <textarea
+                      rows={5}
+                      placeholder={"One ingredient per line, e.g.\n1 1/2 cups diced onion\n2-3 cloves garlic, minced"}
+                      value={pasteText}
+                      onChange={e => setPasteText(e.target.value)}
+                    />
+                    <div style={{ display: "flex", gap: 6 }}>
+                      <button className="btn btn-primary" onClick={addPastedRows} disabled={!pasteText.trim()}>Add Lines</button>
+                      <button className="btn btn-ghost" onClick={() => setPasteOpen(false)}>Cancel</button>
+                    </div>
+                  </div>
+                )}
+
+                <div style={{ marginTop: 4, display: "flex", gap: 6 }}>
                   <button className="btn btn-ghost" onClick={addRow}>+ Add Ingredient</button>
+                  {!pasteOpen && (
+                    <button className="btn btn-ghost" onClick={() => setPasteOpen(true)}>Paste List</button>
+                  )}
                 </div>
               </div>
             </div>
@@ -514,6 +672,10 @@ export default function RecipeDetailPage() {
               <button className="btn btn-primary" onClick={saveRecipe} disabled={isSaving}>
                 {isSaving ? "Saving..." : "Save"}
               </button>
+              <label style={{ display: "flex", alignItems: "center", gap: 6, fontSize: 12, color: "var(--muted)" }}>
+                <input type="checkbox" checked={recalcHistory} onChange={e => setRecalcHistory(e.target.checked)} />
+                Also update past log entries
+              </label>
               {status && (
                 <span className={`pill ${status === "Saved." ? "pill-ok" : "pill-err"}`}>
                   {status}
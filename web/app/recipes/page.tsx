@@ -24,6 +24,8 @@ type Item = {
   fat_g_per_serving: number;
   fiber_g_per_serving: number;
   ingredient_count: number;
+  photo_thumb_url?: string;
+  tags: string[];
 };
 
 type ShoppingItem = {
@@ -34,13 +36,8 @@ type ShoppingItem = {
   sort_order: number;
 };
 
-function RecipePhoto({ id, size = 140 }: { id: string; size?: number }) {
-  const [photo, setPhoto] = useState("");
-  useEffect(() => {
-    fetch(`${API}/recipes/${id}/photo`)
-      .then(r => r.ok ? r.json() : null)
-      .then(data => { if (data?.photo) setPhoto(data.photo); });
-  }, [id]);
+function RecipePhoto({ url, size = 140 }: { url?: string; size?: number }) {
+  const photo = url ? `${API}${url}` : "";
   return (
     <div style={{
       width: size,
@@ -108,6 +105,8 @@ export default function RecipesPage() {
   const [creating, setCreating] = useState(false);
   const [status, setStatus] = useState<{ msg: string; ok: boolean } | null>(null);
   const [deletingId, setDeletingId] = useState<string | null>(null);
+  const [allTags, setAllTags] = useState<{ tag: string; count: number }[]>([]);
+  const [activeTags, setActiveTags] = useState<string[]>([]);
 
   // View modal state
   const [viewItem, setViewItem] = useState<Item | null>(null);
@@ -117,16 +116,26 @@ export default function RecipesPage() {
 
   async function load() {
     setLoading(true);
-    const res = await fetch(`${API}/recipes?user_id=${USER_ID}`);
+    const params = new URLSearchParams({ user_id: USER_ID });
+    activeTags.forEach(t => params.append("tag", t));
+    const res = await fetch(`${API}/recipes?${params}`);
     if (res.ok) setItems(await res.json());
     setLoading(false);
   }
 
+  useEffect(() => { load(); }, [activeTags]);
+
   useEffect(() => {
-    load();
     fetchCategories().then(cats => { catsRef.current = cats; });
+    fetch(`${API}/recipes/tags?user_id=${USER_ID}`)
+      .then(r => r.ok ? r.json() : [])
+      .then(setAllTags);
   }, []);
 
+  function toggleTag(tag: string) {
+    setActiveTags(prev => prev.includes(tag) ? prev.filter(t => t !== tag) : [...prev, tag]);
+  }
+
   async function openView(item: Item) {
     setViewItem(item);
     setViewIngredients([]);
@@ -162,9 +171,32 @@ export default function RecipesPage() {
     setCreating(false);
   }
 
+  // Pasting a recipe URL into the search box imports it via schema.org data.
+  async function importFromURL(url: string) {
+    setCreating(true);
+    setStatus(null);
+    const res = await fetch(`${API}/recipes/import`, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ user_id: USER_ID, url }),
+    });
+    const body = await res.json().catch(() => ({}));
+    if (res.ok && body.id) {
+      window.location.href = `/recipes/${body.id}`;
+      return;
+    }
+    setStatus({ msg: body?.error || "Could not import recipe", ok: false });
+    setCreating(false);
+  }
+
   async function deleteItem(id: string) {
     setDeletingId(id);
-    const res = await fetch(`${API}/food-items/${id}`, { method: "DELETE" });
+    let res = await fetch(`${API}/food-items/${id}`, { method: "DELETE" });
+    if (res.status === 409) {
+      // Still referenced by the log, a recipe or a preset: archive instead so history survives.
+      res = await fetch(`${API}/food-items/${id}/archive`, { method: "POST" });
+      if (res.ok) setStatus({ msg: "Archived — it's still used in your history.", ok: true });
+    }
     if (res.ok) {
       setItems(prev => prev.filter(i => i.id !== id));
       if (viewItem?.id === id) closeView();
@@ -176,9 +208,10 @@ export default function RecipesPage() {
   }
 
   const q = search.trim().toLowerCase();
+  const isURL = /^https?:\/\/\S+$/i.test(search.trim());
   const filtered = items
     .filter(it => it.ingredient_count > 0)
-    .filter(it => !q || it.name.toLowerCase().includes(q) || (it.brand && it.brand.toLowerCase().includes(q)));
+    .filter(it => !q || it.name.toLowerCase().includes(q) || (it.brand && it.brand.toLowerCase().includes(q)) || it.tags?.some(t => t.includes(q)));
 
   return (
     <div style={{ display: "flex", flexDirection: "column", height: "100%", gap: 0 }}>
@@ -195,11 +228,11 @@ export default function RecipesPage() {
           <button
             className="btn btn-primary"
             style={{ flexShrink: 0 }}
-            onClick={() => create(search.trim() || undefined)}
+            onClick={() => (isURL ? importFromURL(search.trim()) : create(search.trim() || undefined))}
             disabled={creating || !search.trim()}
-            title={search.trim() ? `Create "${search.trim()}"` : "Type a name to create"}
+            title={isURL ? "Import the recipe on this page" : search.trim() ? `Create "${search.trim()}"` : "Type a name to create"}
           >
-            {creating ? "Creating…" : `+ New${search.trim() ? ` "${search.trim()}"` : " Item"}`}
+            {creating ? (isURL ? "Importing…" : "Creating…") : isURL ? "Import Recipe" : `+ New${search.trim() ? ` "${search.trim()}"` : " Item"}`}
           </button>
         </div>
 
@@ -213,15 +246,32 @@ export default function RecipesPage() {
             value={search}
             onChange={e => setSearch(e.target.value)}
             onKeyDown={e => {
-              if (e.key === "Enter" && filtered.length === 0 && search.trim()) {
+              if (e.key === "Enter" && isURL) {
+                importFromURL(search.trim());
+              } else if (e.key === "Enter" && filtered.length === 0 && search.trim()) {
                 create(search.trim());
               }
             }}
-            placeholder="Search items… or press Enter to create"
+            placeholder="Search items… press Enter to create, or paste a recipe URL"
             style={{ paddingLeft: 36 }}
           />
         </div>
 
+        {allTags.length > 0 && (
+          <div style={{ display: "flex", flexWrap: "wrap", gap: 6, marginTop: 10 }}>
+            {allTags.map(({ tag, count }) => (
+              <button
+                key={tag}
+                className={`pill ${activeTags.includes(tag) ? "pill-ok" : ""}`}
+                style={{ cursor: "pointer", border: "1px solid var(--border)" }}
+                onClick={() => toggleTag(tag)}
+              >
+                #{tag} <span style={{ color: "var(--muted)" }}>{count}</span>
+              </button>
+            ))}
+          </div>
+        )}
+
         {status && (
           <div className={`pill ${status.ok ? "pill-ok" : "pill-err"}`} style={{ marginTop: 10 }}>
             {status.msg}
@@ -257,7 +307,7 @@ export default function RecipesPage() {
                   }}
                   onClick={() => openView(item)}
                 >
-                  <RecipePhoto id={item.id} size={40} />
+                  <RecipePhoto url={item.photo_thumb_url} size={40} />
                   <div style={{ minWidth: 0 }}>
                     <div style={{ fontWeight: 700, fontSize: 14 }}>
                       {item.name.length > 45 ? item.name.slice(0, 45) + "…" : item.name}
@@ -278,6 +328,9 @@ export default function RecipesPage() {
                           · {item.ingredient_count} ingredient{item.ingredient_count !== 1 ? "s" : ""}
                         </span>
                       )}
+                      {item.tags?.length > 0 && (
+                        <span style={{ marginLeft: 6 }}>· {item.tags.map(t => `#${t}`).join(" ")}</span>
+                      )}
                     </div>
                   </div>
                   <a
@@ -311,7 +364,7 @@ export default function RecipesPage() {
             {/* Header: photo + name/macros */}
             <div className="recipe-modal-header">
               {/* Photo */}
-              <RecipePhoto id={viewItem.id} />
+              <RecipePhoto url={viewItem.photo_thumb_url} />
 
               {/* Name, serving info, macros, actions */}
               <div style={{ display: "flex", flexDirection: "column", gap: 12, minWidth: 0 }}>
@@ -8,7 +8,6 @@ import { todayISOInAppTZ } from "../lib/date";
 const USER_ID = "00000000-0000-0000-0000-000000000001";
 const API = "/api";
 const WATER_GOAL_KEY = "intake_water_goal";
-const WATER_INTAKE_PREFIX = "intake_water_intake_";
 const DEFAULT_WATER_GOAL = 8;
 
 function addDays(dateStr: string, n: number): string {
@@ -17,13 +16,6 @@ function addDays(dateStr: string, n: number): string {
   return d.toISOString().slice(0, 10);
 }
 
-function datesInRange(from: string, to: string): string[] {
-  const dates: string[] = [];
-  let cur = from;
-  while (cur <= to) { dates.push(cur); cur = addDays(cur, 1); }
-  return dates;
-}
-
 export default function SettingsPage() {
   const { unit, setUnit } = useWeightUnit();
   const { goals, setGoals } = useNutritionGoals();
@@ -75,6 +67,28 @@ export default function SettingsPage() {
     }
   }
 
+  // The ZIP export adds progress photo files next to the JSON bundle.
+  async function exportZip() {
+    setBusy("export");
+    setStatus(null);
+    try {
+      const res = await fetch(`${API}/data/export?user_id=${USER_ID}&format=zip`);
+      if (!res.ok) throw new Error("export failed");
+      const blob = await res.blob();
+      const downloadUrl = URL.createObjectURL(blob);
+      const a = document.createElement("a");
+      a.href = downloadUrl;
+      a.download = `intake-export-${todayISOInAppTZ()}.zip`;
+      a.click();
+      URL.revokeObjectURL(downloadUrl);
+      setStatus({ ok: true, msg: "Export downloaded." });
+    } catch {
+      setStatus({ ok: false, msg: "Export failed." });
+    } finally {
+      setBusy(null);
+    }
+  }
+
   function onWaterGoalChange(value: string) {
     const n = Number(value);
     if (!Number.isFinite(n)) return;
@@ -99,16 +113,21 @@ export default function SettingsPage() {
     setStatus(null);
     try {
       console.info("[settings] import file selected", { name: file.name, size: file.size, type: file.type });
-      const text = await file.text();
-      console.info("[settings] import file read", { chars: text.length });
-      const parsed = JSON.parse(text);
-      console.info("[settings] import payload keys", { keys: Object.keys(parsed || {}) });
       const url = `${API}/data/import?user_id=${USER_ID}`;
-      const res = await fetch(url, {
-        method: "POST",
-        headers: { "Content-Type": "application/json" },
-        body: JSON.stringify(parsed),
-      });
+      let res: Response;
+      if (file.name.toLowerCase().endsWith(".zip")) {
+        res = await fetch(url, { method: "POST", headers: { "Content-Type": "application/zip" }, body: file });
+      } else {
+        const text = await file.text();
+        console.info("[settings] import file read", { chars: text.length });
+        const parsed = JSON.parse(text);
+        console.info("[settings] import payload keys", { keys: Object.keys(parsed || {}) });
+        res = await fetch(url, {
+          method: "POST",
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify(parsed),
+        });
+      }
       const raw = await res.text();
       console.info("[settings] import response", { url, status: res.status, ok: res.ok, rawPreview: raw.slice(0, 400) });
       let body: { error?: string; imported_rows?: number } | null = null;
@@ -128,56 +147,26 @@ export default function SettingsPage() {
     }
   }
 
-  async function generateReport() {
+  async function generateReport(format: "json" | "csv") {
     setBusy("report");
     setStatus(null);
     try {
-      const dates = datesInRange(reportFrom, reportTo);
-      const waterGoalVal = Number(localStorage.getItem(WATER_GOAL_KEY)) || DEFAULT_WATER_GOAL;
-      const days = await Promise.all(dates.map(async (date) => {
-        const [dashRes, logRes] = await Promise.all([
-          fetch(`${API}/dashboard/today?user_id=${USER_ID}&date=${date}`),
-          fetch(`${API}/log/today?user_id=${USER_ID}&date=${date}`),
-        ]);
-        const dash = dashRes.ok ? await dashRes.json() : {};
-        const log = logRes.ok ? await logRes.json() : [];
-        const waterDrank = Number(localStorage.getItem(`${WATER_INTAKE_PREFIX}${date}`)) || 0;
-        return {
-          date,
-          summary: {
-            calories_in: dash.calories_in ?? 0,
-            protein_g: dash.protein_g ?? 0,
-            carbs_g: dash.carbs_g ?? 0,
-            fat_g: dash.fat_g ?? 0,
-            fiber_g: dash.fiber_g ?? 0,
-            steps: dash.steps ?? 0,
-            active_kcal_est: dash.active_kcal_est ?? 0,
-          },
-          water: { drank: waterDrank, goal: waterGoalVal },
-          food_log: (log as { meal: string; food_name: string; serving_label: string; servings: number; calories: number; protein_g: number; carbs_g: number; fat_g: number; fiber_g: number }[]).map(e => ({
-            meal: e.meal,
-            food_name: e.food_name,
-            serving_label: e.serving_label,
-            servings: e.servings,
-            calories: e.calories,
-            protein_g: e.protein_g,
-            carbs_g: e.carbs_g,
-            fat_g: e.fat_g,
-            fiber_g: e.fiber_g,
-          })),
-        };
-      }));
-      const report = { generated_at: new Date().toISOString(), from: reportFrom, to: reportTo, days };
-      const blob = new Blob([JSON.stringify(report, null, 2)], { type: "application/json" });
+      const res = await fetch(`${API}/reports/daily?user_id=${USER_ID}&from=${reportFrom}&to=${reportTo}&format=${format}`);
+      if (!res.ok) {
+        const body = await res.json().catch(() => null);
+        throw new Error(body?.error || `report failed (${res.status})`);
+      }
+      const blob = await res.blob();
       const url = URL.createObjectURL(blob);
       const a = document.createElement("a");
       a.href = url;
-      a.download = `intake-report-${reportFrom}-to-${reportTo}.json`;
+      a.download = `intake-report-${reportFrom}-to-${reportTo}.${format}`;
       a.click();
       URL.revokeObjectURL(url);
-      setStatus({ ok: true, msg: `Report generated (${dates.length} days).` });
-    } catch {
-      setStatus({ ok: false, msg: "Report generation failed." });
+      setStatus({ ok: true, msg: "Report generated." });
+    } catch (err) {
+      const msg = err instanceof Error ? err.message : "Report generation failed.";
+      setStatus({ ok: false, msg: `Report generation failed: ${msg}` });
     } finally {
       setBusy(null);
     }
@@ -250,17 +239,20 @@ export default function SettingsPage() {
               <button className="btn btn-primary" onClick={exportData} disabled={busy !== null}>
                 {busy === "export" ? "Exporting..." : "Export JSON"}
               </button>
+              <button className="btn btn-ghost" onClick={exportZip} disabled={busy !== null}>
+                Export ZIP (with photos)
+              </button>
               <button
                 className="btn btn-ghost"
                 onClick={() => fileInputRef.current?.click()}
                 disabled={busy !== null}
               >
-                {busy === "import" ? "Importing..." : "Import JSON"}
+                {busy === "import" ? "Importing..." : "Import JSON / ZIP"}
               </button>
               <input
                 ref={fileInputRef}
                 type="file"
-                accept="application/json,.json"
+                accept="application/json,.json,application/zip,.zip"
                 style={{ display: "none" }}
                 onChange={e => {
                   const file = e.target.files?.[0];
@@ -287,15 +279,24 @@ export default function SettingsPage() {
                 style={{ maxWidth: 150 }}
               />
             </div>
-            <button
-              className="btn btn-ghost"
-              onClick={generateReport}
-              disabled={busy !== null || !reportFrom || !reportTo || reportFrom > reportTo}
-            >
-              {busy === "report" ? "Generating…" : "Generate Report"}
-            </button>
+            <div style={{ display: "flex", gap: 8 }}>
+              <button
+                className="btn btn-ghost"
+                onClick={() => generateReport("json")}
+                disabled={busy !== null || !reportFrom || !reportTo || reportFrom > reportTo}
+              >
+                {busy === "report" ? "Generating…" : "Generate Report"}
+              </button>
+              <button
+                className="btn btn-ghost"
+                onClick={() => generateReport("csv")}
+                disabled={busy !== null || !reportFrom || !reportTo || reportFrom > reportTo}
+              >
+                CSV
+              </button>
+            </div>
             <p style={{ fontSize: 12, color: "var(--muted)", marginTop: 6 }}>
-              Exports per-day JSON with macros, steps, water, and food log entries.
+              Exports per-day macros, steps, water, and goal comparison. The JSON version also includes food log entries.
             </p>
           </section>
 